@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"mcp-bash-tools/internal/policy"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// approvalSchema 确认请求的表单：只有一个“本会话不再询问”选项
+var approvalSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"remember": map[string]any{
+			"type":        "boolean",
+			"title":       "Remember for this session",
+			"description": "Don't ask again for commands matching this rule on this connection",
+		},
+	},
+}
+
+// sessionApprovals 每个连接中用户选择不再询问的规则，连接断开时清除
+type sessionApprovals struct {
+	mu    sync.Mutex
+	rules map[string]map[string]bool // 连接 -> 规则ID
+}
+
+// remembered 判断连接是否已记住对规则的确认
+func (a *sessionApprovals) remembered(owner, rule string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rules[owner][rule]
+}
+
+// remember 记住连接对规则的确认
+func (a *sessionApprovals) remember(owner, rule string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.rules == nil {
+		a.rules = make(map[string]map[string]bool)
+	}
+	if a.rules[owner] == nil {
+		a.rules[owner] = make(map[string]bool)
+	}
+	a.rules[owner][rule] = true
+}
+
+// forget 清除连接记住的全部确认
+func (a *sessionApprovals) forget(owner string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.rules, owner)
+}
+
+// approvalKey 在Context中保存已确认的规则ID的键，审计记录据此标记用户确认
+type approvalKey struct{}
+
+// approvedRule 返回本次调用经用户确认的规则ID，未经确认时为空
+func approvedRule(ctx context.Context) string {
+	rule, _ := ctx.Value(approvalKey{}).(string)
+	return rule
+}
+
+// requestApproval 通过 MCP elicitation 请用户确认需要确认（ask）的命令
+// 返回带有确认记录的Context；客户端不支持 elicitation、用户拒绝或等待超时时返回错误
+func (s *MCPServer) requestApproval(ctx context.Context, req *mcp.CallToolRequest, decision policy.Decision) (context.Context, error) {
+	owner := ownerFrom(ctx)
+	if s.approvals.remembered(owner, decision.RuleID) {
+		return context.WithValue(ctx, approvalKey{}, decision.RuleID), nil
+	}
+	if req == nil || req.Session == nil {
+		return nil, fmt.Errorf("client does not support elicitation")
+	}
+	if params := req.Session.InitializeParams(); params == nil || params.Capabilities == nil || params.Capabilities.Elicitation == nil {
+		return nil, fmt.Errorf("client does not support elicitation")
+	}
+
+	timeout := s.cfg().Security.ApprovalTimeout
+	elicitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result, err := req.Session.Elicit(elicitCtx, &mcp.ElicitParams{
+		Message: fmt.Sprintf("Approve running this command?\n\nCommand: %s\nRule: %s\nReason: %s",
+			decision.Command, decision.RuleID, decision.Reason),
+		RequestedSchema: approvalSchema,
+	})
+	if err != nil {
+		if errors.Is(elicitCtx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("approval timed out after %s", timeout)
+		}
+		return nil, fmt.Errorf("approval request failed: %w", err)
+	}
+	if result.Action != "accept" {
+		return nil, fmt.Errorf("not approved by user (%s)", result.Action)
+	}
+	if remember, _ := result.Content["remember"].(bool); remember {
+		s.approvals.remember(owner, decision.RuleID)
+	}
+	return context.WithValue(ctx, approvalKey{}, decision.RuleID), nil
+}
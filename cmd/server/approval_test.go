@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mcp-bash-tools/internal/audit"
+	"mcp-bash-tools/internal/config"
+	"mcp-bash-tools/internal/executor"
+	"mcp-bash-tools/internal/security"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newApprovalServer 创建 echo needs-approval 需要确认的服务器
+func newApprovalServer(t *testing.T, timeout time.Duration) *MCPServer {
+	t.Cleanup(func() { security.SetDangerousPatterns(nil) })
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+rules:
+  - id: approval-test
+    verdict: ask
+    reason: test approval
+    commands: [write-output]
+    arguments: [needs-approval]
+`), 0o600))
+	cfg := config.Default()
+	cfg.Security.PolicyFile = path
+	cfg.Security.ApprovalTimeout = timeout
+	require.NoError(t, config.Validate(cfg))
+	server := NewMCPServerWithConfig(cfg)
+	if server.shellExecutor.GetShellPath(executor.Sh) == "" {
+		t.Skip("sh not available")
+	}
+	require.NoError(t, server.ApplyConfig(cfg))
+	t.Cleanup(server.Shutdown)
+	return server
+}
+
+// connectApprovalClient 通过内存传输连接客户端，handler 为nil时客户端不支持 elicitation
+func connectApprovalClient(t *testing.T, server *MCPServer, handler func(context.Context, *mcp.ElicitRequest) (*mcp.ElicitResult, error)) *mcp.ClientSession {
+	mcpServer := newServer(server, "", &authState{})
+	addBashTools(mcpServer, server, "")
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	serverSession, err := mcpServer.Connect(context.Background(), serverTransport, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { serverSession.Close() })
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.0.0"}, &mcp.ClientOptions{ElicitationHandler: handler})
+	session, err := client.Connect(context.Background(), clientTransport, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { session.Close() })
+	return session
+}
+
+// runApprovalCommand 执行需要确认的命令，返回是否出错和输出文本
+func runApprovalCommand(t *testing.T, session *mcp.ClientSession) (bool, string) {
+	result, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "bash",
+		Arguments: map[string]any{"command": "echo needs-approval", "timeout": 5000, "shell": "sh"},
+	})
+	require.NoError(t, err)
+	var text string
+	for _, content := range result.Content {
+		if tc, ok := content.(*mcp.TextContent); ok {
+			text += tc.Text
+		}
+	}
+	return result.IsError, text
+}
+
+// TestApprovalAcceptAndRemember 测试用户确认后执行命令，选择记住后本会话不再询问
+func TestApprovalAcceptAndRemember(t *testing.T) {
+	server := newApprovalServer(t, time.Minute)
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := audit.Open(auditPath, audit.Options{})
+	require.NoError(t, err)
+	defer auditLog.Close()
+	server.audit = auditLog
+	var prompts atomic.Int32
+	session := connectApprovalClient(t, server, func(ctx context.Context, req *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+		prompts.Add(1)
+		assert.Contains(t, req.Params.Message, "echo needs-approval")
+		assert.Contains(t, req.Params.Message, "approval-test")
+		assert.Contains(t, req.Params.Message, "test approval")
+		return &mcp.ElicitResult{Action: "accept", Content: map[string]any{"remember": prompts.Load() > 1}}, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		isError, text := runApprovalCommand(t, session)
+		assert.False(t, isError, text)
+		assert.Contains(t, text, "needs-approval")
+	}
+	// 第一次确认未选择记住，第二次选择记住，第三次不再询问
+	assert.Equal(t, int32(2), prompts.Load())
+
+	// 审计记录标记经用户确认的规则
+	records := readAuditRecords(t, auditPath)
+	require.NotEmpty(t, records)
+	assert.Equal(t, audit.EventStart, records[0].Event)
+	assert.Equal(t, audit.VerdictApproved, records[0].Verdict)
+	assert.Equal(t, "approval-test", records[0].Rule)
+
+	// 连接断开后清除记住的确认
+	server.ReleaseOwner("")
+	assert.False(t, server.approvals.remembered("", "approval-test"))
+}
+
+// TestApprovalRejected 测试用户拒绝、等待超时和客户端不支持 elicitation 时拒绝执行
+func TestApprovalRejected(t *testing.T) {
+	server := newApprovalServer(t, 200*time.Millisecond)
+
+	declined := connectApprovalClient(t, server, func(ctx context.Context, req *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+		return &mcp.ElicitResult{Action: "decline"}, nil
+	})
+	isError, text := runApprovalCommand(t, declined)
+	assert.True(t, isError)
+	assert.Contains(t, text, "requires approval")
+	assert.Contains(t, text, "rule approval-test")
+	assert.Contains(t, text, "not approved by user (decline)")
+
+	slow := connectApprovalClient(t, server, func(ctx context.Context, req *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	start := time.Now()
+	isError, text = runApprovalCommand(t, slow)
+	assert.True(t, isError)
+	assert.Contains(t, text, "approval timed out")
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	unsupported := connectApprovalClient(t, server, nil)
+	isError, text = runApprovalCommand(t, unsupported)
+	assert.True(t, isError)
+	assert.Contains(t, text, "does not support elicitation")
+}
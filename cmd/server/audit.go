@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"mcp-bash-tools/internal/audit"
+	"mcp-bash-tools/internal/config"
+	"mcp-bash-tools/internal/core"
+	"mcp-bash-tools/internal/executor"
+	"mcp-bash-tools/internal/policy"
+	"mcp-bash-tools/internal/redact"
+	"mcp-bash-tools/internal/security"
+)
+
+// openAuditLog 按 logging.audit_file 打开审计日志，未配置时返回nil
+// 审计文件和轮转设置只在启动时读取
+func openAuditLog(cfg core.LoggingConfig) (*audit.Logger, error) {
+	if cfg.AuditFile == "" {
+		return nil, nil
+	}
+	return audit.Open(cfg.AuditFile, audit.Options{
+		MaxSize:    int64(cfg.MaxSize) << 20,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     time.Duration(cfg.MaxAge) * 24 * time.Hour,
+	})
+}
+
+// auditRecord 屏蔽命令、描述和原因中的敏感信息后写入审计记录，写入失败只输出警告，不影响命令执行
+func (s *MCPServer) auditRecord(r audit.Record) {
+	if s.audit == nil {
+		return
+	}
+	r.Command = redact.String(r.Command)
+	r.Description = redact.String(r.Description)
+	r.Reason = redact.String(r.Reason)
+	if err := s.audit.Log(r); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to write audit record: %v\n", err)
+	}
+}
+
+// auditCommand 构造命令的审计记录，填充调用方身份和命令参数
+func auditCommand(ctx context.Context, event string, args BashArguments) audit.Record {
+	r := audit.Record{
+		Event:       event,
+		Connection:  ownerFrom(ctx),
+		SessionID:   args.SessionID,
+		Background:  args.RunInBackground,
+		Shell:       args.Shell,
+		Cwd:         args.Cwd,
+		Command:     args.Command,
+		Description: args.Description,
+	}
+	if r.Connection == "" {
+		r.Connection = "stdio"
+	}
+	if rule := approvedRule(ctx); rule != "" {
+		r.Verdict = audit.VerdictApproved
+		r.Rule = rule
+	}
+	if auth, ok := security.GetAuthContext(ctx); ok {
+		r.User = auth.UserID
+	}
+	return r
+}
+
+// auditRejected 记录被安全检查、权限、限流或参数校验拒绝的命令
+func (s *MCPServer) auditRejected(ctx context.Context, args BashArguments, reason string) {
+	r := auditCommand(ctx, audit.EventRejected, args)
+	r.Verdict = audit.VerdictRejected
+	r.Reason = reason
+	s.auditRecord(r)
+}
+
+// auditPolicyRejected 记录被命令策略拒绝的命令和触发的规则
+func (s *MCPServer) auditPolicyRejected(ctx context.Context, args BashArguments, decision policy.Decision, reason string) {
+	r := auditCommand(ctx, audit.EventRejected, args)
+	r.Verdict = audit.VerdictRejected
+	r.Reason = reason
+	r.Rule = decision.RuleID
+	s.auditRecord(r)
+}
+
+// auditStart 记录命令开始执行，返回的记录作为结束记录的模板
+func (s *MCPServer) auditStart(r audit.Record, id string, startTime time.Time) audit.Record {
+	r.Event = audit.EventStart
+	r.ID = id
+	if r.Verdict == "" {
+		r.Verdict = audit.VerdictAllowed
+	}
+	r.StartTime = &startTime
+	s.auditRecord(r)
+	return r
+}
+
+// auditEnd 根据开始记录写入命令结束记录
+func (s *MCPServer) auditEnd(start audit.Record, exitCode *int, killed bool, execErr error, outputHash string, outputBytes int64, outputTruncated bool) {
+	end := start
+	end.Event = audit.EventEnd
+	end.Time = time.Time{}
+	endTime := time.Now()
+	end.EndTime = &endTime
+	end.ExitCode = exitCode
+	end.Killed = killed
+	end.Reason = ""
+	if execErr != nil {
+		end.Reason = execErr.Error()
+	}
+	end.OutputHash, end.OutputBytes, end.OutputTruncated = outputHash, outputBytes, outputTruncated
+	s.auditRecord(end)
+}
+
+// auditResultEnd 根据前台或会话命令的执行结果写入结束记录
+// 输出溢出到文件时摘要按文件中的完整输出计算
+func (s *MCPServer) auditResultEnd(start audit.Record, taskID string, result executor.ExecResult, killed bool, execErr error) {
+	if s.audit == nil {
+		return
+	}
+	start.TaskID = taskID
+	exitCode := result.ExitCode
+	outputHash := audit.HashBytes([]byte(result.Output))
+	outputBytes, truncated := int64(len(result.Output)), result.Truncated
+	if result.TotalBytes > outputBytes {
+		outputBytes = result.TotalBytes
+	}
+	if result.OutputFile != "" {
+		if hash, n, err := audit.HashFile(result.OutputFile); err == nil {
+			outputHash, outputBytes, truncated = hash, n, false
+		}
+	}
+	s.auditEnd(start, &exitCode, killed, execErr, outputHash, outputBytes, truncated)
+}
+
+// auditTaskEnd 后台任务结束时写入结束记录，输出摘要由输出写入器在写入时计算
+func (s *MCPServer) auditTaskEnd(task *BackgroundTask, sink *outputSink) {
+	if s.audit == nil {
+		return
+	}
+	s.mutex.RLock()
+	start := task.AuditRecord
+	killed := task.Status == "killed"
+	exitCode := task.ExitCode
+	var execErr error
+	if task.Status != "completed" && task.Error != "" {
+		execErr = errors.New(task.Error)
+	}
+	s.mutex.RUnlock()
+
+	outputHash, outputBytes := audit.HashBytes(nil), int64(0)
+	if sink != nil {
+		outputHash, outputBytes = sink.Digest()
+	}
+	s.auditEnd(start, exitCode, killed, execErr, outputHash, outputBytes, false)
+}
+
+// runAuditCommand 执行 audit 子命令，返回进程退出码
+//
+//	bash-tools audit verify [-config path] [file...]
+//
+// 未指定文件时校验配置中 logging.audit_file 及其轮转文件组成的完整链。
+func runAuditCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Fprintf(stderr, "usage: bash-tools audit verify [-config path] [file...]\n")
+		return 2
+	}
+	fs := flag.NewFlagSet("audit verify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "", "config file path, env "+config.ConfigFileEnvVar)
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		var loadArgs []string
+		if *configPath != "" {
+			loadArgs = []string{"-config", *configPath}
+		}
+		cfg, _, err := config.Load(loadArgs, stderr)
+		if err != nil {
+			fmt.Fprintf(stderr, "Failed to load configuration: %v\n", err)
+			return 2
+		}
+		if cfg.Logging.AuditFile == "" {
+			fmt.Fprintf(stderr, "logging.audit_file is not configured; pass the audit log files to verify\n")
+			return 2
+		}
+		if files, err = audit.Files(cfg.Logging.AuditFile); err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			return 2
+		}
+		if len(files) == 0 {
+			fmt.Fprintf(stderr, "no audit log found at %s\n", cfg.Logging.AuditFile)
+			return 2
+		}
+	}
+
+	result, err := audit.VerifyFiles(files)
+	if err != nil {
+		fmt.Fprintf(stderr, "Audit log verification FAILED after %d valid records: %v\n", result.Records, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Audit log OK: %d records (seq %d-%d) in %d file(s), last hash %s\n",
+		result.Records, result.FirstSeq, result.LastSeq, len(files), result.LastHash)
+	if result.FirstSeq > 1 {
+		fmt.Fprintf(stdout, "Note: records before seq %d were removed by rotation\n", result.FirstSeq)
+	}
+	return 0
+}
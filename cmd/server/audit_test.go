@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mcp-bash-tools/internal/audit"
+	"mcp-bash-tools/internal/executor"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readAuditRecords 读取审计文件中的全部记录
+func readAuditRecords(t *testing.T, path string) []audit.Record {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var records []audit.Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r audit.Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		records = append(records, r)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
+
+// TestAuditHashChain 测试哈希链能发现修改、删除和重排
+func TestAuditHashChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := audit.Open(path, audit.Options{})
+	require.NoError(t, err)
+	for _, command := range []string{"echo one", "echo two", "echo three"} {
+		require.NoError(t, log.Log(audit.Record{Event: audit.EventStart, Command: command, Verdict: audit.VerdictAllowed}))
+	}
+	require.NoError(t, log.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	result, err := audit.Verify(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Records)
+	assert.Equal(t, uint64(1), result.FirstSeq)
+	assert.Equal(t, uint64(3), result.LastSeq)
+
+	lines := strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 3)
+	tampered := map[string]string{
+		"modified":  lines[0] + strings.Replace(lines[1], "echo two", "echo TWO", 1) + lines[2],
+		"removed":   lines[0] + lines[2],
+		"reordered": lines[0] + lines[2] + "\n" + lines[1],
+	}
+	for name, content := range tampered {
+		_, err := audit.Verify(strings.NewReader(content))
+		assert.Error(t, err, name)
+	}
+
+	// 开头的记录缺失时（轮转删除）从剩余最早的记录开始校验
+	result, err = audit.Verify(strings.NewReader(lines[1] + lines[2]))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), result.FirstSeq)
+
+	// 重新打开后链继续
+	log, err = audit.Open(path, audit.Options{})
+	require.NoError(t, err)
+	require.NoError(t, log.Log(audit.Record{Event: audit.EventEnd}))
+	require.NoError(t, log.Close())
+	result, err = audit.VerifyFiles([]string{path})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), result.LastSeq)
+}
+
+// TestAuditRotation 测试轮转后的文件按顺序组成完整的链，超出保留数量的文件被删除
+func TestAuditRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := audit.Open(path, audit.Options{MaxSize: 700})
+	require.NoError(t, err)
+	for i := 0; i < 12; i++ {
+		require.NoError(t, log.Log(audit.Record{Event: audit.EventStart, Command: strings.Repeat("x", 100)}))
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(t, log.Close())
+
+	files, err := audit.Files(path)
+	require.NoError(t, err)
+	require.Greater(t, len(files), 2)
+	assert.Equal(t, path, files[len(files)-1])
+	result, err := audit.VerifyFiles(files)
+	require.NoError(t, err)
+	assert.Equal(t, 12, result.Records)
+
+	// 重新打开后继续轮转，只保留两个轮转文件
+	log, err = audit.Open(path, audit.Options{MaxSize: 700, MaxBackups: 2})
+	require.NoError(t, err)
+	for i := 0; i < 8; i++ {
+		require.NoError(t, log.Log(audit.Record{Event: audit.EventStart, Command: strings.Repeat("y", 100)}))
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(t, log.Close())
+
+	files, err = audit.Files(path)
+	require.NoError(t, err)
+	assert.Len(t, files, 3)
+	result, err = audit.VerifyFiles(files)
+	require.NoError(t, err)
+	assert.Greater(t, result.FirstSeq, uint64(1))
+	assert.Equal(t, uint64(20), result.LastSeq)
+}
+
+// TestAuditCommands 测试执行、拒绝和终止命令都写入审计日志
+func TestAuditCommands(t *testing.T) {
+	server := NewMCPServer()
+	if server.shellExecutor.GetShellPath(executor.Sh) == "" {
+		t.Skip("sh not available")
+	}
+	defer server.Shutdown()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := audit.Open(path, audit.Options{})
+	require.NoError(t, err)
+	defer auditLog.Close()
+	server.audit = auditLog
+	ctx := withOwner(context.Background(), "conn_audit")
+
+	_, result, err := server.BashHandler(ctx, &mcp.CallToolRequest{}, BashArguments{Command: "echo audited", Timeout: 5000, Shell: "sh", Description: "greet"})
+	require.NoError(t, err)
+	_, _, err = server.BashHandler(ctx, &mcp.CallToolRequest{}, BashArguments{Command: "format C:", Timeout: 5000, Shell: "sh"})
+	require.Error(t, err)
+	_, started, err := server.BashHandler(ctx, &mcp.CallToolRequest{}, BashArguments{Command: "exec sleep 30", Timeout: 5000, Shell: "sh", RunInBackground: true})
+	require.NoError(t, err)
+	_, _, err = server.KillShellHandler(ctx, &mcp.CallToolRequest{}, KillShellArguments{ShellID: started.ShellID})
+	require.NoError(t, err)
+
+	// 被终止任务的结束记录在其执行协程退出时写入
+	var records []audit.Record
+	require.Eventually(t, func() bool {
+		records = readAuditRecords(t, path)
+		return len(records) == 6
+	}, 10*time.Second, 50*time.Millisecond)
+
+	start, end := records[0], records[1]
+	assert.Equal(t, audit.EventStart, start.Event)
+	assert.Equal(t, audit.VerdictAllowed, start.Verdict)
+	assert.Equal(t, "conn_audit", start.Connection)
+	assert.Equal(t, "sh", start.Shell)
+	assert.Equal(t, "echo audited", start.Command)
+	assert.Equal(t, "greet", start.Description)
+	assert.NotNil(t, start.StartTime)
+	assert.Equal(t, audit.EventEnd, end.Event)
+	assert.Equal(t, start.ID, end.ID)
+	require.NotNil(t, end.ExitCode)
+	assert.Equal(t, 0, *end.ExitCode)
+	assert.NotNil(t, end.EndTime)
+	assert.Equal(t, audit.HashBytes([]byte(result.Output)), end.OutputHash)
+
+	assert.Equal(t, audit.EventRejected, records[2].Event)
+	assert.Equal(t, audit.VerdictRejected, records[2].Verdict)
+	assert.Contains(t, records[2].Reason, "security reasons")
+
+	assert.Equal(t, audit.EventStart, records[3].Event)
+	assert.True(t, records[3].Background)
+	assert.Equal(t, started.ShellID, records[3].TaskID)
+	assert.Equal(t, audit.EventKill, records[4].Event)
+	assert.Equal(t, started.ShellID, records[4].TaskID)
+	assert.Equal(t, audit.EventEnd, records[5].Event)
+	assert.Equal(t, started.ShellID, records[5].TaskID)
+	assert.True(t, records[5].Killed)
+
+	// verify 子命令
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, runAuditCommand([]string{"verify", path}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "6 records")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, bytes.Replace(data, []byte("echo audited"), []byte("echo innocent"), 1), 0o600))
+	stdout.Reset()
+	stderr.Reset()
+	assert.Equal(t, 1, runAuditCommand([]string{"verify", path}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "FAILED")
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"mcp-bash-tools/internal/core"
+	"mcp-bash-tools/internal/security"
+	"mcp-bash-tools/pkg/logger"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// AuthMetaKey initialize 请求 _meta 中携带令牌的键，用于没有HTTP头的 stdio 传输
+const AuthMetaKey = "authorization"
+
+// errAuthRequired 连接尚未提供有效令牌
+var errAuthRequired = errors.New("authentication required: send a bearer token in the Authorization header or in _meta.authorization of the initialize request")
+
+// newSecurityManager 根据配置创建认证管理器，未开启认证时返回nil
+func newSecurityManager(cfg *core.Config) *security.SecurityManager {
+	if !cfg.Security.EnableAuth {
+		return nil
+	}
+	log := logger.NewLogger()
+	log.SetLevel(cfg.Logging.Level)
+	log.SetFormat(cfg.Logging.Format)
+	return security.NewSecurityManager(security.SecurityConfig{
+		EnableAuth:  true,
+		APIKeys:     cfg.Security.APIKeys,
+		JWTSecret:   cfg.Security.JWTSecret,
+		EnableAudit: true,
+	}, log)
+}
+
+// authState 一个MCP连接的认证状态
+// 令牌在连接建立时（HTTP头或 initialize 的 _meta）验证一次，之后的请求复用结果；
+// 请求携带了不同的令牌或认证配置被重新加载时重新验证。
+type authState struct {
+	mu      sync.Mutex
+	manager *security.SecurityManager // 验证当前令牌时使用的管理器
+	token   string
+	auth    *security.AuthContext
+}
+
+// newAuthState 使用HTTP层已验证的令牌创建连接的认证状态
+func newAuthState(r *http.Request) *authState {
+	state := &authState{}
+	if r != nil {
+		if auth, ok := security.GetAuthContext(r.Context()); ok {
+			state.auth = auth
+			state.token = security.BearerToken(r.Header.Get("Authorization"))
+		}
+	}
+	return state
+}
+
+// authMiddleware 返回MCP认证中间件，认证成功后将 AuthContext 放入处理器的Context
+func (s *MCPServer) authMiddleware(state *authState) mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			manager := s.authManager.Load()
+			if manager == nil {
+				return next(ctx, method, req)
+			}
+			auth, err := state.authenticate(ctx, manager, requestToken(method, req))
+			if err != nil {
+				return nil, err
+			}
+			return next(security.SetAuthContext(ctx, auth), method, req)
+		}
+	}
+}
+
+// authenticate 返回连接的认证信息，token 非空且与已验证的令牌不同时重新验证
+func (a *authState) authenticate(ctx context.Context, manager *security.SecurityManager, token string) (*security.AuthContext, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if token == "" && a.manager != manager {
+		// 认证配置已重新加载，已撤销的密钥不再有效
+		token = a.token
+	}
+	if token != "" && (token != a.token || a.manager != manager) {
+		auth, err := manager.Authenticate(ctx, token)
+		if err != nil {
+			a.auth = nil
+			return nil, fmt.Errorf("authentication failed: %w", err)
+		}
+		if a.auth != nil && a.auth.UserID != auth.UserID {
+			return nil, fmt.Errorf("authentication failed: token belongs to a different user than this connection")
+		}
+		a.auth, a.token = auth, token
+	}
+	a.manager = manager
+
+	if a.auth == nil {
+		return nil, errAuthRequired
+	}
+	if a.auth.Expired(time.Now()) {
+		return nil, fmt.Errorf("authentication failed: token expired")
+	}
+	return a.auth, nil
+}
+
+// requestToken 从请求的HTTP头或 initialize 的 _meta 中取出令牌
+func requestToken(method string, req mcp.Request) string {
+	if extra := req.GetExtra(); extra != nil && extra.Header != nil {
+		if token := security.BearerToken(extra.Header.Get("Authorization")); token != "" {
+			return token
+		}
+	}
+	if method == "initialize" {
+		if params, ok := req.GetParams().(*mcp.InitializeParams); ok {
+			if value, ok := params.Meta[AuthMetaKey].(string); ok {
+				return security.BearerToken(value)
+			}
+		}
+	}
+	return ""
+}
+
+// requireHTTPAuth 要求每个HTTP请求携带有效的 Bearer 令牌，并将认证信息放入请求Context
+// SSE传输的消息不携带HTTP头，因此连接的身份在建立事件流时确定。
+func requireHTTPAuth(next http.Handler, bashServer *MCPServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		manager := bashServer.authManager.Load()
+		if manager == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := security.BearerToken(r.Header.Get("Authorization"))
+		if token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mcp-bash-tools"`)
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		auth, err := manager.Authenticate(r.Context(), token)
+		if err == nil && auth.Expired(time.Now()) {
+			err = fmt.Errorf("token expired")
+		}
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mcp-bash-tools", error="invalid_token"`)
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(security.SetAuthContext(r.Context(), auth)))
+	})
+}
+
+// requirePermissions 检查调用方是否拥有全部权限，未开启认证或 Context 中没有认证信息（内部调用）时不限制
+func (s *MCPServer) requirePermissions(ctx context.Context, permissions ...string) error {
+	manager := s.authManager.Load()
+	auth, ok := security.GetAuthContext(ctx)
+	if manager == nil || !ok {
+		return nil
+	}
+	if err := manager.ValidatePermissions(ctx, auth, permissions); err != nil {
+		return fmt.Errorf("permission denied: %w", err)
+	}
+	return nil
+}
+
+// granted 报告调用方是否被明确授予全部权限，不记录拒绝事件；未开启认证时返回false
+// 用于决定是否放开连接隔离（例如 kill_shell.any），因此不能像 requirePermissions 一样默认放行
+func (s *MCPServer) granted(ctx context.Context, permissions ...string) bool {
+	auth, ok := security.GetAuthContext(ctx)
+	if s.authManager.Load() == nil || !ok {
+		return false
+	}
+	return security.CheckPermissions(auth, permissions) == nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mcp-bash-tools/internal/config"
+	"mcp-bash-tools/internal/security"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAPIKey    = "alice:0123456789abcdef:bash.execute+bash_output.read"
+	testJWTSecret = "0123456789abcdef0123456789abcdef"
+)
+
+// headerTransport 为每个请求添加Authorization头
+type headerTransport struct {
+	token string
+}
+
+func (h headerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+h.token)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// newAuthServer 创建开启认证的服务器
+func newAuthServer(t *testing.T) *MCPServer {
+	cfg := config.Default()
+	cfg.Security.EnableAuth = true
+	cfg.Security.APIKeys = []string{testAPIKey}
+	cfg.Security.JWTSecret = testJWTSecret
+	require.NoError(t, config.Validate(cfg))
+	return NewMCPServerWithConfig(cfg)
+}
+
+// signToken 使用测试密钥签发JWT
+func signToken(t *testing.T, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testJWTSecret))
+	require.NoError(t, err)
+	return token
+}
+
+// TestAuthProviders 测试API密钥和JWT的验证
+func TestAuthProviders(t *testing.T) {
+	provider, err := security.NewAuthProvider(security.SecurityConfig{
+		APIKeys:   []string{testAPIKey, "bob:fedcba9876543210"},
+		JWTSecret: testJWTSecret,
+	}, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	auth, err := provider.Authenticate(ctx, "0123456789abcdef")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", auth.UserID)
+	assert.Equal(t, []string{"bash.execute", "bash_output.read"}, auth.Permissions)
+	assert.Error(t, provider.ValidatePermissions(ctx, auth, []string{"kill_shell.any"}))
+
+	auth, err = provider.Authenticate(ctx, "fedcba9876543210")
+	require.NoError(t, err)
+	assert.Equal(t, []string{security.PermissionAll}, auth.Permissions)
+	assert.NoError(t, provider.ValidatePermissions(ctx, auth, []string{"kill_shell.any"}))
+
+	// 签发的JWT携带过期时间和权限
+	token, err := provider.GenerateToken(ctx, "carol", []string{"bash_output.read"})
+	require.NoError(t, err)
+	auth, err = provider.Authenticate(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, "carol", auth.UserID)
+	assert.Equal(t, []string{"bash_output.read"}, auth.Permissions)
+	assert.WithinDuration(t, time.Now().Add(security.DefaultTokenExpiry), auth.ExpiresAt, time.Minute)
+
+	// 过期、缺少过期时间、签名错误和错误算法的令牌被拒绝
+	invalid := []string{
+		"wrong-key-0000000000",
+		signToken(t, jwt.MapClaims{"sub": "carol", "exp": time.Now().Add(-time.Minute).Unix()}),
+		signToken(t, jwt.MapClaims{"sub": "carol"}),
+		token[:len(token)-2] + "xx",
+	}
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"sub": "carol", "exp": time.Now().Add(time.Hour).Unix()}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	invalid = append(invalid, none)
+	for _, token := range invalid {
+		_, err := provider.Authenticate(ctx, token)
+		assert.Error(t, err, token)
+	}
+
+	// 配置校验
+	cfg := config.Default()
+	cfg.Security.EnableAuth = true
+	assert.Error(t, config.Validate(cfg))
+	cfg.Security.APIKeys = []string{"alice:short"}
+	assert.Error(t, config.Validate(cfg))
+	cfg.Security.APIKeys = nil
+	cfg.Security.JWTSecret = "too-short"
+	assert.Error(t, config.Validate(cfg))
+}
+
+// TestAuthMiddlewareSetsContext 测试认证中间件将 AuthContext 放入处理器Context
+func TestAuthMiddlewareSetsContext(t *testing.T) {
+	server := newAuthServer(t)
+	var seen *security.AuthContext
+	handler := server.authMiddleware(&authState{})(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		seen, _ = security.GetAuthContext(ctx)
+		return nil, nil
+	})
+
+	call := func(token string) error {
+		req := &mcp.CallToolRequest{Extra: &mcp.RequestExtra{Header: http.Header{}}}
+		if token != "" {
+			req.Extra.Header.Set("Authorization", "Bearer "+token)
+		}
+		_, err := handler(context.Background(), "tools/call", req)
+		return err
+	}
+
+	assert.Error(t, call(""))
+	require.NoError(t, call("0123456789abcdef"))
+	require.NotNil(t, seen)
+	assert.Equal(t, "alice", seen.UserID)
+
+	// 之后的请求复用连接的认证信息，但不能切换到其他用户
+	require.NoError(t, call(""))
+	assert.Error(t, call(signToken(t, jwt.MapClaims{"sub": "mallory", "exp": time.Now().Add(time.Hour).Unix()})))
+
+	// 重新加载后已撤销的密钥失效
+	cfg := config.Default()
+	cfg.Security.EnableAuth = true
+	cfg.Security.JWTSecret = testJWTSecret
+	require.NoError(t, server.ApplyConfig(cfg))
+	assert.Error(t, call(""))
+}
+
+// TestHTTPAuth 测试HTTP传输要求Bearer令牌
+func TestHTTPAuth(t *testing.T) {
+	server := newAuthServer(t)
+	defer server.Shutdown()
+	ts := httptest.NewServer(NewHTTPHandler(server))
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+StreamableHTTPPath, "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("WWW-Authenticate"), "Bearer")
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.0.0"}, nil)
+	_, err = client.Connect(context.Background(), &mcp.StreamableClientTransport{
+		Endpoint:   ts.URL + StreamableHTTPPath,
+		HTTPClient: &http.Client{Transport: headerTransport{token: "not-a-valid-key!"}},
+		MaxRetries: -1,
+	}, nil)
+	assert.Error(t, err)
+
+	// API密钥通过 streamable HTTP，JWT通过SSE
+	jwtToken := signToken(t, jwt.MapClaims{"sub": "carol", "exp": time.Now().Add(time.Hour).Unix(), "permissions": []string{"bash_output.read"}})
+	transports := []mcp.Transport{
+		&mcp.StreamableClientTransport{
+			Endpoint:   ts.URL + StreamableHTTPPath,
+			HTTPClient: &http.Client{Transport: headerTransport{token: "0123456789abcdef"}},
+		},
+		&mcp.SSEClientTransport{
+			Endpoint:   ts.URL + SSEPath,
+			HTTPClient: &http.Client{Transport: headerTransport{token: jwtToken}},
+		},
+	}
+	for _, transport := range transports {
+		session := connectClient(t, transport)
+		listed, isError := callTool(t, session, "list_shells", map[string]any{})
+		assert.False(t, isError)
+		assert.Equal(t, float64(0), listed["total"])
+		session.Close()
+	}
+}
+
+// TestStdioAuthMeta 测试没有HTTP头的传输在 initialize 的 _meta 中提供令牌
+func TestStdioAuthMeta(t *testing.T) {
+	server := newAuthServer(t)
+	connect := func(token string) (*mcp.ClientSession, error) {
+		mcpServer := newServer(server, "", &authState{})
+		addBashTools(mcpServer, server, "")
+		serverTransport, clientTransport := mcp.NewInMemoryTransports()
+		serverSession, err := mcpServer.Connect(context.Background(), serverTransport, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { serverSession.Close() })
+
+		client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.0.0"}, nil)
+		client.AddSendingMiddleware(func(next mcp.MethodHandler) mcp.MethodHandler {
+			return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+				if params, ok := req.GetParams().(*mcp.InitializeParams); ok && token != "" {
+					params.Meta = mcp.Meta{AuthMetaKey: "Bearer " + token}
+				}
+				return next(ctx, method, req)
+			}
+		})
+		return client.Connect(context.Background(), clientTransport, nil)
+	}
+
+	_, err := connect("")
+	assert.Error(t, err)
+
+	session, err := connect("0123456789abcdef")
+	require.NoError(t, err)
+	defer session.Close()
+	_, isError := callTool(t, session, "list_shells", map[string]any{})
+	assert.False(t, isError)
+}
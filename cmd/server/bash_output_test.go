@@ -8,6 +8,8 @@ import (
 	"testing"
 	"time"
 
+	"mcp-bash-tools/internal/executor"
+
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -314,6 +316,160 @@ func (suite *BashOutputHandlerTestSuite) TestBashOutputHandler_TempFileReading()
 	suite.server.mutex.Unlock()
 }
 
+// TestBashOutputHandler_IncrementalTempFile 测试运行中任务的增量读取
+func (suite *BashOutputHandlerTestSuite) TestBashOutputHandler_IncrementalTempFile() {
+	taskID := "test_incremental_task"
+	tempFile, err := os.CreateTemp("", "test_output_*.txt")
+	require.NoError(suite.T(), err)
+	defer os.Remove(tempFile.Name())
+
+	tempFile.WriteString("line 1\nline 2\npartial")
+	tempFile.Close()
+
+	task := &BackgroundTask{
+		ID:        taskID,
+		Command:   "echo test",
+		Status:    "running",
+		StartTime: time.Now(),
+		TempFile:  tempFile.Name(),
+	}
+
+	suite.server.mutex.Lock()
+	suite.server.backgroundTasks[taskID] = task
+	suite.server.mutex.Unlock()
+	defer func() {
+		suite.server.mutex.Lock()
+		delete(suite.server.backgroundTasks, taskID)
+		suite.server.mutex.Unlock()
+	}()
+
+	args := BashOutputArguments{BashID: taskID}
+
+	// 首次读取只返回完整的行
+	_, output, err := suite.server.BashOutputHandler(context.Background(), &mcp.CallToolRequest{}, args)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "line 1\nline 2\n", output.Output)
+	assert.Equal(suite.T(), int64(14), output.NextOffset)
+
+	// 没有新的完整行时返回空输出
+	_, output, err = suite.server.BashOutputHandler(context.Background(), &mcp.CallToolRequest{}, args)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "", output.Output)
+	assert.Equal(suite.T(), int64(14), output.NextOffset)
+
+	// 追加输出后只返回新内容
+	f, err := os.OpenFile(tempFile.Name(), os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(suite.T(), err)
+	f.WriteString(" done\nline 4\n")
+	f.Close()
+
+	_, output, err = suite.server.BashOutputHandler(context.Background(), &mcp.CallToolRequest{}, args)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "partial done\nline 4\n", output.Output)
+	assert.Equal(suite.T(), int64(34), output.NextOffset)
+
+	// 显式since可以重新读取
+	since := int64(7)
+	_, output, err = suite.server.BashOutputHandler(context.Background(), &mcp.CallToolRequest{}, BashOutputArguments{BashID: taskID, Since: &since})
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "line 2\npartial done\nline 4\n", output.Output)
+	assert.Equal(suite.T(), int64(34), output.NextOffset)
+}
+
+// TestBashOutputHandler_IncrementalCompletedTask 测试已完成任务的内存输出增量读取
+func (suite *BashOutputHandlerTestSuite) TestBashOutputHandler_IncrementalCompletedTask() {
+	taskID := "test_incremental_completed_task"
+	exitCode := 0
+	task := &BackgroundTask{
+		ID:         taskID,
+		Command:    "echo test",
+		Output:     "first\nsecond\ntail",
+		Status:     "completed",
+		StartTime:  time.Now(),
+		ExitCode:   &exitCode,
+		ReadOffset: 6,
+	}
+
+	suite.server.mutex.Lock()
+	suite.server.backgroundTasks[taskID] = task
+	suite.server.mutex.Unlock()
+	defer func() {
+		suite.server.mutex.Lock()
+		delete(suite.server.backgroundTasks, taskID)
+		suite.server.mutex.Unlock()
+	}()
+
+	// 完成的任务返回剩余的全部输出（包括没有换行结尾的部分）
+	_, output, err := suite.server.BashOutputHandler(context.Background(), &mcp.CallToolRequest{}, BashOutputArguments{BashID: taskID})
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "second\ntail", output.Output)
+	assert.Equal(suite.T(), int64(17), output.NextOffset)
+
+	// 超出范围的since被截断到末尾
+	since := int64(1000)
+	_, output, err = suite.server.BashOutputHandler(context.Background(), &mcp.CallToolRequest{}, BashOutputArguments{BashID: taskID, Since: &since})
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "", output.Output)
+	assert.Equal(suite.T(), int64(17), output.NextOffset)
+
+	// since=0 从头读取
+	since = 0
+	_, output, err = suite.server.BashOutputHandler(context.Background(), &mcp.CallToolRequest{}, BashOutputArguments{BashID: taskID, Since: &since})
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "first\nsecond\ntail", output.Output)
+
+	// 负数since无效
+	since = -1
+	_, _, err = suite.server.BashOutputHandler(context.Background(), &mcp.CallToolRequest{}, BashOutputArguments{BashID: taskID, Since: &since})
+	assert.Error(suite.T(), err)
+}
+
+// TestBashOutputHandler_SeparateStreams 测试后台输出按流拆分
+func (suite *BashOutputHandlerTestSuite) TestBashOutputHandler_SeparateStreams() {
+	for _, prefix := range []string{DefaultStderrPrefix, ""} {
+		taskID := "test_streams_task"
+		tempFile, err := os.CreateTemp("", "test_output_*.txt")
+		require.NoError(suite.T(), err)
+		tempFile.Close()
+		defer os.Remove(tempFile.Name())
+
+		sink := newOutputSink(tempFile.Name(), prefix)
+		require.NoError(suite.T(), sink.WriteLine(executor.StreamStdout, "compiling"))
+		require.NoError(suite.T(), sink.WriteLine(executor.StreamStderr, "warning: unused"))
+		require.NoError(suite.T(), sink.WriteLine(executor.StreamStdout, "done"))
+
+		task := &BackgroundTask{
+			ID:           taskID,
+			Command:      "build",
+			Status:       "running",
+			StartTime:    time.Now(),
+			TempFile:     tempFile.Name(),
+			Sink:         sink,
+			StderrPrefix: prefix,
+		}
+		suite.server.mutex.Lock()
+		suite.server.backgroundTasks[taskID] = task
+		suite.server.mutex.Unlock()
+
+		_, output, err := suite.server.BashOutputHandler(context.Background(), &mcp.CallToolRequest{}, BashOutputArguments{BashID: taskID})
+		require.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "compiling\n"+prefix+"warning: unused\ndone\n", output.Output)
+		assert.Equal(suite.T(), "compiling\ndone\n", output.Stdout)
+		assert.Equal(suite.T(), "warning: unused\n", output.Stderr)
+
+		// 增量读取时只拆分新返回的范围
+		require.NoError(suite.T(), sink.WriteLine(executor.StreamStderr, "late error"))
+		_, output, err = suite.server.BashOutputHandler(context.Background(), &mcp.CallToolRequest{}, BashOutputArguments{BashID: taskID})
+		require.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "", output.Stdout)
+		assert.Equal(suite.T(), "late error\n", output.Stderr)
+
+		suite.server.mutex.Lock()
+		delete(suite.server.backgroundTasks, taskID)
+		suite.server.mutex.Unlock()
+	}
+}
+
 // 运行BashOutputHandler测试套件
 func TestBashOutputHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(BashOutputHandlerTestSuite))
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mcp-bash-tools/internal/config"
+	"mcp-bash-tools/internal/executor"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfigFile 在临时目录写入配置文件并返回路径
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+// TestConfigDefaults 测试默认值来自 default 标签
+func TestConfigDefaults(t *testing.T) {
+	cfg := config.Default()
+	assert.Equal(t, 1000, cfg.Execution.MinTimeout)
+	assert.Equal(t, 600000, cfg.Execution.MaxTimeout)
+	assert.Equal(t, 50, cfg.Execution.MaxConcurrentJobs)
+	assert.Equal(t, int64(1024*1024), cfg.Execution.DefaultMaxOutputBytes)
+	assert.Equal(t, 5*time.Second, cfg.Execution.DoneWaitTimeout)
+	assert.Equal(t, time.Hour, cfg.Retention.TTL)
+	assert.Equal(t, 30*time.Second, cfg.Server.ReadTimeout)
+	assert.True(t, cfg.RateLimit.Enabled)
+	require.NoError(t, config.Validate(cfg))
+}
+
+// TestConfigFileFormats 测试YAML、JSON和TOML配置文件
+func TestConfigFileFormats(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": "execution:\n  max_timeout: 120000\n  allowed_commands: [git, go]\nretention:\n  ttl: 10m\n",
+		"config.json": `{"execution": {"max_timeout": 120000, "allowed_commands": ["git", "go"]}, "retention": {"ttl": "10m"}}`,
+		"config.toml": "[execution]\nmax_timeout = 120000\nallowed_commands = [\"git\", \"go\"]\n[retention]\nttl = \"10m\"\n",
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg := config.Default()
+			require.NoError(t, config.LoadFile(cfg, writeConfigFile(t, name, content)))
+			assert.Equal(t, 120000, cfg.Execution.MaxTimeout)
+			assert.Equal(t, []string{"git", "go"}, cfg.Execution.AllowedCommands)
+			assert.Equal(t, 10*time.Minute, cfg.Retention.TTL)
+			// 未出现的键保持默认值
+			assert.Equal(t, 1000, cfg.Execution.MinTimeout)
+		})
+	}
+
+	cfg := config.Default()
+	assert.Error(t, config.LoadFile(cfg, writeConfigFile(t, "bad.yaml", "execution:\n  max_timeuot: 1\n")))
+	assert.Error(t, config.LoadFile(cfg, writeConfigFile(t, "bad.yaml", "execution:\n  max_timeout: soon\n")))
+	assert.Error(t, config.LoadFile(cfg, writeConfigFile(t, "config.ini", "")))
+}
+
+// TestConfigPrecedence 测试 默认值 < 配置文件 < 环境变量 < 命令行参数
+func TestConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "execution:\n  max_timeout: 300000\n  max_sessions: 3\n  max_concurrent_jobs: 5\n")
+	t.Setenv(config.ConfigFileEnvVar, path)
+	t.Setenv("MCP_BASH_EXECUTION_MAX_SESSIONS", "4")
+	t.Setenv("MCP_BASH_EXECUTION_MAX_CONCURRENT_JOBS", "6")
+	t.Setenv(config.AllowedRootsEnvVar, "/tmp"+string(os.PathListSeparator)+"/var")
+
+	cfg, file, err := config.Load([]string{"-execution.max_concurrent_jobs=7"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, path, file)
+	assert.Equal(t, 300000, cfg.Execution.MaxTimeout)      // 配置文件
+	assert.Equal(t, 4, cfg.Execution.MaxSessions)          // 环境变量覆盖配置文件
+	assert.Equal(t, 7, cfg.Execution.MaxConcurrentJobs)    // 命令行参数覆盖环境变量
+	assert.Equal(t, 10000, cfg.Execution.MaxCommandLength) // 默认值
+	assert.Equal(t, []string{"/tmp", "/var"}, cfg.Security.AllowedPaths)
+
+	_, _, err = config.Load([]string{"-execution.min_timeout=700000"}, nil)
+	assert.Error(t, err)
+	_, _, err = config.Load([]string{"-execution.max_sessions=many"}, nil)
+	assert.Error(t, err)
+}
+
+// TestServerUsesConfig 测试处理器使用配置中的限制
+func TestServerUsesConfig(t *testing.T) {
+	cfg := config.Default()
+	cfg.Execution.MaxCommandLength = 10
+	cfg.Execution.MaxTimeout = 2000
+	server := NewMCPServerWithConfig(cfg)
+
+	_, result, err := server.BashHandler(context.Background(), nil, BashArguments{Command: "echo 0123456789", Timeout: 1000})
+	require.Error(t, err)
+	assert.Contains(t, result.Output, "max 10 characters")
+
+	_, result, err = server.BashHandler(context.Background(), nil, BashArguments{Command: "echo x", Timeout: 5000})
+	require.Error(t, err)
+	assert.Contains(t, result.Output, "between 1000 and 2000 milliseconds")
+}
+
+// TestServerUsesWorkingDir 测试未指定 cwd 时命令在 execution.working_dir 中执行
+func TestServerUsesWorkingDir(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	cfg := config.Default()
+	cfg.Execution.WorkingDir = dir
+	server := NewMCPServerWithConfig(cfg)
+	if server.shellExecutor.GetShellPath(executor.Sh) == "" {
+		t.Skip("sh not available")
+	}
+
+	_, result, err := server.BashHandler(context.Background(), nil, BashArguments{Command: "pwd", Timeout: 5000, Shell: "sh"})
+	require.NoError(t, err)
+	assert.Equal(t, dir, strings.TrimSpace(result.Output))
+
+	other := t.TempDir()
+	_, result, err = server.BashHandler(context.Background(), nil, BashArguments{Command: "pwd", Timeout: 5000, Shell: "sh", Cwd: other})
+	require.NoError(t, err)
+	assert.NotEqual(t, dir, strings.TrimSpace(result.Output), "cwd 优先于 execution.working_dir")
+}
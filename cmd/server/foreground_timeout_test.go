@@ -20,6 +20,8 @@ type ForegroundTimeoutTestSuite struct {
 
 // SetupSuite 测试套件初始化
 func (suite *ForegroundTimeoutTestSuite) SetupSuite() {
+	// 测试命令使用PowerShell语法（Start-Sleep、Write-Output）
+	requirePowerShell(suite.T())
 	suite.server = NewMCPServer()
 }
 
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// HTTP传输的端点路径
+const (
+	StreamableHTTPPath = "/mcp" // MCP streamable HTTP 传输
+	SSEPath            = "/sse" // 旧版 HTTP+SSE 传输（GET建立事件流，POST发送消息）
+)
+
+// NewHTTPHandler 返回同时提供 streamable HTTP 和 SSE 传输的处理器
+// 开启认证时每个HTTP请求都需要携带 Authorization: Bearer <API密钥或JWT>。
+// 每个新建的MCP会话使用独立的服务器实例和连接标识，只能访问自己创建的后台任务和会话；
+// 会话结束（客户端断开、空闲超时或服务器关闭）后释放其运行中的任务和会话。
+func NewHTTPHandler(bashServer *MCPServer) http.Handler {
+	getServer := func(r *http.Request) *mcp.Server {
+		owner := fmt.Sprintf("conn_%s", uuid.New().String())
+		server := newServer(bashServer, owner, newAuthState(r))
+		addBashTools(server, bashServer, owner)
+		return server
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(StreamableHTTPPath, mcp.NewStreamableHTTPHandler(getServer, &mcp.StreamableHTTPOptions{
+		SessionTimeout: bashServer.cfg().Server.SessionTimeout,
+	}))
+	mux.Handle(SSEPath, mcp.NewSSEHandler(getServer, nil))
+	return requireHTTPAuth(mux, bashServer)
+}
+
+// ServeHTTP 在 server.host:server.port 上提供HTTP传输，ctx 取消时优雅关闭
+// 关闭时先停止接受新连接并结束事件流，再等待进行中的请求完成（最长 server.shutdown_timeout）。
+func ServeHTTP(ctx context.Context, bashServer *MCPServer) error {
+	cfg := bashServer.cfg().Server
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	if cfg.MaxConns > 0 {
+		listener = newLimitListener(listener, cfg.MaxConns)
+	}
+
+	// 事件流是长连接，关闭时单独取消，避免优雅关闭一直等待
+	streams, stopStreams := context.WithCancel(context.Background())
+	defer stopStreams()
+
+	httpServer := &http.Server{
+		Handler:           withStreamDeadlines(NewHTTPHandler(bashServer), bashServer, streams),
+		ReadHeaderTimeout: cfg.ReadTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.Serve(listener)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Starting MCP server with HTTP transport on %s\n", listener.Addr())
+	fmt.Fprintf(os.Stderr, "   Streamable HTTP: http://%s%s\n", listener.Addr(), StreamableHTTPPath)
+	fmt.Fprintf(os.Stderr, "   SSE: http://%s%s\n", listener.Addr(), SSEPath)
+	if ip := net.ParseIP(cfg.Host); !bashServer.cfg().Security.EnableAuth && cfg.Host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		fmt.Fprintf(os.Stderr, "Warning: listening on a non-loopback address without authentication\n")
+	}
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Fprintf(os.Stderr, "Shutting down HTTP server...\n")
+	stopStreams()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: graceful shutdown incomplete, closing remaining connections: %v\n", err)
+		httpServer.Close()
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// withStreamDeadlines 调整长时间请求的写超时
+// GET请求是事件流，不设写超时并在 streams 取消时结束；
+// POST请求可能等待前台命令执行完成，写超时在 server.write_timeout 基础上加上命令最大超时。
+func withStreamDeadlines(next http.Handler, bashServer *MCPServer, streams context.Context) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := bashServer.cfg()
+		rc := http.NewResponseController(w)
+		switch r.Method {
+		case http.MethodGet:
+			rc.SetWriteDeadline(time.Time{})
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			stop := context.AfterFunc(streams, cancel)
+			defer stop()
+			r = r.WithContext(ctx)
+		case http.MethodPost:
+			if cfg.Server.WriteTimeout > 0 {
+				maxTimeout := time.Duration(cfg.Execution.MaxTimeout) * time.Millisecond
+				rc.SetWriteDeadline(time.Now().Add(cfg.Server.WriteTimeout + maxTimeout))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitListener 限制同时打开的连接数，达到上限时新连接等待已有连接关闭
+type limitListener struct {
+	net.Listener
+	slots     chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newLimitListener 创建最多同时保持 n 个连接的监听器
+func newLimitListener(l net.Listener, n int) *limitListener {
+	return &limitListener{
+		Listener: l,
+		slots:    make(chan struct{}, n),
+		done:     make(chan struct{}),
+	}
+}
+
+// Accept 等待空闲名额后接受连接
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.slots <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.slots
+		return nil, err
+	}
+	return &limitConn{Conn: conn, release: sync.OnceFunc(func() { <-l.slots })}, nil
+}
+
+// Close 关闭监听器并唤醒等待名额的 Accept
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// limitConn 关闭时归还连接名额
+type limitConn struct {
+	net.Conn
+	release func()
+}
+
+// Close 关闭连接并归还名额
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.release()
+	return err
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mcp-bash-tools/internal/config"
+	"mcp-bash-tools/internal/executor"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// connectClient 通过指定传输连接MCP服务器
+func connectClient(t *testing.T, transport mcp.Transport) *mcp.ClientSession {
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.0.0"}, nil)
+	session, err := client.Connect(context.Background(), transport, nil)
+	require.NoError(t, err)
+	return session
+}
+
+// callTool 调用工具并返回结构化结果
+func callTool(t *testing.T, session *mcp.ClientSession, name string, args map[string]any) (map[string]any, bool) {
+	result, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: name, Arguments: args})
+	require.NoError(t, err)
+	structured, _ := result.StructuredContent.(map[string]any)
+	return structured, result.IsError
+}
+
+// TestHTTPTransportIsolatesConnections 测试不同连接之间的后台任务和会话相互隔离
+func TestHTTPTransportIsolatesConnections(t *testing.T) {
+	server := NewMCPServer()
+	if server.shellExecutor.GetShellPath(executor.Sh) == "" {
+		t.Skip("sh not available")
+	}
+	defer server.Shutdown()
+	ts := httptest.NewServer(NewHTTPHandler(server))
+	defer ts.Close()
+
+	alice := connectClient(t, &mcp.StreamableClientTransport{Endpoint: ts.URL + StreamableHTTPPath})
+	bob := connectClient(t, &mcp.SSEClientTransport{Endpoint: ts.URL + SSEPath})
+	defer bob.Close()
+
+	started, isError := callTool(t, alice, "bash", map[string]any{
+		"command":           "sleep 30",
+		"timeout":           5000,
+		"shell":             "sh",
+		"run_in_background": true,
+	})
+	require.False(t, isError)
+	taskID, _ := started["shellId"].(string)
+	require.NotEmpty(t, taskID)
+
+	opened, isError := callTool(t, alice, "session_open", map[string]any{"shell": "sh"})
+	require.False(t, isError)
+	sessionID, _ := opened["session_id"].(string)
+	require.NotEmpty(t, sessionID)
+
+	// 其他连接看不到也无法操作该任务和会话
+	listed, isError := callTool(t, bob, "list_shells", map[string]any{})
+	require.False(t, isError)
+	assert.Equal(t, float64(0), listed["total"])
+	_, isError = callTool(t, bob, "bash_output", map[string]any{"bash_id": taskID})
+	assert.True(t, isError)
+	_, isError = callTool(t, bob, "kill_shell", map[string]any{"shell_id": taskID})
+	assert.True(t, isError)
+	_, isError = callTool(t, bob, "bash", map[string]any{"command": "echo hi", "timeout": 5000, "session_id": sessionID})
+	assert.True(t, isError)
+	_, isError = callTool(t, bob, "session_close", map[string]any{"session_id": sessionID})
+	assert.True(t, isError)
+
+	// 创建者仍可访问
+	listed, isError = callTool(t, alice, "list_shells", map[string]any{})
+	require.False(t, isError)
+	assert.Equal(t, float64(1), listed["total"])
+	output, isError := callTool(t, alice, "bash_output", map[string]any{"bash_id": taskID})
+	require.False(t, isError)
+	assert.Equal(t, "running", output["status"])
+
+	// 连接断开后释放其任务和会话
+	require.NoError(t, alice.Close())
+	assert.Eventually(t, func() bool {
+		server.mutex.RLock()
+		defer server.mutex.RUnlock()
+		_, taskExists := server.backgroundTasks[taskID]
+		_, err := server.sessions.Get(sessionID)
+		return !taskExists && err != nil
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+// TestTransportConfig 测试传输方式配置
+func TestTransportConfig(t *testing.T) {
+	cfg, _, err := config.Load(nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "stdio", cfg.Server.Transport)
+
+	cfg, _, err = config.Load([]string{"--transport=http", "-server.port=9090"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "http", cfg.Server.Transport)
+	assert.Equal(t, 9090, cfg.Server.Port)
+
+	_, _, err = config.Load([]string{"-transport=grpc"}, nil)
+	assert.Error(t, err)
+}
+
+// TestServeHTTPShutdown 测试取消Context后HTTP服务器优雅退出
+func TestServeHTTPShutdown(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.Transport = "http"
+	cfg.Server.Host = "127.0.0.1"
+	cfg.Server.Port = 0
+	server := NewMCPServerWithConfig(cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ServeHTTP(ctx, server) }()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeHTTP did not return after cancellation")
+	}
+}
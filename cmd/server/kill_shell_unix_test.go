@@ -0,0 +1,198 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"mcp-bash-tools/internal/config"
+	"mcp-bash-tools/internal/executor"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startBackground 启动后台命令并等待其输出的第一行（子进程PID）
+func startBackground(t *testing.T, server *MCPServer, command string) (string, int) {
+	_, started, err := server.BashHandler(context.Background(), nil, BashArguments{
+		Command:         command,
+		Timeout:         5000,
+		Shell:           "sh",
+		RunInBackground: true,
+	})
+	require.NoError(t, err)
+
+	var output strings.Builder
+	require.Eventually(t, func() bool {
+		_, page, _ := server.BashOutputHandler(context.Background(), nil, BashOutputArguments{BashID: started.ShellID})
+		output.WriteString(page.Output)
+		return strings.Contains(output.String(), "\n")
+	}, 5*time.Second, 20*time.Millisecond)
+	pid, err := strconv.Atoi(strings.TrimSpace(strings.SplitN(output.String(), "\n", 2)[0]))
+	require.NoError(t, err)
+	return started.ShellID, pid
+}
+
+// processAlive 判断进程是否仍在运行，已退出但未被回收的僵尸进程视为已终止
+func processAlive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return true // 没有 /proc 的系统只能依据信号检查
+	}
+	// 状态字段位于进程名（括号内）之后
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
+
+// TestKillShellKillsProcessGroup 测试 kill_shell 终止Shell启动的子进程，子进程可以处理 SIGTERM
+func TestKillShellKillsProcessGroup(t *testing.T) {
+	server := NewMCPServer()
+	if server.shellExecutor.GetShellPath(executor.Sh) == "" {
+		t.Skip("sh not available")
+	}
+	marker := filepath.Join(t.TempDir(), "terminated")
+
+	// 子Shell收到 SIGTERM 时写入标记文件，模拟需要收尾的开发服务器
+	shellID, pid := startBackground(t, server,
+		`sh -c 'trap "echo flushed > `+marker+`; exit 0" TERM; echo $$; while :; do sleep 0.05; done' & wait`)
+	require.True(t, processAlive(pid))
+
+	// 后台启动的子Shell忽略 SIGINT，在 SIGTERM 阶段退出
+	_, result, err := server.KillShellHandler(context.Background(), nil, KillShellArguments{ShellID: shellID, GraceMs: 500})
+	require.NoError(t, err)
+	assert.Contains(t, result.Message, "killed successfully")
+	assert.Equal(t, string(executor.StageTerminate), result.Stage)
+
+	require.Eventually(t, func() bool { return !processAlive(pid) }, 2*time.Second, 20*time.Millisecond,
+		"孙进程应随进程组一起终止")
+	content, err := os.ReadFile(marker)
+	require.NoError(t, err)
+	assert.Equal(t, "flushed\n", string(content))
+}
+
+// TestKillShellEscalatesToSIGKILL 测试忽略 SIGINT 和 SIGTERM 的进程在宽限期后被 SIGKILL 终止
+func TestKillShellEscalatesToSIGKILL(t *testing.T) {
+	server := NewMCPServer()
+	if server.shellExecutor.GetShellPath(executor.Sh) == "" {
+		t.Skip("sh not available")
+	}
+	cfg := config.Default()
+	cfg.Execution.KillGracePeriod = 300 * time.Millisecond
+	require.NoError(t, server.ApplyConfig(cfg))
+
+	// 后台的 sleep 忽略 SIGINT；被忽略的信号在 exec 后仍然被忽略，sleep 同样不响应 SIGTERM
+	shellID, pid := startBackground(t, server, `trap "" TERM; sleep 30 & echo $!; wait`)
+
+	start := time.Now()
+	_, result, err := server.KillShellHandler(context.Background(), nil, KillShellArguments{ShellID: shellID})
+	require.NoError(t, err)
+	assert.Equal(t, string(executor.StageKill), result.Stage)
+	assert.GreaterOrEqual(t, time.Since(start), 600*time.Millisecond, "SIGINT 和 SIGTERM 阶段各等待一个宽限期")
+	require.Eventually(t, func() bool { return !processAlive(pid) }, 2*time.Second, 20*time.Millisecond)
+}
+
+// TestKillShellGracefulInterrupt 测试响应 SIGINT 的进程在中断阶段结束
+func TestKillShellGracefulInterrupt(t *testing.T) {
+	server := NewMCPServer()
+	if server.shellExecutor.GetShellPath(executor.Sh) == "" {
+		t.Skip("sh not available")
+	}
+	shellID, pid := startBackground(t, server, `echo $$; exec sleep 30`)
+
+	start := time.Now()
+	_, result, err := server.KillShellHandler(context.Background(), nil, KillShellArguments{ShellID: shellID, GraceMs: 5000})
+	require.NoError(t, err)
+	assert.Equal(t, string(executor.StageInterrupt), result.Stage)
+	assert.Less(t, time.Since(start), 5*time.Second, "进程退出后不应等满宽限期")
+	require.Eventually(t, func() bool { return !processAlive(pid) }, 2*time.Second, 20*time.Millisecond)
+}
+
+// TestKillShellForceMode 测试 force 模式跳过宽限期直接强制终止
+func TestKillShellForceMode(t *testing.T) {
+	server := NewMCPServer()
+	if server.shellExecutor.GetShellPath(executor.Sh) == "" {
+		t.Skip("sh not available")
+	}
+	shellID, pid := startBackground(t, server, `trap "" INT TERM; echo $$; while :; do sleep 0.05; done`)
+
+	start := time.Now()
+	_, result, err := server.KillShellHandler(context.Background(), nil, KillShellArguments{ShellID: shellID, Mode: "force", GraceMs: 5000})
+	require.NoError(t, err)
+	assert.Equal(t, string(executor.StageKill), result.Stage)
+	assert.Less(t, time.Since(start), time.Second)
+	require.Eventually(t, func() bool { return !processAlive(pid) }, 2*time.Second, 20*time.Millisecond)
+}
+
+// TestKillShellInvalidArguments 测试无效的终止方式和宽限期被拒绝
+func TestKillShellInvalidArguments(t *testing.T) {
+	server := NewMCPServer()
+
+	_, _, err := server.KillShellHandler(context.Background(), nil, KillShellArguments{ShellID: "bash_1", Mode: "sigkill"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid mode")
+
+	_, _, err = server.KillShellHandler(context.Background(), nil, KillShellArguments{ShellID: "bash_1", GraceMs: -1})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "grace_ms must be between")
+}
+
+// TestBackgroundOutputNotLost 测试快速结束的后台命令的最后一行输出不会丢失
+func TestBackgroundOutputNotLost(t *testing.T) {
+	server := NewMCPServer()
+	if server.shellExecutor.GetShellPath(executor.Sh) == "" {
+		t.Skip("sh not available")
+	}
+	for i := range 20 {
+		_, started, err := server.BashHandler(context.Background(), nil, BashArguments{
+			Command:         "echo first; echo last >&2",
+			Timeout:         5000,
+			Shell:           "sh",
+			RunInBackground: true,
+		})
+		require.NoError(t, err)
+		var output strings.Builder
+		require.Eventually(t, func() bool {
+			_, page, err := server.BashOutputHandler(context.Background(), nil, BashOutputArguments{BashID: started.ShellID})
+			output.WriteString(page.Output)
+			return err == nil && page.Status != "running"
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Contains(t, output.String(), "first", "run %d", i)
+		assert.Contains(t, output.String(), "last", "run %d", i)
+	}
+}
+
+// TestSessionCloseKillsBackgroundChildren 测试关闭会话时终止会话中启动的后台进程
+func TestSessionCloseKillsBackgroundChildren(t *testing.T) {
+	server := NewMCPServer()
+	if server.shellExecutor.GetShellPath(executor.Sh) == "" {
+		t.Skip("sh not available")
+	}
+	_, opened, err := server.SessionOpenHandler(context.Background(), nil, SessionOpenArguments{Shell: "sh"})
+	require.NoError(t, err)
+
+	_, result, err := server.BashHandler(context.Background(), nil, BashArguments{
+		Command:   "sleep 30 >/dev/null 2>&1 & echo $!",
+		Timeout:   5000,
+		SessionID: opened.SessionID,
+	})
+	require.NoError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(result.Stdout))
+	require.NoError(t, err)
+	require.True(t, processAlive(pid))
+
+	_, _, err = server.SessionCloseHandler(context.Background(), nil, SessionCloseArguments{SessionID: opened.SessionID})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return !processAlive(pid) }, 2*time.Second, 20*time.Millisecond)
+}
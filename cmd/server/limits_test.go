@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"mcp-bash-tools/internal/config"
+	"mcp-bash-tools/internal/core"
+	"mcp-bash-tools/internal/executor"
+	"mcp-bash-tools/internal/resources"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLimiter 只支持指定限制项的限制机制，不实际启动进程
+type fakeLimiter struct {
+	supported []string
+}
+
+func (l fakeLimiter) Name() string { return "fake" }
+
+func (l fakeLimiter) Unsupported(limits resources.Limits) []string {
+	var names []string
+	check := func(name string, set bool) {
+		if set && !slices.Contains(l.supported, name) {
+			names = append(names, name)
+		}
+	}
+	check(resources.Memory, limits.MemoryBytes > 0)
+	check(resources.CPU, limits.CPUPercent > 0)
+	check(resources.FileSize, limits.FileSizeBytes > 0)
+	check(resources.OpenFiles, limits.OpenFiles > 0)
+	check(resources.Processes, limits.Processes > 0)
+	return names
+}
+
+func (l fakeLimiter) Prepare(cmd *exec.Cmd, limits resources.Limits) (resources.Process, error) {
+	return nil, assert.AnError
+}
+
+// TestResolveLimits 测试默认值、上限和限制机制不支持的项
+func TestResolveLimits(t *testing.T) {
+	limiter := fakeLimiter{supported: []string{resources.Memory, resources.FileSize, resources.OpenFiles}}
+	cfg := core.LimitsConfig{MemoryMB: 256, MaxMemoryMB: 1024, MaxFileSizeMB: 100, OpenFiles: 128}
+
+	l, err := resources.Resolve(cfg, resources.Request{}, limiter)
+	require.NoError(t, err)
+	assert.Equal(t, resources.Limits{MemoryBytes: 256 << 20, FileSizeBytes: 100 << 20, OpenFiles: 128}, l,
+		"未指定的项使用默认值，没有默认值时使用上限")
+
+	l, err = resources.Resolve(cfg, resources.Request{MemoryMB: 512, FileSizeMB: 1, OpenFiles: 4096}, limiter)
+	require.NoError(t, err)
+	assert.Equal(t, resources.Limits{MemoryBytes: 512 << 20, FileSizeBytes: 1 << 20, OpenFiles: 4096}, l,
+		"没有上限的项可以超过默认值")
+
+	_, err = resources.Resolve(cfg, resources.Request{MemoryMB: 2048, FileSizeMB: -1}, limiter)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "memory_mb must not exceed 1024")
+	assert.Contains(t, err.Error(), "file_size_mb must not be negative")
+
+	_, err = resources.Resolve(cfg, resources.Request{CPUPercent: 50}, limiter)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cpu_percent is not supported by the fake limiter")
+
+	// 配置的默认值不受支持时不报错，由 ApplyConfig 警告
+	_, err = resources.Resolve(core.LimitsConfig{Processes: 10}, resources.Request{}, limiter)
+	assert.NoError(t, err)
+}
+
+// TestLimitsConfigValidation 测试资源限制配置的校验
+func TestLimitsConfigValidation(t *testing.T) {
+	cfg := config.Default()
+	assert.NoError(t, config.Validate(cfg))
+	assert.True(t, mustResolve(t, cfg.Limits).IsZero(), "默认不限制资源")
+
+	cfg.Limits.MemoryMB = 512
+	cfg.Limits.MaxMemoryMB = 256
+	cfg.Limits.OpenFiles = -1
+	err := config.Validate(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "memory_mb (512) must not exceed max_memory_mb (256)")
+	assert.Contains(t, err.Error(), "open_files and max_open_files must not be negative")
+
+	cfg = config.Default()
+	cfg.Limits.CgroupParent = filepath.Join(t.TempDir(), "missing")
+	assert.Error(t, config.Validate(cfg))
+}
+
+func mustResolve(t *testing.T, cfg core.LimitsConfig) resources.Limits {
+	l, err := resources.Resolve(cfg, resources.Request{}, resources.Current())
+	require.NoError(t, err)
+	return l
+}
+
+// TestBashHandlerRejectsUnsupportedLimits 测试限制机制不支持的项和会话中的 limits 参数被拒绝
+func TestBashHandlerRejectsUnsupportedLimits(t *testing.T) {
+	defer resources.SetCurrent(resources.Current())
+	server := NewMCPServer()
+	resources.SetCurrent(fakeLimiter{supported: []string{resources.Memory}})
+
+	_, result, err := server.BashHandler(context.Background(), nil, BashArguments{
+		Command: "echo hi",
+		Timeout: 5000,
+		Limits:  &resources.Request{CPUPercent: 50},
+	})
+	require.Error(t, err)
+	assert.Contains(t, result.Output, "cpu_percent is not supported by the fake limiter")
+
+	_, opened, err := server.SessionOpenHandler(context.Background(), nil, SessionOpenArguments{
+		Limits: &resources.Request{Processes: 5},
+	})
+	require.Error(t, err)
+	assert.Contains(t, opened.Message, "processes is not supported")
+
+	_, result, err = server.BashHandler(context.Background(), nil, BashArguments{
+		Command:   "echo hi",
+		Timeout:   5000,
+		SessionID: "session_x",
+		Limits:    &resources.Request{MemoryMB: 64},
+	})
+	require.Error(t, err)
+	assert.Contains(t, result.Output, "limits cannot be combined with session_id")
+}
+
+// TestBashHandlerAppliesLimits 测试前台、后台和会话命令在 rlimit 限制下运行
+func TestBashHandlerAppliesLimits(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("rlimit limits are only tested on Linux")
+	}
+	server := NewMCPServer()
+	if server.shellExecutor.GetShellPath(executor.Sh) == "" {
+		t.Skip("sh not available")
+	}
+	cfg := config.Default()
+	cfg.Limits.OpenFiles = 64
+	cfg.Limits.MaxFileSizeMB = 1
+	require.NoError(t, server.ApplyConfig(cfg))
+	defer server.ApplyConfig(config.Default())
+
+	// 限制在进程启动后设置，命令先等待片刻
+	_, result, err := server.BashHandler(context.Background(), nil, BashArguments{
+		Command: "sleep 0.1; ulimit -n",
+		Timeout: 5000,
+		Shell:   "sh",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "64\n", result.Stdout)
+
+	_, result, err = server.BashHandler(context.Background(), nil, BashArguments{
+		Command: "sleep 0.1; ulimit -n",
+		Timeout: 5000,
+		Shell:   "sh",
+		Limits:  &resources.Request{OpenFiles: 32},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "32\n", result.Stdout)
+
+	_, result, err = server.BashHandler(context.Background(), nil, BashArguments{
+		Command: "echo hi",
+		Timeout: 5000,
+		Shell:   "sh",
+		Limits:  &resources.Request{FileSizeMB: 2},
+	})
+	require.Error(t, err)
+	assert.Contains(t, result.Output, "file_size_mb must not exceed 1")
+
+	// 写入超过 file_size_mb 的文件被截断在上限处
+	path := filepath.Join(t.TempDir(), "big")
+	_, started, err := server.BashHandler(context.Background(), nil, BashArguments{
+		Command:         "sleep 0.1; head -c 3000000 /dev/zero > '" + path + "'; echo exit=$?; sleep 0.1",
+		Timeout:         5000,
+		Shell:           "sh",
+		RunInBackground: true,
+	})
+	require.NoError(t, err)
+	var output strings.Builder
+	require.Eventually(t, func() bool {
+		_, page, err := server.BashOutputHandler(context.Background(), nil, BashOutputArguments{BashID: started.ShellID})
+		output.WriteString(page.Output)
+		return err == nil && page.Status != "running"
+	}, 10*time.Second, 50*time.Millisecond)
+	assert.NotContains(t, output.String(), "exit=0")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1<<20), info.Size())
+
+	_, opened, err := server.SessionOpenHandler(context.Background(), nil, SessionOpenArguments{
+		Shell:  "sh",
+		Limits: &resources.Request{OpenFiles: 48},
+	})
+	require.NoError(t, err)
+	defer server.SessionCloseHandler(context.Background(), nil, SessionCloseArguments{SessionID: opened.SessionID})
+	time.Sleep(100 * time.Millisecond)
+	_, result, err = server.BashHandler(context.Background(), nil, BashArguments{
+		Command:   "ulimit -n",
+		Timeout:   5000,
+		SessionID: opened.SessionID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "48\n", result.Stdout)
+}
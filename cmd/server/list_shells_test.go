@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// ListShellsHandlerTestSuite 后台任务列表测试套件
+type ListShellsHandlerTestSuite struct {
+	suite.Suite
+	server *MCPServer
+}
+
+// SetupTest 每个测试前准备一组任务
+func (suite *ListShellsHandlerTestSuite) SetupTest() {
+	suite.server = NewMCPServer()
+
+	now := time.Now()
+	zero := 0
+	one := 1
+	tasks := []*BackgroundTask{
+		{
+			ID:          "bash_dev_server",
+			Command:     "npm run dev",
+			Description: "前端开发服务器",
+			Status:      "running",
+			StartTime:   now.Add(-10 * time.Minute),
+		},
+		{
+			ID:        "bash_build",
+			Command:   "go build ./...",
+			Output:    "build ok\n",
+			Status:    "completed",
+			StartTime: now.Add(-5 * time.Minute),
+			EndTime:   now.Add(-4 * time.Minute),
+			ExitCode:  &zero,
+		},
+		{
+			ID:        "bash_tests",
+			Command:   "go test ./...",
+			Output:    "FAIL\n",
+			Status:    "failed",
+			StartTime: now.Add(-2 * time.Minute),
+			EndTime:   now.Add(-1 * time.Minute),
+			ExitCode:  &one,
+		},
+	}
+
+	suite.server.mutex.Lock()
+	for _, task := range tasks {
+		suite.server.backgroundTasks[task.ID] = task
+	}
+	suite.server.mutex.Unlock()
+}
+
+// ids 提取结果中的任务ID
+func ids(shells []ShellInfo) []string {
+	result := make([]string, 0, len(shells))
+	for _, shell := range shells {
+		result = append(result, shell.ID)
+	}
+	return result
+}
+
+// TestListShells_Default 测试默认按开始时间倒序列出全部任务
+func (suite *ListShellsHandlerTestSuite) TestListShells_Default() {
+	_, result, err := suite.server.ListShellsHandler(context.Background(), &mcp.CallToolRequest{}, ListShellsArguments{})
+
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 3, result.Total)
+	assert.Equal(suite.T(), []string{"bash_tests", "bash_build", "bash_dev_server"}, ids(result.Shells))
+
+	build := result.Shells[1]
+	assert.Equal(suite.T(), "go build ./...", build.Command)
+	assert.Equal(suite.T(), int64(time.Minute/time.Millisecond), build.DurationMs)
+	require.NotNil(suite.T(), build.ExitCode)
+	assert.Equal(suite.T(), 0, *build.ExitCode)
+	assert.Equal(suite.T(), int64(len("build ok\n")), build.OutputSize)
+
+	dev := result.Shells[2]
+	assert.Equal(suite.T(), "前端开发服务器", dev.Description)
+	assert.Nil(suite.T(), dev.ExitCode)
+	assert.GreaterOrEqual(suite.T(), dev.DurationMs, int64(10*time.Minute/time.Millisecond))
+}
+
+// TestListShells_StatusFilter 测试按状态过滤
+func (suite *ListShellsHandlerTestSuite) TestListShells_StatusFilter() {
+	_, result, err := suite.server.ListShellsHandler(context.Background(), &mcp.CallToolRequest{}, ListShellsArguments{Status: "running"})
+
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"bash_dev_server"}, ids(result.Shells))
+
+	_, result, err = suite.server.ListShellsHandler(context.Background(), &mcp.CallToolRequest{}, ListShellsArguments{Status: "killed"})
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, result.Total)
+	assert.NotNil(suite.T(), result.Shells)
+}
+
+// TestListShells_SortOrder 测试排序字段和方向
+func (suite *ListShellsHandlerTestSuite) TestListShells_SortOrder() {
+	_, result, err := suite.server.ListShellsHandler(context.Background(), &mcp.CallToolRequest{}, ListShellsArguments{SortBy: "id", Order: "asc"})
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"bash_build", "bash_dev_server", "bash_tests"}, ids(result.Shells))
+
+	_, result, err = suite.server.ListShellsHandler(context.Background(), &mcp.CallToolRequest{}, ListShellsArguments{SortBy: "duration"})
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "bash_dev_server", result.Shells[0].ID)
+}
+
+// TestListShells_InvalidArguments 测试无效参数
+func (suite *ListShellsHandlerTestSuite) TestListShells_InvalidArguments() {
+	invalid := []ListShellsArguments{
+		{Status: "unknown"},
+		{SortBy: "command"},
+		{Order: "random"},
+	}
+	for _, args := range invalid {
+		_, _, err := suite.server.ListShellsHandler(context.Background(), &mcp.CallToolRequest{}, args)
+		assert.Error(suite.T(), err)
+	}
+}
+
+// TestListShells_TempFileOutputSize 测试运行中任务从临时文件计算输出大小
+func (suite *ListShellsHandlerTestSuite) TestListShells_TempFileOutputSize() {
+	tempFile, err := os.CreateTemp("", "test_output_*.txt")
+	require.NoError(suite.T(), err)
+	defer os.Remove(tempFile.Name())
+	tempFile.WriteString("0123456789")
+	tempFile.Close()
+
+	suite.server.mutex.Lock()
+	suite.server.backgroundTasks["bash_dev_server"].TempFile = tempFile.Name()
+	suite.server.mutex.Unlock()
+
+	_, result, err := suite.server.ListShellsHandler(context.Background(), &mcp.CallToolRequest{}, ListShellsArguments{Status: "running"})
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), result.Shells, 1)
+	assert.Equal(suite.T(), int64(10), result.Shells[0].OutputSize)
+}
+
+// 运行ListShellsHandler测试套件
+func TestListShellsHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(ListShellsHandlerTestSuite))
+}
@@ -2,18 +2,32 @@ package main
 
 import (
 	"bufio"
+	"cmp"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"mcp-bash-tools/internal/audit"
+	"mcp-bash-tools/internal/config"
+	"mcp-bash-tools/internal/core"
 	"mcp-bash-tools/internal/executor"
+	"mcp-bash-tools/internal/pathpolicy"
+	"mcp-bash-tools/internal/policy"
+	"mcp-bash-tools/internal/redact"
+	"mcp-bash-tools/internal/resources"
 	"mcp-bash-tools/internal/security"
 	"mcp-bash-tools/internal/windows"
 
@@ -21,23 +35,6 @@ import (
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
-// 常量定义
-const (
-	// 超时配置
-	DefaultTimeoutMs = 30000  // 默认超时时间（毫秒）
-	MinTimeoutMs     = 1000   // 最小超时时间（毫秒）
-	MaxTimeoutMs     = 600000 // 最大超时时间（毫秒）
-
-	// 任务配置
-	MaxShellIDLength   = 100   // Shell ID 最大长度
-	MaxBashIDLength    = 100   // Bash ID 最大长度
-	MaxBackgroundTasks = 50    // 最大后台任务数
-	MaxCommandLength   = 10000 // 最大命令长度（字符）
-
-	// 超时等待配置
-	DoneChannelTimeout = 5 * time.Second // done channel 等待超时
-)
-
 // NewShellExecutor 创建实际的ShellExecutor
 func NewShellExecutor() ShellExecutorInterface {
 	return executor.NewShellExecutor()
@@ -45,62 +42,166 @@ func NewShellExecutor() ShellExecutorInterface {
 
 // BashArguments 定义Bash工具的输入参数 - 使用官方标准命名
 type BashArguments struct {
-	Command         string `json:"command" jsonschema:"要执行的PowerShell命令"`
-	Timeout         int    `json:"timeout" jsonschema:"命令超时时间(毫秒),必填,范围1000-600000"`
-	Description     string `json:"description,omitempty" jsonschema:"命令描述,用于日志记录"`
-	RunInBackground bool   `json:"run_in_background,omitempty" jsonschema:"是否在后台执行命令"`
+	Command         string             `json:"command" jsonschema:"要执行的Shell命令,语法取决于shell参数选择的Shell"`
+	Timeout         int                `json:"timeout" jsonschema:"命令超时时间(毫秒),必填,范围1000-600000"`
+	Description     string             `json:"description,omitempty" jsonschema:"命令描述,用于日志记录"`
+	RunInBackground bool               `json:"run_in_background,omitempty" jsonschema:"是否在后台执行命令"`
+	Shell           string             `json:"shell,omitempty" jsonschema:"执行命令的Shell(pwsh,powershell,cmd,bash,sh,zsh),默认使用首选Shell"`
+	Cwd             string             `json:"cwd,omitempty" jsonschema:"命令的工作目录,必须位于允许的根目录内"`
+	Env             map[string]string  `json:"env,omitempty" jsonschema:"额外的环境变量,覆盖继承的同名变量"`
+	SessionID       string             `json:"session_id,omitempty" jsonschema:"在指定的持久化会话中执行命令(由session_open返回)"`
+	NoErrorPrefix   bool               `json:"no_error_prefix,omitempty" jsonschema:"后台任务的合并输出中不为stderr行添加ERROR:前缀"`
+	MaxOutputBytes  int                `json:"max_output_bytes,omitempty" jsonschema:"输出字节上限(前台结果及后台任务内存保留),超出时保留首尾并将完整输出写入文件,默认1048576,最大16777216"`
+	Limits          *resources.Request `json:"limits,omitempty" jsonschema:"命令进程树的资源限制,未指定的项使用配置的默认值,不能超过配置的上限"`
 }
 
 // BashResult 定义Bash工具的输出结果 - 使用官方标准命名
 type BashResult struct {
-	Output   string `json:"output" jsonschema:"命令执行输出内容"`
-	ExitCode int    `json:"exitCode" jsonschema:"命令退出代码"`
-	Killed   bool   `json:"killed,omitempty" jsonschema:"命令是否被强制终止"`
-	ShellID  string `json:"shellId,omitempty" jsonschema:"后台任务的Shell ID"`
+	Output        string                `json:"output" jsonschema:"命令执行输出内容(stdout与stderr按到达顺序交错)"`
+	Stdout        string                `json:"stdout,omitempty" jsonschema:"标准输出内容"`
+	Stderr        string                `json:"stderr,omitempty" jsonschema:"标准错误内容"`
+	ExitCode      int                   `json:"exitCode" jsonschema:"命令退出代码"`
+	Killed        bool                  `json:"killed,omitempty" jsonschema:"命令是否被强制终止"`
+	ShellID       string                `json:"shellId,omitempty" jsonschema:"后台任务的Shell ID"`
+	Shell         string                `json:"shell,omitempty" jsonschema:"实际执行命令的Shell"`
+	SessionID     string                `json:"sessionId,omitempty" jsonschema:"执行命令的会话ID"`
+	Truncated     bool                  `json:"truncated,omitempty" jsonschema:"输出是否超出上限被截断(仅保留首尾)"`
+	TotalBytes    int64                 `json:"totalBytes,omitempty" jsonschema:"合并输出的总字节数"`
+	OutputFile    string                `json:"outputFile,omitempty" jsonschema:"截断时完整输出所在的文件,可通过bash_output分页读取"`
+	RetryAfter    int64                 `json:"retryAfterMs,omitempty" jsonschema:"超出调用频率限制时,距离可以再次调用的毫秒数"`
+	Policy        *policy.Decision      `json:"policy,omitempty" jsonschema:"命令被策略拒绝时的判定和触发的规则"`
+	PathViolation *pathpolicy.Violation `json:"pathViolation,omitempty" jsonschema:"命令写入或删除的路径超出路径约束时被拒绝的操作和路径"`
 }
 
 // BashOutputArguments 定义BashOutput工具的输入参数
 type BashOutputArguments struct {
 	BashID string `json:"bash_id" jsonschema:"后台任务的Bash ID"`
 	Filter string `json:"filter,omitempty" jsonschema:"正则表达式过滤器,用于筛选输出内容"`
+	Since  *int64 `json:"since,omitempty" jsonschema:"从该字节偏移开始读取(通常为上次返回的nextOffset),省略时从上次读取位置继续,0表示从头读取"`
+	Limit  int    `json:"limit,omitempty" jsonschema:"单次返回的最大字节数,默认1048576,最大16777216"`
 }
 
 // BashOutputResult 定义BashOutput工具的输出结果
 type BashOutputResult struct {
-	Output   string `json:"output" jsonschema:"后台任务的输出内容"`
-	Status   string `json:"status" jsonschema:"任务状态(running,completed,failed,killed)"`
-	ExitCode *int   `json:"exitCode,omitempty" jsonschema:"任务退出代码(仅任务完成时有效)"`
+	Output     string `json:"output" jsonschema:"后台任务的输出内容(stdout与stderr交错)"`
+	Stdout     string `json:"stdout,omitempty" jsonschema:"本次返回范围内的标准输出内容"`
+	Stderr     string `json:"stderr,omitempty" jsonschema:"本次返回范围内的标准错误内容(不含ERROR:前缀)"`
+	Status     string `json:"status" jsonschema:"任务状态(running,completed,failed,killed)"`
+	ExitCode   *int   `json:"exitCode,omitempty" jsonschema:"任务退出代码(仅任务完成时有效)"`
+	NextOffset int64  `json:"nextOffset" jsonschema:"下次读取的字节偏移,作为since参数传入即可只获取新输出"`
+	Truncated  bool   `json:"truncated,omitempty" jsonschema:"本次返回受limit限制,nextOffset之后还有已产生的输出"`
+	TotalBytes int64  `json:"totalBytes" jsonschema:"任务当前输出的总字节数"`
+	OutputFile string `json:"outputFile,omitempty" jsonschema:"保存任务完整输出的文件"`
+	RetryAfter int64  `json:"retryAfterMs,omitempty" jsonschema:"超出调用频率限制时,距离可以再次调用的毫秒数"`
 }
 
 // KillShellArguments 定义KillShell工具的输入参数
 type KillShellArguments struct {
 	ShellID string `json:"shell_id" jsonschema:"要终止的后台任务Shell ID"`
+	Mode    string `json:"mode,omitempty" jsonschema:"终止方式(graceful,force),默认graceful:先发送Ctrl+Break(Windows)或SIGINT/SIGTERM(POSIX),宽限期后仍未退出再强制终止"`
+	GraceMs int    `json:"grace_ms,omitempty" jsonschema:"graceful模式下每个阶段的等待毫秒数,省略时使用配置的kill_grace_period"`
 }
 
 // KillShellResult 定义KillShell工具的输出结果
 type KillShellResult struct {
 	Message string `json:"message" jsonschema:"操作结果消息"`
 	ShellID string `json:"shell_id" jsonschema:"被终止的任务Shell ID"`
+	Stage   string `json:"stage,omitempty" jsonschema:"结束进程的终止阶段(exited,interrupt,terminate,kill)"`
+}
+
+// ListShellsArguments 定义ListShells工具的输入参数
+type ListShellsArguments struct {
+	Status string `json:"status,omitempty" jsonschema:"按状态过滤(running,completed,failed,killed),省略时返回全部"`
+	SortBy string `json:"sort_by,omitempty" jsonschema:"排序字段(start_time,duration,status,id),默认start_time"`
+	Order  string `json:"order,omitempty" jsonschema:"排序方向(asc,desc),默认desc"`
+}
+
+// ShellInfo 描述一个后台任务的摘要信息
+type ShellInfo struct {
+	ID          string    `json:"id" jsonschema:"后台任务ID"`
+	Command     string    `json:"command" jsonschema:"执行的命令"`
+	Description string    `json:"description,omitempty" jsonschema:"命令描述"`
+	Status      string    `json:"status" jsonschema:"任务状态"`
+	Shell       string    `json:"shell,omitempty" jsonschema:"执行命令的Shell"`
+	StartTime   time.Time `json:"startTime" jsonschema:"开始时间"`
+	DurationMs  int64     `json:"durationMs" jsonschema:"运行时长(毫秒),运行中的任务计算到当前时间"`
+	ExitCode    *int      `json:"exitCode,omitempty" jsonschema:"退出代码(仅任务结束时有效)"`
+	PID         int       `json:"pid,omitempty" jsonschema:"进程PID"`
+	OutputSize  int64     `json:"outputSize" jsonschema:"输出大小(字节)"`
+}
+
+// ListShellsResult 定义ListShells工具的输出结果
+type ListShellsResult struct {
+	Shells     []ShellInfo `json:"shells" jsonschema:"后台任务列表"`
+	Total      int         `json:"total" jsonschema:"返回的任务数量"`
+	RetryAfter int64       `json:"retryAfterMs,omitempty" jsonschema:"超出调用频率限制时,距离可以再次调用的毫秒数"`
+}
+
+// SessionOpenArguments 定义SessionOpen工具的输入参数
+type SessionOpenArguments struct {
+	Shell       string             `json:"shell,omitempty" jsonschema:"会话使用的Shell(pwsh,powershell,bash,sh,zsh),默认使用首选Shell"`
+	Cwd         string             `json:"cwd,omitempty" jsonschema:"会话的初始工作目录,必须位于允许的根目录内"`
+	Env         map[string]string  `json:"env,omitempty" jsonschema:"会话的额外环境变量"`
+	Description string             `json:"description,omitempty" jsonschema:"会话描述,用于日志记录"`
+	Limits      *resources.Request `json:"limits,omitempty" jsonschema:"会话Shell进程树的资源限制,未指定的项使用配置的默认值,不能超过配置的上限"`
+}
+
+// SessionOpenResult 定义SessionOpen工具的输出结果
+type SessionOpenResult struct {
+	SessionID  string `json:"session_id" jsonschema:"新会话的ID"`
+	Shell      string `json:"shell" jsonschema:"会话使用的Shell"`
+	Pid        int    `json:"pid" jsonschema:"会话Shell进程的PID"`
+	Message    string `json:"message" jsonschema:"操作结果消息"`
+	RetryAfter int64  `json:"retry_after_ms,omitempty" jsonschema:"超出调用频率限制时,距离可以再次调用的毫秒数"`
+}
+
+// SessionCloseArguments 定义SessionClose工具的输入参数
+type SessionCloseArguments struct {
+	SessionID string `json:"session_id" jsonschema:"要关闭的会话ID"`
+}
+
+// SessionCloseResult 定义SessionClose工具的输出结果
+type SessionCloseResult struct {
+	Message   string `json:"message" jsonschema:"操作结果消息"`
+	SessionID string `json:"session_id" jsonschema:"被关闭的会话ID"`
 }
 
 // BackgroundTask 表示一个后台任务
 type BackgroundTask struct {
-	ID        string             `json:"id"`
-	Command   string             `json:"command"`
-	Output    string             `json:"output"`
-	Status    string             `json:"status"` // running, completed, failed, killed
-	StartTime time.Time          `json:"startTime"`
-	Error     string             `json:"error,omitempty"`
-	ExitCode  *int               `json:"exitCode,omitempty"`
-	TempFile  string             `json:"tempFile,omitempty"` // 临时文件路径用于存储输出
-	Process   *os.Process        `json:"-"`                  // 进程句柄，用于终止进程
-	Cancel    context.CancelFunc `json:"-"`                  // Context取消函数，用于终止命令
-	Job       *windows.JobObject `json:"-"`                  // Windows Job Object，用于管理进程树
+	ID             string                 `json:"id"`
+	Command        string                 `json:"command"`
+	Description    string                 `json:"description,omitempty"`
+	Shell          executor.ShellType     `json:"-"` // 执行命令的Shell类型
+	Cwd            string                 `json:"cwd,omitempty"`
+	Env            map[string]string      `json:"-"` // 额外环境变量（可能包含敏感信息，不序列化）
+	Output         string                 `json:"output"`
+	ReadOffset     int64                  `json:"-"`                   // bash_output 的隐式读取位置（字节偏移）
+	Chunks         []executor.OutputChunk `json:"-"`                   // 输出中各流的分段（任务结束后使用）
+	Sink           *outputSink            `json:"-"`                   // 运行中任务的输出写入器
+	StderrPrefix   string                 `json:"-"`                   // 合并输出中stderr行的前缀
+	MaxOutputBytes int64                  `json:"-"`                   // 任务结束后内存中保留的输出字节上限
+	Limits         resources.Limits       `json:"-"`                   // 命令进程树的资源限制
+	Truncated      bool                   `json:"truncated,omitempty"` // 内存中的输出只保留了首尾，完整输出在TempFile中
+	Status         string                 `json:"status"`              // running, completed, failed, killed
+	StartTime      time.Time              `json:"startTime"`
+	EndTime        time.Time              `json:"endTime,omitzero"` // 任务结束时间，运行中为零值
+	Error          string                 `json:"error,omitempty"`
+	ExitCode       *int                   `json:"exitCode,omitempty"`
+	TempFile       string                 `json:"tempFile,omitempty"` // 临时文件路径用于存储输出
+	Process        *os.Process            `json:"-"`                  // 进程句柄，用于终止进程
+	Cancel         context.CancelFunc     `json:"-"`                  // Context取消函数，用于终止命令
+	Job            *windows.JobObject     `json:"-"`                  // Windows Job Object，用于管理进程树
+	Owner          string                 `json:"-"`                  // 创建任务的连接，HTTP模式下其他连接不可见
+	AuditRecord    audit.Record           `json:"-"`                  // 命令开始时的审计记录，任务结束时据此写入结束记录
 }
 
 // ShellExecutorInterface 定义Shell执行器接口
 type ShellExecutorInterface interface {
 	ExecuteCommand(command string, timeout int) (string, int, error)
+	ExecuteWithShell(shellType executor.ShellType, command string, timeout int, opts executor.ExecOptions) (executor.ExecResult, error)
+	GetPreferredShell() executor.ShellType
+	GetShellPath(shellType executor.ShellType) string
+	GetAvailableShells() []executor.ShellType
 	PrintShellInfo()
 }
 
@@ -109,18 +210,118 @@ type MCPServer struct {
 	backgroundTasks map[string]*BackgroundTask
 	mutex           sync.RWMutex
 	shellExecutor   ShellExecutorInterface
+	config          atomic.Pointer[core.Config]              // 运行时配置，重新加载时整体替换
+	authManager     atomic.Pointer[security.SecurityManager] // 认证管理器，未开启认证时为nil
+	rateLimits      atomic.Pointer[rateLimits]               // 工具调用限流，未开启限流时为nil
+	audit           *audit.Logger                            // 命令审计日志，未配置时为nil
+	sessions        *executor.SessionManager
+	sessionOwners   map[string]string // 会话ID -> 创建会话的连接
+	retention       RetentionPolicy   // 已结束任务的保留策略
+	approvals       sessionApprovals  // 用户选择本会话不再询问的规则
 }
 
-// NewMCPServer 创建新的MCP服务器
+// NewMCPServer 使用默认配置创建新的MCP服务器
 func NewMCPServer() *MCPServer {
-	return &MCPServer{
+	return NewMCPServerWithConfig(config.Default())
+}
+
+// NewMCPServerWithConfig 使用指定配置创建新的MCP服务器
+func NewMCPServerWithConfig(cfg *core.Config) *MCPServer {
+	s := &MCPServer{
 		backgroundTasks: make(map[string]*BackgroundTask),
 		shellExecutor:   NewShellExecutor(), // 使用实际的ShellExecutor
+		sessions:        executor.NewSessionManager(cfg.Execution.MaxSessions),
+		sessionOwners:   make(map[string]string),
+		retention:       RetentionPolicyFromConfig(cfg.Retention),
+	}
+	s.config.Store(cfg)
+	s.authManager.Store(newSecurityManager(cfg))
+	s.rateLimits.Store(newRateLimits(cfg.RateLimit))
+	return s
+}
+
+// cfg 返回当前配置快照，调用方不得修改
+func (s *MCPServer) cfg() *core.Config {
+	return s.config.Load()
+}
+
+// resolveByteLimit 校验字节上限参数，0表示使用默认值
+func (s *MCPServer) resolveByteLimit(name string, value int) (int64, error) {
+	limits := s.cfg().Execution
+	if value == 0 {
+		return limits.DefaultMaxOutputBytes, nil
+	}
+	if value < 0 || int64(value) > limits.MaxOutputBytesLimit {
+		return 0, fmt.Errorf("%s must be between 1 and %d bytes, got: %d", name, limits.MaxOutputBytesLimit, value)
 	}
+	return int64(value), nil
+}
+
+// resolveLimits 计算调用的资源限制，未指定 limits 参数时使用配置的默认值
+func (s *MCPServer) resolveLimits(req *resources.Request) (resources.Limits, error) {
+	var request resources.Request
+	if req != nil {
+		request = *req
+	}
+	l, err := resources.Resolve(s.cfg().Limits, request, resources.Current())
+	if err != nil {
+		return resources.Limits{}, fmt.Errorf("invalid limits: %w", err)
+	}
+	return l, nil
+}
+
+// resolveShell 解析并校验调用方指定的Shell，为空时使用首选Shell
+func (s *MCPServer) resolveShell(name string) (executor.ShellType, error) {
+	available := s.shellExecutor.GetAvailableShells()
+	if name == "" {
+		preferred := s.shellExecutor.GetPreferredShell()
+		if preferred == executor.Unknown {
+			return executor.Unknown, fmt.Errorf("no suitable shell found")
+		}
+		return preferred, nil
+	}
+
+	shellType, err := executor.ParseShellType(name)
+	if err != nil {
+		return executor.Unknown, err
+	}
+	for _, candidate := range available {
+		if candidate == shellType {
+			return shellType, nil
+		}
+	}
+
+	names := make([]string, 0, len(available))
+	for _, candidate := range available {
+		names = append(names, candidate.String())
+	}
+	return executor.Unknown, fmt.Errorf("shell %s is not available (available: %s)", shellType.String(), strings.Join(names, ", "))
+}
+
+// commandShell 返回执行命令的Shell，用于按对应的语法判定命令：会话中的命令使用会话的Shell
+// 无法确定时返回 Unknown，命令随后会因Shell或会话无效被拒绝
+func (s *MCPServer) commandShell(ctx context.Context, args BashArguments) executor.ShellType {
+	if args.SessionID != "" {
+		if !s.ownsSession(ownerFrom(ctx), args.SessionID) {
+			return executor.Unknown
+		}
+		session, err := s.sessions.Get(args.SessionID)
+		if err != nil {
+			return executor.Unknown
+		}
+		return session.Shell
+	}
+	shellType, _ := s.resolveShell(args.Shell)
+	return shellType
 }
 
 // BashHandler 处理Bash命令执行 - 使用官方标准Handler签名
 func (s *MCPServer) BashHandler(ctx context.Context, req *mcp.CallToolRequest, args BashArguments) (*mcp.CallToolResult, BashResult, error) {
+	// 同一次调用使用同一份配置，避免中途重新加载导致限制不一致
+	cfg := s.cfg()
+	limits := cfg.Execution
+	owner := ownerFrom(ctx)
+
 	// 参数验证
 	if args.Command == "" {
 		errorMsg := "command is required"
@@ -131,8 +332,8 @@ func (s *MCPServer) BashHandler(ctx context.Context, req *mcp.CallToolRequest, a
 	}
 
 	// 命令长度验证
-	if len(args.Command) > MaxCommandLength {
-		errorMsg := fmt.Sprintf("command too long (max %d characters), got: %d", MaxCommandLength, len(args.Command))
+	if len(args.Command) > limits.MaxCommandLength {
+		errorMsg := fmt.Sprintf("command too long (max %d characters), got: %d", limits.MaxCommandLength, len(args.Command))
 		return nil, BashResult{
 			ExitCode: 1,
 			Output:   errorMsg,
@@ -140,45 +341,177 @@ func (s *MCPServer) BashHandler(ctx context.Context, req *mcp.CallToolRequest, a
 	}
 
 	if args.Timeout == 0 {
-		errorMsg := fmt.Sprintf("timeout is required and must be between %d and %d milliseconds", MinTimeoutMs, MaxTimeoutMs)
+		errorMsg := fmt.Sprintf("timeout is required and must be between %d and %d milliseconds", limits.MinTimeout, limits.MaxTimeout)
 		return nil, BashResult{
 			ExitCode: 1,
 			Output:   errorMsg,
 		}, fmt.Errorf("%s", errorMsg)
 	}
 
-	if args.Timeout < MinTimeoutMs || args.Timeout > MaxTimeoutMs {
-		errorMsg := fmt.Sprintf("timeout must be between %d and %d milliseconds, got: %d", MinTimeoutMs, MaxTimeoutMs, args.Timeout)
+	if args.Timeout < limits.MinTimeout || args.Timeout > limits.MaxTimeout {
+		errorMsg := fmt.Sprintf("timeout must be between %d and %d milliseconds, got: %d", limits.MinTimeout, limits.MaxTimeout, args.Timeout)
 		return nil, BashResult{
 			ExitCode: 1,
 			Output:   errorMsg,
 		}, fmt.Errorf("%s", errorMsg)
 	}
 
-	// 安全检查
-	if security.IsDangerousCommand(args.Command) {
-		errorMsg := fmt.Sprintf("command rejected for security reasons: %s", args.Command)
+	// 安全检查：按命令策略判定，拒绝时返回触发的规则
+	// 需要确认（ask）的命令在通过权限和限流检查后再请用户确认
+	// bash、sh、zsh 中反引号和 $(...) 是命令替换，需要按 POSIX 语法判定
+	posix := s.commandShell(ctx, args).IsPOSIX()
+	decision := security.EvaluateCommand(args.Command, posix)
+	if decision.Verdict == policy.Deny {
+		errorMsg := fmt.Sprintf("command rejected for security reasons: %s", decision)
+		s.auditPolicyRejected(ctx, args, decision, errorMsg)
 		return nil, BashResult{
 			ExitCode: 1,
 			Output:   errorMsg,
+			Policy:   &decision,
 		}, fmt.Errorf("%s", errorMsg)
 	}
 
+	// 权限检查：执行命令、后台执行以及命令所属类别都需要对应权限
+	permissions := append([]string{security.PermBashExecute}, security.CommandPermissions(args.Command, posix)...)
+	if args.RunInBackground {
+		permissions = append(permissions, security.PermBashBackground)
+	}
+	if err := s.requirePermissions(ctx, permissions...); err != nil {
+		errorMsg := err.Error()
+		s.auditRejected(ctx, args, errorMsg)
+		return nil, BashResult{
+			ExitCode: 1,
+			Output:   errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+
+	// 限流：启动后台任务和执行前台命令使用不同的预算
+	budget := BudgetExecute
+	if args.RunInBackground {
+		budget = BudgetBackground
+	}
+	if limitErr := s.allowCall(ctx, budget); limitErr != nil {
+		s.auditRejected(ctx, args, limitErr.Error())
+		return rateLimitedResult(limitErr), BashResult{
+			ExitCode:   1,
+			Output:     limitErr.Error(),
+			RetryAfter: limitErr.RetryAfter.Milliseconds(),
+		}, nil
+	}
+
+	// 用户确认：通过 MCP elicitation 请用户确认，可选择本会话内不再询问同一规则
+	if decision.Verdict == policy.Ask {
+		approvedCtx, err := s.requestApproval(ctx, req, decision)
+		if err != nil {
+			errorMsg := fmt.Sprintf("command requires approval and was rejected for security reasons: %s: %v", decision, err)
+			s.auditPolicyRejected(ctx, args, decision, errorMsg)
+			return nil, BashResult{
+				ExitCode: 1,
+				Output:   errorMsg,
+				Policy:   &decision,
+			}, fmt.Errorf("%s", errorMsg)
+		}
+		ctx = approvedCtx
+	}
+
+	// 输出上限
+	maxOutputBytes, err := s.resolveByteLimit("max_output_bytes", args.MaxOutputBytes)
+	if err != nil {
+		errorMsg := err.Error()
+		return nil, BashResult{
+			ExitCode: 1,
+			Output:   errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+
+	// 会话模式：命令在已有的持久化Shell中执行
+	if args.SessionID != "" {
+		return s.executeInSession(ctx, args, maxOutputBytes)
+	}
+
+	// 资源限制
+	resourceLimits, err := s.resolveLimits(args.Limits)
+	if err != nil {
+		errorMsg := err.Error()
+		return nil, BashResult{
+			ExitCode: 1,
+			Output:   errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+
+	// Shell选择
+	shellType, err := s.resolveShell(args.Shell)
+	if err != nil {
+		errorMsg := err.Error()
+		return nil, BashResult{
+			ExitCode: 1,
+			Output:   errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+
+	// 工作目录和环境变量校验
+	paths, err := pathpolicy.New(cfg.Security.AllowedPaths, cfg.Security.BlockedPaths)
+	if err != nil {
+		errorMsg := err.Error()
+		return nil, BashResult{
+			ExitCode: 1,
+			Output:   errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+	opts := executor.ExecOptions{Env: args.Env, MaxOutputBytes: maxOutputBytes, Limits: resourceLimits}
+	// 未指定 cwd 时使用 execution.working_dir
+	if workDir := cmp.Or(args.Cwd, cfg.Execution.WorkingDir); workDir != "" {
+		dir, err := security.ValidateWorkingDir(workDir, paths)
+		if err != nil {
+			errorMsg := err.Error()
+			s.auditRejected(ctx, args, errorMsg)
+			return nil, BashResult{
+				ExitCode: 1,
+				Output:   errorMsg,
+			}, fmt.Errorf("%s", errorMsg)
+		}
+		opts.Dir = dir
+	}
+	if err := security.ValidateEnv(args.Env, cfg.Security.Mode == policy.ModeAllowlist); err != nil {
+		errorMsg := err.Error()
+		s.auditRejected(ctx, args, errorMsg)
+		return nil, BashResult{
+			ExitCode: 1,
+			Output:   errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+
+	// 路径约束：命令写入或删除的路径必须位于允许的根目录内，相对路径相对于工作目录
+	cwd := opts.Dir
+	if cwd == "" {
+		cwd, _ = os.Getwd()
+	}
+	if _, err := paths.CheckCommand(args.Command, cwd); err != nil {
+		return s.pathRejected(ctx, args, err)
+	}
+
+	// 审计记录使用实际的Shell和工作目录
+	auditRecord := auditCommand(ctx, "", args)
+	auditRecord.Shell = shellType.String()
+	auditRecord.Cwd = opts.Dir
+
 	// 日志记录
 	logMsg := args.Description
 	if logMsg == "" {
 		logMsg = args.Command
 	}
-	fmt.Fprintf(os.Stderr, "Executing command: %s\n", logMsg)
+	fmt.Fprintf(os.Stderr, "Executing command: %s\n", redact.String(logMsg))
 
 	if args.RunInBackground {
-		// 检查后台任务数量限制
+		// 先按保留策略清理已结束的任务，再检查运行中任务数量限制
+		s.pruneFinishedTasks(time.Now())
 		s.mutex.RLock()
-		taskCount := len(s.backgroundTasks)
+		taskCount := s.runningTaskCount()
 		s.mutex.RUnlock()
 
-		if taskCount >= MaxBackgroundTasks {
-			errorMsg := fmt.Sprintf("maximum background tasks limit reached (%d/%d)", taskCount, MaxBackgroundTasks)
+		if taskCount >= limits.MaxConcurrentJobs {
+			errorMsg := fmt.Sprintf("maximum running background tasks limit reached (%d/%d)", taskCount, limits.MaxConcurrentJobs)
+			s.auditRejected(ctx, args, errorMsg)
 			return nil, BashResult{
 				ExitCode: 1,
 				Output:   errorMsg,
@@ -190,11 +523,23 @@ func (s *MCPServer) BashHandler(ctx context.Context, req *mcp.CallToolRequest, a
 		// 使用UUID保证全局唯一性
 		taskID := fmt.Sprintf("bash_%s", uuid.New().String())
 		task := &BackgroundTask{
-			ID:        taskID,
-			Command:   args.Command,
-			StartTime: time.Now(),
-			Status:    "running",
+			ID:          taskID,
+			Command:     args.Command,
+			Description: args.Description,
+			Shell:       shellType,
+			Cwd:         opts.Dir,
+			Env:         opts.Env,
+			StartTime:   time.Now(),
+			Status:      "running",
+			Owner:       owner,
 		}
+		task.MaxOutputBytes = maxOutputBytes
+		task.Limits = opts.Limits
+		if !args.NoErrorPrefix {
+			task.StderrPrefix = DefaultStderrPrefix
+		}
+		auditRecord.TaskID = taskID
+		task.AuditRecord = s.auditStart(auditRecord, taskID, task.StartTime)
 		s.backgroundTasks[taskID] = task
 
 		// 启动后台任务（传入0表示无超时限制）
@@ -205,61 +550,76 @@ func (s *MCPServer) BashHandler(ctx context.Context, req *mcp.CallToolRequest, a
 		return nil, BashResult{
 			ExitCode: 0,
 			ShellID:  taskID,
+			Shell:    shellType.String(),
 			Output:   fmt.Sprintf("Background task started with ID: %s", taskID),
 		}, nil
 	}
 
 	// 前台执行 - 带超时，超时后自动转后台
 	resultChan := make(chan struct {
-		output   string
-		exitCode int
-		err      error
+		result executor.ExecResult
+		err    error
 	}, 1)
 
 	// 在goroutine中执行命令
+	startTime := time.Now()
+	auditRecord = s.auditStart(auditRecord, fmt.Sprintf("cmd_%s", uuid.New().String()), startTime)
 	go func() {
-		output, exitCode, err := s.shellExecutor.ExecuteCommand(args.Command, args.Timeout)
+		result, err := s.shellExecutor.ExecuteWithShell(shellType, args.Command, args.Timeout, opts)
 		resultChan <- struct {
-			output   string
-			exitCode int
-			err      error
-		}{output, exitCode, err}
+			result executor.ExecResult
+			err    error
+		}{result, err}
 	}()
 
 	// 等待结果或超时
 	select {
-	case result := <-resultChan:
+	case res := <-resultChan:
 		// 命令在超时前完成
-		killed := false
-		if result.err != nil {
-			errStr := result.err.Error()
-			if strings.Contains(errStr, "killed") ||
-				strings.Contains(errStr, "timed out") ||
-				strings.Contains(errStr, "context deadline exceeded") {
-				killed = true
-			}
+		result := res.result
+		killed := isKilledError(res.err)
+
+		// 输出溢出到文件时登记为已结束任务，便于通过bash_output分页读取
+		shellID := ""
+		if result.OutputFile != "" {
+			shellID = s.registerSpilledOutput(ctx, args, shellType, startTime, result, res.err)
 		}
+		s.auditResultEnd(auditRecord, shellID, result, killed, res.err)
 
-		if result.err != nil && !killed {
-			errorOutput := result.output
+		if res.err != nil && !killed {
+			errorOutput := result.Output
 			if errorOutput == "" {
-				errorOutput = fmt.Sprintf("command execution failed: %v", result.err)
+				errorOutput = fmt.Sprintf("command execution failed: %v", res.err)
 			} else {
-				errorOutput = fmt.Sprintf("%s\nError: %v", result.output, result.err)
+				errorOutput = fmt.Sprintf("%s\nError: %v", result.Output, res.err)
 			}
 
 			return nil, BashResult{
-				Output:   errorOutput,
-				ExitCode: result.exitCode,
-				Killed:   killed,
+				Output:     errorOutput,
+				Stdout:     result.Stdout,
+				Stderr:     result.Stderr,
+				ExitCode:   result.ExitCode,
+				Killed:     killed,
+				ShellID:    shellID,
+				Shell:      shellType.String(),
+				Truncated:  result.Truncated,
+				TotalBytes: result.TotalBytes,
+				OutputFile: result.OutputFile,
 			}, nil
 		}
 
 		// 成功返回
 		return nil, BashResult{
-			Output:   result.output,
-			ExitCode: result.exitCode,
-			Killed:   killed,
+			Output:     result.Output,
+			Stdout:     result.Stdout,
+			Stderr:     result.Stderr,
+			ExitCode:   result.ExitCode,
+			Killed:     killed,
+			ShellID:    shellID,
+			Shell:      shellType.String(),
+			Truncated:  result.Truncated,
+			TotalBytes: result.TotalBytes,
+			OutputFile: result.OutputFile,
 		}, nil
 
 	case <-time.After(time.Duration(args.Timeout) * time.Millisecond):
@@ -267,11 +627,18 @@ func (s *MCPServer) BashHandler(ctx context.Context, req *mcp.CallToolRequest, a
 		taskID := fmt.Sprintf("bash_%s", uuid.New().String())
 
 		task := &BackgroundTask{
-			ID:        taskID,
-			Command:   args.Command,
-			Status:    "running",
-			StartTime: time.Now(),
-			Output:    fmt.Sprintf("Task exceeded timeout (%dms), converted to background execution\n", args.Timeout),
+			ID:             taskID,
+			Command:        args.Command,
+			Description:    args.Description,
+			Shell:          shellType,
+			Cwd:            opts.Dir,
+			Env:            opts.Env,
+			Status:         "running",
+			StartTime:      startTime,
+			MaxOutputBytes: maxOutputBytes,
+			Limits:         opts.Limits,
+			Owner:          owner,
+			Output:         fmt.Sprintf("Task exceeded timeout (%dms), converted to background execution\n", args.Timeout),
 		}
 
 		s.mutex.Lock()
@@ -280,15 +647,28 @@ func (s *MCPServer) BashHandler(ctx context.Context, req *mcp.CallToolRequest, a
 
 		// 继续监控任务完成（任务实际上还在执行）
 		go func() {
-			result := <-resultChan
+			res := <-resultChan
+			result := res.result
+
+			s.auditResultEnd(auditRecord, taskID, result, isKilledError(res.err), res.err)
 
 			s.mutex.Lock()
 			if task, exists := s.backgroundTasks[taskID]; exists {
-				task.Output += result.output
-				task.ExitCode = &result.exitCode
-				if result.err != nil {
+				if result.OutputFile != "" {
+					// 完整输出已溢出到文件，分段偏移以文件为准
+					task.TempFile = result.OutputFile
+					task.Truncated = true
+					task.Chunks = result.Chunks
+				} else {
+					// 分段偏移基于命令自身的输出，追加到已有提示信息之后需要平移
+					task.Chunks = executor.ShiftChunks(result.Chunks, int64(len(task.Output)))
+				}
+				task.Output += result.Output
+				task.ExitCode = &result.ExitCode
+				task.EndTime = time.Now()
+				if res.err != nil {
 					task.Status = "failed"
-					task.Error = result.err.Error()
+					task.Error = res.err.Error()
 				} else {
 					task.Status = "completed"
 				}
@@ -302,8 +682,178 @@ func (s *MCPServer) BashHandler(ctx context.Context, req *mcp.CallToolRequest, a
 			ExitCode: 0,
 			ShellID:  taskID,
 			Killed:   false,
+			Shell:    shellType.String(),
+		}, nil
+	}
+}
+
+// pathRejected 返回命令因路径约束被拒绝的结果，并记录审计
+func (s *MCPServer) pathRejected(ctx context.Context, args BashArguments, err error) (*mcp.CallToolResult, BashResult, error) {
+	errorMsg := fmt.Sprintf("path not allowed: %v", err)
+	s.auditRejected(ctx, args, errorMsg)
+	result := BashResult{
+		ExitCode:  1,
+		Output:    errorMsg,
+		SessionID: args.SessionID,
+	}
+	var violation *pathpolicy.Violation
+	if errors.As(err, &violation) {
+		result.PathViolation = violation
+	}
+	return nil, result, fmt.Errorf("%s", errorMsg)
+}
+
+// isKilledError 判断命令是否因超时或被终止而结束
+func isKilledError(err error) bool {
+	if err == nil {
+		return false
+	}
+	errStr := err.Error()
+	return strings.Contains(errStr, "killed") ||
+		strings.Contains(errStr, "timed out") ||
+		strings.Contains(errStr, "context deadline exceeded")
+}
+
+// registerSpilledOutput 将溢出到文件的完整输出登记为已结束任务，返回任务ID
+// 文件由任务接管，随kill_shell或保留策略一并清理
+func (s *MCPServer) registerSpilledOutput(ctx context.Context, args BashArguments, shellType executor.ShellType, startTime time.Time, result executor.ExecResult, execErr error) string {
+	taskID := fmt.Sprintf("bash_%s", uuid.New().String())
+	exitCode := result.ExitCode
+	task := &BackgroundTask{
+		ID:          taskID,
+		Command:     args.Command,
+		Description: args.Description,
+		Shell:       shellType,
+		Cwd:         args.Cwd,
+		Output:      result.Output,
+		Chunks:      result.Chunks,
+		Status:      "completed",
+		StartTime:   startTime,
+		EndTime:     time.Now(),
+		ExitCode:    &exitCode,
+		TempFile:    result.OutputFile,
+		Truncated:   true,
+		Owner:       ownerFrom(ctx),
+	}
+	if execErr != nil {
+		task.Status = "failed"
+		task.Error = execErr.Error()
+	}
+
+	s.mutex.Lock()
+	s.backgroundTasks[taskID] = task
+	s.mutex.Unlock()
+	return taskID
+}
+
+// executeInSession 在持久化会话中执行命令
+func (s *MCPServer) executeInSession(ctx context.Context, args BashArguments, maxOutputBytes int64) (*mcp.CallToolResult, BashResult, error) {
+	errorResult := func(errorMsg string) (*mcp.CallToolResult, BashResult, error) {
+		return nil, BashResult{
+			ExitCode:  1,
+			Output:    errorMsg,
+			SessionID: args.SessionID,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+
+	if len(args.SessionID) > s.cfg().Execution.MaxIDLength {
+		return errorResult(fmt.Sprintf("session_id is too long (max %d characters), got: %d", s.cfg().Execution.MaxIDLength, len(args.SessionID)))
+	}
+	// 会话状态由Shell进程自身维护，以下参数与会话语义冲突
+	if args.RunInBackground {
+		return errorResult("run_in_background cannot be combined with session_id")
+	}
+	if args.Cwd != "" || len(args.Env) > 0 {
+		return errorResult("cwd and env cannot be combined with session_id; change them inside the session instead")
+	}
+	if args.Limits != nil {
+		return errorResult("limits cannot be combined with session_id; set them when opening the session instead")
+	}
+
+	// 其他连接的会话视为不存在
+	if !s.ownsSession(ownerFrom(ctx), args.SessionID) {
+		return errorResult(fmt.Sprintf("%s: %s", executor.ErrSessionNotFound, args.SessionID))
+	}
+	session, err := s.sessions.Get(args.SessionID)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+	if args.Shell != "" {
+		shellType, err := executor.ParseShellType(args.Shell)
+		if err != nil {
+			return errorResult(err.Error())
+		}
+		if shellType != session.Shell {
+			return errorResult(fmt.Sprintf("session %s uses shell %s, not %s", args.SessionID, session.Shell.String(), shellType.String()))
+		}
+	}
+
+	// 路径约束：相对路径相对于会话中之前的命令切换到的工作目录
+	paths, err := pathpolicy.New(s.cfg().Security.AllowedPaths, s.cfg().Security.BlockedPaths)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+	cwd, err := paths.CheckCommand(args.Command, session.Cwd())
+	if err != nil {
+		return s.pathRejected(ctx, args, err)
+	}
+	session.SetCwd(cwd)
+
+	logMsg := args.Description
+	if logMsg == "" {
+		logMsg = args.Command
+	}
+	fmt.Fprintf(os.Stderr, "Executing command in session %s: %s\n", args.SessionID, redact.String(logMsg))
+
+	startTime := time.Now()
+	auditRecord := auditCommand(ctx, "", args)
+	auditRecord.Shell = session.Shell.String()
+	auditRecord = s.auditStart(auditRecord, fmt.Sprintf("cmd_%s", uuid.New().String()), startTime)
+	result, err := session.Run(ctx, args.Command, time.Duration(args.Timeout)*time.Millisecond, maxOutputBytes)
+	shellID := ""
+	if result.OutputFile != "" {
+		shellID = s.registerSpilledOutput(ctx, args, session.Shell, startTime, result, err)
+	}
+	s.auditResultEnd(auditRecord, shellID, result, errors.Is(err, context.DeadlineExceeded), err)
+	if err != nil {
+		if errors.Is(err, executor.ErrSessionBusy) {
+			return errorResult(err.Error())
+		}
+
+		// 超时或Shell退出后会话不可再用，将其移除
+		s.closeSession(args.SessionID)
+		killed := errors.Is(err, context.DeadlineExceeded)
+		errorOutput := fmt.Sprintf("session command failed: %v", err)
+		if result.Output != "" {
+			errorOutput = fmt.Sprintf("%s\nError: %v", result.Output, err)
+		}
+		return nil, BashResult{
+			Output:     errorOutput,
+			Stdout:     result.Stdout,
+			Stderr:     result.Stderr,
+			ExitCode:   result.ExitCode,
+			Killed:     killed,
+			ShellID:    shellID,
+			Shell:      session.Shell.String(),
+			SessionID:  args.SessionID,
+			Truncated:  result.Truncated,
+			TotalBytes: result.TotalBytes,
+			OutputFile: result.OutputFile,
 		}, nil
 	}
+
+	return nil, BashResult{
+		Output:     result.Output,
+		Stdout:     result.Stdout,
+		Stderr:     result.Stderr,
+		ExitCode:   result.ExitCode,
+		ShellID:    shellID,
+		Shell:      session.Shell.String(),
+		SessionID:  args.SessionID,
+		Truncated:  result.Truncated,
+		TotalBytes: result.TotalBytes,
+		OutputFile: result.OutputFile,
+	}, nil
 }
 
 // BashOutputHandler 处理BashOutput工具调用 - 使用官方标准Handler签名
@@ -314,12 +864,45 @@ func (s *MCPServer) BashOutputHandler(ctx context.Context, req *mcp.CallToolRequ
 		}, fmt.Errorf("bash_id is required")
 	}
 
-	if len(args.BashID) > MaxBashIDLength {
-		errorMsg := fmt.Sprintf("bash_id is too long (max %d characters), got: %d", MaxBashIDLength, len(args.BashID))
+	if len(args.BashID) > s.cfg().Execution.MaxIDLength {
+		errorMsg := fmt.Sprintf("bash_id is too long (max %d characters), got: %d", s.cfg().Execution.MaxIDLength, len(args.BashID))
+		return nil, BashOutputResult{
+			Status: "failed",
+			Output: errorMsg,
+		}, fmt.Errorf("bash_id is too long (max %d characters), got: %d", s.cfg().Execution.MaxIDLength, len(args.BashID))
+	}
+
+	limit, err := s.resolveByteLimit("limit", args.Limit)
+	if err != nil {
+		errorMsg := err.Error()
+		return nil, BashOutputResult{
+			Status: "failed",
+			Output: errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+
+	if args.Since != nil && *args.Since < 0 {
+		errorMsg := fmt.Sprintf("since must be a non-negative byte offset, got: %d", *args.Since)
+		return nil, BashOutputResult{
+			Status: "failed",
+			Output: errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+
+	if err := s.requirePermissions(ctx, security.PermBashOutputRead); err != nil {
+		errorMsg := err.Error()
 		return nil, BashOutputResult{
 			Status: "failed",
 			Output: errorMsg,
-		}, fmt.Errorf("bash_id is too long (max %d characters), got: %d", MaxBashIDLength, len(args.BashID))
+		}, fmt.Errorf("%s", errorMsg)
+	}
+
+	if limitErr := s.allowCall(ctx, BudgetOutput); limitErr != nil {
+		return rateLimitedResult(limitErr), BashOutputResult{
+			Status:     "failed",
+			Output:     limitErr.Error(),
+			RetryAfter: limitErr.RetryAfter.Milliseconds(),
+		}, nil
 	}
 
 	// 先获取任务信息（短暂持锁），然后释放锁再进行文件I/O
@@ -329,7 +912,7 @@ func (s *MCPServer) BashOutputHandler(ctx context.Context, req *mcp.CallToolRequ
 	var tempFilePath string
 
 	s.mutex.RLock()
-	task, exists := s.backgroundTasks[args.BashID]
+	task, exists := s.ownedTask(ownerFrom(ctx), args.BashID)
 	if !exists {
 		s.mutex.RUnlock()
 		errorMsg := fmt.Sprintf("background task not found: %s", args.BashID)
@@ -347,16 +930,43 @@ func (s *MCPServer) BashOutputHandler(ctx context.Context, req *mcp.CallToolRequ
 		taskExitCode = &exitCode
 	}
 	tempFilePath = task.TempFile
+	start := task.ReadOffset
+	sink := task.Sink
+	chunks := task.Chunks
+	taskTruncated := task.Truncated
 	s.mutex.RUnlock()
 
+	if args.Since != nil {
+		start = *args.Since
+	}
+
 	// 在锁外部读取临时文件（避免持锁I/O导致的性能问题和潜在死锁）
-	output := taskOutput
-	if tempFilePath != "" {
-		if content, err := os.ReadFile(tempFilePath); err == nil {
-			output = string(content)
+	output, start, totalBytes := readOutputFrom(tempFilePath, taskOutput, start, limit)
+
+	// 任务运行中或本页已满时只返回完整的行，未写完的行留到下次读取
+	// 本页已满却没有换行时（超长行）原样返回，避免读取停滞
+	pageFull := int64(len(output)) >= limit
+	if taskStatus == "running" || pageFull {
+		if idx := strings.LastIndexByte(output, '\n'); idx >= 0 {
+			output = output[:idx+1]
+		} else if !pageFull {
+			output = ""
 		}
-		// 如果文件读取失败，使用内存中的输出
 	}
+	nextOffset := start + int64(len(output))
+
+	// 运行中的任务在读取文件之后获取分段，保证分段覆盖已读取的内容
+	if sink != nil && tempFilePath != "" {
+		chunks = sink.Chunks()
+	}
+	stdout, stderr := executor.SplitStreams(output, start, chunks)
+
+	// 记录隐式读取位置，只前进不后退
+	s.mutex.Lock()
+	if task, exists := s.ownedTask(ownerFrom(ctx), args.BashID); exists && nextOffset > task.ReadOffset {
+		task.ReadOffset = nextOffset
+	}
+	s.mutex.Unlock()
 
 	if args.Filter != "" {
 		// 使用正则表达式过滤输出
@@ -369,26 +979,70 @@ func (s *MCPServer) BashOutputHandler(ctx context.Context, req *mcp.CallToolRequ
 			}, fmt.Errorf("invalid filter pattern '%s': %v", args.Filter, err)
 		}
 
-		lines := strings.Split(output, "\n")
-		var filteredLines []string
-		for _, line := range lines {
-			if regex.MatchString(line) {
-				filteredLines = append(filteredLines, line)
-			}
-		}
-		output = strings.Join(filteredLines, "\n")
+		output = filterLines(regex, output)
+		stdout = filterLines(regex, stdout)
+		stderr = filterLines(regex, stderr)
 	}
 
 	result := BashOutputResult{
-		Output:   output,
-		Status:   taskStatus,
-		ExitCode: taskExitCode,
+		Output:     output,
+		Stdout:     stdout,
+		Stderr:     stderr,
+		Status:     taskStatus,
+		ExitCode:   taskExitCode,
+		NextOffset: nextOffset,
+		Truncated:  nextOffset < totalBytes,
+		TotalBytes: totalBytes,
+	}
+	if taskTruncated {
+		result.OutputFile = tempFilePath
 	}
 
 	// 成功返回 - 使用结构化输出
 	return nil, result, nil
 }
 
+// filterLines 只保留匹配正则表达式的行
+func filterLines(regex *regexp.Regexp, text string) string {
+	lines := strings.Split(text, "\n")
+	var filteredLines []string
+	for _, line := range lines {
+		if regex.MatchString(line) {
+			filteredLines = append(filteredLines, line)
+		}
+	}
+	return strings.Join(filteredLines, "\n")
+}
+
+// readOutputFrom 从指定字节偏移读取最多 limit 字节的任务输出，优先读取临时文件，失败时使用内存中的输出
+// 偏移超出输出长度时截断到末尾，返回读取内容、实际起始偏移和输出总字节数
+func readOutputFrom(tempFilePath, memoryOutput string, start, limit int64) (string, int64, int64) {
+	if tempFilePath != "" {
+		if f, err := os.Open(tempFilePath); err == nil {
+			defer f.Close()
+			if info, err := f.Stat(); err == nil {
+				total := info.Size()
+				if start > total {
+					start = total
+				}
+				if _, err := f.Seek(start, io.SeekStart); err == nil {
+					if content, err := io.ReadAll(io.LimitReader(f, limit)); err == nil {
+						return string(content), start, total
+					}
+				}
+			}
+		}
+		// 如果文件读取失败，使用内存中的输出
+	}
+
+	total := int64(len(memoryOutput))
+	if start > total {
+		start = total
+	}
+	end := min(start+limit, total)
+	return memoryOutput[start:end], start, total
+}
+
 // KillShellHandler 处理KillShell工具调用 - 使用官方标准Handler签名
 func (s *MCPServer) KillShellHandler(ctx context.Context, req *mcp.CallToolRequest, args KillShellArguments) (*mcp.CallToolResult, KillShellResult, error) {
 	if args.ShellID == "" {
@@ -399,24 +1053,86 @@ func (s *MCPServer) KillShellHandler(ctx context.Context, req *mcp.CallToolReque
 		}, fmt.Errorf("%s", errorMsg)
 	}
 
-	if len(args.ShellID) > MaxShellIDLength {
-		errorMsg := fmt.Sprintf("shell_id is too long (max %d characters), got: %d", MaxShellIDLength, len(args.ShellID))
+	if len(args.ShellID) > s.cfg().Execution.MaxIDLength {
+		errorMsg := fmt.Sprintf("shell_id is too long (max %d characters), got: %d", s.cfg().Execution.MaxIDLength, len(args.ShellID))
+		return nil, KillShellResult{
+			ShellID: args.ShellID,
+			Message: errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+
+	mode, ok := executor.ParseKillMode(args.Mode)
+	if !ok {
+		errorMsg := fmt.Sprintf("invalid mode: %s (expected graceful or force)", args.Mode)
+		return nil, KillShellResult{
+			ShellID: args.ShellID,
+			Message: errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+	grace := s.cfg().Execution.KillGracePeriod
+	if args.GraceMs < 0 || args.GraceMs > s.cfg().Execution.MaxTimeout {
+		errorMsg := fmt.Sprintf("grace_ms must be between 0 and %d, got: %d", s.cfg().Execution.MaxTimeout, args.GraceMs)
 		return nil, KillShellResult{
 			ShellID: args.ShellID,
 			Message: errorMsg,
 		}, fmt.Errorf("%s", errorMsg)
+	} else if args.GraceMs > 0 {
+		grace = time.Duration(args.GraceMs) * time.Millisecond
 	}
 
+	// kill_shell.any 可以终止其他连接的任务，否则需要 kill_shell.own 且只能看到自己的任务
+	killAny := s.granted(ctx, security.PermKillShellAny)
+	if !killAny {
+		if err := s.requirePermissions(ctx, security.PermKillShellOwn); err != nil {
+			errorMsg := err.Error()
+			return nil, KillShellResult{
+				ShellID: args.ShellID,
+				Message: errorMsg,
+			}, fmt.Errorf("%s", errorMsg)
+		}
+	}
+
+	// 终止任务只会释放资源，不受限流约束：轮询用完输出预算时仍然可以停止失控的任务
+
 	s.mutex.Lock()
-	task, exists := s.backgroundTasks[args.ShellID]
+	_, exists := s.ownedTask(ownerFrom(ctx), args.ShellID)
+	if !exists && killAny {
+		_, exists = s.backgroundTasks[args.ShellID]
+	}
+	s.mutex.Unlock()
 	if !exists {
-		s.mutex.Unlock()
 		return nil, KillShellResult{
 			ShellID: args.ShellID,
 			Message: fmt.Sprintf("background task not found: %s", args.ShellID),
 		}, fmt.Errorf("background task not found: %s", args.ShellID)
 	}
 
+	stage, err := s.killTask(ctx, args.ShellID, mode, grace)
+	if err != nil {
+		return nil, KillShellResult{
+			ShellID: args.ShellID,
+			Message: err.Error(),
+		}, err
+	}
+
+	// 成功返回 - 使用结构化输出
+	return nil, KillShellResult{
+		Message: fmt.Sprintf("Background task %s killed successfully", args.ShellID),
+		ShellID: args.ShellID,
+		Stage:   string(stage),
+	}, nil
+}
+
+// killTask 终止后台任务及其进程树并从任务列表中移除，返回结束进程的阶段
+// 不做权限检查和限流，供 kill_shell 校验通过后以及连接断开、服务器关闭时使用；ctx 只用于审计记录
+func (s *MCPServer) killTask(ctx context.Context, id string, mode executor.KillMode, grace time.Duration) (executor.KillStage, error) {
+	s.mutex.Lock()
+	task, exists := s.backgroundTasks[id]
+	if !exists {
+		s.mutex.Unlock()
+		return "", fmt.Errorf("background task not found: %s", id)
+	}
+
 	// 获取需要的信息，然后释放锁
 	process := task.Process
 	cancelFunc := task.Cancel
@@ -428,79 +1144,322 @@ func (s *MCPServer) KillShellHandler(ctx context.Context, req *mcp.CallToolReque
 	if wasRunning {
 		task.Status = "killed"
 		task.Error = "Task killed by user request"
+		task.EndTime = time.Now()
 	}
 
+	// 记录终止请求的发起者，任务自身的结束记录在其执行协程退出时写入
+	killRecord := auditCommand(ctx, audit.EventKill, BashArguments{Command: task.Command, Description: task.Description})
+	killRecord.ID, killRecord.TaskID = id, id
+
 	// 从后台任务列表中移除
-	delete(s.backgroundTasks, args.ShellID)
+	delete(s.backgroundTasks, id)
 	s.mutex.Unlock()
+	s.auditRecord(killRecord)
 
 	// 在锁外部执行实际的进程终止和资源清理
-	// 优先使用 Job Object 终止整个进程树
-	if job != nil && runtime.GOOS == "windows" {
-		fmt.Fprintf(os.Stderr, "Terminating process tree using Job Object...\n")
-		if err := job.Terminate(1); err != nil {
-			fmt.Fprintf(os.Stderr, "Note: Job.Terminate failed: %v, trying other methods\n", err)
-		} else {
-			fmt.Fprintf(os.Stderr, "Successfully terminated process tree using Job Object\n")
-			// 关闭 Job Object
+	// graceful 模式先给进程树机会自行退出（如开发服务器、数据库保存状态）
+	var stage executor.KillStage
+	stopped := false
+	if process != nil && mode == executor.KillGraceful {
+		fmt.Fprintf(os.Stderr, "Stopping process tree with PID %d gracefully (grace period %v)...\n", process.Pid, grace)
+		stage, stopped = executor.GracefulStop(process, grace)
+	}
+
+	switch {
+	case stopped:
+		fmt.Fprintf(os.Stderr, "Process tree stopped at stage %s\n", stage)
+		if job != nil && runtime.GOOS == "windows" {
+			// Shell已退出，关闭 Job Object 时终止其中残留的子进程
 			job.Close()
-			// 清理临时文件
-			if tempFilePath != "" {
-				if err := os.Remove(tempFilePath); err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: failed to remove temp file %s: %v\n", tempFilePath, err)
-				}
-			}
-			fmt.Fprintf(os.Stderr, "Background task %s killed successfully\n", args.ShellID)
-			return nil, KillShellResult{
-				Message: fmt.Sprintf("Background task %s killed successfully", args.ShellID),
-				ShellID: args.ShellID,
-			}, nil
+		}
+	case job != nil && runtime.GOOS == "windows" && job.Terminate(1) == nil:
+		// 优先使用 Job Object 终止整个进程树
+		fmt.Fprintf(os.Stderr, "Successfully terminated process tree using Job Object\n")
+		job.Close()
+		stage = executor.StageKill
+	case process != nil:
+		stage = executor.StageKill
+		// 回退方案：终止整个进程树，确保所有子进程（如pnpm启动的node/vite）都被终止
+		// POSIX 向命令的进程组发送 SIGKILL；Windows 使用 taskkill /T
+		if err := executor.KillProcessTree(process); errors.Is(err, os.ErrProcessDone) {
+			stage = executor.StageExited
+		} else if err != nil {
+			// 进程可能已经退出，忽略错误
+			fmt.Fprintf(os.Stderr, "Note: process tree kill returned: %v (may have already exited)\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Successfully killed process tree with PID %d\n", process.Pid)
 		}
 	}
 
-	// 回退方案：先调用Cancel函数取消Context
+	// 取消Context，通知执行协程收尾
 	if cancelFunc != nil {
 		cancelFunc()
 	}
 
-	// 强制终止进程树（Windows需要特殊处理）
-	if process != nil && runtime.GOOS == "windows" {
-		// 在Windows上使用taskkill终止整个进程树
-		// 这样可以确保所有子进程（如pnpm启动的node/vite）都被终止
-		killCmd := exec.Command("taskkill", "/F", "/T", "/PID", fmt.Sprintf("%d", process.Pid))
-		if err := killCmd.Run(); err != nil {
-			// 如果taskkill失败，尝试使用Go的Kill方法
-			fmt.Fprintf(os.Stderr, "Note: taskkill failed: %v, trying process.Kill()\n", err)
-			if err := process.Kill(); err != nil {
-				// 进程可能已经退出，忽略错误
-				fmt.Fprintf(os.Stderr, "Note: process kill returned: %v (may have already exited)\n", err)
-			}
-		} else {
-			fmt.Fprintf(os.Stderr, "Successfully killed process tree with PID %d\n", process.Pid)
+	// 清理临时文件（无论任务状态如何）
+	if tempFilePath != "" {
+		// 命令在终止进程树期间退出时，执行协程可能已经删除了临时文件
+		if err := os.Remove(tempFilePath); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove temp file %s: %v\n", tempFilePath, err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Background task %s killed successfully (stage %s)\n", id, stage)
+	return stage, nil
+}
+
+// ListShellsHandler 处理ListShells工具调用，列出后台任务
+func (s *MCPServer) ListShellsHandler(ctx context.Context, req *mcp.CallToolRequest, args ListShellsArguments) (*mcp.CallToolResult, ListShellsResult, error) {
+	switch args.Status {
+	case "", "running", "completed", "failed", "killed":
+	default:
+		errorMsg := fmt.Sprintf("invalid status filter: %s (expected running, completed, failed or killed)", args.Status)
+		return nil, ListShellsResult{}, fmt.Errorf("%s", errorMsg)
+	}
+
+	sortBy := args.SortBy
+	if sortBy == "" {
+		sortBy = "start_time"
+	}
+	switch sortBy {
+	case "start_time", "duration", "status", "id":
+	default:
+		errorMsg := fmt.Sprintf("invalid sort_by: %s (expected start_time, duration, status or id)", args.SortBy)
+		return nil, ListShellsResult{}, fmt.Errorf("%s", errorMsg)
+	}
+
+	order := args.Order
+	if order == "" {
+		order = "desc"
+	}
+	if order != "asc" && order != "desc" {
+		errorMsg := fmt.Sprintf("invalid order: %s (expected asc or desc)", args.Order)
+		return nil, ListShellsResult{}, fmt.Errorf("%s", errorMsg)
+	}
+
+	if err := s.requirePermissions(ctx, security.PermBashOutputRead); err != nil {
+		return nil, ListShellsResult{}, err
+	}
+	if limitErr := s.allowCall(ctx, BudgetOutput); limitErr != nil {
+		return rateLimitedResult(limitErr), ListShellsResult{
+			Shells:     []ShellInfo{},
+			RetryAfter: limitErr.RetryAfter.Milliseconds(),
+		}, nil
+	}
+	// 拥有 kill_shell.any 时列出所有连接的任务，以便找到要终止的任务
+	listAll := s.granted(ctx, security.PermKillShellAny)
+
+	// 持锁复制任务信息，文件大小在锁外获取
+	now := time.Now()
+	owner := ownerFrom(ctx)
+	shells := make([]ShellInfo, 0)
+	tempFiles := make([]string, 0)
+
+	s.mutex.RLock()
+	for _, task := range s.backgroundTasks {
+		if task.Owner != owner && !listAll {
+			continue
+		}
+		if args.Status != "" && task.Status != args.Status {
+			continue
+		}
+
+		end := task.EndTime
+		if end.IsZero() {
+			end = now
 		}
-	} else if process != nil {
-		// 非 Windows 系统，直接使用 Kill
-		if err := process.Kill(); err != nil {
-			fmt.Fprintf(os.Stderr, "Note: process kill returned: %v (may have already exited)\n", err)
+		info := ShellInfo{
+			ID:          task.ID,
+			Command:     task.Command,
+			Description: task.Description,
+			Status:      task.Status,
+			StartTime:   task.StartTime,
+			DurationMs:  end.Sub(task.StartTime).Milliseconds(),
+			OutputSize:  int64(len(task.Output)),
 		}
+		if task.Shell != executor.Unknown {
+			info.Shell = task.Shell.String()
+		}
+		if task.ExitCode != nil {
+			exitCode := *task.ExitCode
+			info.ExitCode = &exitCode
+		}
+		if task.Process != nil {
+			info.PID = task.Process.Pid
+		}
+		shells = append(shells, info)
+		tempFiles = append(tempFiles, task.TempFile)
 	}
+	s.mutex.RUnlock()
 
-	// 清理临时文件（无论任务状态如何）
-	if tempFilePath != "" {
-		if err := os.Remove(tempFilePath); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to remove temp file %s: %v\n", tempFilePath, err)
+	for i, tempFilePath := range tempFiles {
+		if tempFilePath == "" {
+			continue
+		}
+		if stat, err := os.Stat(tempFilePath); err == nil {
+			shells[i].OutputSize = stat.Size()
 		}
 	}
 
-	fmt.Fprintf(os.Stderr, "Background task %s killed successfully\n", args.ShellID)
+	sort.SliceStable(shells, func(i, j int) bool {
+		a, b := shells[i], shells[j]
+		if order == "desc" {
+			a, b = b, a
+		}
+		switch sortBy {
+		case "duration":
+			return a.DurationMs < b.DurationMs
+		case "status":
+			return a.Status < b.Status
+		case "id":
+			return a.ID < b.ID
+		default:
+			return a.StartTime.Before(b.StartTime)
+		}
+	})
 
-	// 成功返回 - 使用结构化输出
-	return nil, KillShellResult{
-		Message: fmt.Sprintf("Background task %s killed successfully", args.ShellID),
-		ShellID: args.ShellID,
+	return nil, ListShellsResult{
+		Shells: shells,
+		Total:  len(shells),
+	}, nil
+}
+
+// SessionOpenHandler 处理SessionOpen工具调用，启动持久化Shell会话
+func (s *MCPServer) SessionOpenHandler(ctx context.Context, req *mcp.CallToolRequest, args SessionOpenArguments) (*mcp.CallToolResult, SessionOpenResult, error) {
+	if err := s.requirePermissions(ctx, security.PermBashExecute); err != nil {
+		errorMsg := err.Error()
+		return nil, SessionOpenResult{
+			Message: errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+	if limitErr := s.allowCall(ctx, BudgetExecute); limitErr != nil {
+		return rateLimitedResult(limitErr), SessionOpenResult{
+			Message:    limitErr.Error(),
+			RetryAfter: limitErr.RetryAfter.Milliseconds(),
+		}, nil
+	}
+
+	shellType, err := s.resolveShell(args.Shell)
+	if err != nil {
+		errorMsg := err.Error()
+		return nil, SessionOpenResult{
+			Message: errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+
+	paths, err := pathpolicy.New(s.cfg().Security.AllowedPaths, s.cfg().Security.BlockedPaths)
+	if err != nil {
+		errorMsg := err.Error()
+		return nil, SessionOpenResult{
+			Message: errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+	resourceLimits, err := s.resolveLimits(args.Limits)
+	if err != nil {
+		errorMsg := err.Error()
+		return nil, SessionOpenResult{
+			Message: errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+	opts := executor.ExecOptions{Env: args.Env, Limits: resourceLimits}
+	if workDir := cmp.Or(args.Cwd, s.cfg().Execution.WorkingDir); workDir != "" {
+		dir, err := security.ValidateWorkingDir(workDir, paths)
+		if err != nil {
+			errorMsg := err.Error()
+			return nil, SessionOpenResult{
+				Message: errorMsg,
+			}, fmt.Errorf("%s", errorMsg)
+		}
+		opts.Dir = dir
+	}
+	if err := security.ValidateEnv(args.Env, s.cfg().Security.Mode == policy.ModeAllowlist); err != nil {
+		errorMsg := err.Error()
+		return nil, SessionOpenResult{
+			Message: errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+
+	shellPath := s.shellExecutor.GetShellPath(shellType)
+	if shellPath == "" {
+		shellPath = shellType.String()
+	}
+
+	session, err := s.sessions.Open(shellPath, shellType, opts)
+	if err != nil {
+		errorMsg := err.Error()
+		return nil, SessionOpenResult{
+			Shell:   shellType.String(),
+			Message: errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+	session.Description = args.Description
+	s.mutex.Lock()
+	s.sessionOwners[session.ID] = ownerFrom(ctx)
+	s.mutex.Unlock()
+
+	fmt.Fprintf(os.Stderr, "Session %s opened with %s (PID %d)\n", session.ID, shellType.String(), session.Pid())
+
+	return nil, SessionOpenResult{
+		SessionID: session.ID,
+		Shell:     shellType.String(),
+		Pid:       session.Pid(),
+		Message:   fmt.Sprintf("Session started with ID: %s", session.ID),
+	}, nil
+}
+
+// SessionCloseHandler 处理SessionClose工具调用，终止持久化Shell会话
+func (s *MCPServer) SessionCloseHandler(ctx context.Context, req *mcp.CallToolRequest, args SessionCloseArguments) (*mcp.CallToolResult, SessionCloseResult, error) {
+	if args.SessionID == "" {
+		errorMsg := "session_id is required"
+		return nil, SessionCloseResult{
+			Message: errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+
+	if len(args.SessionID) > s.cfg().Execution.MaxIDLength {
+		errorMsg := fmt.Sprintf("session_id is too long (max %d characters), got: %d", s.cfg().Execution.MaxIDLength, len(args.SessionID))
+		return nil, SessionCloseResult{
+			SessionID: args.SessionID,
+			Message:   errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+
+	if err := s.requirePermissions(ctx, security.PermBashExecute); err != nil {
+		errorMsg := err.Error()
+		return nil, SessionCloseResult{
+			SessionID: args.SessionID,
+			Message:   errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+
+	err := fmt.Errorf("%w: %s", executor.ErrSessionNotFound, args.SessionID)
+	if s.ownsSession(ownerFrom(ctx), args.SessionID) {
+		err = s.closeSession(args.SessionID)
+	}
+	if err != nil {
+		errorMsg := err.Error()
+		return nil, SessionCloseResult{
+			SessionID: args.SessionID,
+			Message:   errorMsg,
+		}, fmt.Errorf("%s", errorMsg)
+	}
+
+	fmt.Fprintf(os.Stderr, "Session %s closed\n", args.SessionID)
+
+	return nil, SessionCloseResult{
+		Message:   fmt.Sprintf("Session %s closed successfully", args.SessionID),
+		SessionID: args.SessionID,
 	}, nil
 }
 
+// closeSession 关闭会话并移除其归属记录
+func (s *MCPServer) closeSession(id string) error {
+	s.mutex.Lock()
+	delete(s.sessionOwners, id)
+	s.mutex.Unlock()
+	return s.sessions.Close(id)
+}
+
 // executeBackgroundCommand 执行后台命令
 func (s *MCPServer) executeBackgroundCommand(task *BackgroundTask, timeout int) {
 	// 后台任务不应该有超时限制（timeout参数保留用于兼容性，但设为0表示无限制）
@@ -510,12 +1469,17 @@ func (s *MCPServer) executeBackgroundCommand(task *BackgroundTask, timeout int)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel() // 确保在函数退出时释放资源
 
+	// 任务结束（包括启动失败）时写入审计结束记录
+	var sink *outputSink
+	defer func() { s.auditTaskEnd(task, sink) }()
+
 	// 创建临时文件来存储输出（使用更具描述性的前缀）
 	tempFile, err := os.CreateTemp("", "mcp_bash_output_*.txt")
 	if err != nil {
 		s.mutex.Lock()
 		task.Status = "failed"
 		task.Error = fmt.Sprintf("Failed to create temp file: %v", err)
+		task.EndTime = time.Now()
 		s.mutex.Unlock()
 		return
 	}
@@ -536,29 +1500,47 @@ func (s *MCPServer) executeBackgroundCommand(task *BackgroundTask, timeout int)
 		}
 	}
 
-	// 获取Shell执行器的首选Shell路径
-	shellPath := "powershell" // 默认值
-	if shellExec, ok := s.shellExecutor.(*executor.ShellExecutor); ok {
-		if path := shellExec.GetShellPath(shellExec.GetPreferredShell()); path != "" {
-			shellPath = path
-		}
+	// 获取任务指定Shell的路径，未检测到路径时按名称交给系统PATH解析
+	shellType := task.Shell
+	shellPath := s.shellExecutor.GetShellPath(shellType)
+	if shellPath == "" {
+		shellPath = shellType.String()
 	}
 
 	// 在goroutine外部创建cmd，以便超时处理时能访问
-	// 强制设置控制台输出编码为UTF-8 (CodePage 65001)
-	cmdArgs := fmt.Sprintf("[Console]::OutputEncoding=[System.Text.Encoding]::UTF8; %s", task.Command)
-	cmd := exec.CommandContext(ctx, shellPath, "-NoProfile", "-Command", cmdArgs)
+	// 参数由Shell类型统一构建（PowerShell会强制UTF-8输出编码），并应用工作目录和环境变量
+	cmd, err := executor.BuildCommand(ctx, shellPath, shellType, task.Command, executor.ExecOptions{
+		Dir:    task.Cwd,
+		Env:    task.Env,
+		Limits: task.Limits,
+	})
+	if err != nil {
+		s.mutex.Lock()
+		task.Status = "failed"
+		task.Error = err.Error()
+		task.EndTime = time.Now()
+		s.mutex.Unlock()
+		os.Remove(tempFilePath)
+		if job != nil {
+			job.Close()
+		}
+		return
+	}
 
 	// 加锁保护任务字段赋值
+	// 输出写入器按行写入临时文件，并记录各流的分段
 	s.mutex.Lock()
+	sink = newOutputSink(tempFilePath, task.StderrPrefix)
 	task.TempFile = tempFilePath
+	task.Sink = sink
 	task.Cancel = cancel
 	task.Job = job
+	// kill_shell 在取消函数设置之前到达时，任务已标记为终止，这里补上取消
+	if task.Status == "killed" {
+		cancel()
+	}
 	s.mutex.Unlock()
 
-	// 使用同步机制保护文件写入
-	writeMutex := sync.Mutex{}
-
 	// 启动命令并实时写入临时文件
 	done := make(chan struct {
 		err      error
@@ -568,7 +1550,7 @@ func (s *MCPServer) executeBackgroundCommand(task *BackgroundTask, timeout int)
 	// 使用WaitGroup等待所有goroutine完成
 	var wg sync.WaitGroup
 
-	go s.executeCommandWithTask(cmd, task, tempFilePath, &writeMutex, &wg, done)
+	go s.executeCommandWithTask(cmd, task, sink, &wg, done)
 
 	// 等待命令完成（后台任务无超时限制）
 	select {
@@ -582,7 +1564,7 @@ func (s *MCPServer) executeBackgroundCommand(task *BackgroundTask, timeout int)
 }
 
 // executeCommand 执行命令并处理输出
-func (s *MCPServer) executeCommandWithTask(cmd *exec.Cmd, task *BackgroundTask, tempFilePath string, writeMutex *sync.Mutex, wg *sync.WaitGroup, done chan<- struct {
+func (s *MCPServer) executeCommandWithTask(cmd *exec.Cmd, task *BackgroundTask, sink *outputSink, wg *sync.WaitGroup, done chan<- struct {
 	err      error
 	exitCode int
 }) {
@@ -594,25 +1576,18 @@ func (s *MCPServer) executeCommandWithTask(cmd *exec.Cmd, task *BackgroundTask,
 		return
 	}
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		done <- struct {
-			err      error
-			exitCode int
-		}{fmt.Errorf("failed to create stdout pipe: %w", err), 1}
-		return
-	}
+	// 输出经 io.Pipe 交给读取协程：Wait 会等到Shell及其子进程关闭输出管道、全部输出复制完毕才返回，
+	// 子进程在Shell退出后仍持有管道时最多再等待 done_wait_timeout
+	stdout, stdoutWriter := io.Pipe()
+	stderr, stderrWriter := io.Pipe()
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+	cmd.WaitDelay = s.cfg().Execution.DoneWaitTimeout
 
-	stderr, err := cmd.StderrPipe()
+	release, err := resources.Start(cmd, task.Limits)
 	if err != nil {
-		done <- struct {
-			err      error
-			exitCode int
-		}{fmt.Errorf("failed to create stderr pipe: %w", err), 1}
-		return
-	}
-
-	if err := cmd.Start(); err != nil {
+		stdoutWriter.Close()
+		stderrWriter.Close()
 		done <- struct {
 			err      error
 			exitCode int
@@ -637,16 +1612,25 @@ func (s *MCPServer) executeCommandWithTask(cmd *exec.Cmd, task *BackgroundTask,
 
 	// 启动输出读取goroutine
 	wg.Add(2)
-	go s.readOutputPipe(stdout, tempFilePath, writeMutex, wg)
-	go s.readErrorPipe(stderr, tempFilePath, writeMutex, wg)
+	go s.readOutputPipe(stdout, executor.StreamStdout, sink, wg)
+	go s.readOutputPipe(stderr, executor.StreamStderr, sink, wg)
 
 	// 等待命令完成
 	cmdErr := cmd.Wait()
+	if errors.Is(cmdErr, exec.ErrWaitDelay) {
+		// 命令已成功退出，只是它启动的子进程仍持有输出管道
+		cmdErr = nil
+	}
 	finalExitCode := -1
 	if cmd.ProcessState != nil {
 		finalExitCode = cmd.ProcessState.ExitCode()
 	}
+	// 释放资源限制，残留的子进程随之终止
+	release()
 
+	// 已复制的输出全部交给读取协程后才结束任务
+	stdoutWriter.Close()
+	stderrWriter.Close()
 	wg.Wait()
 	done <- struct {
 		err      error
@@ -654,46 +1638,17 @@ func (s *MCPServer) executeCommandWithTask(cmd *exec.Cmd, task *BackgroundTask,
 	}{cmdErr, finalExitCode}
 }
 
-// readOutputPipe 读取stdout并写入临时文件
-func (s *MCPServer) readOutputPipe(stdout io.ReadCloser, tempFilePath string, writeMutex *sync.Mutex, wg *sync.WaitGroup) {
-	defer wg.Done()
-	scanner := bufio.NewScanner(stdout)
-	for scanner.Scan() {
-		line := scanner.Text()
-		writeMutex.Lock()
-		// 每次写入都重新打开文件，以避免长时间持有文件锁
-		f, err := os.OpenFile(tempFilePath, os.O_APPEND|os.O_WRONLY, 0644)
-		if err == nil {
-			if _, err := f.WriteString(line + "\n"); err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to write to temp file: %v\n", err)
-			}
-			f.Close()
-		} else {
-			fmt.Fprintf(os.Stderr, "Failed to open temp file for writing: %v\n", err)
-		}
-		writeMutex.Unlock()
-	}
-}
-
-// readErrorPipe 读取stderr并写入临时文件
-func (s *MCPServer) readErrorPipe(stderr io.ReadCloser, tempFilePath string, writeMutex *sync.Mutex, wg *sync.WaitGroup) {
+// readOutputPipe 逐行读取stdout或stderr并写入输出写入器
+func (s *MCPServer) readOutputPipe(pipe io.ReadCloser, stream string, sink *outputSink, wg *sync.WaitGroup) {
 	defer wg.Done()
-	scanner := bufio.NewScanner(stderr)
+	scanner := bufio.NewScanner(pipe)
 	for scanner.Scan() {
-		line := scanner.Text()
-		writeMutex.Lock()
-		// 每次写入都重新打开文件，以避免长时间持有文件锁
-		f, err := os.OpenFile(tempFilePath, os.O_APPEND|os.O_WRONLY, 0644)
-		if err == nil {
-			if _, err := f.WriteString("ERROR: " + line + "\n"); err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to write to temp file: %v\n", err)
-			}
-			f.Close()
-		} else {
-			fmt.Fprintf(os.Stderr, "Failed to open temp file for writing: %v\n", err)
+		if err := sink.WriteLine(stream, scanner.Text()); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
 		}
-		writeMutex.Unlock()
 	}
+	// 扫描出错（如单行过长）时丢弃剩余输出，避免命令因管道写满而阻塞
+	io.Copy(io.Discard, pipe)
 }
 
 // handleCommandCompletion 处理命令正常完成
@@ -704,13 +1659,13 @@ func (s *MCPServer) handleCommandCompletion(task *BackgroundTask, result struct
 	execErr := result.err
 	actualExitCode := result.exitCode
 
-	// 读取完整的输出内容
-	// 使用 OpenFile 和 ReadAll 确保在读取时不被写入锁阻塞（最好加个重试机制，但目前先简单处理）
-	outputContent, readErr := os.ReadFile(tempFilePath)
+	// 读取输出内容，超出上限时只在内存中保留首尾
+	outputContent, truncated, readErr := loadTaskOutput(tempFilePath, task.MaxOutputBytes)
 	if readErr != nil {
 		s.mutex.Lock()
 		task.Status = "failed"
 		task.Error = fmt.Sprintf("Failed to read output file: %v", readErr)
+		task.EndTime = time.Now()
 		exitCode := -1
 		task.ExitCode = &exitCode
 		task.TempFile = "" // 清除临时文件路径
@@ -723,25 +1678,52 @@ func (s *MCPServer) handleCommandCompletion(task *BackgroundTask, result struct
 	}
 
 	s.mutex.Lock()
-	task.Output = string(outputContent)
-	if execErr != nil {
+	task.Output = outputContent
+	task.Truncated = truncated
+	if task.Sink != nil {
+		task.Chunks = task.Sink.Chunks()
+		task.Sink = nil
+	}
+	switch {
+	case task.Status == "killed":
+		// kill_shell 终止进程树期间命令已退出，保留终止状态
+	case execErr != nil:
 		task.Status = "failed"
 		task.Error = execErr.Error()
-	} else {
+	default:
 		task.Status = "completed"
 	}
 	task.ExitCode = &actualExitCode
-	task.TempFile = "" // 清除临时文件路径，表示内容已加载到内存
+	task.EndTime = time.Now()
+	if !truncated {
+		task.TempFile = "" // 清除临时文件路径，表示内容已加载到内存
+	}
 	s.mutex.Unlock()
 
-	// 删除临时文件（内容已保存到task.Output）
-	if tempFilePath != "" {
-		if err := os.Remove(tempFilePath); err != nil {
+	// 删除临时文件（内容已保存到task.Output）；被截断时保留文件供分页读取
+	if tempFilePath != "" && !truncated {
+		if err := os.Remove(tempFilePath); err != nil && !os.IsNotExist(err) {
 			fmt.Fprintf(os.Stderr, "Warning: failed to remove temp file %s: %v\n", tempFilePath, err)
 		}
 	}
 }
 
+// loadTaskOutput 读取任务输出文件，超出 limit 时只保留首尾（limit <= 0 表示不限制）
+// 返回的 truncated 为true时调用方应保留文件，以便分页读取完整输出
+func loadTaskOutput(tempFilePath string, limit int64) (string, bool, error) {
+	f, err := os.Open(tempFilePath)
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+
+	buffer := executor.NewHeadTailBuffer(limit)
+	if _, err := io.Copy(buffer, f); err != nil {
+		return "", false, err
+	}
+	return buffer.String(), buffer.Truncated(), nil
+}
+
 // handleCommandCancellation 处理命令被取消（通过kill_shell）
 func (s *MCPServer) handleCommandCancellation(task *BackgroundTask, cmd *exec.Cmd, tempFilePath string, done chan struct {
 	err      error
@@ -760,15 +1742,9 @@ func (s *MCPServer) handleCommandCancellation(task *BackgroundTask, cmd *exec.Cm
 				fmt.Fprintf(os.Stderr, "Note: Job.Terminate failed in cancellation: %v\n", err)
 			}
 			job.Close()
-		} else if runtime.GOOS == "windows" {
-			// 回退到 taskkill
-			killCmd := exec.Command("taskkill", "/F", "/T", "/PID", fmt.Sprintf("%d", cmd.Process.Pid))
-			if err := killCmd.Run(); err != nil {
-				fmt.Fprintf(os.Stderr, "Note: taskkill failed in cancellation: %v, trying process.Kill()\n", err)
-				cmd.Process.Kill()
-			}
 		} else {
-			cmd.Process.Kill()
+			// kill_shell 已按宽限期终止进程树，这里强制终止可能残留的进程
+			executor.KillProcessTree(cmd.Process)
 		}
 	}
 	// 等待输出 goroutine 完成后再关闭文件
@@ -776,29 +1752,35 @@ func (s *MCPServer) handleCommandCancellation(task *BackgroundTask, cmd *exec.Cm
 	// 接收 done 结果，避免 executeCommand 的发送长期占用（带短超时防止永久阻塞）
 	select {
 	case <-done:
-	case <-time.After(DoneChannelTimeout):
+	case <-time.After(s.cfg().Execution.DoneWaitTimeout):
 	}
 
-	// 读取已有的输出
+	// 读取已有的输出，超出上限时只在内存中保留首尾
 	var outputStr string
+	truncated := false
 	if tempFilePath != "" {
-		outputContent, _ := os.ReadFile(tempFilePath)
-		if len(outputContent) > 0 {
-			outputStr = string(outputContent)
-		}
+		outputStr, truncated, _ = loadTaskOutput(tempFilePath, task.MaxOutputBytes)
 	}
 
 	s.mutex.Lock()
 	task.Status = "killed"
 	task.Error = "Task was cancelled by user"
+	task.EndTime = time.Now()
 	exitCode := -1
 	task.ExitCode = &exitCode
 	task.Output = outputStr
-	task.TempFile = "" // 清除临时文件路径，表示内容已加载到内存
+	task.Truncated = truncated
+	if task.Sink != nil {
+		task.Chunks = task.Sink.Chunks()
+		task.Sink = nil
+	}
+	if !truncated {
+		task.TempFile = "" // 清除临时文件路径，表示内容已加载到内存
+	}
 	s.mutex.Unlock()
 
-	// 删除临时文件（内容已保存到task.Output）
-	if tempFilePath != "" {
+	// 删除临时文件（内容已保存到task.Output）；被截断时保留文件供分页读取
+	if tempFilePath != "" && !truncated {
 		if err := os.Remove(tempFilePath); err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: failed to remove temp file %s: %v\n", tempFilePath, err)
 		}
@@ -806,37 +1788,64 @@ func (s *MCPServer) handleCommandCancellation(task *BackgroundTask, cmd *exec.Cm
 }
 
 // AddBashTools 注册所有bash工具 - 使用官方标准注册模式
-func AddBashTools(server *mcp.Server) {
-	bashServer := NewMCPServer()
+func AddBashTools(server *mcp.Server, bashServer *MCPServer) {
+	// 启动已结束任务的定期清理
+	bashServer.StartJanitor(context.Background())
+	addBashTools(server, bashServer, "")
+}
+
+// addBashTools 以指定连接的身份注册所有bash工具，owner 为空表示本地 stdio 连接
+func addBashTools(server *mcp.Server, bashServer *MCPServer, owner string) {
+	limits := bashServer.cfg().Execution
 
 	// 注册Bash工具 - 使用官方推荐的AddTool模式
 	mcp.AddTool(server, &mcp.Tool{
-		Name:        "bash",
-		Description: "安全执行PowerShell命令，支持前台和后台执行模式\n\n主要功能：\n• 仅支持PowerShell 7+和Windows PowerShell 5.x命令执行\n• 智能Shell环境检测，自动选择最佳Shell\n• 支持前台执行（同步等待结果）和后台执行（异步任务）\n• 必填超时时间（1-600秒）防止无限等待\n• 企业级安全验证（危险命令过滤、长度限制）\n• 完整错误处理和退出代码返回\n\n参数说明：\n• command（必填）：要执行的PowerShell命令\n• timeout（必填）：超时时间（毫秒），范围1000-600000\n• description（可选）：命令描述，用于日志记录\n• run_in_background（可选）：是否后台执行，默认false\n\n返回结果：\n• output：命令执行输出内容\n• exitCode：命令退出代码\n• killed：是否被强制终止\n• shellId：后台任务ID（仅后台执行时返回）\n\n安全限制：\n• 最大命令长度10000字符\n• 禁止危险命令（删除、格式化、关机等）\n• 自动检测和过滤恶意操作\n• timeout参数为必填项，确保命令执行时间可控",
-	}, bashServer.BashHandler)
+		Name: "bash",
+		Description: fmt.Sprintf("安全执行Shell命令，支持前台和后台执行模式\n\n主要功能：\n• 支持Windows、Linux和macOS，可选PowerShell 7+、Windows PowerShell 5.x、cmd、bash、zsh、sh\n• 智能Shell环境检测，按优先级自动选择最佳Shell\n• 支持前台执行（同步等待结果）和后台执行（异步任务）\n• 必填超时时间（%d-%d毫秒）防止无限等待\n• 企业级安全验证（危险命令过滤、长度限制）\n• 完整错误处理和退出代码返回\n\n参数说明：\n• command（必填）：要执行的Shell命令，使用所选Shell的语法\n• timeout（必填）：超时时间（毫秒），范围%d-%d\n• description（可选）：命令描述，用于日志记录\n• run_in_background（可选）：是否后台执行，默认false\n• shell（可选）：指定执行Shell（pwsh、powershell、cmd、bash、sh、zsh），默认使用首选Shell\n• cwd（可选）：命令工作目录，必须位于允许的根目录内\n• env（可选）：额外环境变量（键值对）\n• session_id（可选）：在session_open创建的持久化会话中执行，不能与run_in_background、cwd、env、limits同时使用\n• no_error_prefix（可选）：后台任务的合并输出中不为stderr行添加\"ERROR: \"前缀\n• max_output_bytes（可选）：输出字节上限，默认%d，最大%d；超出时只保留开头和结尾\n• limits（可选）：资源限制（memory_mb、cpu_percent、file_size_mb、open_files、processes），未指定的项使用配置的默认值，不能超过配置的上限\n\n返回结果：\n• output：命令执行输出内容（stdout与stderr按到达顺序交错）\n• stdout / stderr：分开的标准输出和标准错误\n• exitCode：命令退出代码\n• killed：是否被强制终止\n• shellId：后台任务ID（后台执行或输出被截断时返回）\n• shell：实际执行命令的Shell\n• truncated / totalBytes：输出是否被截断及完整输出的总字节数\n• outputFile：截断时完整输出所在的文件，可用shellId通过bash_output分页读取\n\n安全限制：\n• 最大命令长度%d字符\n• 禁止危险命令（删除、格式化、关机等）\n• 命令策略标记为需要确认的命令（如git push --force）通过MCP elicitation请用户确认，客户端不支持时拒绝\n• 自动检测和过滤恶意操作\n• timeout参数为必填项，确保命令执行时间可控\n• 开启认证时需要bash.execute权限，后台执行需要bash.background，网络、写文件、进程控制类命令需要对应的command.*权限",
+			limits.MinTimeout, limits.MaxTimeout, limits.MinTimeout, limits.MaxTimeout,
+			limits.DefaultMaxOutputBytes, limits.MaxOutputBytesLimit, limits.MaxCommandLength),
+	}, ownedBy(owner, bashServer.BashHandler))
 
 	// 注册BashOutput工具
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "bash_output",
-		Description: "获取后台任务的实时输出内容，支持正则表达式过滤\n\n主要功能：\n• 实时读取后台命令执行输出\n• 从临时文件实时获取最新内容\n• 支持正则表达式过滤输出行\n• 精确的任务状态追踪\n• 自动清理完成的任务\n\n参数说明：\n• bash_id（必填）：后台任务的Bash ID（由bash工具返回）\n• filter（可选）：正则表达式过滤器，用于筛选输出内容\n\n返回结果：\n• output：后台任务的输出内容（过滤后）\n• status：任务状态（running, completed, failed, killed, not_found）\n• exitCode：任务退出代码（仅任务完成时返回）\n\n使用说明：\n• 与bash工具的run_in_background参数配合使用\n• 适用于长时间运行的任务（编译、部署、下载等）\n• 可通过正则表达式精确筛选日志内容\n• 建议定期轮询获取最新输出\n• 任务完成后自动更新状态",
-	}, bashServer.BashOutputHandler)
+		Description: fmt.Sprintf("获取后台任务的实时输出内容，支持正则表达式过滤\n\n主要功能：\n• 实时读取后台命令执行输出\n• 从临时文件实时获取最新内容\n• 增量读取：默认只返回上次读取之后的新输出\n• 支持正则表达式过滤输出行\n• 精确的任务状态追踪\n• 自动清理完成的任务\n\n参数说明：\n• bash_id（必填）：后台任务的Bash ID（由bash工具返回）\n• filter（可选）：正则表达式过滤器，用于筛选输出内容\n• since（可选）：从该字节偏移开始读取，通常传入上次返回的nextOffset；传0从头读取；省略时从上次读取位置继续\n• limit（可选）：单次返回的最大字节数，默认%d，最大%d\n\n返回结果：\n• output：后台任务的输出内容（过滤后，stderr行默认带\"ERROR: \"前缀）\n• stdout / stderr：本次返回范围内分开的标准输出和标准错误（不带前缀）\n• status：任务状态（running, completed, failed, killed, not_found）\n• exitCode：任务退出代码（仅任务完成时返回）\n• nextOffset：下次读取的字节偏移（任务运行中只返回完整的行）\n• truncated：本次返回受limit限制，nextOffset之后还有输出\n• totalBytes：任务当前输出的总字节数\n• outputFile：任务输出被截断时保存完整输出的文件\n\n使用说明：\n• 与bash工具的run_in_background参数配合使用\n• 适用于长时间运行的任务（编译、部署、下载等）\n• 可通过正则表达式精确筛选日志内容\n• 建议定期轮询获取最新输出\n• 任务完成后自动更新状态\n• 开启认证时需要bash_output.read权限", limits.DefaultMaxOutputBytes, limits.MaxOutputBytesLimit),
+	}, ownedBy(owner, bashServer.BashOutputHandler))
 
 	// 注册KillShell工具
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "kill_shell",
-		Description: "终止正在运行的后台任务，释放系统资源\n\n主要功能：\n• 强制终止指定的后台命令\n• 自动清理任务相关资源\n• 更新任务状态为killed\n• 防止资源泄漏和僵尸进程\n\n参数说明：\n• shell_id（必填）：要终止的后台任务Shell ID\n\n返回结果：\n• message：操作结果消息\n• shell_id：被终止的任务Shell ID\n\n使用场景：\n• 长时间运行的任务需要手动中断\n• 发现任务异常或卡死时强制终止\n• 系统维护和资源清理\n• 测试和开发环境中的任务管理\n\n注意事项：\n• 仅能终止通过bash工具创建的后台任务\n• 被终止的任务无法恢复\n• 建议确认任务确实需要终止后再调用\n• 终止操作会立即生效",
-	}, bashServer.KillShellHandler)
+		Description: "终止正在运行的后台任务，释放系统资源\n\n主要功能：\n• 终止指定的后台命令及其启动的全部子进程\n• 自动清理任务相关资源\n• 更新任务状态为killed\n• 防止资源泄漏和僵尸进程\n\n参数说明：\n• shell_id（必填）：要终止的后台任务Shell ID\n• mode（可选）：graceful（默认）先发送Ctrl+Break（Windows）或SIGINT、SIGTERM（POSIX），宽限期后仍未退出再强制终止；force 直接强制终止\n• grace_ms（可选）：graceful模式下每个阶段的等待毫秒数，默认使用配置的kill_grace_period\n\n返回结果：\n• message：操作结果消息\n• shell_id：被终止的任务Shell ID\n• stage：结束进程的阶段（exited已退出、interrupt、terminate、kill）\n\n使用场景：\n• 长时间运行的任务需要手动中断\n• 发现任务异常或卡死时强制终止\n• 系统维护和资源清理\n• 测试和开发环境中的任务管理\n\n注意事项：\n• 仅能终止通过bash工具创建的后台任务\n• 被终止的任务无法恢复\n• 建议确认任务确实需要终止后再调用\n• force模式立即生效，graceful模式最多等待两个宽限期\n• 开启认证时需要kill_shell.own权限；拥有kill_shell.any权限时可终止其他连接的任务",
+	}, ownedBy(owner, bashServer.KillShellHandler))
+
+	// 注册ListShells工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "list_shells",
+		Description: "列出后台任务，用于找回丢失的任务ID\n\n主要功能：\n• 列出所有后台任务（包括前台超时转入后台的任务）\n• 按状态过滤、按字段排序\n• 显示运行时长、退出代码、PID和输出大小\n\n参数说明：\n• status（可选）：按状态过滤（running, completed, failed, killed）\n• sort_by（可选）：排序字段（start_time, duration, status, id），默认start_time\n• order（可选）：排序方向（asc, desc），默认desc\n\n返回结果：\n• shells：任务列表（id, command, description, status, shell, startTime, durationMs, exitCode, pid, outputSize）\n• total：返回的任务数量",
+	}, ownedBy(owner, bashServer.ListShellsHandler))
+
+	// 注册SessionOpen工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "session_open",
+		Description: "启动持久化Shell会话，在多次bash调用之间保留状态\n\n主要功能：\n• 启动长期运行的Shell进程，命令通过stdin逐条执行\n• 工作目录（cd）、环境变量、导入的模块和定义的函数在调用之间保持\n• 每条命令返回独立的输出和退出代码\n\n参数说明：\n• shell（可选）：会话使用的Shell（pwsh、powershell、bash、sh、zsh），默认使用首选Shell，不支持cmd\n• cwd（可选）：会话初始工作目录，必须位于允许的根目录内\n• env（可选）：会话额外环境变量（键值对）\n• description（可选）：会话描述\n• limits（可选）：会话Shell进程树的资源限制，字段同bash工具\n\n返回结果：\n• session_id：会话ID，传给bash工具的session_id参数使用\n• shell：会话使用的Shell\n• pid：会话Shell进程PID\n\n注意事项：\n• 会话中的命令超时会终止整个会话\n• 同一会话同一时间只能执行一条命令\n• 使用完毕后请调用session_close释放资源",
+	}, ownedBy(owner, bashServer.SessionOpenHandler))
+
+	// 注册SessionClose工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "session_close",
+		Description: "关闭持久化Shell会话并终止其Shell进程\n\n参数说明：\n• session_id（必填）：要关闭的会话ID（由session_open返回）\n\n返回结果：\n• message：操作结果消息\n• session_id：被关闭的会话ID",
+	}, ownedBy(owner, bashServer.SessionCloseHandler))
 }
 
-func main() {
-	// 创建MCP服务器实例 - 使用官方标准配置
-	server := mcp.NewServer(&mcp.Implementation{
-		Name:    "mcp-bash-tools",
-		Version: "1.0.0",
-	}, &mcp.ServerOptions{
-		Instructions: `MCP Bash Tools Server - Windows专用安全命令执行服务器
+// newServer 创建MCP服务器实例，owner 为空表示本地 stdio 连接，auth 为该连接的认证状态
+// HTTP模式下每个连接使用独立的服务器实例，连接断开后释放其后台任务和会话
+func newServer(bashServer *MCPServer, owner string, auth *authState) *mcp.Server {
+	limits := bashServer.cfg().Execution
+	opts := &mcp.ServerOptions{
+		Instructions: fmt.Sprintf(`MCP Bash Tools Server - 跨平台安全Shell命令执行服务器
 
 功能特性：
+- 跨平台Shell支持 - 支持Windows、Linux和macOS，默认按pwsh、powershell、bash、zsh、sh、cmd的顺序选择已安装的Shell，可通过shell参数指定
 - 企业级安全验证 - 多层安全检查防止恶意命令执行
 - 支持前台/后台执行模式 - 灵活的任务管理
 - 实时输出监控 - 后台任务输出实时获取
@@ -844,42 +1853,115 @@ func main() {
 - 资源限制保护 - 防止系统资源滥用
 
 可用工具：
-- bash - 执行PowerShell命令
+- bash - 在所选Shell中执行命令
 - bash_output - 获取后台任务输出
 - kill_shell - 终止后台任务
+- list_shells - 列出后台任务
+- session_open - 启动持久化Shell会话
+- session_close - 关闭持久化Shell会话
 
 安全限制：
 - 禁止危险命令（rm -rf, format, shutdown等）
-- 命令长度限制（最大10000字符）
-- 超时保护（默认30秒，最大600秒）`,
-	})
+- 命令长度限制（最大%d字符）
+- 超时保护（默认%d毫秒，最大%d毫秒）`, limits.MaxCommandLength, limits.DefaultTimeout, limits.MaxTimeout),
+	}
+	if owner != "" {
+		opts.InitializedHandler = func(ctx context.Context, req *mcp.InitializedRequest) {
+			go func() {
+				req.Session.Wait()
+				bashServer.ReleaseOwner(owner)
+			}()
+		}
+	}
+
+	// 创建MCP服务器实例 - 使用官方标准配置
+	server := mcp.NewServer(&mcp.Implementation{
+		Name:    "mcp-bash-tools",
+		Version: "1.0.0",
+	}, opts)
+	// 开启认证时所有请求都需要有效令牌
+	server.AddReceivingMiddleware(bashServer.authMiddleware(auth))
+	return server
+}
+
+func main() {
+	// audit 子命令：校验审计日志的哈希链
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		os.Exit(runAuditCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// 加载配置：默认值 < 配置文件 < 环境变量 < 命令行参数
+	cfg, configFile, err := config.Load(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		os.Exit(2)
+	}
 
 	// 打印启动信息
 	fmt.Fprintf(os.Stderr, "MCP Bash Tools Server starting...\n")
 	fmt.Fprintf(os.Stderr, "Server Information:\n")
 	fmt.Fprintf(os.Stderr, "   Name: %s\n", "mcp-bash-tools")
 	fmt.Fprintf(os.Stderr, "   Version: %s\n", "1.0.0")
+	if configFile != "" {
+		fmt.Fprintf(os.Stderr, "   Config: %s\n", configFile)
+	}
 	fmt.Fprintln(os.Stderr)
 
 	// 创建并初始化Shell执行器
-	bashServer := NewMCPServer()
+	bashServer := NewMCPServerWithConfig(cfg)
+	if err := bashServer.ApplyConfig(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to apply configuration: %v\n", err)
+		os.Exit(2)
+	}
+	// 审计日志不显式关闭：退出时被终止任务的结束记录仍可能写入，记录不经缓冲直接写入文件
+	bashServer.audit, err = openAuditLog(cfg.Logging)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open audit log: %v\n", err)
+		os.Exit(2)
+	}
+	if bashServer.audit != nil {
+		fmt.Fprintf(os.Stderr, "Audit log: %s\n", bashServer.audit.Path())
+	}
 	fmt.Fprintf(os.Stderr, "Shell Environment Information:\n")
 	bashServer.shellExecutor.PrintShellInfo()
 	fmt.Fprintln(os.Stderr)
 
-	// 注册所有bash工具
-	fmt.Fprintf(os.Stderr, "Registering MCP tools...\n")
-	AddBashTools(server)
-	fmt.Fprintf(os.Stderr, "Tools registered successfully:\n")
-	fmt.Fprintf(os.Stderr, "   - bash - Execute PowerShell commands\n")
+	fmt.Fprintf(os.Stderr, "Tools available:\n")
+	fmt.Fprintf(os.Stderr, "   - bash - Execute shell commands (PowerShell, cmd, bash, sh, zsh)\n")
 	fmt.Fprintf(os.Stderr, "   - bash_output - Get background task output\n")
 	fmt.Fprintf(os.Stderr, "   - kill_shell - Terminate background tasks\n")
+	fmt.Fprintf(os.Stderr, "   - list_shells - List background tasks\n")
+	fmt.Fprintf(os.Stderr, "   - session_open - Start a persistent shell session\n")
+	fmt.Fprintf(os.Stderr, "   - session_close - Close a persistent shell session\n")
 	fmt.Fprintln(os.Stderr)
 
-	// 启动服务器 - 使用官方标准启动方式
-	fmt.Fprintf(os.Stderr, "Starting MCP server with stdio transport...\n")
-	if err := server.Run(context.Background(), &mcp.StdioTransport{}); err != nil {
-		fmt.Fprintf(os.Stderr, "Server failed to start: %v\n", err)
+	// 收到SIGINT/SIGTERM时优雅退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// 配置文件变更或收到SIGHUP时重新加载安全和执行策略
+	go NewConfigReloader(bashServer, os.Args[1:], configFile).Watch(ctx)
+
+	if cfg.Server.Transport == "http" {
+		bashServer.StartJanitor(ctx)
+		err = ServeHTTP(ctx, bashServer)
+	} else {
+		// 注册所有bash工具
+		server := newServer(bashServer, "", &authState{})
+		AddBashTools(server, bashServer)
+		fmt.Fprintf(os.Stderr, "Tools registered successfully\n")
+		// 启动服务器 - 使用官方标准启动方式
+		fmt.Fprintf(os.Stderr, "Starting MCP server with stdio transport...\n")
+		err = server.Run(ctx, &mcp.StdioTransport{})
+	}
+
+	// 退出前终止后台任务并关闭会话，避免遗留子进程
+	bashServer.Shutdown()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "Server failed: %v\n", err)
 		os.Exit(1)
 	}
 }
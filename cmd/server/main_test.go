@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
 
+	"mcp-bash-tools/internal/executor"
+
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -208,6 +212,167 @@ func (suite *BashHandlerTestSuite) TestBashHandler_DescriptionLogging() {
 	assert.NotNil(suite.T(), output)
 }
 
+// TestBashHandler_ShellSelection 测试按调用指定Shell
+func (suite *BashHandlerTestSuite) TestBashHandler_ShellSelection() {
+	tests := []struct {
+		shell    string
+		expected string
+	}{
+		{"", "pwsh"},
+		{"powershell", "powershell"},
+		{"PowerShell.exe", "powershell"},
+		{"cmd", "cmd"},
+	}
+
+	for _, tt := range tests {
+		suite.Run("shell: "+tt.shell, func() {
+			args := BashArguments{
+				Command: "echo test",
+				Timeout: 5000,
+				Shell:   tt.shell,
+			}
+
+			_, output, err := suite.server.BashHandler(context.Background(), &mcp.CallToolRequest{}, args)
+
+			require.NoError(suite.T(), err)
+			assert.Equal(suite.T(), tt.expected, output.Shell)
+		})
+	}
+}
+
+// TestBashHandler_UnavailableShell 测试不可用或未知的Shell
+func (suite *BashHandlerTestSuite) TestBashHandler_UnavailableShell() {
+	tests := []struct {
+		shell    string
+		expected string
+	}{
+		{"bash", "shell bash is not available"},
+		{"fish", "unknown shell: fish"},
+	}
+
+	for _, tt := range tests {
+		suite.Run("shell: "+tt.shell, func() {
+			args := BashArguments{
+				Command: "echo test",
+				Timeout: 5000,
+				Shell:   tt.shell,
+			}
+
+			_, output, err := suite.server.BashHandler(context.Background(), &mcp.CallToolRequest{}, args)
+
+			require.Error(suite.T(), err)
+			assert.Contains(suite.T(), err.Error(), tt.expected)
+			assert.Equal(suite.T(), 1, output.ExitCode)
+		})
+	}
+}
+
+// TestBashHandler_BackgroundShellSelection 测试后台任务记录指定的Shell
+func (suite *BashHandlerTestSuite) TestBashHandler_BackgroundShellSelection() {
+	args := BashArguments{
+		Command:         "echo background",
+		Timeout:         5000,
+		RunInBackground: true,
+		Shell:           "powershell",
+	}
+
+	_, output, err := suite.server.BashHandler(context.Background(), &mcp.CallToolRequest{}, args)
+
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "powershell", output.Shell)
+
+	suite.server.mutex.Lock()
+	task, exists := suite.server.backgroundTasks[output.ShellID]
+	require.True(suite.T(), exists)
+	assert.Equal(suite.T(), executor.PowerShell, task.Shell)
+	delete(suite.server.backgroundTasks, output.ShellID)
+	suite.server.mutex.Unlock()
+}
+
+// TestBashHandler_WorkingDirectory 测试工作目录校验
+func (suite *BashHandlerTestSuite) TestBashHandler_WorkingDirectory() {
+	root := suite.T().TempDir()
+	inside := filepath.Join(root, "project")
+	require.NoError(suite.T(), os.Mkdir(inside, 0755))
+	outside := suite.T().TempDir()
+
+	cfg := *suite.server.cfg()
+	cfg.Security.AllowedPaths = []string{root}
+	previous := suite.server.config.Swap(&cfg)
+	defer suite.server.config.Store(previous)
+
+	tests := []struct {
+		name     string
+		cwd      string
+		expected string
+	}{
+		{"inside root", inside, ""},
+		{"root itself", root, ""},
+		{"outside root", outside, "working directory not allowed"},
+		{"dot-dot escape", filepath.Join(inside, "..", ".."), "working directory not allowed"},
+		{"missing directory", filepath.Join(root, "missing"), "working directory not accessible"},
+	}
+
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			args := BashArguments{
+				Command: "echo test",
+				Timeout: 5000,
+				Cwd:     tt.cwd,
+			}
+
+			_, output, err := suite.server.BashHandler(context.Background(), &mcp.CallToolRequest{}, args)
+
+			if tt.expected == "" {
+				require.NoError(suite.T(), err)
+				assert.Equal(suite.T(), 0, output.ExitCode)
+			} else {
+				require.Error(suite.T(), err)
+				assert.Contains(suite.T(), err.Error(), tt.expected)
+				assert.Equal(suite.T(), 1, output.ExitCode)
+			}
+		})
+	}
+}
+
+// TestBashHandler_InvalidEnv 测试无效的环境变量
+func (suite *BashHandlerTestSuite) TestBashHandler_InvalidEnv() {
+	args := BashArguments{
+		Command: "echo test",
+		Timeout: 5000,
+		Env:     map[string]string{"BAD=NAME": "value"},
+	}
+
+	_, output, err := suite.server.BashHandler(context.Background(), &mcp.CallToolRequest{}, args)
+
+	require.Error(suite.T(), err)
+	assert.Contains(suite.T(), err.Error(), "invalid environment variable name")
+	assert.Equal(suite.T(), 1, output.ExitCode)
+}
+
+// TestBashHandler_BackgroundCwdAndEnv 测试后台任务记录工作目录和环境变量
+func (suite *BashHandlerTestSuite) TestBashHandler_BackgroundCwdAndEnv() {
+	dir := suite.T().TempDir()
+	args := BashArguments{
+		Command:         "echo background",
+		Timeout:         5000,
+		RunInBackground: true,
+		Cwd:             dir,
+		Env:             map[string]string{"MCP_TEST_VAR": "1"},
+	}
+
+	_, output, err := suite.server.BashHandler(context.Background(), &mcp.CallToolRequest{}, args)
+	require.NoError(suite.T(), err)
+
+	suite.server.mutex.Lock()
+	task, exists := suite.server.backgroundTasks[output.ShellID]
+	require.True(suite.T(), exists)
+	assert.Equal(suite.T(), dir, task.Cwd)
+	assert.Equal(suite.T(), "1", task.Env["MCP_TEST_VAR"])
+	delete(suite.server.backgroundTasks, output.ShellID)
+	suite.server.mutex.Unlock()
+}
+
 // 运行BashHandler测试套件
 func TestBashHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(BashHandlerTestSuite))
@@ -221,5 +386,95 @@ func (m *MockShellExecutor) ExecuteCommand(command string, timeout int) (string,
 	return "Mock output: " + command, 0, nil
 }
 
+// ExecuteWithShell 模拟指定Shell执行
+func (m *MockShellExecutor) ExecuteWithShell(shellType executor.ShellType, command string, timeout int, opts executor.ExecOptions) (executor.ExecResult, error) {
+	output := "Mock output: " + command
+	return executor.ExecResult{Output: output, Stdout: output}, nil
+}
+
+// GetPreferredShell 模拟首选Shell
+func (m *MockShellExecutor) GetPreferredShell() executor.ShellType {
+	return executor.PowerShell7
+}
+
+// GetShellPath 模拟Shell路径（返回空表示按名称解析）
+func (m *MockShellExecutor) GetShellPath(shellType executor.ShellType) string {
+	return ""
+}
+
+// GetAvailableShells 模拟可用Shell列表
+func (m *MockShellExecutor) GetAvailableShells() []executor.ShellType {
+	return []executor.ShellType{executor.PowerShell7, executor.PowerShell, executor.Cmd}
+}
+
 // PrintShellInfo 模拟Shell信息打印
 func (m *MockShellExecutor) PrintShellInfo() {}
+
+// requirePowerShell 在没有PowerShell的环境（如Linux CI容器）中跳过测试
+func requirePowerShell(t *testing.T) {
+	t.Helper()
+	if !executor.NewShellExecutor().GetPreferredShell().IsPowerShell() {
+		t.Skip("PowerShell not available, skipping PowerShell-specific test")
+	}
+}
+
+// TestShellType_BuildArgs 测试各Shell的参数构建
+func TestShellType_BuildArgs(t *testing.T) {
+	args, err := executor.PowerShell7.BuildArgs("Get-Date")
+	require.NoError(t, err)
+	assert.Equal(t, "-NoProfile", args[0])
+	assert.Equal(t, "-Command", args[1])
+	assert.True(t, strings.HasSuffix(args[2], "Get-Date"))
+	assert.Contains(t, args[2], "[Console]::OutputEncoding")
+
+	for _, shellType := range []executor.ShellType{executor.Bash, executor.Sh, executor.Zsh} {
+		args, err := shellType.BuildArgs("echo hi")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"-c", "echo hi"}, args)
+	}
+
+	_, err = executor.Unknown.BuildArgs("echo hi")
+	assert.Error(t, err)
+}
+
+// TestShellExecutor_POSIXExecution 测试POSIX Shell前台执行
+func TestShellExecutor_POSIXExecution(t *testing.T) {
+	shellExec := executor.NewShellExecutor()
+	if shellExec.GetShellPath(executor.Sh) == "" {
+		t.Skip("sh not available")
+	}
+
+	result, err := shellExec.ExecuteWithShell(executor.Sh, "echo posix-ok; exit 3", 5000, executor.ExecOptions{})
+	require.Error(t, err)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Contains(t, result.Output, "posix-ok")
+
+	dir := t.TempDir()
+	result, err = shellExec.ExecuteWithShell(executor.Sh, `pwd; echo "var=$MCP_TEST_VAR"`, 5000, executor.ExecOptions{
+		Dir: dir,
+		Env: map[string]string{"MCP_TEST_VAR": "from-env"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Contains(t, result.Output, filepath.Base(dir))
+	assert.Contains(t, result.Output, "var=from-env")
+}
+
+// TestShellExecutor_SeparateStreams 测试前台执行分别返回stdout和stderr
+func TestShellExecutor_SeparateStreams(t *testing.T) {
+	shellExec := executor.NewShellExecutor()
+	if shellExec.GetShellPath(executor.Sh) == "" {
+		t.Skip("sh not available")
+	}
+
+	result, err := shellExec.ExecuteWithShell(executor.Sh, "echo out1; echo err1 >&2; echo out2", 5000, executor.ExecOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "out1\nout2\n", result.Stdout)
+	assert.Equal(t, "err1\n", result.Stderr)
+	assert.Len(t, result.Output, len(result.Stdout)+len(result.Stderr))
+	assert.Contains(t, result.Output, "err1\n")
+
+	stdout, stderr := executor.SplitStreams(result.Output, 0, result.Chunks)
+	assert.Equal(t, result.Stdout, stdout)
+	assert.Equal(t, result.Stderr, stderr)
+}
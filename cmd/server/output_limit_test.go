@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"mcp-bash-tools/internal/executor"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countLinesCommand 输出 "line 0" 到 "line 1999"，共 18890 字节
+const countLinesCommand = `i=0; while [ $i -lt 2000 ]; do echo "line $i"; i=$((i+1)); done`
+
+// TestHeadTailBuffer 测试输出缓冲保留首尾并标记截断
+func TestHeadTailBuffer(t *testing.T) {
+	buffer := executor.NewHeadTailBuffer(10)
+	buffer.Write([]byte("abc"))
+	assert.False(t, buffer.Truncated())
+	assert.Equal(t, "abc", buffer.String())
+
+	buffer.Write([]byte(strings.Repeat("x", 100) + "tail!"))
+	assert.True(t, buffer.Truncated())
+	assert.Equal(t, int64(108), buffer.TotalBytes())
+	output := buffer.String()
+	assert.True(t, strings.HasPrefix(output, "abcxx"))
+	assert.True(t, strings.HasSuffix(output, "tail!"))
+	assert.Contains(t, output, "[output truncated: 98 bytes omitted]")
+	assert.Empty(t, buffer.SpillPath())
+}
+
+// TestForegroundOutputTruncation 测试前台输出超出上限时截断并可分页读取完整输出
+func TestForegroundOutputTruncation(t *testing.T) {
+	server := NewMCPServer()
+	if server.shellExecutor.GetShellPath(executor.Sh) == "" {
+		t.Skip("sh not available")
+	}
+
+	_, result, err := server.BashHandler(context.Background(), nil, BashArguments{
+		Command:        countLinesCommand,
+		Timeout:        10000,
+		Shell:          "sh",
+		MaxOutputBytes: 1000,
+	})
+	require.NoError(t, err)
+	assert.True(t, result.Truncated)
+	assert.Equal(t, int64(18890), result.TotalBytes)
+	assert.True(t, strings.HasPrefix(result.Output, "line 0\n"))
+	assert.True(t, strings.HasSuffix(result.Output, "line 1999\n"))
+	assert.Contains(t, result.Output, "output truncated")
+	assert.Less(t, len(result.Output), 1100)
+	require.NotEmpty(t, result.OutputFile)
+	require.NotEmpty(t, result.ShellID)
+	defer os.Remove(result.OutputFile)
+
+	content, err := os.ReadFile(result.OutputFile)
+	require.NoError(t, err)
+	assert.Len(t, content, 18890)
+
+	// 分页读取完整输出，每页只包含完整的行
+	var pages strings.Builder
+	offset := int64(0)
+	for range 100 {
+		_, page, err := server.BashOutputHandler(context.Background(), nil, BashOutputArguments{
+			BashID: result.ShellID,
+			Since:  &offset,
+			Limit:  4096,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "completed", page.Status)
+		assert.Equal(t, result.OutputFile, page.OutputFile)
+		assert.Equal(t, int64(18890), page.TotalBytes)
+		assert.LessOrEqual(t, len(page.Output), 4096)
+		assert.True(t, strings.HasSuffix(page.Output, "\n"))
+		pages.WriteString(page.Output)
+		offset = page.NextOffset
+		if !page.Truncated {
+			break
+		}
+	}
+	assert.Equal(t, string(content), pages.String())
+
+	// 输出未超出上限时不截断
+	_, result, err = server.BashHandler(context.Background(), nil, BashArguments{
+		Command: "echo small",
+		Timeout: 5000,
+		Shell:   "sh",
+	})
+	require.NoError(t, err)
+	assert.False(t, result.Truncated)
+	assert.Empty(t, result.OutputFile)
+	assert.Empty(t, result.ShellID)
+}
+
+// TestOutputLimitValidation 测试输出上限参数校验
+func TestOutputLimitValidation(t *testing.T) {
+	server := NewMCPServer()
+
+	_, result, err := server.BashHandler(context.Background(), nil, BashArguments{
+		Command:        "echo x",
+		Timeout:        5000,
+		MaxOutputBytes: int(server.cfg().Execution.MaxOutputBytesLimit) + 1,
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, result.ExitCode)
+
+	_, output, err := server.BashOutputHandler(context.Background(), nil, BashOutputArguments{
+		BashID: "bash_1",
+		Limit:  -1,
+	})
+	assert.Error(t, err)
+	assert.Equal(t, "failed", output.Status)
+}
+
+// TestLoadTaskOutput 测试后台任务输出加载时按上限截断
+func TestLoadTaskOutput(t *testing.T) {
+	path := t.TempDir() + "/output.txt"
+	require.NoError(t, os.WriteFile(path, []byte(strings.Repeat("0123456789\n", 100)), 0644))
+
+	output, truncated, err := loadTaskOutput(path, 100)
+	require.NoError(t, err)
+	assert.True(t, truncated)
+	assert.True(t, strings.HasPrefix(output, "0123456789\n"))
+	assert.Contains(t, output, "output truncated")
+
+	output, truncated, err = loadTaskOutput(path, 2000)
+	require.NoError(t, err)
+	assert.False(t, truncated)
+	assert.Len(t, output, 1100)
+}
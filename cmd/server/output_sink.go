@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"sync"
+	"time"
+
+	"mcp-bash-tools/internal/executor"
+	"mcp-bash-tools/internal/redact"
+)
+
+// DefaultStderrPrefix 后台任务合并输出中stderr行的默认前缀
+const DefaultStderrPrefix = "ERROR: "
+
+// outputSink 后台任务的输出写入器
+// 按行追加到临时文件（合并输出），同时记录每个流的分段及时间戳，
+// 以便在保持交错顺序的同时拆分出stdout和stderr；写入前按行屏蔽敏感信息
+type outputSink struct {
+	mutex        sync.Mutex
+	path         string
+	size         int64
+	stderrPrefix string
+	log          executor.ChunkLog
+	hash         hash.Hash // 完整合并输出的摘要，用于审计
+	redact       map[string]*redact.Stream
+}
+
+// newOutputSink 创建输出写入器，stderrPrefix 为空表示stderr行不加前缀
+func newOutputSink(path, stderrPrefix string) *outputSink {
+	redactor := redact.Current()
+	return &outputSink{
+		path:         path,
+		stderrPrefix: stderrPrefix,
+		hash:         sha256.New(),
+		redact: map[string]*redact.Stream{
+			executor.StreamStdout: redactor.NewStream(),
+			executor.StreamStderr: redactor.NewStream(),
+		},
+	}
+}
+
+// WriteLine 追加一行输出，stderr行在合并输出中加前缀，分段只记录行内容
+func (o *outputSink) WriteLine(stream, line string) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	line, ok := o.redact[stream].Line(line)
+	if !ok {
+		return nil
+	}
+	prefix := ""
+	if stream == executor.StreamStderr {
+		prefix = o.stderrPrefix
+	}
+
+	// 每次写入都重新打开文件，以避免长时间持有文件锁
+	f, err := os.OpenFile(o.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open temp file for writing: %w", err)
+	}
+	defer f.Close()
+
+	content := line + "\n"
+	if _, err := f.WriteString(prefix + content); err != nil {
+		return fmt.Errorf("failed to write to temp file: %w", err)
+	}
+
+	o.hash.Write([]byte(prefix + content))
+	o.log.Add(stream, o.size+int64(len(prefix)), int64(len(content)), time.Now())
+	o.size += int64(len(prefix) + len(content))
+	return nil
+}
+
+// Digest 返回已写入的合并输出的 sha256 摘要和字节数
+func (o *outputSink) Digest() (string, int64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return hex.EncodeToString(o.hash.Sum(nil)), o.size
+}
+
+// Chunks 返回已记录的分段
+func (o *outputSink) Chunks() []executor.OutputChunk {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.log.Chunks()
+}
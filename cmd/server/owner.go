@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"mcp-bash-tools/internal/executor"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ownerKey 在Context中保存调用方所属连接的键
+type ownerKey struct{}
+
+// withOwner 返回带有调用方所属连接标识的Context
+func withOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerKey{}, owner)
+}
+
+// ownerFrom 返回调用方所属连接的标识，stdio 模式和测试中为空
+func ownerFrom(ctx context.Context) string {
+	owner, _ := ctx.Value(ownerKey{}).(string)
+	return owner
+}
+
+// ownedBy 包装工具处理器，使其以指定连接的身份执行
+// 同一连接的所有调用共享同一个 owner，只能访问该连接创建的后台任务和会话
+func ownedBy[In, Out any](owner string, handler mcp.ToolHandlerFor[In, Out]) mcp.ToolHandlerFor[In, Out] {
+	if owner == "" {
+		return handler
+	}
+	return func(ctx context.Context, req *mcp.CallToolRequest, args In) (*mcp.CallToolResult, Out, error) {
+		return handler(withOwner(ctx, owner), req, args)
+	}
+}
+
+// ownedTask 查找属于 owner 的后台任务，其他连接的任务视为不存在（调用方需持有锁）
+func (s *MCPServer) ownedTask(owner, id string) (*BackgroundTask, bool) {
+	task, exists := s.backgroundTasks[id]
+	if !exists || task.Owner != owner {
+		return nil, false
+	}
+	return task, true
+}
+
+// ownsSession 判断会话是否属于 owner
+func (s *MCPServer) ownsSession(owner, id string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	sessionOwner, exists := s.sessionOwners[id]
+	return exists && sessionOwner == owner
+}
+
+// ReleaseOwner 在连接断开后终止其运行中的后台任务、关闭其会话并清除记住的确认
+// 连接断开后这些资源已无法再被访问，保留只会占用进程和任务配额
+func (s *MCPServer) ReleaseOwner(owner string) {
+	var taskIDs, sessionIDs []string
+	s.mutex.Lock()
+	for id, task := range s.backgroundTasks {
+		if task.Owner == owner && !isTaskFinished(task) {
+			taskIDs = append(taskIDs, id)
+		}
+	}
+	for id, sessionOwner := range s.sessionOwners {
+		if sessionOwner == owner {
+			sessionIDs = append(sessionIDs, id)
+			delete(s.sessionOwners, id)
+		}
+	}
+	s.mutex.Unlock()
+	s.approvals.forget(owner)
+
+	// 直接终止任务：连接已断开，不受调用方的权限和限流约束
+	ctx := withOwner(context.Background(), owner)
+	grace := s.cfg().Execution.KillGracePeriod
+	killed := 0
+	for _, id := range taskIDs {
+		if _, err := s.killTask(ctx, id, executor.KillGraceful, grace); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to kill background task %s: %v\n", id, err)
+			continue
+		}
+		killed++
+	}
+	for _, id := range sessionIDs {
+		s.sessions.Close(id)
+	}
+	if killed > 0 || len(sessionIDs) > 0 {
+		name := owner
+		if name == "" {
+			name = "stdio"
+		}
+		fmt.Fprintf(os.Stderr, "Released connection %s: killed %d background task(s), closed %d session(s)\n", name, killed, len(sessionIDs))
+	}
+}
+
+// Shutdown 终止所有运行中的后台任务并关闭所有会话（服务器退出时调用）
+func (s *MCPServer) Shutdown() {
+	owners := map[string]bool{}
+	s.mutex.Lock()
+	for _, task := range s.backgroundTasks {
+		if !isTaskFinished(task) {
+			owners[task.Owner] = true
+		}
+	}
+	for _, owner := range s.sessionOwners {
+		owners[owner] = true
+	}
+	s.mutex.Unlock()
+
+	for owner := range owners {
+		s.ReleaseOwner(owner)
+	}
+	s.sessions.CloseAll()
+}
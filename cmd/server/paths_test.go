@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"mcp-bash-tools/internal/config"
+	"mcp-bash-tools/internal/pathpolicy"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// confinedRoot 创建允许的根目录：root/project 为项目目录，root/project/escape 是指向根目录之外的符号链接
+func confinedRoot(t *testing.T) (project, outside string) {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	outside, err = filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	project = filepath.Join(root, "project")
+	require.NoError(t, os.MkdirAll(filepath.Join(project, "src"), 0o755))
+	if err := os.Symlink(outside, filepath.Join(project, "escape")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	return project, outside
+}
+
+// TestBashHandlerPathConfinement 测试 security.allowed_paths 约束命令写入和删除的路径
+func TestBashHandlerPathConfinement(t *testing.T) {
+	project, outside := confinedRoot(t)
+	cfg := config.Default()
+	cfg.Security.AllowedPaths = []string{project}
+	server := NewMCPServerWithConfig(cfg)
+
+	_, result, err := server.BashHandler(context.Background(), nil, BashArguments{
+		Command: "rm -rf " + filepath.Join(outside, "data"),
+		Timeout: 5000,
+		Cwd:     project,
+	})
+	require.Error(t, err)
+	assert.Contains(t, result.Output, "path not allowed: delete")
+	require.NotNil(t, result.PathViolation)
+	assert.Equal(t, pathpolicy.OpDelete, result.PathViolation.Op)
+	assert.Contains(t, result.PathViolation.Reason, "outside allowed roots")
+
+	_, result, err = server.BashHandler(context.Background(), nil, BashArguments{
+		Command: "echo confined > out.txt",
+		Timeout: 5000,
+		Cwd:     project,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.ExitCode)
+	assert.FileExists(t, filepath.Join(project, "out.txt"))
+
+	// 禁止的路径同样约束工作目录
+	cfg.Security.BlockedPaths = []string{filepath.Join(project, "src")}
+	_, result, err = server.BashHandler(context.Background(), nil, BashArguments{Command: "echo x", Timeout: 5000, Cwd: filepath.Join(project, "src")})
+	require.Error(t, err)
+	assert.Contains(t, result.Output, "inside blocked path")
+}
+
+// TestSessionPathConfinement 测试会话中 cd 切换的工作目录在调用之间延续
+func TestSessionPathConfinement(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell syntax")
+	}
+	project, outside := confinedRoot(t)
+	cfg := config.Default()
+	cfg.Security.AllowedPaths = []string{project}
+	server := NewMCPServerWithConfig(cfg)
+	defer server.sessions.CloseAll()
+
+	_, opened, err := server.SessionOpenHandler(context.Background(), nil, SessionOpenArguments{Cwd: project})
+	if err != nil {
+		t.Skipf("no session-capable shell available: %v", err)
+	}
+	run := func(command string) (BashResult, error) {
+		_, result, err := server.BashHandler(context.Background(), nil, BashArguments{Command: command, Timeout: 10000, SessionID: opened.SessionID})
+		return result, err
+	}
+
+	_, err = run("cd src")
+	require.NoError(t, err)
+	_, err = run("cd " + outside)
+	assert.ErrorContains(t, err, "outside allowed roots")
+
+	// 相对路径相对于上一次调用切换到的 src 目录解析
+	result, err := run("touch ../../escaped")
+	assert.ErrorContains(t, err, "outside allowed roots")
+	require.NotNil(t, result.PathViolation)
+	assert.Equal(t, filepath.Join(filepath.Dir(project), "escaped"), result.PathViolation.Resolved)
+
+	_, err = run("touch ../created")
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(project, "created"))
+}
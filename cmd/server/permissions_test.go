@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mcp-bash-tools/internal/security"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// asUser 返回携带指定权限和连接标识的Context
+func asUser(owner string, permissions ...string) context.Context {
+	ctx := withOwner(context.Background(), owner)
+	return security.SetAuthContext(ctx, &security.AuthContext{UserID: owner, Username: owner, Permissions: permissions})
+}
+
+// addTask 添加一个已完成的后台任务
+func addTask(server *MCPServer, id, owner string) {
+	exitCode := 0
+	server.mutex.Lock()
+	server.backgroundTasks[id] = &BackgroundTask{
+		ID:        id,
+		Command:   "echo done",
+		Output:    "done\n",
+		Status:    "completed",
+		StartTime: time.Now(),
+		ExitCode:  &exitCode,
+		Owner:     owner,
+	}
+	server.mutex.Unlock()
+}
+
+// TestCommandPermissions 测试命令类别识别
+func TestCommandPermissions(t *testing.T) {
+	cases := []struct {
+		command string
+		want    []string
+	}{
+		{"echo hello", nil},
+		{"ls -la | grep rm", nil},
+		{"grep -r curl .", nil},
+		{"go test ./... 2>&1", nil},
+		{"make build > /dev/null 2>&1", nil},
+		{"Get-ChildItem | Out-Null", nil},
+		{"curl https://example.com", []string{security.PermCommandNetwork}},
+		{"cd repo && git  push origin main", []string{security.PermCommandNetwork}},
+		{"Invoke-WebRequest https://example.com", []string{security.PermCommandNetwork}},
+		{"rm -f build.log", []string{security.PermCommandFilesystemWrite}},
+		{"echo hi > out.txt", []string{security.PermCommandFilesystemWrite}},
+		{"Set-Content -Path a.txt -Value x", []string{security.PermCommandFilesystemWrite}},
+		{"sudo kill -9 1234", []string{security.PermCommandProcessControl}},
+		{"Get-Process node | Stop-Process", []string{security.PermCommandProcessControl}},
+		{"wget -O file.tgz http://example.com/file.tgz; pkill old", []string{security.PermCommandNetwork, security.PermCommandFilesystemWrite, security.PermCommandProcessControl}},
+		{"curl -s http://example.com >> log.txt", []string{security.PermCommandNetwork, security.PermCommandFilesystemWrite}},
+		{"echo 'a; rm -rf x' \"| kill 1\"", nil},
+		{"iwr https://example.com -OutFile x.zip", []string{security.PermCommandNetwork, security.PermCommandFilesystemWrite}},
+		{"ri build -Recurse", []string{security.PermCommandFilesystemWrite}},
+		{"cmd /c del /q build.log", []string{security.PermCommandFilesystemWrite}},
+		{"bash -c 'echo `pkill node`'", []string{security.PermCommandProcessControl}},
+		{"systemctl restart nginx", []string{security.PermCommandProcessControl}},
+		{"echo $(git fetch)", []string{security.PermCommandNetwork}},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, security.CommandPermissions(c.command, false), c.command)
+	}
+
+	// POSIX Shell 中反引号是命令替换
+	assert.Nil(t, security.CommandPermissions("echo `rm x`", false))
+	assert.Equal(t, []string{security.PermCommandFilesystemWrite}, security.CommandPermissions("echo `rm x`", true))
+}
+
+// TestRolePermissions 测试角色展开
+func TestRolePermissions(t *testing.T) {
+	observer := &security.AuthContext{UserID: "watcher", Permissions: []string{"role:observer"}}
+	assert.NoError(t, security.CheckPermissions(observer, []string{security.PermBashOutputRead}))
+	assert.Error(t, security.CheckPermissions(observer, []string{security.PermBashExecute}))
+
+	operator := &security.AuthContext{UserID: "ci", Permissions: []string{"role:operator"}}
+	assert.NoError(t, security.CheckPermissions(operator, []string{security.PermBashExecute, security.PermCommandNetwork}))
+	assert.Error(t, security.CheckPermissions(operator, []string{security.PermKillShellAny}))
+
+	unknown := &security.AuthContext{UserID: "x", Permissions: []string{"role:missing"}}
+	assert.Error(t, security.CheckPermissions(unknown, []string{security.PermBashOutputRead}))
+
+	// API密钥中可以直接授予角色
+	auth, _, err := security.ParseAPIKey("watcher:0123456789abcdef:role:observer")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"role:observer"}, auth.Permissions)
+}
+
+// TestObserverCannotExecute 测试只有 bash_output.read 的观察者可以查看输出但不能执行
+func TestObserverCannotExecute(t *testing.T) {
+	server := newAuthServer(t)
+	defer server.Shutdown()
+	addTask(server, "observed_task", "observer")
+	observer := asUser("observer", "role:observer")
+
+	_, result, err := server.BashHandler(observer, &mcp.CallToolRequest{}, BashArguments{Command: "echo hi", Timeout: 5000})
+	require.Error(t, err)
+	assert.Contains(t, result.Output, "permission denied")
+	assert.Contains(t, result.Output, security.PermBashExecute)
+
+	_, _, err = server.SessionOpenHandler(observer, &mcp.CallToolRequest{}, SessionOpenArguments{})
+	assert.Error(t, err)
+	_, _, err = server.KillShellHandler(observer, &mcp.CallToolRequest{}, KillShellArguments{ShellID: "observed_task"})
+	assert.Error(t, err)
+
+	_, output, err := server.BashOutputHandler(observer, &mcp.CallToolRequest{}, BashOutputArguments{BashID: "observed_task"})
+	require.NoError(t, err)
+	assert.Equal(t, "completed", output.Status)
+	_, listed, err := server.ListShellsHandler(observer, &mcp.CallToolRequest{}, ListShellsArguments{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, listed.Total)
+}
+
+// TestCommandClassPermissions 测试命令类别权限和后台执行权限
+func TestCommandClassPermissions(t *testing.T) {
+	server := newAuthServer(t)
+	defer server.Shutdown()
+	ctx := asUser("builder", security.PermBashExecute)
+
+	for _, command := range []string{"curl http://example.com", "rm -rf build", "echo x > file.txt", "pkill node"} {
+		_, result, err := server.BashHandler(ctx, &mcp.CallToolRequest{}, BashArguments{Command: command, Timeout: 5000})
+		require.Error(t, err, command)
+		assert.Contains(t, result.Output, "permission denied", command)
+		assert.Contains(t, result.Output, "command.", command)
+	}
+
+	_, result, err := server.BashHandler(ctx, &mcp.CallToolRequest{}, BashArguments{Command: "echo hi", Timeout: 5000, RunInBackground: true})
+	require.Error(t, err)
+	assert.Contains(t, result.Output, security.PermBashBackground)
+
+	_, result, err = server.BashHandler(ctx, &mcp.CallToolRequest{}, BashArguments{Command: "echo hi", Timeout: 5000})
+	require.NoError(t, err)
+	assert.Contains(t, result.Output, "hi")
+}
+
+// TestKillShellOwnAndAny 测试 kill_shell.own 只能终止自己的任务，kill_shell.any 可以终止任意任务
+func TestKillShellOwnAndAny(t *testing.T) {
+	server := newAuthServer(t)
+	defer server.Shutdown()
+	addTask(server, "alice_task", "alice")
+	addTask(server, "bob_task", "bob")
+
+	alice := asUser("alice", security.PermKillShellOwn, security.PermBashOutputRead)
+	_, _, err := server.KillShellHandler(alice, &mcp.CallToolRequest{}, KillShellArguments{ShellID: "bob_task"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "background task not found")
+	_, _, err = server.KillShellHandler(alice, &mcp.CallToolRequest{}, KillShellArguments{ShellID: "alice_task"})
+	require.NoError(t, err)
+
+	// 没有 kill_shell 权限时不能终止自己的任务
+	addTask(server, "carol_task", "carol")
+	carol := asUser("carol", security.PermBashExecute)
+	_, _, err = server.KillShellHandler(carol, &mcp.CallToolRequest{}, KillShellArguments{ShellID: "carol_task"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "permission denied")
+
+	admin := asUser("admin", security.PermKillShellAny, security.PermBashOutputRead)
+	_, listed, err := server.ListShellsHandler(admin, &mcp.CallToolRequest{}, ListShellsArguments{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, listed.Total)
+	_, _, err = server.KillShellHandler(admin, &mcp.CallToolRequest{}, KillShellArguments{ShellID: "bob_task"})
+	require.NoError(t, err)
+
+	// 未开启认证时连接之间仍然相互隔离
+	open := NewMCPServer()
+	addTask(open, "bob_task", "bob")
+	_, _, err = open.KillShellHandler(withOwner(context.Background(), "alice"), &mcp.CallToolRequest{}, KillShellArguments{ShellID: "bob_task"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mcp-bash-tools/internal/config"
+	"mcp-bash-tools/internal/executor"
+	"mcp-bash-tools/internal/policy"
+	"mcp-bash-tools/internal/security"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPolicyYAML 测试用的命令策略
+const testPolicyYAML = `
+rules:
+  - id: clean-build
+    verdict: allow
+    commands: [remove-item]
+    paths: ["C:\\Build\\**"]
+  - id: no-delete
+    verdict: deny
+    reason: deletes are not allowed
+    commands: [remove-item]
+  - id: force-push
+    verdict: ask
+    reason: rewrites remote history
+    commands: [git]
+    arguments: [push, "--force|-f|--force-with-lease*"]
+  - id: curl-pipe
+    verdict: deny
+    reason: pipes a download into a shell
+    commands: [bash, sh]
+    with_commands: [invoke-webrequest]
+`
+
+// TestBashHandlerReportsPolicyRule 测试拒绝命令时返回触发的规则和原因
+func TestBashHandlerReportsPolicyRule(t *testing.T) {
+	server := NewMCPServer()
+	_, result, err := server.BashHandler(context.Background(), nil, BashArguments{Command: "Get-Date; shutdown /r /t 0", Timeout: 5000})
+	require.Error(t, err)
+	assert.Contains(t, result.Output, "command rejected for security reasons: rule shutdown")
+	assert.Contains(t, result.Output, "shuts down or restarts the computer")
+	require.NotNil(t, result.Policy)
+	assert.Equal(t, policy.Deny, result.Policy.Verdict)
+	assert.Equal(t, "shutdown", result.Policy.RuleID)
+}
+
+// TestBashHandlerPOSIXCommandSubstitution 测试在 sh 中执行时按 POSIX 语法判定命令替换
+func TestBashHandlerPOSIXCommandSubstitution(t *testing.T) {
+	server := NewMCPServer()
+	if server.shellExecutor.GetShellPath(executor.Sh) == "" {
+		t.Skip("sh not available")
+	}
+	for _, command := range []string{"echo `rm -rf /`", `echo "$(rm -rf /)"`} {
+		_, result, err := server.BashHandler(context.Background(), nil, BashArguments{Command: command, Timeout: 5000, Shell: "sh"})
+		require.Error(t, err, command)
+		require.NotNil(t, result.Policy, command)
+		assert.Equal(t, "protected-path-delete", result.Policy.RuleID, command)
+	}
+}
+
+// TestApplyConfigLoadsPolicyFile 测试从配置加载策略文件，ask 判定在不支持确认时拒绝执行
+func TestApplyConfigLoadsPolicyFile(t *testing.T) {
+	defer security.SetDangerousPatterns(nil)
+	server := NewMCPServer()
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testPolicyYAML), 0o600))
+	cfg := config.Default()
+	cfg.Security.PolicyFile = path
+	cfg.Security.DangerousPatterns = []string{`^forbidden-tool`}
+	require.NoError(t, config.Validate(cfg))
+	require.NoError(t, server.ApplyConfig(cfg))
+
+	assert.True(t, security.IsDangerousCommand("forbidden-tool --now"), "dangerous_patterns 追加在策略文件之后")
+	assert.False(t, security.IsDangerousCommand("diskpart"), "策略文件替换内置策略")
+
+	_, result, err := server.BashHandler(context.Background(), nil, BashArguments{Command: "git push -f", Timeout: 5000})
+	require.Error(t, err)
+	assert.Contains(t, result.Output, "requires approval")
+	require.NotNil(t, result.Policy)
+	assert.Equal(t, policy.Ask, result.Policy.Verdict)
+
+	// 无效的策略文件不替换当前策略
+	require.NoError(t, os.WriteFile(path, []byte("rules:\n  - {id: x, verdict: maybe, commands: [x]}\n"), 0o600))
+	assert.Error(t, config.Validate(cfg))
+	assert.Error(t, server.ApplyConfig(cfg))
+	assert.Equal(t, policy.Ask, security.EvaluateCommand("git push -f", false).Verdict)
+}
+
+// TestAllowlistMode 测试 security.mode 为 allowlist 时 execution.allowed_commands 放行的命令，内置拒绝规则仍然优先
+func TestAllowlistMode(t *testing.T) {
+	cfg := config.Default()
+	cfg.Security.Mode = policy.ModeAllowlist
+	cfg.Execution.AllowedCommands = []string{"echo", "shutdown"}
+	require.NoError(t, config.Validate(cfg))
+	p, err := policy.FromConfig(cfg)
+	require.NoError(t, err)
+
+	assert.Equal(t, policy.Allow, p.Evaluate("echo hello").Verdict)
+	assert.Equal(t, "allowed-command-1", p.Evaluate("Write-Output hello").RuleID)
+	assert.Equal(t, policy.Deny, p.Evaluate("ls").Verdict)
+	assert.Equal(t, "shutdown", p.Evaluate("shutdown /s").RuleID)
+	assert.Equal(t, policy.Allow, p.Evaluate("shutdown").Verdict)
+
+	cfg.Security.Mode = "strict"
+	assert.Error(t, config.Validate(cfg))
+}
+
+// TestAllowlistModePOSIXShell 测试 allowlist 模式下在 sh 中执行时，命令替换中的命令也必须在允许列表中
+func TestAllowlistModePOSIXShell(t *testing.T) {
+	defer security.SetDangerousPatterns(nil)
+	cfg := config.Default()
+	cfg.Security.Mode = policy.ModeAllowlist
+	cfg.Execution.AllowedCommands = []string{"echo", "git"}
+	require.NoError(t, config.Validate(cfg))
+	p, err := policy.FromConfig(cfg)
+	require.NoError(t, err)
+
+	denied := map[string]string{
+		"git status `touch /tmp/pwn`": "touch /tmp/pwn",
+		"echo \"`id`\"":               "id",
+		"echo \"$(id)\"":              "id",
+		"echo ${x:-$(id)}":            "id",
+	}
+	for command, matched := range denied {
+		d := p.EvaluatePOSIX(command)
+		assert.Equal(t, policy.Deny, d.Verdict, command)
+		assert.Equal(t, "default", d.RuleID, command)
+		assert.Equal(t, matched, d.Command, command)
+	}
+	assert.Equal(t, policy.Allow, p.EvaluatePOSIX("echo \"$(git status)\" `echo hi`").Verdict)
+
+	server := NewMCPServer()
+	require.NoError(t, server.ApplyConfig(cfg))
+	if server.shellExecutor.GetShellPath(executor.Sh) == "" {
+		t.Skip("sh not available")
+	}
+	marker := filepath.Join(t.TempDir(), "pwn")
+	for _, command := range []string{"git status `touch " + marker + "`", "echo \"`touch " + marker + "`\""} {
+		_, result, err := server.BashHandler(context.Background(), nil, BashArguments{Command: command, Timeout: 5000, Shell: "sh"})
+		require.Error(t, err, command)
+		require.NotNil(t, result.Policy, command)
+		assert.Equal(t, "default", result.Policy.RuleID, command)
+	}
+	assert.NoFileExists(t, marker)
+}
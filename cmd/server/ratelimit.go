@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"mcp-bash-tools/internal/core"
+	"mcp-bash-tools/internal/security"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// 限流预算，每种预算独立计数
+const (
+	BudgetExecute    = "execute"    // 前台命令、会话命令和 session_open
+	BudgetBackground = "background" // 启动后台任务
+	BudgetOutput     = "output"     // bash_output 和 list_shells
+)
+
+// kill_shell 和 session_close 只释放资源，不受限流约束
+
+// rateLimits 按预算划分的限流器
+type rateLimits struct {
+	limiters map[string]*security.RateLimiter
+}
+
+// newRateLimits 根据配置创建限流器，未开启限流时返回nil
+func newRateLimits(cfg core.RateLimitConfig) *rateLimits {
+	if !cfg.Enabled {
+		return nil
+	}
+	budget := func(name string, perMinute, burst int) *security.RateLimiter {
+		return security.NewRateLimiter(security.RateLimiterConfig{
+			Name:  name,
+			RPS:   float64(perMinute) / 60,
+			Burst: burst,
+		})
+	}
+	return &rateLimits{limiters: map[string]*security.RateLimiter{
+		BudgetExecute:    budget(BudgetExecute, cfg.ExecutePerMinute, cfg.ExecuteBurst),
+		BudgetBackground: budget(BudgetBackground, cfg.BackgroundPerMinute, cfg.BackgroundBurst),
+		BudgetOutput:     budget(BudgetOutput, cfg.OutputPerMinute, cfg.OutputBurst),
+	}}
+}
+
+// cleanup 移除长时间未使用的令牌桶
+func (r *rateLimits) cleanup() {
+	for _, limiter := range r.limiters {
+		limiter.Cleanup()
+	}
+}
+
+// rateLimitKey 返回调用方的限流标识：开启认证时按用户（重新连接不能绕过限流），否则按连接
+func rateLimitKey(ctx context.Context) string {
+	if auth, ok := security.GetAuthContext(ctx); ok {
+		return "user:" + auth.UserID
+	}
+	if owner := ownerFrom(ctx); owner != "" {
+		return owner
+	}
+	return "stdio"
+}
+
+// allowCall 从调用方的预算中取一个令牌，超出限制时返回 *security.RateLimitError
+func (s *MCPServer) allowCall(ctx context.Context, budget string) *security.RateLimitError {
+	limits := s.rateLimits.Load()
+	if limits == nil {
+		return nil
+	}
+	var limitErr *security.RateLimitError
+	if err := limits.limiters[budget].Allow(rateLimitKey(ctx)); errors.As(err, &limitErr) {
+		return limitErr
+	}
+	return nil
+}
+
+// rateLimitedResult 返回限流时的工具结果
+// 以工具错误结果而非 error 返回，使结构化输出中的 retryAfterMs 能够到达客户端
+func rateLimitedResult(err *security.RateLimitError) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		IsError: true,
+		Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+	}
+}
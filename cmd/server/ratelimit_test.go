@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mcp-bash-tools/internal/config"
+	"mcp-bash-tools/internal/security"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTokenBucketFractionalRefill 测试令牌按时间连续补充，速率可以低于每秒一个
+func TestTokenBucketFractionalRefill(t *testing.T) {
+	bucket := security.NewTokenBucket(1, 20)
+	require.Nil(t, bucket.Allow())
+	limitErr := bucket.Allow()
+	require.NotNil(t, limitErr)
+	assert.InDelta(t, 50*time.Millisecond, limitErr.RetryAfter, float64(10*time.Millisecond))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Nil(t, bucket.Allow(), "a token should accrue well before a whole second has passed")
+
+	slow := security.NewRateLimiter(security.RateLimiterConfig{Name: "background", RPS: 0.5, Burst: 1})
+	require.NoError(t, slow.Allow("a"))
+	err := slow.Allow("a")
+	var rateErr *security.RateLimitError
+	require.ErrorAs(t, err, &rateErr)
+	assert.Equal(t, "background", rateErr.Limit)
+	assert.InDelta(t, 2*time.Second, rateErr.RetryAfter, float64(50*time.Millisecond))
+	assert.NoError(t, slow.Allow("b"), "identifiers have separate buckets")
+}
+
+// newRateLimitedServer 创建每种预算只允许一次调用的服务器
+func newRateLimitedServer(t *testing.T) *MCPServer {
+	cfg := config.Default()
+	cfg.RateLimit.ExecuteBurst = 1
+	cfg.RateLimit.BackgroundBurst = 1
+	cfg.RateLimit.OutputBurst = 1
+	cfg.RateLimit.ExecutePerMinute = 1
+	cfg.RateLimit.BackgroundPerMinute = 1
+	cfg.RateLimit.OutputPerMinute = 1
+	require.NoError(t, config.Validate(cfg))
+	server := NewMCPServerWithConfig(cfg)
+	t.Cleanup(server.Shutdown)
+	return server
+}
+
+// TestRateLimitBudgets 测试前台执行、后台任务和输出轮询使用独立预算，并返回 retryAfterMs
+func TestRateLimitBudgets(t *testing.T) {
+	server := newRateLimitedServer(t)
+	ctx := withOwner(context.Background(), "conn_a")
+
+	_, _, err := server.BashHandler(ctx, &mcp.CallToolRequest{}, BashArguments{Command: "echo one", Timeout: 5000})
+	require.NoError(t, err)
+	result, output, err := server.BashHandler(ctx, &mcp.CallToolRequest{}, BashArguments{Command: "echo two", Timeout: 5000})
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.True(t, result.IsError)
+	assert.Contains(t, output.Output, "rate limit exceeded for execute")
+	assert.Greater(t, output.RetryAfter, int64(0))
+
+	// 后台任务使用单独的预算
+	_, output, err = server.BashHandler(ctx, &mcp.CallToolRequest{}, BashArguments{Command: "echo bg", Timeout: 5000, RunInBackground: true})
+	require.NoError(t, err)
+	require.NotEmpty(t, output.ShellID)
+	background := output.ShellID
+	result, output, err = server.BashHandler(ctx, &mcp.CallToolRequest{}, BashArguments{Command: "echo bg", Timeout: 5000, RunInBackground: true})
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.True(t, result.IsError)
+	assert.Contains(t, output.Output, "background")
+
+	// 输出轮询和列出任务共用输出预算
+	_, _, err = server.ListShellsHandler(ctx, &mcp.CallToolRequest{}, ListShellsArguments{})
+	require.NoError(t, err)
+	result, _, err = server.BashOutputHandler(ctx, &mcp.CallToolRequest{}, BashOutputArguments{BashID: "anything"})
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.True(t, result.IsError)
+
+	// 输出预算用完后仍然可以终止任务
+	_, killed, err := server.KillShellHandler(ctx, &mcp.CallToolRequest{}, KillShellArguments{ShellID: "anything"})
+	assert.ErrorContains(t, err, "not found")
+	assert.NotContains(t, killed.Message, "rate limit")
+	_, killed, err = server.KillShellHandler(ctx, &mcp.CallToolRequest{}, KillShellArguments{ShellID: background})
+	require.NoError(t, err)
+	assert.Contains(t, killed.Message, "killed successfully")
+
+	// 其他连接有自己的预算
+	_, _, err = server.ListShellsHandler(withOwner(context.Background(), "conn_b"), &mcp.CallToolRequest{}, ListShellsArguments{})
+	assert.NoError(t, err)
+}
+
+// TestRateLimitByUser 测试开启认证时同一用户的多个连接共用预算
+func TestRateLimitByUser(t *testing.T) {
+	server := newRateLimitedServer(t)
+	first := asUser("conn_a", security.PermissionAll)
+	second := security.SetAuthContext(withOwner(context.Background(), "conn_b"), &security.AuthContext{UserID: "conn_a", Permissions: []string{security.PermissionAll}})
+
+	result, _, err := server.ListShellsHandler(first, &mcp.CallToolRequest{}, ListShellsArguments{})
+	require.NoError(t, err)
+	assert.Nil(t, result)
+	result, _, err = server.ListShellsHandler(second, &mcp.CallToolRequest{}, ListShellsArguments{})
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.True(t, result.IsError)
+}
+
+// TestRateLimitOverMCP 测试限流结果以带结构化 retryAfterMs 的工具错误返回给客户端
+func TestRateLimitOverMCP(t *testing.T) {
+	server := newRateLimitedServer(t)
+	mcpServer := newServer(server, "", &authState{})
+	addBashTools(mcpServer, server, "")
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	serverSession, err := mcpServer.Connect(context.Background(), serverTransport, nil)
+	require.NoError(t, err)
+	defer serverSession.Close()
+	session := connectClient(t, clientTransport)
+	defer session.Close()
+
+	_, isError := callTool(t, session, "list_shells", map[string]any{})
+	require.False(t, isError)
+	limited, isError := callTool(t, session, "list_shells", map[string]any{})
+	assert.True(t, isError)
+	assert.Greater(t, limited["retryAfterMs"], float64(0))
+}
+
+// TestRateLimitConfig 测试限流配置校验和重新加载
+func TestRateLimitConfig(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit.BackgroundBurst = 0
+	assert.Error(t, config.Validate(cfg))
+	cfg.RateLimit.Enabled = false
+	assert.NoError(t, config.Validate(cfg))
+
+	server := newRateLimitedServer(t)
+	ctx := withOwner(context.Background(), "conn_a")
+	_, _, err := server.ListShellsHandler(ctx, &mcp.CallToolRequest{}, ListShellsArguments{})
+	require.NoError(t, err)
+
+	// 限流设置未变时重新加载不会重置已消耗的令牌
+	same := *server.cfg()
+	same.Execution.MaxSessions = 5
+	require.NoError(t, server.ApplyConfig(&same))
+	result, _, _ := server.ListShellsHandler(ctx, &mcp.CallToolRequest{}, ListShellsArguments{})
+	require.NotNil(t, result)
+
+	// 关闭限流立即生效
+	disabled := same
+	disabled.RateLimit.Enabled = false
+	require.NoError(t, server.ApplyConfig(&disabled))
+	result, _, err = server.ListShellsHandler(ctx, &mcp.CallToolRequest{}, ListShellsArguments{})
+	require.NoError(t, err)
+	assert.Nil(t, result)
+}
+
+// TestReleaseOwnerIgnoresRateLimit 测试输出预算用尽后，连接断开仍然终止其后台任务
+func TestReleaseOwnerIgnoresRateLimit(t *testing.T) {
+	server := newRateLimitedServer(t)
+	ctx := withOwner(context.Background(), "conn_a")
+
+	_, output, err := server.BashHandler(ctx, &mcp.CallToolRequest{}, BashArguments{Command: "exec sleep 30", Timeout: 5000, Shell: "sh", RunInBackground: true})
+	require.NoError(t, err)
+	require.NotEmpty(t, output.ShellID)
+	_, _, err = server.ListShellsHandler(ctx, &mcp.CallToolRequest{}, ListShellsArguments{})
+	require.NoError(t, err)
+
+	server.ReleaseOwner("conn_a")
+
+	server.mutex.RLock()
+	_, exists := server.backgroundTasks[output.ShellID]
+	server.mutex.RUnlock()
+	assert.False(t, exists, "task should be killed and removed despite the exhausted output budget")
+}
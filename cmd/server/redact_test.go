@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mcp-bash-tools/internal/audit"
+	"mcp-bash-tools/internal/config"
+	"mcp-bash-tools/internal/executor"
+	"mcp-bash-tools/internal/redact"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 测试用的凭据在运行时拼接，避免源码被密钥扫描工具误报
+var testGitHubToken = "ghp_" + strings.Repeat("aB3dE5fG7h", 4)[:36]
+
+// TestRedactionConfigValidation 测试配置校验报告无效的检测器名和正则
+func TestRedactionConfigValidation(t *testing.T) {
+	cfg := config.Default()
+	assert.True(t, cfg.Redaction.Enabled)
+	cfg.Redaction.Patterns = []string{"(unclosed"}
+	cfg.Redaction.DisabledDetectors = []string{"no-such-detector"}
+	cfg.Redaction.Literals = []string{"abc"}
+	err := config.Validate(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown detector")
+	assert.Contains(t, err.Error(), "invalid pattern")
+}
+
+// TestBashHandlerRedactsOutput 测试前台、会话和后台命令的输出被屏蔽
+func TestBashHandlerRedactsOutput(t *testing.T) {
+	defer redact.SetCurrent(redact.Builtin())
+	server := NewMCPServer()
+	if server.shellExecutor.GetShellPath(executor.Sh) == "" {
+		t.Skip("sh not available")
+	}
+	cfg := config.Default()
+	cfg.Redaction.Literals = []string{"my-literal-secret"}
+	require.NoError(t, server.ApplyConfig(cfg))
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := audit.Open(path, audit.Options{})
+	require.NoError(t, err)
+	defer auditLog.Close()
+	server.audit = auditLog
+
+	// 令牌由 shell 拼接，命令本身不含完整的令牌；字面量分两次写入
+	command := `t=ghp_; printf 'GITHUB_TOKEN=%s%s\n' "$t" "` + testGitHubToken[4:] + `"; printf 'my-literal-' >&2; sleep 0.1; printf 'secret\n' >&2; sleep 0.1`
+
+	_, result, err := server.BashHandler(context.Background(), nil, BashArguments{Command: command, Timeout: 5000, Shell: "sh"})
+	require.NoError(t, err)
+	assert.Equal(t, "GITHUB_TOKEN=[REDACTED:github-token]\n", result.Stdout)
+	assert.Equal(t, "[REDACTED:literal]\n", result.Stderr)
+	assert.NotContains(t, result.Output, testGitHubToken)
+
+	_, started, err := server.BashHandler(context.Background(), nil, BashArguments{Command: command, Timeout: 5000, Shell: "sh", RunInBackground: true})
+	require.NoError(t, err)
+	// bash_output 每次只返回上次读取之后的新输出
+	var output strings.Builder
+	require.Eventually(t, func() bool {
+		_, page, err := server.BashOutputHandler(context.Background(), nil, BashOutputArguments{BashID: started.ShellID})
+		output.WriteString(page.Output)
+		return err == nil && page.Status != "running"
+	}, 10*time.Second, 50*time.Millisecond)
+	assert.Contains(t, output.String(), "GITHUB_TOKEN=[REDACTED:github-token]")
+	assert.Contains(t, output.String(), "[REDACTED:literal]")
+	assert.NotContains(t, output.String(), testGitHubToken[4:])
+
+	// 审计记录中的命令同样被屏蔽
+	_, _, err = server.BashHandler(context.Background(), nil, BashArguments{Command: "echo my-literal-secret", Timeout: 5000, Shell: "sh"})
+	require.NoError(t, err)
+	var commands []string
+	for _, r := range readAuditRecords(t, path) {
+		commands = append(commands, r.Command)
+	}
+	assert.Contains(t, commands, "echo [REDACTED:literal]")
+	assert.NotContains(t, strings.Join(commands, "\n"), "my-literal-secret")
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"mcp-bash-tools/internal/config"
+	"mcp-bash-tools/internal/core"
+	"mcp-bash-tools/internal/policy"
+	"mcp-bash-tools/internal/redact"
+	"mcp-bash-tools/internal/resources"
+)
+
+// ApplyConfig 原子替换运行时的安全和执行策略
+// 命令策略、输出屏蔽规则、资源限制、认证密钥、限流、超时范围、任务和会话上限以及保留策略立即生效；
+// 运行中的后台任务和已打开的会话保持启动时的设置继续执行。
+func (s *MCPServer) ApplyConfig(cfg *core.Config) error {
+	// 先加载命令策略，策略文件或模式无效时不修改任何配置
+	p, err := policy.FromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	redactor, err := redact.New(cfg.Redaction)
+	if err != nil {
+		return err
+	}
+	limiter, err := resources.New(cfg.Limits)
+	if err != nil {
+		return err
+	}
+	policy.SetCurrent(p)
+	redact.SetCurrent(redactor)
+	resources.SetCurrent(limiter)
+	// 限制机制无法执行的默认值不会生效，调用时显式指定这些项会被拒绝
+	defaults, _ := resources.Resolve(cfg.Limits, resources.Request{}, limiter)
+	if unsupported := limiter.Unsupported(defaults); len(unsupported) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: resource limits %s are not supported by the %s limiter and will not be enforced\n", strings.Join(unsupported, ", "), limiter.Name())
+	}
+	previous := s.config.Swap(cfg)
+	s.authManager.Store(newSecurityManager(cfg))
+	if previous == nil || previous.RateLimit != cfg.RateLimit {
+		// 限流设置未变时保留已消耗的令牌，避免重新加载清空限流状态
+		s.rateLimits.Store(newRateLimits(cfg.RateLimit))
+	}
+	s.sessions.SetMaxSessions(cfg.Execution.MaxSessions)
+
+	s.mutex.Lock()
+	s.retention = RetentionPolicyFromConfig(cfg.Retention)
+	s.mutex.Unlock()
+	return nil
+}
+
+// ConfigReloader 在配置文件或命令策略文件变更、或收到SIGHUP时重新加载配置
+type ConfigReloader struct {
+	server *MCPServer
+	args   []string // 启动时的命令行参数，重新加载后仍保持最高优先级
+	path   string   // 配置文件路径，为空时只响应信号和策略文件变更
+	stamps map[string]fileStamp
+}
+
+// fileStamp 文件的修改时间和大小
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewConfigReloader 创建配置重新加载器，path 为启动时使用的配置文件
+func NewConfigReloader(server *MCPServer, args []string, path string) *ConfigReloader {
+	r := &ConfigReloader{server: server, args: args, path: path, stamps: make(map[string]fileStamp)}
+	r.changed()
+	return r
+}
+
+// watchedFiles 返回需要检查变更的文件：配置文件和当前配置的命令策略文件
+func (r *ConfigReloader) watchedFiles() []string {
+	var files []string
+	if r.path != "" {
+		files = append(files, r.path)
+	}
+	if policyFile := r.server.cfg().Security.PolicyFile; policyFile != "" {
+		files = append(files, policyFile)
+	}
+	return files
+}
+
+// Reload 按原有优先级重新加载配置，失败时保留当前配置
+func (r *ConfigReloader) Reload() error {
+	cfg, _, err := config.Load(r.args, io.Discard)
+	if err != nil {
+		return err
+	}
+	return r.server.ApplyConfig(cfg)
+}
+
+// Watch 按 server.reload_interval 检查配置文件并响应重新加载信号，ctx 取消时退出
+func (r *ConfigReloader) Watch(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	if sigs := reloadSignals(); len(sigs) > 0 {
+		signal.Notify(signals, sigs...)
+		defer signal.Stop(signals)
+	}
+
+	for {
+		// 每轮重新读取检查间隔，使其本身也可以被重新加载
+		var timer *time.Timer
+		var tick <-chan time.Time
+		interval := r.server.cfg().Server.ReloadInterval
+		if len(r.watchedFiles()) > 0 && interval > 0 {
+			timer = time.NewTimer(interval)
+			tick = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			r.reload(sig.String())
+		case <-tick:
+			if r.changed() {
+				r.reload("config or policy file changed")
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// reload 重新加载配置并记录结果
+func (r *ConfigReloader) reload(reason string) {
+	if err := r.Reload(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to reload configuration (%s), keeping current settings: %v\n", reason, err)
+		return
+	}
+	// 记录新配置引用的策略文件的当前状态，避免下一轮检查时重复加载
+	r.changed()
+	fmt.Fprintf(os.Stderr, "Configuration reloaded (%s)\n", reason)
+}
+
+// changed 检查监视文件的修改时间和大小是否变化，并记录最新状态
+func (r *ConfigReloader) changed() bool {
+	changed := false
+	for _, file := range r.watchedFiles() {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		stamp := fileStamp{modTime: info.ModTime(), size: info.Size()}
+		if previous, ok := r.stamps[file]; ok && previous.modTime.Equal(stamp.modTime) && previous.size == stamp.size {
+			continue
+		}
+		r.stamps[file] = stamp
+		changed = true
+	}
+	return changed
+}
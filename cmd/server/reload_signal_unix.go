@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignals 返回触发配置重新加载的信号
+func reloadSignals() []os.Signal {
+	return []os.Signal{syscall.SIGHUP}
+}
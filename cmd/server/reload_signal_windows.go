@@ -0,0 +1,10 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// reloadSignals 返回触发配置重新加载的信号（Windows 没有 SIGHUP，只按文件变更重新加载）
+func reloadSignals() []os.Signal {
+	return nil
+}
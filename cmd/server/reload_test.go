@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"mcp-bash-tools/internal/config"
+	"mcp-bash-tools/internal/security"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestApplyConfigSwapsDangerousPatterns 测试替换危险命令模式，内置策略始终生效
+func TestApplyConfigSwapsDangerousPatterns(t *testing.T) {
+	defer security.SetDangerousPatterns(nil)
+	server := NewMCPServer()
+
+	cfg := config.Default()
+	cfg.Security.DangerousPatterns = []string{`forbidden-tool`}
+	require.NoError(t, server.ApplyConfig(cfg))
+	assert.True(t, security.IsDangerousCommand("forbidden-tool --now"))
+	assert.True(t, security.IsDangerousCommand("diskpart"), "自定义模式追加在内置策略之后")
+
+	_, result, err := server.BashHandler(context.Background(), nil, BashArguments{Command: "forbidden-tool", Timeout: 5000})
+	require.Error(t, err)
+	assert.Contains(t, result.Output, "security")
+
+	// 无效模式不替换任何配置
+	invalid := config.Default()
+	invalid.Security.DangerousPatterns = []string{`(unclosed`}
+	invalid.Execution.MaxTimeout = 2000
+	assert.Error(t, server.ApplyConfig(invalid))
+	assert.True(t, security.IsDangerousCommand("forbidden-tool"))
+	assert.Equal(t, 600000, server.cfg().Execution.MaxTimeout)
+
+	// 为空时只保留内置策略
+	require.NoError(t, server.ApplyConfig(config.Default()))
+	assert.True(t, security.IsDangerousCommand("diskpart"))
+	assert.False(t, security.IsDangerousCommand("forbidden-tool"))
+}
+
+// TestConfigReloaderKeepsRunningTasks 测试重新加载配置不影响运行中的后台任务
+func TestConfigReloaderKeepsRunningTasks(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "execution:\n  max_timeout: 600000\n")
+	server := NewMCPServer()
+	reloader := NewConfigReloader(server, []string{"-config", path}, path)
+	assert.False(t, reloader.changed())
+
+	_, started, err := server.BashHandler(context.Background(), nil, BashArguments{
+		Command:         "sleep 1",
+		Timeout:         5000,
+		Shell:           "sh",
+		RunInBackground: true,
+	})
+	if err != nil {
+		t.Skipf("sh not available: %v", err)
+	}
+
+	require.NoError(t, os.WriteFile(path, []byte("execution:\n  max_timeout: 2000\n  default_timeout: 2000\nretention:\n  ttl: 5m\n"), 0644))
+	require.True(t, reloader.changed())
+	require.NoError(t, reloader.Reload())
+	assert.Equal(t, 2000, server.cfg().Execution.MaxTimeout)
+	assert.Equal(t, 5*time.Minute, server.retention.TTL)
+
+	// 新限制立即生效
+	_, result, err := server.BashHandler(context.Background(), nil, BashArguments{Command: "echo x", Timeout: 5000})
+	require.Error(t, err)
+	assert.Contains(t, result.Output, "between 1000 and 2000 milliseconds")
+
+	// 运行中的任务继续执行到正常结束
+	require.Eventually(t, func() bool {
+		_, output, err := server.BashOutputHandler(context.Background(), nil, BashOutputArguments{BashID: started.ShellID})
+		return err == nil && output.Status == "completed" && output.ExitCode != nil && *output.ExitCode == 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// 无效配置保留当前设置
+	require.NoError(t, os.WriteFile(path, []byte("execution:\n  max_timeout: never\n"), 0644))
+	assert.Error(t, reloader.Reload())
+	assert.Equal(t, 2000, server.cfg().Execution.MaxTimeout)
+}
+
+// TestConfigReloaderWatch 测试轮询配置文件变更
+func TestConfigReloaderWatch(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "server:\n  reload_interval: 20ms\n")
+	cfg, _, err := config.Load([]string{"-config", path}, nil)
+	require.NoError(t, err)
+	server := NewMCPServerWithConfig(cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go NewConfigReloader(server, []string{"-config", path}, path).Watch(ctx)
+
+	// 确保修改时间与初始状态不同
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, os.WriteFile(path, []byte("server:\n  reload_interval: 20ms\nexecution:\n  max_sessions: 2\n"), 0644))
+	assert.Eventually(t, func() bool {
+		return server.cfg().Execution.MaxSessions == 2
+	}, 5*time.Second, 20*time.Millisecond)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"mcp-bash-tools/internal/core"
+)
+
+// DefaultJanitorInterval 未配置清理间隔时的默认运行间隔
+const DefaultJanitorInterval = 1 * time.Minute
+
+// RetentionPolicy 已结束后台任务的保留策略
+// 运行中的任务不受保留策略影响，其数量由 execution.max_concurrent_jobs 单独限制
+type RetentionPolicy struct {
+	TTL              time.Duration // 任务结束后的保留时长，0表示不按时间清理
+	MaxFinishedTasks int           // 最多保留的已结束任务数，0表示不限制
+	MaxOutputBytes   int64         // 已结束任务输出的总字节上限（内存中的输出加上溢出文件），0表示不限制
+	JanitorInterval  time.Duration // 清理协程的运行间隔
+}
+
+// RetentionPolicyFromConfig 根据配置创建保留策略
+func RetentionPolicyFromConfig(cfg core.RetentionConfig) RetentionPolicy {
+	return RetentionPolicy{
+		TTL:              cfg.TTL,
+		MaxFinishedTasks: cfg.MaxFinishedTasks,
+		MaxOutputBytes:   cfg.MaxOutputBytes,
+		JanitorInterval:  cfg.JanitorInterval,
+	}
+}
+
+// isTaskFinished 判断任务是否已结束
+func isTaskFinished(task *BackgroundTask) bool {
+	return task.Status != "running"
+}
+
+// taskFinishedAt 返回任务结束时间，未记录时使用开始时间
+func taskFinishedAt(task *BackgroundTask) time.Time {
+	if task.EndTime.IsZero() {
+		return task.StartTime
+	}
+	return task.EndTime
+}
+
+// retainedBytes 返回已结束任务占用的输出字节数：内存中的输出加上保存完整输出的溢出文件
+func retainedBytes(task *BackgroundTask) int64 {
+	size := int64(len(task.Output))
+	if task.TempFile != "" {
+		if info, err := os.Stat(task.TempFile); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// runningTaskCount 统计运行中的后台任务数（调用方需持有锁）
+func (s *MCPServer) runningTaskCount() int {
+	count := 0
+	for _, task := range s.backgroundTasks {
+		if !isTaskFinished(task) {
+			count++
+		}
+	}
+	return count
+}
+
+// pruneFinishedTasks 按保留策略清理已结束的任务，返回被清理的任务ID
+func (s *MCPServer) pruneFinishedTasks(now time.Time) []string {
+	var removed []string
+	var tempFiles []string
+
+	s.mutex.Lock()
+	policy := s.retention
+
+	finished := make([]*BackgroundTask, 0)
+	for _, task := range s.backgroundTasks {
+		if isTaskFinished(task) {
+			finished = append(finished, task)
+		}
+	}
+
+	// 从最早结束的任务开始清理
+	sort.Slice(finished, func(i, j int) bool {
+		return taskFinishedAt(finished[i]).Before(taskFinishedAt(finished[j]))
+	})
+
+	sizes := make(map[string]int64, len(finished))
+	var totalBytes int64
+	for _, task := range finished {
+		sizes[task.ID] = retainedBytes(task)
+		totalBytes += sizes[task.ID]
+	}
+
+	remaining := len(finished)
+	for _, task := range finished {
+		expired := policy.TTL > 0 && now.Sub(taskFinishedAt(task)) >= policy.TTL
+		overCount := policy.MaxFinishedTasks > 0 && remaining > policy.MaxFinishedTasks
+		overBytes := policy.MaxOutputBytes > 0 && totalBytes > policy.MaxOutputBytes
+		if !expired && !overCount && !overBytes {
+			// 任务按结束时间排序，后面的任务更新，不会因时间过期
+			break
+		}
+
+		delete(s.backgroundTasks, task.ID)
+		removed = append(removed, task.ID)
+		if task.TempFile != "" {
+			tempFiles = append(tempFiles, task.TempFile)
+		}
+		remaining--
+		totalBytes -= sizes[task.ID]
+	}
+	s.mutex.Unlock()
+
+	// 在锁外部清理临时文件
+	for _, tempFilePath := range tempFiles {
+		if err := os.Remove(tempFilePath); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove temp file %s: %v\n", tempFilePath, err)
+		}
+	}
+
+	return removed
+}
+
+// StartJanitor 启动定期清理已结束任务的协程，ctx 取消时退出
+// 每轮清理后重新读取运行间隔，重新加载配置后无需重启协程
+func (s *MCPServer) StartJanitor(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.janitorInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if removed := s.pruneFinishedTasks(now); len(removed) > 0 {
+					fmt.Fprintf(os.Stderr, "Janitor removed %d finished background tasks\n", len(removed))
+				}
+				if limits := s.rateLimits.Load(); limits != nil {
+					limits.cleanup()
+				}
+				ticker.Reset(s.janitorInterval())
+			}
+		}
+	}()
+}
+
+// janitorInterval 返回当前保留策略的清理间隔
+func (s *MCPServer) janitorInterval() time.Duration {
+	s.mutex.RLock()
+	interval := s.retention.JanitorInterval
+	s.mutex.RUnlock()
+	if interval <= 0 {
+		interval = DefaultJanitorInterval
+	}
+	return interval
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// RetentionTestSuite 任务保留策略测试套件
+type RetentionTestSuite struct {
+	suite.Suite
+	server *MCPServer
+	now    time.Time
+}
+
+// SetupTest 每个测试使用独立的服务器
+func (suite *RetentionTestSuite) SetupTest() {
+	suite.server = NewMCPServer()
+	suite.now = time.Now()
+}
+
+// addTask 添加一个测试任务，endedAgo 为0表示任务仍在运行
+func (suite *RetentionTestSuite) addTask(id string, endedAgo time.Duration, output string) {
+	task := &BackgroundTask{
+		ID:        id,
+		Command:   "echo " + id,
+		Output:    output,
+		Status:    "running",
+		StartTime: suite.now.Add(-endedAgo - time.Second),
+	}
+	if endedAgo > 0 {
+		task.Status = "completed"
+		task.EndTime = suite.now.Add(-endedAgo)
+	}
+
+	suite.server.mutex.Lock()
+	suite.server.backgroundTasks[id] = task
+	suite.server.mutex.Unlock()
+}
+
+// taskExists 判断任务是否仍被保留
+func (suite *RetentionTestSuite) taskExists(id string) bool {
+	suite.server.mutex.RLock()
+	defer suite.server.mutex.RUnlock()
+	_, exists := suite.server.backgroundTasks[id]
+	return exists
+}
+
+// TestTTL 测试超过保留时长的任务被清理
+func (suite *RetentionTestSuite) TestTTL() {
+	suite.server.retention = RetentionPolicy{TTL: 10 * time.Minute}
+	suite.addTask("old", 20*time.Minute, "")
+	suite.addTask("recent", time.Minute, "")
+	suite.addTask("running", 0, "")
+
+	removed := suite.server.pruneFinishedTasks(suite.now)
+
+	assert.Equal(suite.T(), []string{"old"}, removed)
+	assert.True(suite.T(), suite.taskExists("recent"))
+	assert.True(suite.T(), suite.taskExists("running"))
+}
+
+// TestMaxFinishedTasks 测试超过数量上限时清理最早结束的任务
+func (suite *RetentionTestSuite) TestMaxFinishedTasks() {
+	suite.server.retention = RetentionPolicy{MaxFinishedTasks: 2}
+	suite.addTask("first", 3*time.Minute, "")
+	suite.addTask("second", 2*time.Minute, "")
+	suite.addTask("third", time.Minute, "")
+	suite.addTask("running", 0, "")
+
+	removed := suite.server.pruneFinishedTasks(suite.now)
+
+	assert.Equal(suite.T(), []string{"first"}, removed)
+	assert.True(suite.T(), suite.taskExists("second"))
+	assert.True(suite.T(), suite.taskExists("third"))
+	assert.True(suite.T(), suite.taskExists("running"))
+}
+
+// TestMaxOutputBytes 测试超过输出总量上限时清理最早结束的任务
+func (suite *RetentionTestSuite) TestMaxOutputBytes() {
+	suite.server.retention = RetentionPolicy{MaxOutputBytes: 150}
+	suite.addTask("first", 3*time.Minute, strings.Repeat("a", 100))
+	suite.addTask("second", 2*time.Minute, strings.Repeat("b", 100))
+	suite.addTask("third", time.Minute, strings.Repeat("c", 10))
+	suite.addTask("running", 0, strings.Repeat("d", 1000))
+
+	removed := suite.server.pruneFinishedTasks(suite.now)
+
+	assert.Equal(suite.T(), []string{"first"}, removed)
+	assert.True(suite.T(), suite.taskExists("second"))
+	assert.True(suite.T(), suite.taskExists("running"))
+}
+
+// TestMaxOutputBytesCountsSpillFiles 测试输出总量包括溢出文件，清理任务时删除其溢出文件
+func (suite *RetentionTestSuite) TestMaxOutputBytesCountsSpillFiles() {
+	suite.server.retention = RetentionPolicy{MaxOutputBytes: 1000}
+	suite.addTask("first", 3*time.Minute, "head...tail")
+	suite.addTask("second", 2*time.Minute, "head...tail")
+	suite.addTask("third", time.Minute, strings.Repeat("c", 10))
+	spill := make(map[string]string)
+	for _, id := range []string{"first", "second"} {
+		spill[id] = filepath.Join(suite.T().TempDir(), id+".log")
+		require.NoError(suite.T(), os.WriteFile(spill[id], []byte(strings.Repeat("x", 800)), 0o600))
+		suite.server.backgroundTasks[id].TempFile = spill[id]
+		suite.server.backgroundTasks[id].Truncated = true
+	}
+
+	removed := suite.server.pruneFinishedTasks(suite.now)
+
+	assert.Equal(suite.T(), []string{"first"}, removed)
+	assert.NoFileExists(suite.T(), spill["first"])
+	assert.FileExists(suite.T(), spill["second"])
+	assert.True(suite.T(), suite.taskExists("second"))
+}
+
+// TestFinishedTasksDoNotBlockNewTasks 测试已结束任务不占用运行中任务的名额
+func (suite *RetentionTestSuite) TestFinishedTasksDoNotBlockNewTasks() {
+	// 关闭保留策略，确保已结束的任务全部保留
+	suite.server.retention = RetentionPolicy{}
+	for i := 0; i < suite.server.cfg().Execution.MaxConcurrentJobs; i++ {
+		suite.addTask(fmt.Sprintf("finished_%d", i), time.Minute, "")
+	}
+
+	_, result, err := suite.server.BashHandler(context.Background(), &mcp.CallToolRequest{}, BashArguments{
+		Command:         "echo retention",
+		Timeout:         5000,
+		RunInBackground: true,
+	})
+	require.NoError(suite.T(), err)
+	assert.NotEmpty(suite.T(), result.ShellID)
+}
+
+// TestRunningTaskLimit 测试运行中任务数量上限
+func (suite *RetentionTestSuite) TestRunningTaskLimit() {
+	for i := 0; i < suite.server.cfg().Execution.MaxConcurrentJobs; i++ {
+		suite.addTask(fmt.Sprintf("running_%d", i), 0, "")
+	}
+
+	_, result, err := suite.server.BashHandler(context.Background(), &mcp.CallToolRequest{}, BashArguments{
+		Command:         "echo retention",
+		Timeout:         5000,
+		RunInBackground: true,
+	})
+	require.Error(suite.T(), err)
+	assert.Contains(suite.T(), result.Output, "maximum running background tasks limit reached")
+}
+
+// TestJanitor 测试清理协程定期清理过期任务
+func (suite *RetentionTestSuite) TestJanitor() {
+	suite.server.retention = RetentionPolicy{TTL: time.Millisecond, JanitorInterval: 10 * time.Millisecond}
+	suite.addTask("expired", time.Minute, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	suite.server.StartJanitor(ctx)
+
+	assert.Eventually(suite.T(), func() bool {
+		return !suite.taskExists("expired")
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+// 运行保留策略测试套件
+func TestRetentionTestSuite(t *testing.T) {
+	suite.Run(t, new(RetentionTestSuite))
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mcp-bash-tools/internal/executor"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// SessionTestSuite 持久化会话测试套件
+type SessionTestSuite struct {
+	suite.Suite
+	server *MCPServer
+	shell  executor.ShellType
+}
+
+// SetupSuite 测试套件初始化
+func (suite *SessionTestSuite) SetupSuite() {
+	suite.server = NewMCPServer()
+	suite.shell = suite.server.shellExecutor.GetPreferredShell()
+	if suite.shell == executor.Unknown || suite.shell == executor.Cmd {
+		suite.T().Skip("no session-capable shell available")
+	}
+}
+
+// TearDownSuite 测试套件清理
+func (suite *SessionTestSuite) TearDownSuite() {
+	suite.server.sessions.CloseAll()
+}
+
+// pick 按会话Shell类型选择命令
+func (suite *SessionTestSuite) pick(powershell, posix string) string {
+	if suite.shell.IsPowerShell() {
+		return powershell
+	}
+	return posix
+}
+
+// openSession 打开一个会话并在测试结束时关闭
+func (suite *SessionTestSuite) openSession(args SessionOpenArguments) string {
+	_, result, err := suite.server.SessionOpenHandler(context.Background(), nil, args)
+	require.NoError(suite.T(), err)
+	require.True(suite.T(), strings.HasPrefix(result.SessionID, "session_"))
+	assert.Equal(suite.T(), suite.shell.String(), result.Shell)
+	assert.Greater(suite.T(), result.Pid, 0)
+	return result.SessionID
+}
+
+// run 在会话中执行命令
+func (suite *SessionTestSuite) run(sessionID, command string) BashResult {
+	_, result, err := suite.server.BashHandler(context.Background(), nil, BashArguments{
+		Command:   command,
+		Timeout:   10000,
+		SessionID: sessionID,
+	})
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), sessionID, result.SessionID)
+	return result
+}
+
+// TestStatePersistsAcrossCalls 测试工作目录和变量在调用之间保持
+func (suite *SessionTestSuite) TestStatePersistsAcrossCalls() {
+	sessionID := suite.openSession(SessionOpenArguments{})
+	defer suite.server.sessions.Close(sessionID)
+
+	dir := suite.T().TempDir()
+	result := suite.run(sessionID, "cd '"+dir+"'")
+	assert.Equal(suite.T(), 0, result.ExitCode)
+
+	result = suite.run(sessionID, "pwd")
+	assert.Equal(suite.T(), 0, result.ExitCode)
+	assert.Contains(suite.T(), result.Output, filepath.Base(dir))
+
+	suite.run(sessionID, suite.pick(`$env:MCP_SESSION_VAR = 'kept'`, `export MCP_SESSION_VAR=kept`))
+	result = suite.run(sessionID, suite.pick(`Write-Output "var=$env:MCP_SESSION_VAR"`, `echo "var=$MCP_SESSION_VAR"`))
+	assert.Equal(suite.T(), "var=kept", strings.TrimSpace(result.Output))
+
+	suite.run(sessionID, suite.pick(`function Get-McpGreeting { 'hello from function' }`, `mcp_greeting() { echo 'hello from function'; }`))
+	result = suite.run(sessionID, suite.pick(`Get-McpGreeting`, `mcp_greeting`))
+	assert.Contains(suite.T(), result.Output, "hello from function")
+}
+
+// TestPerCommandExitCode 测试每条命令独立返回退出码
+func (suite *SessionTestSuite) TestPerCommandExitCode() {
+	sessionID := suite.openSession(SessionOpenArguments{})
+	defer suite.server.sessions.Close(sessionID)
+
+	result := suite.run(sessionID, suite.pick(`Write-Output before; cmd /c exit 3`, `echo before; (exit 3)`))
+	assert.Equal(suite.T(), 3, result.ExitCode)
+	assert.Contains(suite.T(), result.Output, "before")
+
+	result = suite.run(sessionID, "echo after")
+	assert.Equal(suite.T(), 0, result.ExitCode)
+	assert.Equal(suite.T(), "after", strings.TrimSpace(result.Output))
+}
+
+// TestOutputWithoutTrailingNewline 测试末尾无换行的输出和引号处理
+func (suite *SessionTestSuite) TestOutputWithoutTrailingNewline() {
+	sessionID := suite.openSession(SessionOpenArguments{})
+	defer suite.server.sessions.Close(sessionID)
+
+	result := suite.run(sessionID, suite.pick(`[Console]::Out.Write("it's partial")`, `printf '%s' "it's partial"`))
+	assert.Equal(suite.T(), 0, result.ExitCode)
+	assert.Equal(suite.T(), "it's partial", result.Output)
+}
+
+// TestSeparateStreams 测试会话命令分别返回stdout和stderr
+func (suite *SessionTestSuite) TestSeparateStreams() {
+	sessionID := suite.openSession(SessionOpenArguments{})
+	defer suite.server.sessions.Close(sessionID)
+
+	result := suite.run(sessionID, suite.pick(`Write-Output out; [Console]::Error.WriteLine('err')`, `echo out; echo err >&2`))
+	assert.Equal(suite.T(), "out", strings.TrimSpace(result.Stdout))
+	assert.Equal(suite.T(), "err", strings.TrimSpace(result.Stderr))
+	assert.Contains(suite.T(), result.Output, "out")
+	assert.Contains(suite.T(), result.Output, "err")
+}
+
+// TestOpenWithCwdAndEnv 测试会话的初始工作目录和环境变量
+func (suite *SessionTestSuite) TestOpenWithCwdAndEnv() {
+	dir := suite.T().TempDir()
+	sessionID := suite.openSession(SessionOpenArguments{
+		Cwd: dir,
+		Env: map[string]string{"MCP_SESSION_INIT": "from-open"},
+	})
+	defer suite.server.sessions.Close(sessionID)
+
+	result := suite.run(sessionID, "pwd")
+	assert.Contains(suite.T(), result.Output, filepath.Base(dir))
+
+	result = suite.run(sessionID, suite.pick(`Write-Output $env:MCP_SESSION_INIT`, `echo "$MCP_SESSION_INIT"`))
+	assert.Equal(suite.T(), "from-open", strings.TrimSpace(result.Output))
+}
+
+// TestInvalidCombinations 测试与会话冲突的参数组合
+func (suite *SessionTestSuite) TestInvalidCombinations() {
+	sessionID := suite.openSession(SessionOpenArguments{})
+	defer suite.server.sessions.Close(sessionID)
+
+	cases := []BashArguments{
+		{Command: "echo x", Timeout: 5000, SessionID: sessionID, RunInBackground: true},
+		{Command: "echo x", Timeout: 5000, SessionID: sessionID, Cwd: suite.T().TempDir()},
+		{Command: "echo x", Timeout: 5000, SessionID: sessionID, Env: map[string]string{"A": "B"}},
+		{Command: "echo x", Timeout: 5000, SessionID: sessionID, Shell: "cmd"},
+		{Command: "echo x", Timeout: 5000, SessionID: "session_does_not_exist"},
+	}
+	for _, args := range cases {
+		_, result, err := suite.server.BashHandler(context.Background(), nil, args)
+		assert.Error(suite.T(), err)
+		assert.Equal(suite.T(), 1, result.ExitCode)
+	}
+}
+
+// TestTimeoutTerminatesSession 测试会话命令超时后会话被终止
+func (suite *SessionTestSuite) TestTimeoutTerminatesSession() {
+	sessionID := suite.openSession(SessionOpenArguments{})
+
+	_, result, err := suite.server.BashHandler(context.Background(), nil, BashArguments{
+		Command:   suite.pick("Start-Sleep -Seconds 30", "sleep 30"),
+		Timeout:   1000,
+		SessionID: sessionID,
+	})
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), result.Killed)
+
+	_, err = suite.server.sessions.Get(sessionID)
+	assert.ErrorIs(suite.T(), err, executor.ErrSessionNotFound)
+}
+
+// TestClose 测试关闭会话
+func (suite *SessionTestSuite) TestClose() {
+	sessionID := suite.openSession(SessionOpenArguments{})
+
+	_, result, err := suite.server.SessionCloseHandler(context.Background(), nil, SessionCloseArguments{SessionID: sessionID})
+	require.NoError(suite.T(), err)
+	assert.Contains(suite.T(), result.Message, "closed successfully")
+
+	_, _, err = suite.server.SessionCloseHandler(context.Background(), nil, SessionCloseArguments{SessionID: sessionID})
+	assert.Error(suite.T(), err)
+
+	_, _, err = suite.server.SessionCloseHandler(context.Background(), nil, SessionCloseArguments{})
+	assert.Error(suite.T(), err)
+}
+
+// TestOpenRejectsCmd 测试CMD不支持会话模式
+func (suite *SessionTestSuite) TestOpenRejectsCmd() {
+	_, err := executor.StartSession("cmd", executor.Cmd, executor.ExecOptions{})
+	assert.Error(suite.T(), err)
+}
+
+// TestSessionTestSuite 运行会话测试套件
+func TestSessionTestSuite(t *testing.T) {
+	suite.Run(t, new(SessionTestSuite))
+}
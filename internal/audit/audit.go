@@ -0,0 +1,432 @@
+package audit
+
+/*
+	命令审计日志
+
+	每条记录是一行JSON（JSON Lines），只追加不修改。记录之间以哈希链相连：
+	- prev_hash 为上一条记录的 hash，第一条记录为 GenesisHash
+	- hash = sha256(prev_hash + "\n" + 不含 hash 字段的记录JSON)，写入时 hash 作为最后一个字段追加
+	修改、删除或重排任何记录都会使之后的链校验失败。
+
+	文件超过大小上限时轮转为 <name>-<时间戳><ext>，新文件的第一条记录仍指向旧文件的最后一条，
+	因此按时间顺序拼接所有文件即可校验完整的链；超出保留数量或天数的旧文件会被删除，
+	此时链从剩余最早的记录开始校验。
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GenesisHash 链中第一条记录的 prev_hash
+const GenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// 审计事件类型
+const (
+	EventStart    = "command.start"    // 命令通过校验并开始执行
+	EventEnd      = "command.end"      // 命令结束（完成、失败、超时或被终止）
+	EventRejected = "command.rejected" // 命令被安全检查、权限或限流拒绝
+	EventKill     = "command.kill"     // 通过 kill_shell 请求终止后台任务
+)
+
+// 校验结论
+const (
+	VerdictAllowed  = "allowed"
+	VerdictRejected = "rejected"
+	VerdictApproved = "approved" // 命令策略要求确认，用户已确认
+)
+
+const (
+	maxLineSize      = 16 << 20                    // 校验时允许的最大记录长度
+	backupTimeFormat = "20060102T150405.000000000" // 轮转文件名中的时间戳
+)
+
+// Record 一条审计记录
+type Record struct {
+	Seq             uint64     `json:"seq"`
+	Time            time.Time  `json:"time"`
+	Event           string     `json:"event"`
+	ID              string     `json:"id,omitempty"`         // 关联同一次执行的各条记录
+	User            string     `json:"user,omitempty"`       // 认证用户，未开启认证时为空
+	Connection      string     `json:"connection,omitempty"` // 发起调用的连接
+	SessionID       string     `json:"session_id,omitempty"`
+	TaskID          string     `json:"task_id,omitempty"` // 后台任务ID（后台执行、超时转后台或输出溢出时）
+	Background      bool       `json:"background,omitempty"`
+	Shell           string     `json:"shell,omitempty"`
+	Cwd             string     `json:"cwd,omitempty"`
+	Command         string     `json:"command,omitempty"`
+	Description     string     `json:"description,omitempty"`
+	Verdict         string     `json:"verdict,omitempty"`
+	Reason          string     `json:"reason,omitempty"` // 拒绝原因或执行错误
+	Rule            string     `json:"rule,omitempty"`   // 拒绝命令或经用户确认的策略规则ID
+	StartTime       *time.Time `json:"start_time,omitempty"`
+	EndTime         *time.Time `json:"end_time,omitempty"`
+	ExitCode        *int       `json:"exit_code,omitempty"`
+	Killed          bool       `json:"killed,omitempty"`
+	OutputHash      string     `json:"output_hash,omitempty"`      // 合并输出的 sha256
+	OutputBytes     int64      `json:"output_bytes,omitempty"`     // 合并输出的总字节数
+	OutputTruncated bool       `json:"output_truncated,omitempty"` // 完整输出不可用，output_hash 只覆盖保留的首尾
+	PrevHash        string     `json:"prev_hash"`
+	Hash            string     `json:"hash,omitempty"`
+}
+
+// Options 审计日志的轮转设置，0表示不限制
+type Options struct {
+	MaxSize    int64         // 单个文件的最大字节数
+	MaxBackups int           // 保留的轮转文件数
+	MaxAge     time.Duration // 轮转文件的保留时长
+}
+
+// Logger 追加写入带哈希链的审计日志，并发安全
+type Logger struct {
+	mu       sync.Mutex
+	path     string
+	opts     Options
+	file     *os.File
+	size     int64
+	seq      uint64
+	lastHash string
+}
+
+// Open 打开（或创建）审计日志，并从已有记录的末尾继续哈希链
+func Open(path string, opts Options) (*Logger, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	l := &Logger{path: path, opts: opts, lastHash: GenesisHash}
+
+	// 当前文件为空时从最近的轮转文件继续
+	files, err := Files(path)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		last, err := lastRecord(files[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to resume audit log %s: %w", files[i], err)
+		}
+		if last != nil {
+			l.seq, l.lastHash = last.Seq, last.Hash
+			break
+		}
+	}
+
+	if err := l.openFile(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Path 返回当前审计日志文件路径
+func (l *Logger) Path() string {
+	return l.path
+}
+
+// Log 追加一条记录，填充序号、时间和哈希
+func (l *Logger) Log(r Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+
+	r.Seq = l.seq + 1
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	r.Time = r.Time.UTC()
+	r.PrevHash = l.lastHash
+	r.Hash = ""
+	body, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	hash := chainHash(r.PrevHash, body)
+	line := appendHash(body, hash)
+
+	if l.opts.MaxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.opts.MaxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	// 整行一次写入，进程中途退出时最多留下最后一行不完整
+	if _, err := l.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	l.size += int64(len(line))
+	l.seq, l.lastHash = r.Seq, hash
+	return nil
+}
+
+// Close 关闭审计日志
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// openFile 以追加模式打开当前文件
+func (l *Logger) openFile() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	l.file, l.size = f, info.Size()
+	return nil
+}
+
+// rotate 将当前文件改名为带时间戳的轮转文件，打开新文件并清理过期的轮转文件
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %w", err)
+	}
+	l.file = nil
+	ext := filepath.Ext(l.path)
+	backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(l.path, ext), time.Now().UTC().Format(backupTimeFormat), ext)
+	if err := os.Rename(l.path, backup); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	if err := l.openFile(); err != nil {
+		return err
+	}
+	l.prune()
+	return nil
+}
+
+// prune 删除超出保留数量或保留时长的轮转文件
+func (l *Logger) prune() {
+	backups, err := backupFiles(l.path)
+	if err != nil {
+		return
+	}
+	for i, backup := range backups {
+		remove := l.opts.MaxBackups > 0 && i < len(backups)-l.opts.MaxBackups
+		if !remove && l.opts.MaxAge > 0 {
+			if info, err := os.Stat(backup); err == nil && time.Since(info.ModTime()) > l.opts.MaxAge {
+				remove = true
+			}
+		}
+		if remove {
+			os.Remove(backup)
+		}
+	}
+}
+
+// Files 按时间顺序返回审计日志的所有文件：轮转文件在前，当前文件在最后
+func Files(path string) ([]string, error) {
+	files, err := backupFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// backupFiles 返回按时间排序的轮转文件（时间戳格式保证字典序即时间序）
+func backupFiles(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	matches, err := filepath.Glob(globEscape(base) + "-*" + globEscape(ext))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit log backups: %w", err)
+	}
+	backups := matches[:0]
+	for _, match := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(match, base+"-"), ext)
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	slices.Sort(backups)
+	return backups, nil
+}
+
+// globEscape 转义路径中的通配符（使用字符类，Windows路径分隔符不受影响）
+func globEscape(s string) string {
+	return strings.NewReplacer(`*`, `[*]`, `?`, `[?]`, `[`, `[[]`).Replace(s)
+}
+
+// lastRecord 读取文件中最后一条记录，文件不存在或为空时返回nil
+func lastRecord(path string) (*Record, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimRight(data, "\n")
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		data = data[i+1:]
+	}
+	var r Record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("last record is not valid JSON: %w", err)
+	}
+	if r.Hash == "" {
+		return nil, fmt.Errorf("last record has no hash")
+	}
+	return &r, nil
+}
+
+// chainHash 计算记录的链哈希
+func chainHash(prevHash string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prevHash))
+	h.Write([]byte("\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// appendHash 将 hash 作为最后一个字段追加到记录JSON，并加上换行
+func appendHash(body []byte, hash string) []byte {
+	line := make([]byte, 0, len(body)+len(hash)+12)
+	line = append(line, body[:len(body)-1]...)
+	line = append(line, `,"hash":"`...)
+	line = append(line, hash...)
+	line = append(line, "\"}\n"...)
+	return line
+}
+
+// VerifyResult 链校验结果
+type VerifyResult struct {
+	Records  int    // 校验的记录数
+	FirstSeq uint64 // 最早的记录序号，大于1表示更早的记录已被轮转删除
+	LastSeq  uint64
+	LastHash string
+}
+
+// VerifyError 描述链校验失败的位置
+type VerifyError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyFiles 按顺序校验多个文件组成的哈希链
+func VerifyFiles(paths []string) (VerifyResult, error) {
+	var result VerifyResult
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return result, err
+		}
+		err = verify(f, path, &result)
+		f.Close()
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// Verify 校验一个读取器中的哈希链
+func Verify(r io.Reader) (VerifyResult, error) {
+	var result VerifyResult
+	err := verify(r, "audit", &result)
+	return result, err
+}
+
+// verify 逐行校验记录的哈希、序号和与上一条记录的链接，result 在多个文件之间延续
+func verify(r io.Reader, name string, result *VerifyResult) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fail := func(format string, args ...any) error {
+			return &VerifyError{File: name, Line: line, Err: fmt.Errorf(format, args...)}
+		}
+
+		raw := scanner.Bytes()
+		var r Record
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return fail("invalid JSON: %v", err)
+		}
+		suffix := `,"hash":"` + r.Hash + `"}`
+		if len(r.Hash) != sha256.Size*2 || !bytes.HasSuffix(raw, []byte(suffix)) {
+			return fail("record must end with its hash field")
+		}
+		body := append(slices.Clone(raw[:len(raw)-len(suffix)]), '}')
+		if got := chainHash(r.PrevHash, body); got != r.Hash {
+			return fail("hash mismatch for seq %d: record was modified", r.Seq)
+		}
+
+		if result.Records == 0 {
+			// 链的起点：从第一条记录开始，或更早的记录已被轮转删除
+			if r.Seq == 1 && r.PrevHash != GenesisHash {
+				return fail("first record must link to the genesis hash")
+			}
+			result.FirstSeq = r.Seq
+		} else {
+			if r.PrevHash != result.LastHash {
+				return fail("seq %d does not link to seq %d: records were removed or reordered", r.Seq, result.LastSeq)
+			}
+			if r.Seq != result.LastSeq+1 {
+				return fail("seq %d follows seq %d", r.Seq, result.LastSeq)
+			}
+		}
+		result.Records++
+		result.LastSeq, result.LastHash = r.Seq, r.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return &VerifyError{File: name, Line: line + 1, Err: err}
+	}
+	return nil
+}
+
+// HashBytes 返回数据的 sha256 十六进制摘要
+func HashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashFile 返回文件内容的 sha256 十六进制摘要和字节数
+func HashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
@@ -0,0 +1,480 @@
+// Package config 加载服务器配置
+//
+// 配置来源按优先级从低到高依次为：
+//  1. 字段的 default 标签
+//  2. 配置文件（YAML/JSON/TOML，按扩展名识别），由 -config 参数或 MCP_BASH_CONFIG 环境变量指定
+//  3. 环境变量 MCP_BASH_<SECTION>_<KEY>，例如 MCP_BASH_EXECUTION_MAX_TIMEOUT
+//  4. 命令行参数 -<section>.<key>，例如 -execution.max_timeout=300000（常用键另有简写，如 -transport=http）
+//
+// 键名取自 core.Config 的 mapstructure 标签。列表类型在环境变量和命令行参数中以逗号分隔。
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"mcp-bash-tools/internal/core"
+	"mcp-bash-tools/internal/pathpolicy"
+	"mcp-bash-tools/internal/policy"
+	"mcp-bash-tools/internal/redact"
+	"mcp-bash-tools/internal/resources"
+	"mcp-bash-tools/internal/security"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EnvPrefix 配置环境变量前缀
+	EnvPrefix = "MCP_BASH_"
+	// ConfigFileEnvVar 指定配置文件路径的环境变量
+	ConfigFileEnvVar = "MCP_BASH_CONFIG"
+	// AllowedRootsEnvVar 允许的工作目录根列表（按系统路径列表分隔符分隔），
+	// 等同于 security.allowed_paths，优先级低于 MCP_BASH_SECURITY_ALLOWED_PATHS
+	AllowedRootsEnvVar = "MCP_BASH_ALLOWED_ROOTS"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// flagAliases 常用配置键的简写参数，例如 -transport=http 等同于 -server.transport=http
+var flagAliases = map[string]string{
+	"transport": "server.transport",
+}
+
+// field 配置项叶子字段
+type field struct {
+	value reflect.Value
+	tag   reflect.StructField
+}
+
+// EnvName 返回配置键对应的环境变量名
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Default 返回只包含默认值的配置
+func Default() *core.Config {
+	cfg := &core.Config{}
+	if err := applyDefaults(cfg); err != nil {
+		// default 标签写错属于编程错误
+		panic(err)
+	}
+	return cfg
+}
+
+// Load 按优先级加载配置，args 为不含程序名的命令行参数
+// 返回配置和实际使用的配置文件路径（未使用配置文件时为空）。
+// 命令行包含 -h/-help 时返回 flag.ErrHelp。
+func Load(args []string, output io.Writer) (*core.Config, string, error) {
+	cfg := &core.Config{}
+	if err := applyDefaults(cfg); err != nil {
+		return nil, "", err
+	}
+
+	fs, configPath := newFlagSet(cfg, output)
+	if err := fs.Parse(args); err != nil {
+		return nil, "", err
+	}
+
+	path := *configPath
+	if path == "" {
+		path = os.Getenv(ConfigFileEnvVar)
+	}
+	if path != "" {
+		if err := LoadFile(cfg, path); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, "", err
+	}
+
+	// 只应用显式指定的命令行参数
+	var flagErr error
+	fields := leafFields(cfg)
+	fs.Visit(func(f *flag.Flag) {
+		if flagErr != nil || f.Name == "config" {
+			return
+		}
+		key := f.Name
+		if target, ok := flagAliases[key]; ok {
+			key = target
+		}
+		if err := setValue(fields[key], f.Value.String()); err != nil {
+			flagErr = fmt.Errorf("flag -%s: %w", f.Name, err)
+		}
+	})
+	if flagErr != nil {
+		return nil, "", flagErr
+	}
+
+	if err := Validate(cfg); err != nil {
+		return nil, "", err
+	}
+	return cfg, path, nil
+}
+
+// LoadFile 将配置文件内容合并到 cfg，文件中未出现的键保持原值
+func LoadFile(cfg *core.Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	values := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".json":
+		err = json.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return fmt.Errorf("unsupported config file format: %s (expected .yaml, .yml, .json or .toml)", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if err := applyMap(reflect.ValueOf(cfg).Elem(), values, ""); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate 校验配置取值
+func Validate(cfg *core.Config) error {
+	exec := cfg.Execution
+	var errs []error
+	if exec.MinTimeout <= 0 || exec.MinTimeout > exec.MaxTimeout {
+		errs = append(errs, fmt.Errorf("execution.min_timeout must be positive and not greater than execution.max_timeout"))
+	}
+	if exec.DefaultTimeout < exec.MinTimeout || exec.DefaultTimeout > exec.MaxTimeout {
+		errs = append(errs, fmt.Errorf("execution.default_timeout must be between execution.min_timeout and execution.max_timeout"))
+	}
+	positive := map[string]int64{
+		"execution.max_concurrent_jobs":      int64(exec.MaxConcurrentJobs),
+		"execution.max_command_length":       int64(exec.MaxCommandLength),
+		"execution.max_id_length":            int64(exec.MaxIDLength),
+		"execution.max_sessions":             int64(exec.MaxSessions),
+		"execution.default_max_output_bytes": exec.DefaultMaxOutputBytes,
+		"execution.max_output_bytes_limit":   exec.MaxOutputBytesLimit,
+		"execution.done_wait_timeout":        int64(exec.DoneWaitTimeout),
+		"retention.janitor_interval":         int64(cfg.Retention.JanitorInterval),
+	}
+	for _, key := range sortedKeys(positive) {
+		if positive[key] <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", key))
+		}
+	}
+	if exec.KillGracePeriod < 0 {
+		errs = append(errs, fmt.Errorf("execution.kill_grace_period must not be negative"))
+	}
+	if exec.DefaultMaxOutputBytes > exec.MaxOutputBytesLimit {
+		errs = append(errs, fmt.Errorf("execution.default_max_output_bytes must not exceed execution.max_output_bytes_limit"))
+	}
+	if cfg.Retention.TTL < 0 || cfg.Retention.MaxFinishedTasks < 0 || cfg.Retention.MaxOutputBytes < 0 {
+		errs = append(errs, fmt.Errorf("retention limits must not be negative"))
+	}
+	switch cfg.Server.Transport {
+	case "stdio", "http":
+	default:
+		errs = append(errs, fmt.Errorf("server.transport must be stdio or http, got: %q", cfg.Server.Transport))
+	}
+	if cfg.Server.Transport == "http" && (cfg.Server.Port <= 0 || cfg.Server.Port > 65535) {
+		errs = append(errs, fmt.Errorf("server.port must be between 1 and 65535"))
+	}
+	if cfg.Server.MaxConns < 0 || cfg.Server.ReadTimeout < 0 || cfg.Server.WriteTimeout < 0 ||
+		cfg.Server.SessionTimeout < 0 || cfg.Server.ShutdownTimeout < 0 {
+		errs = append(errs, fmt.Errorf("server connection limits and timeouts must not be negative"))
+	}
+	if cfg.Server.ReloadInterval < 0 {
+		errs = append(errs, fmt.Errorf("server.reload_interval must not be negative"))
+	}
+	if cfg.Logging.MaxSize < 0 || cfg.Logging.MaxBackups < 0 || cfg.Logging.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("logging.max_size, max_backups and max_age must not be negative"))
+	}
+	if rl := cfg.RateLimit; rl.Enabled && (rl.ExecutePerMinute <= 0 || rl.ExecuteBurst <= 0 ||
+		rl.BackgroundPerMinute <= 0 || rl.BackgroundBurst <= 0 || rl.OutputPerMinute <= 0 || rl.OutputBurst <= 0) {
+		errs = append(errs, fmt.Errorf("rate_limit rates and bursts must be positive when rate_limit.enabled is true"))
+	}
+	if cfg.Security.EnableAuth {
+		if len(cfg.Security.APIKeys) == 0 && cfg.Security.JWTSecret == "" {
+			errs = append(errs, fmt.Errorf("security.enable_auth requires security.api_keys or security.jwt_secret"))
+		} else if _, err := security.NewAuthProvider(security.SecurityConfig{
+			APIKeys:   cfg.Security.APIKeys,
+			JWTSecret: cfg.Security.JWTSecret,
+		}, nil); err != nil {
+			errs = append(errs, fmt.Errorf("security: %w", err))
+		}
+	}
+	if _, err := policy.FromPatterns(cfg.Security.DangerousPatterns); err != nil {
+		errs = append(errs, fmt.Errorf("security.dangerous_patterns: %w", err))
+	}
+	if mode := cfg.Security.Mode; mode != policy.ModeBlocklist && mode != policy.ModeAllowlist {
+		errs = append(errs, fmt.Errorf("security.mode must be %s or %s, got %q", policy.ModeBlocklist, policy.ModeAllowlist, mode))
+	}
+	if cfg.Security.ApprovalTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("security.approval_timeout must be positive"))
+	}
+	if _, err := pathpolicy.New(cfg.Security.AllowedPaths, cfg.Security.BlockedPaths); err != nil {
+		errs = append(errs, fmt.Errorf("security: %w", err))
+	}
+	if cfg.Security.PolicyFile != "" {
+		if _, err := policy.Load(cfg.Security.PolicyFile); err != nil {
+			errs = append(errs, fmt.Errorf("security.policy_file: %w", err))
+		}
+	}
+	if err := resources.Validate(cfg.Limits); err != nil {
+		errs = append(errs, fmt.Errorf("limits: %w", err))
+	}
+	if _, err := redact.New(cfg.Redaction); err != nil {
+		errs = append(errs, fmt.Errorf("redaction: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// newFlagSet 为每个配置键注册命令行参数
+func newFlagSet(cfg *core.Config, output io.Writer) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("mcp-bash-tools", flag.ContinueOnError)
+	if output != nil {
+		fs.SetOutput(output)
+	}
+	configPath := fs.String("config", "", "config file path (.yaml, .yml, .json or .toml), env "+ConfigFileEnvVar)
+	fields := leafFields(cfg)
+	for _, key := range sortedKeys(fields) {
+		// 参数值在解析后统一由 setValue 转换，这里只登记名称
+		fs.String(key, formatValue(fields[key].value), "env "+EnvName(key))
+	}
+	for _, alias := range sortedKeys(flagAliases) {
+		key := flagAliases[alias]
+		fs.String(alias, formatValue(fields[key].value), "shorthand for -"+key)
+	}
+	return fs, configPath
+}
+
+// applyDefaults 按 default 标签设置默认值
+func applyDefaults(cfg *core.Config) error {
+	for key, f := range leafFields(cfg) {
+		def, ok := f.tag.Tag.Lookup("default")
+		if !ok {
+			continue
+		}
+		if err := setValue(f, def); err != nil {
+			return fmt.Errorf("invalid default for %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// applyEnv 应用 MCP_BASH_* 环境变量
+func applyEnv(cfg *core.Config) error {
+	fields := leafFields(cfg)
+	if roots, ok := os.LookupEnv(AllowedRootsEnvVar); ok {
+		cfg.Security.AllowedPaths = filepath.SplitList(roots)
+	}
+	for _, key := range sortedKeys(fields) {
+		value, ok := os.LookupEnv(EnvName(key))
+		if !ok {
+			continue
+		}
+		if err := setValue(fields[key], value); err != nil {
+			return fmt.Errorf("environment variable %s: %w", EnvName(key), err)
+		}
+	}
+	return nil
+}
+
+// leafFields 按点分键名收集配置的叶子字段
+func leafFields(cfg *core.Config) map[string]field {
+	fields := map[string]field{}
+	collectFields(reflect.ValueOf(cfg).Elem(), "", fields)
+	return fields
+}
+
+// collectFields 递归收集结构体字段，键名以 prefix 开头
+func collectFields(v reflect.Value, prefix string, fields map[string]field) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := sf.Tag.Get("mapstructure")
+		if name == "" {
+			continue
+		}
+		key := prefix + name
+		if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+			collectFields(v.Field(i), key+".", fields)
+			continue
+		}
+		fields[key] = field{value: v.Field(i), tag: sf}
+	}
+}
+
+// applyMap 将解析后的配置文件内容写入结构体，未知键视为错误
+func applyMap(v reflect.Value, values map[string]any, prefix string) error {
+	t := v.Type()
+	known := map[string]int{}
+	for i := 0; i < t.NumField(); i++ {
+		if name := t.Field(i).Tag.Get("mapstructure"); name != "" {
+			known[name] = i
+		}
+	}
+
+	for _, name := range sortedKeys(values) {
+		key := prefix + name
+		i, ok := known[name]
+		if !ok {
+			return fmt.Errorf("unknown key %q", key)
+		}
+		sf := t.Field(i)
+		raw := values[name]
+		if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+			section, ok := raw.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s must be a table", key)
+			}
+			if err := applyMap(v.Field(i), section, key+"."); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := setValue(field{value: v.Field(i), tag: sf}, raw); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// setValue 将字符串或配置文件解析出的值转换为字段类型并赋值
+func setValue(f field, raw any) error {
+	v := f.value
+	if v.Type() == durationType {
+		var d time.Duration
+		switch value := raw.(type) {
+		case string:
+			parsed, err := time.ParseDuration(strings.TrimSpace(value))
+			if err != nil {
+				return fmt.Errorf("invalid duration %q (expected a value like 30s or 5m)", value)
+			}
+			d = parsed
+		case time.Duration:
+			d = value
+		default:
+			return fmt.Errorf("invalid duration %v (expected a string like 30s or 5m)", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		value, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %v", raw)
+		}
+		v.SetString(value)
+	case reflect.Bool:
+		switch value := raw.(type) {
+		case bool:
+			v.SetBool(value)
+		case string:
+			parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				return fmt.Errorf("invalid boolean %q", value)
+			}
+			v.SetBool(parsed)
+		default:
+			return fmt.Errorf("expected a boolean, got %v", raw)
+		}
+	case reflect.Int, reflect.Int64:
+		n, err := toInt(raw)
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(n) {
+			return fmt.Errorf("value %d out of range", n)
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		var items []string
+		switch value := raw.(type) {
+		case string:
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+		case []any:
+			for _, item := range value {
+				s, ok := item.(string)
+				if !ok {
+					return fmt.Errorf("expected a list of strings, got element %v", item)
+				}
+				items = append(items, s)
+			}
+		case []string:
+			items = value
+		default:
+			return fmt.Errorf("expected a list of strings, got %v", raw)
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// toInt 转换整数值，浮点数必须是整数（JSON数字解析为float64）
+func toInt(raw any) (int64, error) {
+	switch value := raw.(type) {
+	case int:
+		return int64(value), nil
+	case int64:
+		return value, nil
+	case float64:
+		if value != float64(int64(value)) {
+			return 0, fmt.Errorf("expected an integer, got %v", value)
+		}
+		return int64(value), nil
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid integer %q", value)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("expected an integer, got %v", raw)
+	}
+}
+
+// formatValue 将字段值格式化为可在参数中使用的字符串
+func formatValue(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	if v.Kind() == reflect.Slice {
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = v.Index(i).String()
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// sortedKeys 返回排序后的键，保证错误信息和参数列表的顺序稳定
+func sortedKeys[V any](m map[string]V) []string {
+	return slices.Sorted(maps.Keys(m))
+}
@@ -115,41 +115,107 @@ type BackgroundTask struct {
 
 // 配置结构
 type Config struct {
-	Server      ServerConfig      `mapstructure:"server"`
-	Execution   ExecutionConfig   `mapstructure:"execution"`
-	Security    SecurityConfig    `mapstructure:"security"`
-	Logging     LoggingConfig     `mapstructure:"logging"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Execution ExecutionConfig `mapstructure:"execution"`
+	Limits    LimitsConfig    `mapstructure:"limits"`
+	Retention RetentionConfig `mapstructure:"retention"`
+	Security  SecurityConfig  `mapstructure:"security"`
+	Redaction RedactionConfig `mapstructure:"redaction"`
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	Logging   LoggingConfig   `mapstructure:"logging"`
 }
 
 type ServerConfig struct {
-	Host         string `mapstructure:"host" default:"localhost"`
-	Port         int    `mapstructure:"port" default:"8080"`
-	MaxConns     int    `mapstructure:"max_conns" default:"100"`
-	ReadTimeout  int    `mapstructure:"read_timeout" default:"30s"`
-	WriteTimeout int    `mapstructure:"write_timeout" default:"30s"`
+	Transport       string        `mapstructure:"transport" default:"stdio"` // stdio 或 http（同时提供 streamable HTTP 和 SSE）
+	Host            string        `mapstructure:"host" default:"localhost"`
+	Port            int           `mapstructure:"port" default:"8080"`
+	MaxConns        int           `mapstructure:"max_conns" default:"100"`
+	ReadTimeout     time.Duration `mapstructure:"read_timeout" default:"30s"`
+	WriteTimeout    time.Duration `mapstructure:"write_timeout" default:"30s"`    // 不适用于SSE事件流
+	SessionTimeout  time.Duration `mapstructure:"session_timeout" default:"30m"`  // streamable HTTP 空闲会话超时，0表示不超时
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout" default:"10s"` // 优雅关闭等待进行中请求的时间
+	ReloadInterval  time.Duration `mapstructure:"reload_interval" default:"5s"`   // 配置文件变更检查间隔，0表示只响应SIGHUP
 }
 
 type ExecutionConfig struct {
-	DefaultTimeout    int      `mapstructure:"default_timeout" default:"10000"` // 10秒
-	MaxTimeout        int      `mapstructure:"max_timeout" default:"600000"`    // 10分钟
-	MaxConcurrentJobs int      `mapstructure:"max_concurrent_jobs" default:"50"`
-	AllowedCommands   []string `mapstructure:"allowed_commands"`
-	BlockedCommands   []string `mapstructure:"blocked_commands"`
-	WorkingDir        string   `mapstructure:"working_dir"`
+	DefaultTimeout        int           `mapstructure:"default_timeout" default:"30000"`    // 30秒
+	MinTimeout            int           `mapstructure:"min_timeout" default:"1000"`         // 1秒
+	MaxTimeout            int           `mapstructure:"max_timeout" default:"600000"`       // 10分钟
+	MaxConcurrentJobs     int           `mapstructure:"max_concurrent_jobs" default:"50"`   // 同时运行的后台任务数
+	MaxCommandLength      int           `mapstructure:"max_command_length" default:"10000"` // 字符
+	MaxIDLength           int           `mapstructure:"max_id_length" default:"100"`        // shell_id/bash_id/session_id
+	MaxSessions           int           `mapstructure:"max_sessions" default:"10"`
+	DefaultMaxOutputBytes int64         `mapstructure:"default_max_output_bytes" default:"1048576"` // 1MB
+	MaxOutputBytesLimit   int64         `mapstructure:"max_output_bytes_limit" default:"16777216"`  // 16MB
+	DoneWaitTimeout       time.Duration `mapstructure:"done_wait_timeout" default:"5s"`             // 终止任务后等待退出的时长
+	KillGracePeriod       time.Duration `mapstructure:"kill_grace_period" default:"2s"`             // kill_shell 优雅终止时每个阶段的等待时长
+	AllowedCommands       []string      `mapstructure:"allowed_commands"`
+	BlockedCommands       []string      `mapstructure:"blocked_commands"`
+	WorkingDir            string        `mapstructure:"working_dir"` // 未指定 cwd 时命令和会话的工作目录，为空表示服务器的工作目录
+}
+
+// LimitsConfig 命令进程的资源限制，0表示不限制
+// 调用方可以为单次调用指定不超过 max_* 的限制；未配置默认值时使用上限
+type LimitsConfig struct {
+	MemoryMB      int    `mapstructure:"memory_mb"`    // 进程树的内存上限（没有 cgroup 时为每个进程的数据段上限）
+	CPUPercent    int    `mapstructure:"cpu_percent"`  // 占单个 CPU 核心的百分比，需要 cgroup 或 Windows Job Object
+	FileSizeMB    int    `mapstructure:"file_size_mb"` // 每个写入文件的大小上限，Windows 不支持
+	OpenFiles     int    `mapstructure:"open_files"`   // 每个进程的打开文件数上限，Windows 不支持
+	Processes     int    `mapstructure:"processes"`    // 同时存在的进程数上限，需要 cgroup 或 Windows Job Object
+	MaxMemoryMB   int    `mapstructure:"max_memory_mb"`
+	MaxCPUPercent int    `mapstructure:"max_cpu_percent"`
+	MaxFileSizeMB int    `mapstructure:"max_file_size_mb"`
+	MaxOpenFiles  int    `mapstructure:"max_open_files"`
+	MaxProcesses  int    `mapstructure:"max_processes"`
+	CgroupParent  string `mapstructure:"cgroup_parent"` // Linux：为每条命令创建子 cgroup 的 cgroup v2 目录，需委派 memory/cpu/pids 控制器
+}
+
+// RetentionConfig 已结束后台任务的保留策略，0表示不限制
+type RetentionConfig struct {
+	TTL              time.Duration `mapstructure:"ttl" default:"1h"`
+	MaxFinishedTasks int           `mapstructure:"max_finished_tasks" default:"100"`
+	MaxOutputBytes   int64         `mapstructure:"max_output_bytes" default:"67108864"` // 64MB，包括溢出文件
+	JanitorInterval  time.Duration `mapstructure:"janitor_interval" default:"1m"`
 }
 
 type SecurityConfig struct {
-	EnableValidation bool     `mapstructure:"enable_validation" default:"true"`
-	AllowedPaths     []string `mapstructure:"allowed_paths"`
-	BlockedPaths     []string `mapstructure:"blocked_paths"`
-	MaxFileSize      int64    `mapstructure:"max_file_size" default:"104857600"` // 100MB
+	AllowedPaths      []string      `mapstructure:"allowed_paths"`                     // 工作目录和命令写入/删除的路径必须位于其中某个根目录之下，为空表示不限制
+	BlockedPaths      []string      `mapstructure:"blocked_paths"`                     // 禁止作为工作目录或被命令写入/删除的路径，优先于 allowed_paths
+	MaxFileSize       int64         `mapstructure:"max_file_size" default:"104857600"` // 100MB
+	DangerousPatterns []string      `mapstructure:"dangerous_patterns"`                // 危险命令正则，每个正则一条 deny 规则，追加在内置策略或策略文件的规则之后
+	Mode              string        `mapstructure:"mode" default:"blocklist"`          // blocklist 只拦截策略拒绝的命令；allowlist 每个命令调用都必须匹配 allow 规则
+	PolicyFile        string        `mapstructure:"policy_file"`                       // YAML 命令策略文件，为空时使用内置策略
+	ApprovalTimeout   time.Duration `mapstructure:"approval_timeout" default:"2m"`     // 等待用户确认 ask 命令的时长
+	EnableAuth        bool          `mapstructure:"enable_auth" default:"false"`       // 要求客户端提供API密钥或JWT
+	APIKeys           []string      `mapstructure:"api_keys"`                          // 静态API密钥，格式 user:key 或 user:key:perm1+perm2
+	JWTSecret         string        `mapstructure:"jwt_secret"`                        // HS256 JWT 签名密钥
+}
+
+// RedactionConfig 屏蔽命令输出、日志和审计记录中的敏感信息，匹配的内容替换为 [REDACTED:检测器名]
+type RedactionConfig struct {
+	Enabled           bool     `mapstructure:"enabled" default:"true"`
+	DisabledDetectors []string `mapstructure:"disabled_detectors"` // 关闭的内置检测器，如 secret-assignment
+	Patterns          []string `mapstructure:"patterns"`           // 自定义正则（按行匹配），有捕获组时只替换第一个捕获组
+	Literals          []string `mapstructure:"literals"`           // 需要屏蔽的字面量，至少4个字符
+}
+
+// RateLimitConfig 工具调用限流（令牌桶），开启认证时按用户计数，否则按连接计数
+// 速率为每分钟补充的令牌数，按时间连续补充；burst 为可以连续调用的次数
+type RateLimitConfig struct {
+	Enabled             bool `mapstructure:"enabled" default:"true"`
+	ExecutePerMinute    int  `mapstructure:"execute_per_minute" default:"120"` // 前台命令、会话命令和 session_open
+	ExecuteBurst        int  `mapstructure:"execute_burst" default:"30"`
+	BackgroundPerMinute int  `mapstructure:"background_per_minute" default:"30"` // 启动后台任务
+	BackgroundBurst     int  `mapstructure:"background_burst" default:"20"`
+	OutputPerMinute     int  `mapstructure:"output_per_minute" default:"600"` // bash_output 和 list_shells
+	OutputBurst         int  `mapstructure:"output_burst" default:"100"`
 }
 
 type LoggingConfig struct {
 	Level      string `mapstructure:"level" default:"info"`
 	Format     string `mapstructure:"format" default:"json"`
-	Output     string `mapstructure:"output" default:"stdout"`
 	MaxSize    int    `mapstructure:"max_size" default:"100"`
 	MaxBackups int    `mapstructure:"max_backups" default:"3"`
 	MaxAge     int    `mapstructure:"max_age" default:"28"`
+	AuditFile  string `mapstructure:"audit_file"` // 命令审计日志（JSON Lines，哈希链），按 max_size(MB)/max_backups/max_age(天) 轮转，为空表示不记录
 }
\ No newline at end of file
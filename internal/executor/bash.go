@@ -8,6 +8,8 @@ import (
 	"os/exec"
 	"strings"
 	"time"
+
+	"mcp-bash-tools/internal/policy"
 )
 
 // BashExecutor PowerShell命令执行器
@@ -241,21 +243,10 @@ func (be *BashExecutor) ExecuteWithStreaming(command string, timeoutMs int,
 	}
 }
 
-// ValidateCommand 验证命令是否安全
+// ValidateCommand 验证命令是否安全：按当前命令策略判定
 func (be *BashExecutor) ValidateCommand(command string) error {
-	// 基本的安全检查 - 仅针对PowerShell命令
-	dangerousCommands := []string{
-		"del ", "rmdir ", "rd ", "format ", "shutdown ", "reboot ",
-		"reg delete", "reg add", "net user", "net localgroup",
-		"powershell -enc", "powershell -encodedcommand",
+	if decision := policy.Current().Evaluate(command); decision.Verdict != policy.Allow {
+		return fmt.Errorf("command rejected by policy: %s", decision)
 	}
-
-	cmdLower := strings.ToLower(command)
-	for _, dangerous := range dangerousCommands {
-		if strings.Contains(cmdLower, dangerous) {
-			return fmt.Errorf("dangerous command detected: %s", dangerous)
-		}
-	}
-
 	return nil
 }
@@ -0,0 +1,79 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"mcp-bash-tools/internal/resources"
+)
+
+// ExecOptions 单次命令执行的附加选项
+type ExecOptions struct {
+	Dir            string            // 工作目录，为空时使用服务器启动目录
+	Env            map[string]string // 额外环境变量，覆盖继承自服务器的同名变量
+	MaxOutputBytes int64             // 输出字节上限，超出时保留首尾并溢出到文件，<= 0 表示不限制
+	Limits         resources.Limits  // 进程树的资源限制，启动进程时应用
+}
+
+// BuildCommand 构建在指定Shell中执行命令的exec.Cmd
+// 命令在独立的进程组中启动（POSIX），ctx 为 nil 时创建不受context控制的命令
+func BuildCommand(ctx context.Context, shellPath string, shellType ShellType, command string, opts ExecOptions) (*exec.Cmd, error) {
+	args, err := shellType.BuildArgs(command)
+	if err != nil {
+		return nil, err
+	}
+
+	var cmd *exec.Cmd
+	if ctx != nil {
+		cmd = exec.CommandContext(ctx, shellPath, args...)
+		// context 结束时终止整个进程树，而不只是Shell进程
+		cmd.Cancel = func() error {
+			return KillProcessTree(cmd.Process)
+		}
+	} else {
+		cmd = exec.Command(shellPath, args...)
+	}
+	setProcessGroup(cmd)
+	setCommandLine(cmd, shellType, command)
+
+	cmd.Dir = opts.Dir
+	if len(opts.Env) > 0 {
+		cmd.Env = MergeEnv(os.Environ(), opts.Env)
+	}
+
+	return cmd, nil
+}
+
+// MergeEnv 将覆盖变量合并到基础环境变量列表中
+// Windows 上环境变量名不区分大小写，同名变量会被替换而不是重复追加
+func MergeEnv(base []string, overrides map[string]string) []string {
+	normalize := func(key string) string {
+		if runtime.GOOS == "windows" {
+			return strings.ToUpper(key)
+		}
+		return key
+	}
+
+	merged := make([]string, 0, len(base)+len(overrides))
+	for _, entry := range base {
+		key, _, _ := strings.Cut(entry, "=")
+		overridden := false
+		for overrideKey := range overrides {
+			if normalize(overrideKey) == normalize(key) {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			merged = append(merged, entry)
+		}
+	}
+
+	for key, value := range overrides {
+		merged = append(merged, key+"="+value)
+	}
+	return merged
+}
@@ -0,0 +1,148 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"unicode/utf8"
+)
+
+// SpillFilePattern 溢出文件的命名模式（与后台任务临时文件一致）
+const SpillFilePattern = "mcp_bash_output_*.txt"
+
+// tailSlack 尾部缓冲超出保留长度的余量，避免每次写入都复制
+const tailSlack = 64 * 1024
+
+// HeadTailBuffer 有上限的输出缓冲
+// 输出不超过上限时完整保留；超出后只保留开头和结尾各约一半，中间部分丢弃。
+// 启用溢出后，一旦超出上限，完整输出会写入临时文件供分页读取。
+type HeadTailBuffer struct {
+	limit     int64
+	headLimit int
+	tailLimit int
+	head      []byte
+	tail      []byte
+	total     int64
+
+	spill     bool
+	spillFile *os.File
+	spillErr  error
+}
+
+// NewHeadTailBuffer 创建输出缓冲，limit <= 0 表示不限制
+func NewHeadTailBuffer(limit int64) *HeadTailBuffer {
+	b := &HeadTailBuffer{limit: limit}
+	if limit > 0 {
+		b.headLimit = int(limit / 2)
+		b.tailLimit = int(limit) - b.headLimit
+	}
+	return b
+}
+
+// EnableSpill 启用溢出文件，超出上限时完整输出写入临时文件
+func (b *HeadTailBuffer) EnableSpill() {
+	b.spill = true
+}
+
+// Write 实现 io.Writer，始终返回写入成功（溢出文件写入失败只记录错误）
+func (b *HeadTailBuffer) Write(p []byte) (int, error) {
+	if b.limit <= 0 {
+		b.head = append(b.head, p...)
+		b.total += int64(len(p))
+		return len(p), nil
+	}
+
+	// 首次超出上限时，把此前的完整内容写入溢出文件
+	if b.spill && b.spillFile == nil && b.spillErr == nil && b.total+int64(len(p)) > b.limit {
+		b.spillFile, b.spillErr = os.CreateTemp("", SpillFilePattern)
+		if b.spillErr == nil {
+			b.writeSpill(b.head)
+			b.writeSpill(b.tail)
+		}
+	}
+	if b.spillFile != nil {
+		b.writeSpill(p)
+	}
+
+	written := len(p)
+	b.total += int64(written)
+	if room := b.headLimit - len(b.head); room > 0 {
+		n := min(room, len(p))
+		b.head = append(b.head, p[:n]...)
+		p = p[n:]
+	}
+	b.tail = append(b.tail, p...)
+	if len(b.tail) > b.tailLimit+tailSlack {
+		b.tail = append([]byte(nil), b.tail[len(b.tail)-b.tailLimit:]...)
+	}
+	return written, nil
+}
+
+// writeSpill 写入溢出文件，出错后停止写入
+func (b *HeadTailBuffer) writeSpill(p []byte) {
+	if b.spillFile == nil || len(p) == 0 {
+		return
+	}
+	if _, err := b.spillFile.Write(p); err != nil {
+		b.spillErr = err
+		b.spillFile.Close()
+		os.Remove(b.spillFile.Name())
+		b.spillFile = nil
+	}
+}
+
+// keptTail 返回实际保留的尾部内容
+func (b *HeadTailBuffer) keptTail() []byte {
+	if len(b.tail) > b.tailLimit && b.limit > 0 {
+		return b.tail[len(b.tail)-b.tailLimit:]
+	}
+	return b.tail
+}
+
+// Truncated 判断是否有内容被丢弃
+func (b *HeadTailBuffer) Truncated() bool {
+	return b.total > int64(len(b.head)+len(b.keptTail()))
+}
+
+// TotalBytes 返回写入的总字节数
+func (b *HeadTailBuffer) TotalBytes() int64 {
+	return b.total
+}
+
+// String 返回保留的内容，被截断时在开头和结尾之间插入省略标记
+func (b *HeadTailBuffer) String() string {
+	tail := b.keptTail()
+	if !b.Truncated() {
+		return string(b.head) + string(tail)
+	}
+
+	// 截断点可能落在多字节字符中间，调整到字符边界
+	head := b.head
+	for i := 0; i < utf8.UTFMax && len(head) > 0; i++ {
+		if r, size := utf8.DecodeLastRune(head); r != utf8.RuneError || size > 1 {
+			break
+		}
+		head = head[:len(head)-1]
+	}
+	for i := 0; i < utf8.UTFMax && len(tail) > 0 && !utf8.RuneStart(tail[0]); i++ {
+		tail = tail[1:]
+	}
+
+	omitted := b.total - int64(len(head)+len(tail))
+	return fmt.Sprintf("%s\n... [output truncated: %d bytes omitted] ...\n%s", head, omitted, tail)
+}
+
+// SpillPath 返回溢出文件路径，未发生溢出时为空
+func (b *HeadTailBuffer) SpillPath() string {
+	if b.spillFile == nil {
+		return ""
+	}
+	return b.spillFile.Name()
+}
+
+// Close 关闭溢出文件（文件保留，由调用方负责清理）
+func (b *HeadTailBuffer) Close() error {
+	if b.spillFile == nil {
+		return nil
+	}
+	return b.spillFile.Close()
+}
@@ -0,0 +1,30 @@
+package executor
+
+// KillMode 终止后台任务的方式
+type KillMode string
+
+const (
+	KillGraceful KillMode = "graceful" // 先发送中断/终止信号，宽限期后仍未退出再强制终止
+	KillForce    KillMode = "force"    // 直接强制终止进程树
+)
+
+// KillStage 结束进程树的终止阶段
+type KillStage string
+
+const (
+	StageExited    KillStage = "exited"    // 发送信号前进程已经退出
+	StageInterrupt KillStage = "interrupt" // SIGINT（POSIX）或 CTRL_BREAK（Windows）
+	StageTerminate KillStage = "terminate" // SIGTERM（仅 POSIX）
+	StageKill      KillStage = "kill"      // SIGKILL、Job Object 终止或 taskkill /F
+)
+
+// ParseKillMode 解析终止方式，空字符串表示 graceful
+func ParseKillMode(s string) (KillMode, bool) {
+	switch KillMode(s) {
+	case "", KillGraceful:
+		return KillGraceful, true
+	case KillForce:
+		return KillForce, true
+	}
+	return "", false
+}
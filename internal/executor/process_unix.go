@@ -0,0 +1,121 @@
+//go:build !windows
+
+package executor
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// killPollInterval 等待进程组退出时的检查间隔
+const killPollInterval = 20 * time.Millisecond
+
+// setProcessGroup 命令在独立的进程组中启动，终止时可以向Shell启动的所有子进程发送信号
+// 保留已有的 SysProcAttr 设置（如资源限制使用的 cgroup）
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// setCommandLine 只有 Windows 需要设置原样的命令行
+func setCommandLine(cmd *exec.Cmd, shellType ShellType, command string) {}
+
+// GracefulStop 依次向进程所在的进程组发送 SIGINT 和 SIGTERM，每次最多等待 grace
+// 返回结束进程组的阶段；进程组仍有进程存活时返回 false，由调用方强制终止
+func GracefulStop(p *os.Process, grace time.Duration) (KillStage, bool) {
+	pgid := p.Pid
+	steps := []struct {
+		sig   syscall.Signal
+		stage KillStage
+	}{
+		{syscall.SIGINT, StageInterrupt},
+		{syscall.SIGTERM, StageTerminate},
+	}
+	for _, step := range steps {
+		if err := signalGroup(pgid, step.sig); err != nil {
+			// 进程不是进程组组长（未通过 BuildCommand 启动）时交给强制终止处理
+			if errors.Is(err, os.ErrProcessDone) && p.Signal(syscall.Signal(0)) != nil {
+				return StageExited, true
+			}
+			return "", false
+		}
+		if waitGroupExit(pgid, grace) {
+			return step.stage, true
+		}
+	}
+	return "", false
+}
+
+// KillProcessTree 向进程所在的进程组发送 SIGKILL
+// 进程不是进程组组长（未通过 BuildCommand 启动）时只终止进程本身
+func KillProcessTree(p *os.Process) error {
+	err := signalGroup(p.Pid, syscall.SIGKILL)
+	if errors.Is(err, os.ErrProcessDone) {
+		return p.Kill()
+	}
+	return err
+}
+
+// killProcessGroup 强制终止进程组中剩余的进程（组长已退出时使用）
+func killProcessGroup(pgid int) {
+	signalGroup(pgid, syscall.SIGKILL)
+}
+
+// waitGroupExit 等待进程组中的进程全部退出，超过 timeout 时返回 false
+func waitGroupExit(pgid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if !groupAlive(pgid) {
+			return true
+		}
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(killPollInterval)
+	}
+}
+
+// groupAlive 判断进程组中是否还有未退出的进程
+// 已退出但未被回收的僵尸进程不计入（容器中的 PID 1 可能不回收孤儿进程）；没有 /proc 时只能依据信号检查
+func groupAlive(pgid int) bool {
+	if signalGroup(pgid, 0) != nil {
+		return false
+	}
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return true
+	}
+	group := strconv.Itoa(pgid)
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		stat, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		// 进程名（括号内）之后的字段依次为状态、父进程ID、进程组ID
+		fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+		if len(fields) > 2 && fields[2] == group && fields[0] != "Z" {
+			return true
+		}
+	}
+	return false
+}
+
+// signalGroup 向进程组发送信号，sig 为0时只检查进程组是否存在
+func signalGroup(pgid int, sig syscall.Signal) error {
+	err := syscall.Kill(-pgid, sig)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
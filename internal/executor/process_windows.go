@@ -0,0 +1,64 @@
+//go:build windows
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// setProcessGroup 命令在新的控制台进程组中启动，以便单独向它发送 CTRL_BREAK
+// 进程树由 Job Object 或 taskkill /T 终止
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= windows.CREATE_NEW_PROCESS_GROUP
+}
+
+// setCommandLine cmd.exe 使用原样的命令行，其他Shell使用按参数转义的命令行
+func setCommandLine(cmd *exec.Cmd, shellType ShellType, command string) {
+	if shellType != Cmd {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CmdLine = cmdLine(cmd.Path, command)
+}
+
+// GracefulStop 向进程所在的控制台进程组发送 CTRL_BREAK，最多等待 grace
+// Windows 没有可以发给任意进程的 SIGTERM；服务器没有控制台等原因导致发送失败时返回 false，由调用方强制终止
+func GracefulStop(p *os.Process, grace time.Duration) (KillStage, bool) {
+	handle, err := windows.OpenProcess(windows.SYNCHRONIZE, false, uint32(p.Pid))
+	if err != nil {
+		return "", false
+	}
+	defer windows.CloseHandle(handle)
+	if event, _ := windows.WaitForSingleObject(handle, 0); event == windows.WAIT_OBJECT_0 {
+		return StageExited, true
+	}
+	if err := windows.GenerateConsoleCtrlEvent(windows.CTRL_BREAK_EVENT, uint32(p.Pid)); err != nil {
+		return "", false
+	}
+	if event, _ := windows.WaitForSingleObject(handle, uint32(grace.Milliseconds())); event == windows.WAIT_OBJECT_0 {
+		return StageInterrupt, true
+	}
+	return "", false
+}
+
+// KillProcessTree 使用 taskkill /F /T 终止进程树，失败时回退到只终止进程本身
+func KillProcessTree(p *os.Process) error {
+	if err := exec.Command("taskkill", "/F", "/T", "/PID", fmt.Sprintf("%d", p.Pid)).Run(); err != nil {
+		return p.Kill()
+	}
+	return nil
+}
+
+// killProcessGroup Windows 进程退出后无法再按进程树查找其子进程
+func killProcessGroup(pgid int) {}
@@ -22,16 +22,19 @@ package executor
 */
 
 import (
-	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"sync"
 	"time"
+
+	"mcp-bash-tools/internal/pathpolicy"
+	"mcp-bash-tools/internal/policy"
+	"mcp-bash-tools/internal/resources"
 )
 
 // Enterprise-grade secure bash executor
@@ -47,7 +50,6 @@ type SecureBashExecutor struct {
 // ExecutionSecurity handles security policies
 type ExecutionSecurity struct {
 	allowedCommands map[string]bool
-	blockedCommands map[string]bool
 	allowedPaths    []string
 	blockedPaths    []string
 	maxMemory       int64
@@ -109,6 +111,8 @@ type ExecutionResult struct {
 	TimedOut           bool
 	Killed             bool
 	Success            bool
+	OutputTruncated    bool  // output exceeded the size limit; only head and tail were kept
+	TotalOutputBytes   int64 // total bytes produced on stdout and stderr
 }
 
 // ProcessMonitor tracks running processes
@@ -133,7 +137,6 @@ type ProcessInfo struct {
 func NewSecureBashExecutor() *SecureBashExecutor {
 	security := &ExecutionSecurity{
 		allowedCommands: make(map[string]bool),
-		blockedCommands: make(map[string]bool),
 		maxMemory:       512 * 1024 * 1024, // 512MB
 		maxCPU:          80.0,              // 80%
 		enableChroot:    false,
@@ -213,11 +216,13 @@ func (sbe *SecureBashExecutor) Execute(ctx context.Context, execCtx *ExecutionCo
 		return result, fmt.Errorf("failed to setup command: %w", err)
 	}
 
-	// Set up resource limits
-	sbe.setResourceLimits(cmd)
-
-	// Execute command with monitoring
-	result, err = sbe.executeWithMonitoring(ctx, cmd, execCtx.Timeout, result)
+	// Execute command with monitoring and resource limits
+	maxOutputSize := execCtx.MaxOutputSize
+	if maxOutputSize <= 0 {
+		maxOutputSize = sbe.maxOutputSize
+	}
+	limits := sbe.resourceLimits(execCtx.RequireSandbox)
+	result, err = sbe.executeWithMonitoring(ctx, cmd, execCtx.Timeout, maxOutputSize, limits, result)
 	if err != nil {
 		result.Success = false
 		return result, err
@@ -253,10 +258,7 @@ func (sbe *SecureBashExecutor) setupCommand(ctx context.Context, execCtx *Execut
 
 	// Set environment variables
 	if execCtx.EnvVars != nil {
-		cmd.Env = os.Environ()
-		for k, v := range execCtx.EnvVars {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
-		}
+		cmd.Env = MergeEnv(os.Environ(), execCtx.EnvVars)
 	}
 
 	return cmd, nil
@@ -287,7 +289,7 @@ func (sbe *SecureBashExecutor) setupSandboxCommand(ctx context.Context, execCtx
 	}
 }
 
-func (sbe *SecureBashExecutor) executeWithMonitoring(ctx context.Context, cmd *exec.Cmd, timeout time.Duration, result *ExecutionResult) (*ExecutionResult, error) {
+func (sbe *SecureBashExecutor) executeWithMonitoring(ctx context.Context, cmd *exec.Cmd, timeout time.Duration, maxOutputSize int64, limits resources.Limits, result *ExecutionResult) (*ExecutionResult, error) {
 	// Create pipes for output
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -300,45 +302,46 @@ func (sbe *SecureBashExecutor) executeWithMonitoring(ctx context.Context, cmd *e
 		return result, fmt.Errorf("failed to create stderr pipe: %w", err)
 	}
 
-	// Start command
-	if err := cmd.Start(); err != nil {
+	// Start command inside its resource limits
+	release, err := resources.Start(cmd, limits)
+	if err != nil {
 		stdout.Close()
 		stderr.Close()
 		return result, fmt.Errorf("failed to start command: %w", err)
 	}
 
-	// Monitor execution
+	// Collect output with head/tail size limit
+	capture := NewStreamCapture(maxOutputSize, false)
+	var collectors sync.WaitGroup
+	collectors.Add(2)
+	go sbe.collectOutput(stdout, capture.Stdout(), &collectors)
+	go sbe.collectOutput(stderr, capture.Stderr(), &collectors)
+
+	// Monitor execution; Wait must only be called after the pipes are drained
 	done := make(chan error, 1)
 	go func() {
-		done <- cmd.Wait()
+		collectors.Wait()
+		err := cmd.Wait()
+		release()
+		done <- err
 	}()
 
-	// Collect output with size limit
-	outputChan := make(chan string, 100)
-	errorChan := make(chan string, 100)
-
-	go sbe.collectOutput(stdout, outputChan, sbe.maxOutputSize)
-	go sbe.collectOutput(stderr, errorChan, sbe.maxOutputSize)
+	fillOutput := func() {
+		captured := capture.Result()
+		result.Output = captured.Stdout
+		result.ErrorOutput = captured.Stderr
+		result.OutputTruncated = captured.Truncated
+		result.TotalOutputBytes = captured.TotalBytes
+	}
 
 	// Wait for completion or timeout
 	select {
 	case err := <-done:
 		// Command completed
-		close(outputChan)
-		close(errorChan)
-
 		if cmd.ProcessState != nil {
 			result.ExitCode = cmd.ProcessState.ExitCode()
 		}
-
-		// Collect remaining output
-		for output := range outputChan {
-			result.Output += output + "\n"
-		}
-		for errOutput := range errorChan {
-			result.ErrorOutput += errOutput + "\n"
-		}
-
+		fillOutput()
 		return result, err
 
 	case <-time.After(timeout):
@@ -349,16 +352,7 @@ func (sbe *SecureBashExecutor) executeWithMonitoring(ctx context.Context, cmd *e
 		if cmd.Process != nil {
 			cmd.Process.Kill()
 		}
-
-		close(outputChan)
-		close(errorChan)
-
-		for output := range outputChan {
-			result.Output += output + "\n"
-		}
-		for errOutput := range errorChan {
-			result.ErrorOutput += errOutput + "\n"
-		}
+		fillOutput()
 
 		return result, fmt.Errorf("command timed out after %v", timeout)
 
@@ -369,38 +363,40 @@ func (sbe *SecureBashExecutor) executeWithMonitoring(ctx context.Context, cmd *e
 		if cmd.Process != nil {
 			cmd.Process.Kill()
 		}
-
-		close(outputChan)
-		close(errorChan)
+		fillOutput()
 
 		return result, ctx.Err()
 	}
 }
 
-func (sbe *SecureBashExecutor) collectOutput(pipe interface{}, outputChan chan<- string, maxSize int64) {
-	var scanner *bufio.Scanner
-
-	switch p := pipe.(type) {
-	case *os.File:
-		scanner = bufio.NewScanner(p)
-	default:
-		return
-	}
+// collectOutput copies a pipe into a bounded capture writer
+func (sbe *SecureBashExecutor) collectOutput(pipe io.Reader, w io.Writer, wg *sync.WaitGroup) {
+	defer wg.Done()
+	io.Copy(w, pipe)
+}
 
-	var currentSize int64
-	for scanner.Scan() {
-		line := scanner.Text()
-		if currentSize+int64(len(line)) > maxSize {
-			outputChan <- "[OUTPUT TRUNCATED - SIZE LIMIT EXCEEDED]"
-			break
+// resourceLimits returns the limits applied to a command: the sandbox limits for
+// sandboxed commands, otherwise the execution security limits. Limits the platform
+// limiter cannot enforce are ignored.
+func (sbe *SecureBashExecutor) resourceLimits(sandboxed bool) resources.Limits {
+	if sandboxed && sbe.sandbox != nil {
+		l := sbe.sandbox.resources
+		return resources.Limits{
+			MemoryBytes:   l.maxMemory,
+			CPUPercent:    int(l.maxCPU),
+			FileSizeBytes: l.maxDisk,
+			OpenFiles:     l.maxOpenFiles,
+			Processes:     l.maxProcesses,
 		}
-		outputChan <- line
-		currentSize += int64(len(line)) + 1 // +1 for newline
 	}
-}
 
-func (sbe *SecureBashExecutor) setResourceLimits(cmd *exec.Cmd) {
-	// Resource limits are handled by the sandbox on Windows
+	sbe.security.mutex.RLock()
+	defer sbe.security.mutex.RUnlock()
+	return resources.Limits{
+		MemoryBytes: sbe.security.maxMemory,
+		CPUPercent:  int(sbe.security.maxCPU),
+		Processes:   sbe.security.maxProcessCount,
+	}
 }
 
 func (sbe *SecureBashExecutor) validateCommand(command string) []string {
@@ -409,32 +405,16 @@ func (sbe *SecureBashExecutor) validateCommand(command string) []string {
 	sbe.security.mutex.RLock()
 	defer sbe.security.mutex.RUnlock()
 
-	lowerCommand := strings.ToLower(command)
-
-	// Check blocked commands
-	for blockedCmd := range sbe.security.blockedCommands {
-		if strings.Contains(lowerCommand, blockedCmd) {
-			violations = append(violations, fmt.Sprintf("blocked command detected: %s", blockedCmd))
-		}
+	// Evaluate against the shared command policy (same rules as the server's bash tool)
+	if decision := policy.Current().Evaluate(command); decision.Verdict != policy.Allow {
+		violations = append(violations, fmt.Sprintf("command policy verdict %s: %s", decision.Verdict, decision))
 	}
 
-	// Check for dangerous patterns (Windows only)
-	dangerousPatterns := []string{
-		`(?i).*format\s+[a-zA-Z]:.*`, // format C:
-		`(?i).*del\s+/[fFsS].*`,      // del /f /s
-		`(?i).*rmdir\s+/[sS].*`,      // rmdir /s
-		`(?i).*rd\s+/[sS].*`,         // rd /s
-		`(?i).*diskpart.*`,           // diskpart
-		`(?i).*shutdown\s+.*`,        // shutdown
-		`(?i).*stop-computer.*`,      // Stop-Computer
-		`(?i).*restart-computer.*`,   // Restart-Computer
-		`(?i).*%0\|%0.*`,             // Windows fork bomb
-	}
-
-	for _, pattern := range dangerousPatterns {
-		if matched, _ := regexp.MatchString(pattern, command); matched {
-			violations = append(violations, fmt.Sprintf("dangerous pattern detected: %s", pattern))
-		}
+	// Check paths written or deleted by the command against allowed/blocked paths
+	if paths, err := pathpolicy.New(sbe.security.allowedPaths, sbe.security.blockedPaths); err != nil {
+		violations = append(violations, err.Error())
+	} else if _, err := paths.CheckCommand(command, sbe.workingDir); err != nil {
+		violations = append(violations, fmt.Sprintf("path not allowed: %v", err))
 	}
 
 	// Check command length
@@ -475,28 +455,6 @@ func (sbe *SecureBashExecutor) ValidateCommand(command string) error {
 
 // ExecutionSecurity methods
 func (es *ExecutionSecurity) initializeDefaultPolicies() {
-	// Block dangerous commands (Windows only)
-	blockedCommands := []string{
-		// 文件删除命令
-		"del", "rmdir", "rd",
-		// 磁盘操作命令
-		"format", "diskpart",
-		// 系统控制命令
-		"shutdown", "reboot", "stop-computer", "restart-computer",
-		// 网络下载命令
-		"bitsadmin", "certutil",
-		// PowerShell 编码命令
-		"powershell -enc", "powershell -encodedcommand",
-		// 注册表操作
-		"reg delete", "reg add",
-		// 用户管理
-		"net user", "net localgroup",
-	}
-
-	for _, cmd := range blockedCommands {
-		es.blockedCommands[cmd] = true
-	}
-
 	// Allow safe commands (Windows compatible)
 	allowedCommands := []string{
 		// 文件浏览
@@ -517,29 +475,15 @@ func (es *ExecutionSecurity) initializeDefaultPolicies() {
 }
 
 func (es *ExecutionSecurity) isPathAllowed(path string) bool {
-	absPath, err := filepath.Abs(path)
+	paths, err := pathpolicy.New(es.allowedPaths, es.blockedPaths)
 	if err != nil {
 		return false
 	}
-
-	// Check blocked paths
-	for _, blocked := range es.blockedPaths {
-		if strings.HasPrefix(absPath, blocked) {
-			return false
-		}
-	}
-
-	// If allowed paths are specified, check against them
-	if len(es.allowedPaths) > 0 {
-		for _, allowed := range es.allowedPaths {
-			if strings.HasPrefix(absPath, allowed) {
-				return true
-			}
-		}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
 		return false
 	}
-
-	return true
+	return paths.CheckDir(absPath) == nil
 }
 
 // Utility methods
@@ -569,6 +513,6 @@ func (sbe *SecureBashExecutor) GetSecurityStatus() map[string]interface{} {
 		"working_directory":      sbe.workingDir,
 		"max_output_size":        sbe.maxOutputSize,
 		"allowed_commands_count": len(sbe.security.allowedCommands),
-		"blocked_commands_count": len(sbe.security.blockedCommands),
+		"policy_rules_count":     len(policy.Current().Rules),
 	}
 }
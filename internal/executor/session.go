@@ -0,0 +1,485 @@
+package executor
+
+/*
+	持久化Shell会话
+
+	每个会话对应一个长期运行的Shell进程，命令通过stdin逐条发送，
+	因此 cd、环境变量、导入的模块和定义的函数在多次调用之间保持不变。
+
+	输出分帧协议:
+	- 每条命令执行完毕后，Shell向stdout和stderr各写入一行哨兵标记
+	  (__MCP_DONE_<会话随机数>_<序号>__:<退出码>)
+	- 两个流都读到当前序号的哨兵后，该命令的输出即完整
+	- 哨兵之前同一行的内容（命令输出末尾没有换行时）仍归属于命令输出
+
+	仅支持PowerShell和POSIX Shell，CMD不支持会话模式。
+*/
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"mcp-bash-tools/internal/resources"
+)
+
+// 会话相关错误
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionBusy     = errors.New("session is busy executing another command")
+	ErrSessionClosed   = errors.New("session has exited")
+)
+
+// sessionCloseTimeout 关闭会话时等待Shell自行退出的时间
+const sessionCloseTimeout = 2 * time.Second
+
+// 输出流标识
+const (
+	streamStdout = iota
+	streamStderr
+)
+
+// sessionLine 会话输出中的一行
+type sessionLine struct {
+	stream int
+	text   string
+}
+
+// Session 持久化Shell会话
+type Session struct {
+	ID          string
+	Shell       ShellType
+	Dir         string
+	Description string
+	StartTime   time.Time
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	nonce  string
+	seq    int
+	runMu  sync.Mutex // 保证同一时间只执行一条命令
+	stateM sync.Mutex // 保护以下字段
+	lines  []sessionLine
+	active bool // 正在执行命令；空闲时到达的输出（如会话中的后台进程）直接丢弃
+	eof    [2]bool
+	notify chan struct{}
+	exited chan struct{}
+
+	lastUsed  time.Time
+	cwd       string // 调用方记录的当前工作目录，无法确定时为空
+	closeOnce sync.Once
+}
+
+// StartSession 启动一个新的持久化Shell会话
+func StartSession(shellPath string, shellType ShellType, opts ExecOptions) (*Session, error) {
+	args, err := sessionArgs(shellType)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(shellPath, args...)
+	cmd.Dir = opts.Dir
+	if len(opts.Env) > 0 {
+		cmd.Env = MergeEnv(cmd.Environ(), opts.Env)
+	}
+	setProcessGroup(cmd)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+
+	release, err := resources.Start(cmd, opts.Limits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session shell: %w", err)
+	}
+
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+
+	cwd := opts.Dir
+	if cwd == "" {
+		cwd, _ = os.Getwd()
+	}
+	session := &Session{
+		ID:        fmt.Sprintf("session_%s", uuid.New().String()),
+		Shell:     shellType,
+		Dir:       opts.Dir,
+		cwd:       cwd,
+		StartTime: time.Now(),
+		lastUsed:  time.Now(),
+		cmd:       cmd,
+		stdin:     stdin,
+		nonce:     hex.EncodeToString(nonce),
+		notify:    make(chan struct{}, 1),
+		exited:    make(chan struct{}),
+	}
+
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go session.readStream(stdout, streamStdout, &readers)
+	go session.readStream(stderr, streamStderr, &readers)
+	go func() {
+		readers.Wait()
+		cmd.Wait()
+		release()
+		close(session.exited)
+	}()
+
+	// PowerShell会话需要先设置UTF-8输出编码
+	if shellType.IsPowerShell() {
+		if _, err := io.WriteString(stdin, strings.TrimSpace(powerShellUTF8Prefix)+"\n"); err != nil {
+			session.Close()
+			return nil, fmt.Errorf("failed to initialize session: %w", err)
+		}
+	}
+
+	return session, nil
+}
+
+// sessionArgs 返回以stdin读取命令的方式启动Shell的参数
+func sessionArgs(shellType ShellType) ([]string, error) {
+	switch shellType {
+	case PowerShell7, PowerShell:
+		return []string{"-NoProfile", "-NoLogo", "-NonInteractive", "-Command", "-"}, nil
+	case Bash:
+		return []string{"--noprofile", "--norc", "-s"}, nil
+	case Zsh:
+		return []string{"-f", "-s"}, nil
+	case Sh:
+		return []string{"-s"}, nil
+	default:
+		return nil, fmt.Errorf("shell %s does not support persistent sessions", shellType.String())
+	}
+}
+
+// Pid 返回会话Shell进程的PID
+func (s *Session) Pid() int {
+	if s.cmd.Process == nil {
+		return 0
+	}
+	return s.cmd.Process.Pid
+}
+
+// LastUsed 返回会话最后一次执行命令的时间
+func (s *Session) LastUsed() time.Time {
+	s.stateM.Lock()
+	defer s.stateM.Unlock()
+	return s.lastUsed
+}
+
+// Cwd 返回记录的当前工作目录，初始为会话的工作目录，无法确定时为空
+func (s *Session) Cwd() string {
+	s.stateM.Lock()
+	defer s.stateM.Unlock()
+	return s.cwd
+}
+
+// SetCwd 记录会话中的命令改变后的工作目录（Shell状态由调用方推断，会话本身不跟踪）
+func (s *Session) SetCwd(dir string) {
+	s.stateM.Lock()
+	defer s.stateM.Unlock()
+	s.cwd = dir
+}
+
+// Exited 判断会话Shell进程是否已经退出
+func (s *Session) Exited() bool {
+	select {
+	case <-s.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// readStream 持续读取Shell的输出流
+func (s *Session) readStream(pipe io.Reader, stream int, wg *sync.WaitGroup) {
+	defer wg.Done()
+	reader := bufio.NewReader(pipe)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			s.stateM.Lock()
+			if s.active {
+				s.lines = append(s.lines, sessionLine{stream: stream, text: line})
+			}
+			s.stateM.Unlock()
+			s.signal()
+		}
+		if err != nil {
+			s.stateM.Lock()
+			s.eof[stream] = true
+			s.stateM.Unlock()
+			s.signal()
+			return
+		}
+	}
+}
+
+// signal 通知等待者有新的输出
+func (s *Session) signal() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run 在会话中执行一条命令，返回输出（合并及分流）和退出码
+// 超时或context取消时会终止整个会话，因为此时Shell的状态已不可知
+// maxOutputBytes 为输出字节上限（<= 0 表示不限制），超出时完整输出写入溢出文件
+func (s *Session) Run(ctx context.Context, command string, timeout time.Duration, maxOutputBytes int64) (ExecResult, error) {
+	if !s.runMu.TryLock() {
+		return ExecResult{ExitCode: -1}, ErrSessionBusy
+	}
+	defer s.runMu.Unlock()
+
+	if s.Exited() {
+		return ExecResult{ExitCode: -1}, ErrSessionClosed
+	}
+
+	s.seq++
+	token := fmt.Sprintf("__MCP_DONE_%s_%d__:", s.nonce, s.seq)
+
+	// 只收集本条命令执行期间的输出
+	s.stateM.Lock()
+	s.lines = nil
+	s.active = true
+	s.lastUsed = time.Now()
+	s.stateM.Unlock()
+	defer func() {
+		s.stateM.Lock()
+		s.lines = nil
+		s.active = false
+		s.stateM.Unlock()
+	}()
+
+	if _, err := io.WriteString(s.stdin, s.frameCommand(command, token)); err != nil {
+		s.shutdown(false)
+		return ExecResult{ExitCode: -1}, fmt.Errorf("failed to send command to session: %w", err)
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	capture := NewStreamCapture(maxOutputBytes, maxOutputBytes > 0)
+	writers := [2]io.Writer{capture.Stdout(), capture.Stderr()}
+	exitCode := -1
+	result := func() ExecResult {
+		res := capture.Result()
+		res.ExitCode = exitCode
+		return res
+	}
+	var done [2]bool
+
+	for {
+		// 取走已读取的输出，缓冲区只保留尚未处理的行，输出量不受限制时内存也不会增长
+		s.stateM.Lock()
+		pending := s.lines
+		s.lines = nil
+		eof := s.eof
+		s.stateM.Unlock()
+
+		for _, line := range pending {
+			if done[line.stream] {
+				continue
+			}
+			if idx := strings.Index(line.text, token); idx >= 0 {
+				// 哨兵之前的内容是命令输出中没有换行结尾的最后一行
+				io.WriteString(writers[line.stream], line.text[:idx])
+				done[line.stream] = true
+				if line.stream == streamStdout {
+					code := strings.TrimSpace(line.text[idx+len(token):])
+					if parsed, err := strconv.Atoi(code); err == nil {
+						exitCode = parsed
+					}
+				}
+				continue
+			}
+			io.WriteString(writers[line.stream], line.text)
+		}
+
+		if done[streamStdout] && done[streamStderr] {
+			return result(), nil
+		}
+		if eof[streamStdout] && eof[streamStderr] {
+			exitCode = -1
+			return result(), ErrSessionClosed
+		}
+
+		select {
+		case <-s.notify:
+		case <-s.exited:
+			// 进程退出后再读取一次剩余输出
+			s.signal()
+		case <-ctx.Done():
+			s.shutdown(false)
+			exitCode = -1
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return result(), fmt.Errorf("session command timed out after %v, session terminated: %w", timeout, context.DeadlineExceeded)
+			}
+			return result(), ctx.Err()
+		}
+	}
+}
+
+// frameCommand 将命令包装为带哨兵标记的单行脚本
+func (s *Session) frameCommand(command, token string) string {
+	if s.Shell.IsPowerShell() {
+		// 使用Base64传递命令，避免引号和换行破坏单行协议
+		// 点调用脚本块使变量、函数和模块保留在会话作用域中
+		encoded := base64.StdEncoding.EncodeToString([]byte(command))
+		return fmt.Sprintf("$global:LASTEXITCODE = 0; "+
+			"try { . ([ScriptBlock]::Create([Text.Encoding]::UTF8.GetString([Convert]::FromBase64String('%s')))) | Out-Default; $__mcpOk = $? } "+
+			"catch { $__mcpOk = $false; [Console]::Error.WriteLine($_.ToString()) }; "+
+			"$__mcpCode = if ($LASTEXITCODE) { $LASTEXITCODE } elseif ($__mcpOk) { 0 } else { 1 }; "+
+			"[Console]::Out.WriteLine('%s' + $__mcpCode); [Console]::Error.WriteLine('%s' + $__mcpCode)\n",
+			encoded, token, token)
+	}
+
+	// POSIX Shell: 单引号包裹命令交给eval，stdin重定向避免命令读取协议输入
+	quoted := "'" + strings.ReplaceAll(command, "'", `'\''`) + "'"
+	return fmt.Sprintf("eval %s </dev/null; __mcp_ec=$?; printf '%%s%%d\\n' '%s' \"$__mcp_ec\"; printf '%%s%%d\\n' '%s' \"$__mcp_ec\" >&2\n",
+		quoted, token, token)
+}
+
+// Close 关闭会话，先请求Shell正常退出，超时后强制终止
+func (s *Session) Close() error {
+	s.shutdown(true)
+	return nil
+}
+
+// shutdown 终止会话Shell进程及其启动的子进程，graceful 为false时直接强制终止
+// 强制终止后不等待输出流结束，因为Shell启动的子进程可能仍持有管道
+func (s *Session) shutdown(graceful bool) {
+	s.closeOnce.Do(func() {
+		if graceful {
+			io.WriteString(s.stdin, "exit\n")
+			s.stdin.Close()
+			select {
+			case <-s.exited:
+				// Shell已退出，它在后台启动的子进程仍留在进程组中
+				killProcessGroup(s.cmd.Process.Pid)
+				return
+			case <-time.After(sessionCloseTimeout):
+			}
+		} else {
+			s.stdin.Close()
+		}
+		if s.cmd.Process != nil {
+			KillProcessTree(s.cmd.Process)
+		}
+	})
+}
+
+// SessionManager 管理所有持久化会话
+type SessionManager struct {
+	sessions    map[string]*Session
+	maxSessions int
+	mutex       sync.Mutex
+}
+
+// NewSessionManager 创建会话管理器，maxSessions 为最大并存会话数
+func NewSessionManager(maxSessions int) *SessionManager {
+	return &SessionManager{
+		sessions:    make(map[string]*Session),
+		maxSessions: maxSessions,
+	}
+}
+
+// SetMaxSessions 调整最大并存会话数，已打开的会话不受影响
+func (m *SessionManager) SetMaxSessions(maxSessions int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.maxSessions = maxSessions
+}
+
+// Open 启动并登记一个新会话
+func (m *SessionManager) Open(shellPath string, shellType ShellType, opts ExecOptions) (*Session, error) {
+	m.mutex.Lock()
+	m.pruneExitedLocked()
+	if m.maxSessions > 0 && len(m.sessions) >= m.maxSessions {
+		count := len(m.sessions)
+		m.mutex.Unlock()
+		return nil, fmt.Errorf("maximum sessions limit reached (%d/%d)", count, m.maxSessions)
+	}
+	m.mutex.Unlock()
+
+	session, err := StartSession(shellPath, shellType, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	m.sessions[session.ID] = session
+	m.mutex.Unlock()
+	return session, nil
+}
+
+// Get 获取会话
+func (m *SessionManager) Get(id string) (*Session, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	session, exists := m.sessions[id]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	return session, nil
+}
+
+// Close 关闭并移除会话
+func (m *SessionManager) Close(id string) error {
+	m.mutex.Lock()
+	session, exists := m.sessions[id]
+	delete(m.sessions, id)
+	m.mutex.Unlock()
+
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	return session.Close()
+}
+
+// CloseAll 关闭所有会话（服务器退出时调用）
+func (m *SessionManager) CloseAll() {
+	m.mutex.Lock()
+	sessions := m.sessions
+	m.sessions = make(map[string]*Session)
+	m.mutex.Unlock()
+
+	for _, session := range sessions {
+		session.Close()
+	}
+}
+
+// pruneExitedLocked 移除Shell进程已经退出的会话（调用方需持有锁）
+func (m *SessionManager) pruneExitedLocked() {
+	for id, session := range m.sessions {
+		if session.Exited() {
+			delete(m.sessions, id)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+//go:build !windows
+
+package executor
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buffered 返回会话缓冲中尚未处理的输出行数
+func (s *Session) buffered() int {
+	s.stateM.Lock()
+	defer s.stateM.Unlock()
+	return len(s.lines)
+}
+
+// TestSessionOutputBufferBounded 测试超过输出上限的输出和空闲时后台进程的输出都不会留在会话缓冲中
+func TestSessionOutputBufferBounded(t *testing.T) {
+	shellPath, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	session, err := StartSession(shellPath, Sh, ExecOptions{})
+	require.NoError(t, err)
+	defer session.Close()
+
+	result, err := session.Run(context.Background(), "yes | head -n 200000", 10*time.Second, 4096)
+	require.NoError(t, err)
+	assert.True(t, result.Truncated)
+	assert.Zero(t, session.buffered())
+	if result.OutputFile != "" {
+		defer os.Remove(result.OutputFile)
+	}
+
+	// 会话空闲时后台进程持续输出
+	_, err = session.Run(context.Background(), "(sleep 0.1; yes | head -n 200000) &", 10*time.Second, 4096)
+	require.NoError(t, err)
+	time.Sleep(500 * time.Millisecond)
+	assert.Zero(t, session.buffered())
+
+	result, err = session.Run(context.Background(), "echo ok", 10*time.Second, 4096)
+	require.NoError(t, err)
+	assert.Equal(t, "ok\n", result.Output)
+}
@@ -1,12 +1,16 @@
 package executor
 
 /*
-	Windows专用Shell执行器 - 仅支持PowerShell
-	本模块专为Windows设计，仅支持以下Shell:
+	Shell执行器 - 以PowerShell为主，兼容POSIX Shell
+	按优先级检测以下Shell:
 	- PowerShell 7+ (pwsh)
 	- Windows PowerShell 5.x (powershell)
+	- Bash (bash)
+	- Zsh (zsh)
+	- POSIX sh (sh)
+	- CMD (cmd，仅在调用方显式指定时使用)
 
-	不支持Git Bash、CMD或其他Shell。
+	POSIX Shell用于Linux CI容器和WSL等没有PowerShell的环境。
 */
 
 import (
@@ -17,6 +21,8 @@ import (
 	"os/exec"
 	"strings"
 	"time"
+
+	"mcp-bash-tools/internal/resources"
 )
 
 // ShellType 定义Shell类型
@@ -25,9 +31,19 @@ type ShellType int
 const (
 	PowerShell7 ShellType = iota
 	PowerShell
+	Bash
+	Sh
+	Zsh
+	Cmd
 	Unknown
 )
 
+// DefaultShellPreference 默认的Shell优先级顺序（从高到低）
+var DefaultShellPreference = []ShellType{PowerShell7, PowerShell, Bash, Zsh, Sh, Cmd}
+
+// powerShellUTF8Prefix 强制PowerShell控制台输出编码为UTF-8 (CodePage 65001)
+const powerShellUTF8Prefix = "[Console]::OutputEncoding=[System.Text.Encoding]::UTF8; "
+
 // String 返回Shell类型的字符串表示
 func (s ShellType) String() string {
 	switch s {
@@ -35,11 +51,96 @@ func (s ShellType) String() string {
 		return "pwsh"
 	case PowerShell:
 		return "powershell"
+	case Bash:
+		return "bash"
+	case Sh:
+		return "sh"
+	case Zsh:
+		return "zsh"
+	case Cmd:
+		return "cmd"
 	default:
 		return "unknown"
 	}
 }
 
+// ParseShellType 根据名称解析Shell类型（不区分大小写，可带.exe后缀）
+func ParseShellType(name string) (ShellType, error) {
+	normalized := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".exe")
+	switch normalized {
+	case "pwsh", "powershell7":
+		return PowerShell7, nil
+	case "powershell":
+		return PowerShell, nil
+	case "bash":
+		return Bash, nil
+	case "sh":
+		return Sh, nil
+	case "zsh":
+		return Zsh, nil
+	case "cmd":
+		return Cmd, nil
+	default:
+		return Unknown, fmt.Errorf("unknown shell: %s", name)
+	}
+}
+
+// IsPowerShell 判断是否为PowerShell系列Shell
+func (s ShellType) IsPowerShell() bool {
+	return s == PowerShell7 || s == PowerShell
+}
+
+// IsPOSIX 判断是否为POSIX兼容Shell
+func (s ShellType) IsPOSIX() bool {
+	return s == Bash || s == Sh || s == Zsh
+}
+
+// executableNames 返回用于检测该Shell的可执行文件名
+func (s ShellType) executableNames() []string {
+	switch s {
+	case PowerShell7:
+		return []string{"pwsh", "pwsh.exe"}
+	case PowerShell:
+		return []string{"powershell", "powershell.exe"}
+	case Bash:
+		return []string{"bash", "bash.exe"}
+	case Sh:
+		return []string{"sh", "sh.exe"}
+	case Zsh:
+		return []string{"zsh", "zsh.exe"}
+	case Cmd:
+		return []string{"cmd", "cmd.exe"}
+	default:
+		return nil
+	}
+}
+
+// BuildArgs 构建在该Shell中执行命令所需的参数
+// 前台和后台执行共用此方法，保证不同执行路径的行为一致
+func (s ShellType) BuildArgs(command string) ([]string, error) {
+	switch {
+	case s.IsPowerShell():
+		// 强制设置控制台输出编码为UTF-8，避免中文输出乱码
+		return []string{"-NoProfile", "-Command", powerShellUTF8Prefix + command}, nil
+	case s.IsPOSIX():
+		return []string{"-c", command}, nil
+	case s == Cmd:
+		// Windows 上实际的命令行由 cmdLine 构建
+		return []string{"/D", "/S", "/C", command}, nil
+	default:
+		return nil, fmt.Errorf("unsupported shell type: %s", s.String())
+	}
+}
+
+// cmdLine 返回在 cmd.exe 中执行命令的完整命令行，命令原样放在 /S /C 之后的一对引号中，cmd 去掉这对引号后执行其余内容
+// Go 按 CommandLineToArgvW 的规则转义参数（" 写成 \"），cmd.exe 不识别这种转义，因此需要直接设置命令行
+func cmdLine(shellPath, command string) string {
+	if strings.ContainsAny(shellPath, " \t") {
+		shellPath = `"` + shellPath + `"`
+	}
+	return shellPath + ` /D /S /C "` + command + `"`
+}
+
 // ShellExecutor Shell执行器
 type ShellExecutor struct {
 	preferredShell ShellType
@@ -49,7 +150,8 @@ type ShellExecutor struct {
 // NewShellExecutor 创建新的Shell执行器
 func NewShellExecutor() *ShellExecutor {
 	executor := &ShellExecutor{
-		shellPaths: make(map[ShellType]string),
+		preferredShell: Unknown,
+		shellPaths:     make(map[ShellType]string),
 	}
 
 	// 检测可用的Shell
@@ -60,25 +162,22 @@ func NewShellExecutor() *ShellExecutor {
 
 // detectShells 检测系统中可用的Shell
 func (e *ShellExecutor) detectShells() {
-	// Windows Shell detection - 仅支持PowerShell
-	// 按优先级检测Shell
-	shells := []struct {
-		shellType ShellType
-		commands  []string
-	}{
-		{PowerShell7, []string{"pwsh", "pwsh.exe"}},
-		{PowerShell, []string{"powershell", "powershell.exe"}},
-	}
-
-	for _, shell := range shells {
-		for _, cmd := range shell.commands {
+	// 记录所有可用的Shell，首选Shell按优先级顺序选出
+	for _, shellType := range DefaultShellPreference {
+		for _, cmd := range shellType.executableNames() {
 			if path, err := exec.LookPath(strings.Trim(cmd, `"`)); err == nil {
-				e.shellPaths[shell.shellType] = path
-				e.preferredShell = shell.shellType
-				return // 找到第一个可用的Shell就停止
+				e.shellPaths[shellType] = path
+				break
 			}
 		}
 	}
+
+	for _, shellType := range DefaultShellPreference {
+		if _, exists := e.shellPaths[shellType]; exists {
+			e.preferredShell = shellType
+			break
+		}
+	}
 }
 
 // GetPreferredShell 获取首选Shell
@@ -94,35 +193,27 @@ func (e *ShellExecutor) GetShellPath(shellType ShellType) string {
 	return ""
 }
 
-// ExecuteCommand 使用最佳Shell执行命令
+// ExecuteCommand 使用最佳Shell执行命令，返回合并输出
 func (e *ShellExecutor) ExecuteCommand(command string, timeout int) (string, int, error) {
 	if e.preferredShell == Unknown {
 		return "", -1, fmt.Errorf("no suitable shell found")
 	}
 
-	return e.ExecuteWithShell(e.preferredShell, command, timeout)
+	result, err := e.ExecuteWithShell(e.preferredShell, command, timeout, ExecOptions{})
+	return result.Output, result.ExitCode, err
 }
 
-// ExecuteWithShell 使用指定Shell执行命令
-func (e *ShellExecutor) ExecuteWithShell(shellType ShellType, command string, timeout int) (string, int, error) {
+// ExecuteWithShell 使用指定Shell执行命令，opts 指定工作目录和环境变量
+// 结果中同时包含交错的合并输出和分开的stdout/stderr
+func (e *ShellExecutor) ExecuteWithShell(shellType ShellType, command string, timeout int, opts ExecOptions) (ExecResult, error) {
 	shellPath, exists := e.shellPaths[shellType]
 	if !exists {
-		return "", -1, fmt.Errorf("shell %s not available", shellType.String())
+		return ExecResult{ExitCode: -1}, fmt.Errorf("shell %s not available", shellType.String())
 	}
 
-	// 准备命令参数
-	var args []string
-	switch shellType {
-	case PowerShell7, PowerShell:
-		// PowerShell执行
-		args = []string{"-Command", command}
-	default:
-		return "", -1, fmt.Errorf("unsupported shell type: %s", shellType.String())
-	}
-
-	var cmd *exec.Cmd
 	ctx := context.Background()
 	var cancel context.CancelFunc
+	var cmdCtx context.Context
 
 	// 设置超时 - 使用正确的 context 机制，便于超时后统一返回
 	if timeout > 0 {
@@ -132,39 +223,52 @@ func (e *ShellExecutor) ExecuteWithShell(shellType ShellType, command string, ti
 				cancel()
 			}
 		}()
-		cmd = exec.CommandContext(ctx, shellPath, args...)
-	} else {
-		cmd = exec.Command(shellPath, args...)
+		cmdCtx = ctx
 	}
 
-	output, err := cmd.CombinedOutput()
+	cmd, err := BuildCommand(cmdCtx, shellPath, shellType, command, opts)
+	if err != nil {
+		return ExecResult{ExitCode: -1}, err
+	}
+
+	capture := NewStreamCapture(opts.MaxOutputBytes, opts.MaxOutputBytes > 0)
+	cmd.Stdout = capture.Stdout()
+	cmd.Stderr = capture.Stderr()
+	release, err := resources.Start(cmd, opts.Limits)
+	if err == nil {
+		err = cmd.Wait()
+		release()
+	}
+	result := capture.Result()
 
 	// 优先判断是否为超时：CommandContext 超时后会杀进程，Run 返回的 err 可能是 Wait 的退出错误
 	if ctx.Err() == context.DeadlineExceeded {
-		outStr := string(output)
-		return outStr, -1, fmt.Errorf("command timed out after %dms: %w", timeout, context.DeadlineExceeded)
+		result.ExitCode = -1
+		return result, fmt.Errorf("command timed out after %dms: %w", timeout, context.DeadlineExceeded)
 	}
 
-	exitCode := 0
+	result.ExitCode = 0
 	if cmd.ProcessState != nil {
-		exitCode = cmd.ProcessState.ExitCode()
+		result.ExitCode = cmd.ProcessState.ExitCode()
 	}
 	if err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
-			exitCode = exitError.ExitCode()
+			result.ExitCode = exitError.ExitCode()
 		} else if !errors.Is(err, context.DeadlineExceeded) {
-			exitCode = -1
+			result.ExitCode = -1
 		}
 	}
 
-	return string(output), exitCode, err
+	return result, err
 }
 
-// GetAvailableShells 获取所有可用的Shell
+// GetAvailableShells 获取所有可用的Shell（按默认优先级排序）
 func (e *ShellExecutor) GetAvailableShells() []ShellType {
 	var shells []ShellType
-	for shellType := range e.shellPaths {
-		shells = append(shells, shellType)
+	for _, shellType := range DefaultShellPreference {
+		if _, exists := e.shellPaths[shellType]; exists {
+			shells = append(shells, shellType)
+		}
 	}
 	return shells
 }
@@ -172,8 +276,8 @@ func (e *ShellExecutor) GetAvailableShells() []ShellType {
 // PrintShellInfo 打印Shell信息
 func (e *ShellExecutor) PrintShellInfo() {
 	// MCP协议要求stdout只用于JSON-RPC通信，调试信息输出到stderr
-	fmt.Fprintf(os.Stderr, "🔧 检测到的Shell环境 (仅支持PowerShell):\n")
-	for i, shellType := range []ShellType{PowerShell7, PowerShell} {
+	fmt.Fprintf(os.Stderr, "🔧 检测到的Shell环境:\n")
+	for i, shellType := range DefaultShellPreference {
 		if path, exists := e.shellPaths[shellType]; exists {
 			status := "✅"
 			if shellType == e.preferredShell {
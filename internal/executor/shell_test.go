@@ -0,0 +1,14 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCmdLine 测试 cmd.exe 的命令行原样保留命令中的引号
+func TestCmdLine(t *testing.T) {
+	assert.Equal(t, `C:\Windows\system32\cmd.exe /D /S /C "echo "a b" & findstr "x y" "C:\my file.txt""`,
+		cmdLine(`C:\Windows\system32\cmd.exe`, `echo "a b" & findstr "x y" "C:\my file.txt"`))
+	assert.Equal(t, `"C:\Program Files\cmd.exe" /D /S /C "echo ok"`, cmdLine(`C:\Program Files\cmd.exe`, "echo ok"))
+}
@@ -0,0 +1,24 @@
+package executor
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCmdQuotedCommand 测试 cmd.exe 执行含引号的命令时引号原样传递
+func TestCmdQuotedCommand(t *testing.T) {
+	shellPath, err := exec.LookPath("cmd")
+	if err != nil {
+		t.Skip("cmd not available")
+	}
+	cmd, err := BuildCommand(context.Background(), shellPath, Cmd, `echo "a  b" & echo "c"`, ExecOptions{})
+	require.NoError(t, err)
+	output, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Equal(t, []string{`"a  b" `, `"c"`}, strings.Split(strings.TrimSpace(strings.ReplaceAll(string(output), "\r\n", "\n")), "\n"))
+}
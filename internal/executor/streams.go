@@ -0,0 +1,196 @@
+package executor
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	"mcp-bash-tools/internal/redact"
+)
+
+// 输出流名称
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// chunkMergeWindow 同一流的连续输出在该时间窗口内合并为一个分段
+const chunkMergeWindow = time.Second
+
+// OutputChunk 合并输出中属于同一个流的一段连续内容
+type OutputChunk struct {
+	Stream string    `json:"stream"` // stdout 或 stderr
+	Time   time.Time `json:"time"`   // 分段开始写入的时间
+	Offset int64     `json:"offset"` // 在合并输出中的字节偏移
+	Length int64     `json:"length"` // 字节长度
+}
+
+// ExecResult 命令执行结果
+// Output 为按到达顺序交错的合并输出，Stdout/Stderr 为各流单独的内容。
+// 输出超出上限时只保留开头和结尾，完整的合并输出写入 OutputFile，Chunks 的偏移基于完整输出。
+type ExecResult struct {
+	Output     string
+	Stdout     string
+	Stderr     string
+	Chunks     []OutputChunk
+	ExitCode   int
+	Truncated  bool
+	TotalBytes int64
+	OutputFile string
+}
+
+// ChunkLog 记录合并输出中各流的分段，非并发安全
+type ChunkLog struct {
+	chunks []OutputChunk
+}
+
+// Add 记录一个分段，与上一个同流、相邻且在合并窗口内的分段合并
+func (l *ChunkLog) Add(stream string, offset, length int64, t time.Time) {
+	if length <= 0 {
+		return
+	}
+	if n := len(l.chunks); n > 0 {
+		last := &l.chunks[n-1]
+		if last.Stream == stream && last.Offset+last.Length == offset && t.Sub(last.Time) < chunkMergeWindow {
+			last.Length += length
+			return
+		}
+	}
+	l.chunks = append(l.chunks, OutputChunk{Stream: stream, Time: t, Offset: offset, Length: length})
+}
+
+// Chunks 返回分段列表的副本
+func (l *ChunkLog) Chunks() []OutputChunk {
+	return append([]OutputChunk(nil), l.chunks...)
+}
+
+// SplitStreams 按分段从合并输出中拆出stdout和stderr
+// combined 是合并输出中从 base 偏移开始的一段，只提取落在该范围内的内容
+func SplitStreams(combined string, base int64, chunks []OutputChunk) (string, string) {
+	var stdout, stderr bytes.Buffer
+	end := base + int64(len(combined))
+	for _, chunk := range chunks {
+		from := max(chunk.Offset, base)
+		to := min(chunk.Offset+chunk.Length, end)
+		if from >= to {
+			continue
+		}
+		part := combined[from-base : to-base]
+		if chunk.Stream == StreamStderr {
+			stderr.WriteString(part)
+		} else {
+			stdout.WriteString(part)
+		}
+	}
+	return stdout.String(), stderr.String()
+}
+
+// ShiftChunks 返回偏移整体增加 delta 后的分段副本
+func ShiftChunks(chunks []OutputChunk, delta int64) []OutputChunk {
+	shifted := make([]OutputChunk, len(chunks))
+	for i, chunk := range chunks {
+		chunk.Offset += delta
+		shifted[i] = chunk
+	}
+	return shifted
+}
+
+// StreamCapture 同时捕获合并输出和各流分段，用作 exec.Cmd 的 Stdout/Stderr
+// 写入的内容按行屏蔽敏感信息后再记录，各流的最后一行在 Result 时输出
+type StreamCapture struct {
+	mu       sync.Mutex
+	combined *HeadTailBuffer
+	stdout   *HeadTailBuffer
+	stderr   *HeadTailBuffer
+	log      ChunkLog
+	redact   map[string]*redact.Writer
+}
+
+// NewStreamCapture 创建输出捕获器，limit 为各缓冲的字节上限（<= 0 表示不限制）
+// spill 为true时，合并输出超出上限后完整写入溢出文件
+func NewStreamCapture(limit int64, spill bool) *StreamCapture {
+	c := &StreamCapture{
+		combined: NewHeadTailBuffer(limit),
+		stdout:   NewHeadTailBuffer(limit),
+		stderr:   NewHeadTailBuffer(limit),
+	}
+	if spill {
+		c.combined.EnableSpill()
+	}
+	redactor := redact.Current()
+	c.redact = map[string]*redact.Writer{
+		StreamStdout: redactor.NewWriter(captureSink{capture: c, stream: StreamStdout}),
+		StreamStderr: redactor.NewWriter(captureSink{capture: c, stream: StreamStderr}),
+	}
+	return c
+}
+
+// captureWriter 将写入归属到指定流
+type captureWriter struct {
+	capture *StreamCapture
+	stream  string
+}
+
+// Write 实现 io.Writer
+func (w captureWriter) Write(p []byte) (int, error) {
+	return w.capture.write(w.stream, p)
+}
+
+// Stdout 返回stdout写入器
+func (c *StreamCapture) Stdout() io.Writer {
+	return captureWriter{capture: c, stream: StreamStdout}
+}
+
+// Stderr 返回stderr写入器
+func (c *StreamCapture) Stderr() io.Writer {
+	return captureWriter{capture: c, stream: StreamStderr}
+}
+
+// write 屏蔽一段输出中的敏感信息后追加
+func (c *StreamCapture) write(stream string, p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.redact[stream].Write(p)
+}
+
+// captureSink 接收屏蔽后的输出，调用时已持有 capture.mu
+type captureSink struct {
+	capture *StreamCapture
+	stream  string
+}
+
+// Write 实现 io.Writer
+func (w captureSink) Write(p []byte) (int, error) {
+	return w.capture.append(w.stream, p)
+}
+
+// append 追加一段输出并记录分段
+func (c *StreamCapture) append(stream string, p []byte) (int, error) {
+	c.log.Add(stream, c.combined.TotalBytes(), int64(len(p)), time.Now())
+	c.combined.Write(p)
+	if stream == StreamStderr {
+		c.stderr.Write(p)
+	} else {
+		c.stdout.Write(p)
+	}
+	return len(p), nil
+}
+
+// Result 返回已捕获的输出并关闭溢出文件，ExitCode 由调用方填写
+func (c *StreamCapture) Result() ExecResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.redact[StreamStdout].Flush()
+	c.redact[StreamStderr].Flush()
+	c.combined.Close()
+	return ExecResult{
+		Output:     c.combined.String(),
+		Stdout:     c.stdout.String(),
+		Stderr:     c.stderr.String(),
+		Chunks:     c.log.Chunks(),
+		Truncated:  c.combined.Truncated(),
+		TotalBytes: c.combined.TotalBytes(),
+		OutputFile: c.combined.SpillPath(),
+	}
+}
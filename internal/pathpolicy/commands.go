@@ -0,0 +1,412 @@
+package pathpolicy
+
+import (
+	"os"
+	"slices"
+	"strings"
+
+	"mcp-bash-tools/internal/policy"
+	"mcp-bash-tools/internal/psparse"
+)
+
+// targetKind 命令的哪些参数是写入或删除的路径
+type targetKind int
+
+const (
+	leadingArguments targetKind = iota // 前 n 个位置参数（n 为 0 时全部）
+	afterFirst                         // 第一个位置参数之后的全部位置参数（chmod 的模式、sed 的脚本）
+	destination                        // -Destination 和最后一个位置参数，只有一个位置参数时为工作目录（源路径只读取）
+	secondArgument                     // 第二个位置参数（robocopy 源 目标）
+	outputOperand                      // of=路径（dd）
+	namedOnly                          // 只取命名参数的值（curl -o、tar -C、Invoke-WebRequest -OutFile）
+)
+
+// writeCommand 写入或删除文件的命令
+type writeCommand struct {
+	op         string
+	kind       targetKind
+	arguments  int      // leadingArguments 取的位置参数个数
+	switches   bool     // 以 / 开头的参数是开关而不是路径（Windows 可执行文件）
+	parameters []string // 值为目标路径的命名参数，为空时使用 pathParameters（destination 为 -Destination）
+}
+
+// writeCommands 按规范命令名（已解析别名）识别的写入和删除命令
+// 位置参数按最坏情况处理：多取的参数只会导致误拒，不会漏检
+var writeCommands = map[string]writeCommand{
+	"remove-item":   {op: OpDelete},
+	"unlink":        {op: OpDelete},
+	"shred":         {op: OpDelete},
+	"move-item":     {op: OpWrite}, // 源路径被删除，目标路径被写入
+	"rename-item":   {op: OpWrite, arguments: 1},
+	"new-item":      {op: OpWrite, arguments: 1},
+	"mkdir":         {op: OpWrite},
+	"set-content":   {op: OpWrite, arguments: 1},
+	"add-content":   {op: OpWrite, arguments: 1},
+	"clear-content": {op: OpWrite},
+	"out-file":      {op: OpWrite, arguments: 1},
+	"tee-object":    {op: OpWrite, arguments: 1},
+	"tee":           {op: OpWrite},
+	"touch":         {op: OpWrite},
+	"truncate":      {op: OpWrite},
+	"chmod":         {op: OpWrite, kind: afterFirst},
+	"chown":         {op: OpWrite, kind: afterFirst},
+	"chgrp":         {op: OpWrite, kind: afterFirst},
+	"copy-item":     {op: OpWrite, kind: destination},
+	"xcopy":         {op: OpWrite, kind: destination, switches: true},
+	"ln":            {op: OpWrite, kind: destination},
+	"install":       {op: OpWrite, kind: destination},
+	"robocopy":      {op: OpWrite, kind: secondArgument, switches: true},
+	"dd":            {op: OpWrite, kind: outputOperand},
+
+	// 导出和归档 cmdlet
+	"export-csv":         {op: OpWrite},
+	"export-clixml":      {op: OpWrite},
+	"export-alias":       {op: OpWrite},
+	"export-formatdata":  {op: OpWrite},
+	"export-certificate": {op: OpWrite},
+	"start-transcript":   {op: OpWrite, arguments: 1, parameters: []string{"path", "literalpath", "outputdirectory"}},
+	"compress-archive":   {op: OpWrite, kind: destination, parameters: []string{"destinationpath"}},
+	"expand-archive":     {op: OpWrite, kind: destination, parameters: []string{"destinationpath"}},
+
+	// 下载：curl、wget 在 PowerShell 中是 Invoke-WebRequest 的别名，同时识别它们的输出选项
+	"invoke-webrequest": {op: OpWrite, kind: namedOnly, parameters: downloadParameters},
+	"invoke-restmethod": {op: OpWrite, kind: namedOnly, parameters: downloadParameters},
+	"tar":               {op: OpWrite, kind: namedOnly, parameters: []string{"c", "-directory"}},
+}
+
+// downloadParameters 下载命令的输出参数：-OutFile、curl -o/--output/--output-dir、wget -O/-o/-P 及其长选项
+var downloadParameters = []string{"outfile", "o", "p", "-output", "-output-dir", "-output-document", "-output-file", "-directory-prefix"}
+
+// pathParameters 值为路径的命名参数
+var pathParameters = []string{"path", "literalpath", "pspath", "filepath", "destination"}
+
+// valueParameters cmdlet 中值不是路径的命名参数，至少写出三个字符时才识别，避免与 Unix 短选项混淆
+var valueParameters = []string{"value", "encoding", "itemtype", "inputobject", "stream", "width", "filter", "include", "exclude"}
+
+// locationCommands 改变工作目录的命令
+var locationCommands = map[string]bool{"set-location": true, "pushd": true, "push-location": true}
+
+// nullDevices 丢弃输出的重定向目标
+var nullDevices = map[string]bool{"$null": true, "nul": true, "/dev/null": true, "/dev/stdout": true, "/dev/stderr": true}
+
+// staticFileTypes、staticFileMethods 直接写入或删除文件的 .NET 静态方法（类型::方法名前缀），参数无法静态确定，约束路径时拒绝
+var (
+	staticFileTypes   = []string{"io.file", "io.directory"}
+	staticFileMethods = []string{"write", "append", "create", "delete", "move", "copy", "replace", "open", "set", "encrypt", "decrypt"}
+)
+
+// CheckCommand 检查命令写入和删除的路径，相对路径相对于 cwd（为空表示工作目录无法确定）
+// 命令按 PowerShell 语法解析，cd/Set-Location 改变后续命令的工作目录，cmd /c 等嵌套执行的命令递归检查
+// 返回命令执行后的工作目录（按静态分析推断，无法确定时为空），供持久化会话的下一条命令使用
+func (p *Policy) CheckCommand(command, cwd string) (string, error) {
+	return p.checkScript(command, cwd, 0)
+}
+
+func (p *Policy) checkScript(source, cwd string, depth int) (string, error) {
+	if depth > policy.MaxNestedScripts {
+		return "", &Violation{Op: OpWrite, Path: source, Reason: errTooManyNested.Error()}
+	}
+	script := psparse.Parse(source)
+	if script.Err != nil {
+		return "", &Violation{Op: OpWrite, Path: source, Reason: script.Err.Error()}
+	}
+	if p.Enabled() {
+		for _, method := range script.Methods {
+			if isStaticFileWrite(method) {
+				return "", &Violation{Op: OpWrite, Path: method, Reason: errStaticFileWrite.Error()}
+			}
+		}
+	}
+	for _, cmd := range script.Commands() {
+		for _, target := range writeTargets(cmd) {
+			if err := p.checkTarget(target, cwd); err != nil {
+				return "", err
+			}
+		}
+		for _, nested := range policy.NestedScripts(cmd) {
+			// 嵌套执行的命令在子进程中改变工作目录，不影响后续命令
+			if _, err := p.checkScript(nested, cwd, depth+1); err != nil {
+				return "", err
+			}
+		}
+		next, err := p.nextLocation(cmd, cwd)
+		if err != nil {
+			return "", err
+		}
+		cwd = next
+	}
+	return cwd, nil
+}
+
+// isStaticFileWrite 判断 类型::方法 是否为写入或删除文件的 .NET 静态方法
+func isStaticFileWrite(method string) bool {
+	typeName, name, ok := strings.Cut(method, "::")
+	if !ok {
+		return false
+	}
+	for _, t := range staticFileTypes {
+		if typeName == t {
+			for _, prefix := range staticFileMethods {
+				if strings.HasPrefix(name, prefix) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// target 写入或删除的路径参数
+type target struct {
+	op      string
+	path    string
+	dynamic bool // 含有变量或表达式，无法静态确定
+}
+
+func (p *Policy) checkTarget(t target, cwd string) error {
+	if !p.Enabled() {
+		return nil
+	}
+	if t.dynamic {
+		return &Violation{Op: t.op, Path: t.path, Reason: errDynamicPath.Error()}
+	}
+	return p.Check(t.op, t.path, cwd)
+}
+
+// Writes 判断命令调用是否写入或删除文件：写入命令带有目标路径，或输出重定向到文件
+func Writes(cmd *psparse.Command) bool {
+	return len(writeTargets(cmd)) > 0
+}
+
+// writeTargets 返回命令写入或删除的路径参数，包括输出重定向的目标
+func writeTargets(cmd *psparse.Command) []target {
+	var targets []target
+	for _, r := range cmd.Redirections {
+		if r.Target == "" || r.Operator == "<" || nullDevices[strings.ToLower(r.Target)] {
+			continue
+		}
+		targets = append(targets, target{op: OpWrite, path: r.Target, dynamic: strings.Contains(r.Target, "$")})
+	}
+
+	spec, ok := writeCommands[cmd.Name]
+	if cmd.Name == "sed" && (cmd.HasParameter("i") || cmd.HasParameter("-in-place")) {
+		// sed -i 脚本 文件...
+		spec, ok = writeCommand{op: OpWrite, kind: afterFirst}, true
+	}
+	if cmd.Name == "git" {
+		return append(targets, gitTargets(cmd)...)
+	}
+	if !ok {
+		return targets
+	}
+	if len(cmd.Splats) > 0 {
+		return append(targets, target{op: spec.op, path: "@" + cmd.Splats[0], dynamic: true})
+	}
+
+	parameters := pathParameters
+	if spec.kind == destination {
+		parameters = []string{"destination"}
+	}
+	if spec.parameters != nil {
+		parameters = spec.parameters
+	}
+	named, positional := pathArguments(cmd, parameters)
+	if spec.switches {
+		positional = slices.DeleteFunc(positional, func(e psparse.Element) bool {
+			return strings.HasPrefix(e.Value, "/")
+		})
+	}
+	var selected []psparse.Element
+	switch spec.kind {
+	case leadingArguments:
+		selected = named
+		if spec.arguments == 0 || len(positional) <= spec.arguments {
+			selected = append(selected, positional...)
+		} else {
+			selected = append(selected, positional[:spec.arguments]...)
+		}
+	case afterFirst:
+		if len(positional) > 1 {
+			selected = positional[1:]
+		}
+	case destination:
+		selected = named
+		if len(positional) > 1 {
+			selected = append(selected, positional[len(positional)-1])
+		} else if len(named) == 0 {
+			selected = append(selected, psparse.Element{Value: ".", Literal: true})
+		}
+	case secondArgument:
+		if len(positional) > 1 {
+			selected = positional[1:2]
+		}
+	case namedOnly:
+		selected = named
+		if len(named) == 0 && cmd.Name == "tar" && isTarExtract(cmd) {
+			// 未指定 -C 时解压到工作目录
+			selected = append(selected, psparse.Element{Value: ".", Literal: true})
+		}
+	case outputOperand:
+		for _, e := range positional {
+			if value, ok := strings.CutPrefix(strings.ToLower(e.Value), "of="); ok {
+				selected = append(selected, psparse.Element{Value: e.Value[len(e.Value)-len(value):], Literal: e.Literal})
+			}
+		}
+	}
+	for _, e := range selected {
+		targets = append(targets, target{op: spec.op, path: e.Value, dynamic: !e.Literal})
+	}
+	return targets
+}
+
+// gitTargets 返回 git clone、git init 写入的目录，未指定目录时为工作目录（git -C 指定的目录）
+func gitTargets(cmd *psparse.Command) []target {
+	named, positional := pathArguments(cmd, []string{"c"})
+	// git -C 目录 的值同时计入位置参数，子命令是第一个 clone 或 init
+	sub := slices.IndexFunc(positional, func(e psparse.Element) bool {
+		return e.Literal && (strings.EqualFold(e.Value, "clone") || strings.EqualFold(e.Value, "init"))
+	})
+	if sub < 0 {
+		return nil
+	}
+	args := positional[sub+1:]
+	dirs := named
+	switch {
+	case strings.EqualFold(positional[sub].Value, "clone") && len(args) > 1:
+		// git clone [选项] 仓库 [目录]：选项的值也计入位置参数，按最后一个位置参数处理
+		dirs = append(dirs, args[len(args)-1])
+	case strings.EqualFold(positional[sub].Value, "init") && len(args) > 0:
+		dirs = append(dirs, args[0])
+	default:
+		dirs = append(dirs, psparse.Element{Value: ".", Literal: true})
+	}
+	var targets []target
+	for _, dir := range dirs {
+		targets = append(targets, target{op: OpWrite, path: dir.Value, dynamic: !dir.Literal})
+	}
+	return targets
+}
+
+// isTarExtract 判断 tar 是否为解压模式：-x、-xzf 等短选项组合，旧式写法的 xf，或 --extract/--get
+func isTarExtract(cmd *psparse.Command) bool {
+	for i, e := range cmd.Elements {
+		if long, ok := longOption(e); ok {
+			e = long
+		}
+		switch {
+		case e.Parameter == "-extract" || e.Parameter == "-get":
+			return true
+		case e.Parameter != "":
+			if !strings.HasPrefix(e.Parameter, "-") && strings.Contains(e.Parameter, "x") {
+				return true
+			}
+		case i == 0 && e.Literal && !strings.HasPrefix(e.Value, "-"):
+			// 旧式写法只有第一个参数可以省略 -
+			if strings.Contains(strings.ToLower(e.Value), "x") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pathArguments 返回指定命名参数（可缩写）的值和位置参数
+// 紧随命名参数的值同时计入位置参数（无法区分开关参数和带值参数）；
+// cmdlet 的 -Value、-Encoding 等非路径参数的值不计入
+// 外部程序的 --name 和 --name=value 长选项按名为 -name 的命名参数处理
+func pathArguments(cmd *psparse.Command, parameters []string) (named, positional []psparse.Element) {
+	cmdlet := strings.Contains(cmd.Name, "-")
+	skipNext := false
+	for i, e := range cmd.Elements {
+		if long, ok := longOption(e); ok {
+			e = long
+		}
+		if e.Parameter == "" {
+			if !skipNext {
+				positional = append(positional, e)
+			}
+			skipNext = false
+			continue
+		}
+		skipNext = false
+		if cmdlet && len(e.Parameter) >= 3 && hasPrefixOf(valueParameters, e.Parameter) {
+			skipNext = e.Value == ""
+			continue
+		}
+		if !hasPrefixOf(parameters, e.Parameter) {
+			continue
+		}
+		if e.Value != "" {
+			named = append(named, e)
+		} else if i+1 < len(cmd.Elements) && cmd.Elements[i+1].Parameter == "" {
+			named = append(named, cmd.Elements[i+1])
+		}
+	}
+	return named, positional
+}
+
+// longOption 把 --name、--name=value 形式的位置参数转换为名为 -name 的命名参数
+func longOption(e psparse.Element) (psparse.Element, bool) {
+	word, ok := strings.CutPrefix(e.Value, "--")
+	if e.Parameter != "" || !e.Literal || !ok || word == "" {
+		return e, false
+	}
+	name, value, _ := strings.Cut(word, "=")
+	return psparse.Element{Parameter: "-" + strings.ToLower(name), Value: value, Literal: true}, true
+}
+
+// hasPrefixOf 判断参数是否为任一名称的前缀（PowerShell 参数缩写）
+func hasPrefixOf(names []string, parameter string) bool {
+	for _, name := range names {
+		if strings.HasPrefix(name, parameter) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextLocation 返回命令执行后的工作目录：cd/Set-Location/pushd 切换到静态可确定且已存在的目录，
+// 其他情况下工作目录无法确定；popd/Pop-Location 返回的目录无法确定
+// 配置了约束时切换的目标目录也必须允许，无法静态确定的目标目录被拒绝
+func (p *Policy) nextLocation(cmd *psparse.Command, cwd string) (string, error) {
+	switch {
+	case cmd.Name == "popd" || cmd.Name == "pop-location":
+		return "", nil
+	case !locationCommands[cmd.Name]:
+		return cwd, nil
+	}
+	if len(cmd.Splats) > 0 {
+		return "", p.checkTarget(target{op: OpCwd, path: "@" + cmd.Splats[0], dynamic: true}, cwd)
+	}
+
+	named, positional := pathArguments(cmd, pathParameters)
+	var args []psparse.Element
+	for _, e := range append(named, positional...) {
+		// cmd 的 cd /d 切换盘符参数
+		if !strings.EqualFold(e.Value, "/d") {
+			args = append(args, e)
+		}
+	}
+	if len(args) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil
+		}
+		return home, p.Check(OpCwd, home, cwd)
+	}
+	if args[0].Value == "-" || args[0].Value == "+" {
+		// 返回之前的位置，无法静态确定
+		return "", nil
+	}
+	if err := p.checkTarget(target{op: OpCwd, path: args[0].Value, dynamic: !args[0].Literal}, cwd); err != nil {
+		return "", err
+	}
+	dir, err := Canonicalize(args[0].Value, cwd)
+	if err != nil || !args[0].Literal {
+		return "", nil
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", nil
+	}
+	return dir, nil
+}
@@ -0,0 +1,235 @@
+// Package pathpolicy 文件系统路径约束：规范化路径（符号链接、..、\\?\ 长路径、盘符和大小写），
+// 检查命令写入或删除的路径以及工作目录是否位于允许的根目录内、且不在禁止的路径内
+package pathpolicy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// 路径操作
+const (
+	OpWrite  = "write"  // 创建、修改、移动或重命名
+	OpDelete = "delete" // 删除
+	OpCwd    = "cwd"    // 作为工作目录
+)
+
+// Violation 被拒绝的路径操作
+type Violation struct {
+	Op       string `json:"op"`
+	Path     string `json:"path"`               // 命令中的原始路径
+	Resolved string `json:"resolved,omitempty"` // 规范化后的路径，无法确定时为空
+	Reason   string `json:"reason"`
+}
+
+func (v *Violation) Error() string {
+	if v.Resolved == "" || v.Resolved == v.Path {
+		return fmt.Sprintf("%s %s: %s", v.Op, v.Path, v.Reason)
+	}
+	return fmt.Sprintf("%s %s (resolved to %s): %s", v.Op, v.Path, v.Resolved, v.Reason)
+}
+
+// Policy 路径约束：roots 非空时路径必须位于其中某个根目录之下，且不能位于任何 blocked 路径之下
+type Policy struct {
+	roots   []string
+	blocked []string
+}
+
+// New 创建路径约束，根目录和禁止路径在创建时规范化（相对路径相对于进程工作目录）
+func New(roots, blocked []string) (*Policy, error) {
+	cwd, _ := os.Getwd()
+	p := &Policy{}
+	for _, root := range roots {
+		resolved, err := Canonicalize(root, cwd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed path %s: %w", root, err)
+		}
+		p.roots = append(p.roots, resolved)
+	}
+	for _, path := range blocked {
+		resolved, err := Canonicalize(path, cwd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocked path %s: %w", path, err)
+		}
+		p.blocked = append(p.blocked, resolved)
+	}
+	return p, nil
+}
+
+// Enabled 判断是否配置了任何约束
+func (p *Policy) Enabled() bool {
+	return p != nil && len(p.roots)+len(p.blocked) > 0
+}
+
+// Check 检查路径（相对路径相对于 cwd）是否允许执行操作，cwd 为空表示工作目录无法确定
+func (p *Policy) Check(op, path, cwd string) error {
+	if !p.Enabled() || isSessionProvider(path) {
+		return nil
+	}
+	resolved, err := Canonicalize(path, cwd)
+	if err != nil {
+		return &Violation{Op: op, Path: path, Reason: err.Error()}
+	}
+	if reason := p.reason(resolved); reason != "" {
+		return &Violation{Op: op, Path: path, Resolved: resolved, Reason: reason}
+	}
+	return nil
+}
+
+// CheckDir 检查工作目录（绝对路径）是否允许
+func (p *Policy) CheckDir(dir string) error {
+	return p.Check(OpCwd, dir, "")
+}
+
+// reason 返回规范化路径不被允许的原因，允许时为空
+func (p *Policy) reason(resolved string) string {
+	for _, blocked := range p.blocked {
+		if Within(resolved, blocked) {
+			return "inside blocked path " + blocked
+		}
+	}
+	if len(p.roots) == 0 {
+		return ""
+	}
+	for _, root := range p.roots {
+		if Within(resolved, root) {
+			return ""
+		}
+	}
+	return "outside allowed roots: " + strings.Join(p.roots, ", ")
+}
+
+// Within 判断规范化路径是否等于 root 或位于 root 之下（按路径分隔符边界比较，Windows 下不区分大小写）
+func Within(path, root string) bool {
+	if runtime.GOOS == "windows" {
+		path = strings.ToLower(path)
+		root = strings.ToLower(root)
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+var (
+	errUnknownCwd      = errors.New("working directory cannot be determined")
+	errNotFilesystem   = errors.New("not a filesystem path")
+	errDriveRelative   = errors.New("drive-relative paths are not supported")
+	errEmptyPath       = errors.New("empty path")
+	errDynamicPath     = errors.New("path cannot be determined statically")
+	errTooManyNested   = errors.New("too many nested scripts")
+	errStaticFileWrite = errors.New("static .NET file system methods are not allowed when paths are confined")
+)
+
+// sessionProviders 只影响当前 PowerShell 会话的驱动器，对其中路径的修改不受约束
+var sessionProviders = map[string]bool{"env": true, "variable": true, "function": true, "alias": true}
+
+// isSessionProvider 判断路径是否位于只影响当前会话的 PowerShell 驱动器（env:、variable: 等）
+func isSessionProvider(path string) bool {
+	name, _, ok := strings.Cut(strings.TrimSpace(path), ":")
+	return ok && sessionProviders[strings.ToLower(name)]
+}
+
+// Canonicalize 把路径规范化为绝对路径：去掉 \\?\ 长路径前缀和 FileSystem:: 限定，展开 ~，
+// 相对路径相对于 cwd，解析已存在部分中的符号链接后清理 . 和 ..，Windows 下盘符转为大写
+// 可能匹配 .. 的通配符路径段按 .. 处理；其他 PowerShell 驱动器（HKLM:、Cert: 等）和 URL 返回错误
+func Canonicalize(path, cwd string) (string, error) {
+	p := strings.TrimSpace(path)
+	if p == "" {
+		return "", errEmptyPath
+	}
+	p = stripLongPathPrefix(p)
+	if i := strings.Index(p, "::"); i >= 0 {
+		if !strings.EqualFold(p[:i], "filesystem") && !strings.EqualFold(p[:i], `microsoft.powershell.core\filesystem`) {
+			return "", errNotFilesystem
+		}
+		p = stripLongPathPrefix(p[i+2:])
+	}
+	if i := strings.IndexByte(p, ':'); i > 1 && !strings.ContainsAny(p[:i], `\/`) {
+		return "", errNotFilesystem
+	}
+	if p == "~" || strings.HasPrefix(p, "~/") || strings.HasPrefix(p, `~\`) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		p = home + p[1:]
+	}
+
+	if !filepath.IsAbs(p) {
+		volume := filepath.VolumeName(p)
+		switch {
+		case volume != "":
+			return "", errDriveRelative
+		case cwd == "":
+			return "", errUnknownCwd
+		case strings.HasPrefix(p, `\`) || strings.HasPrefix(p, "/"):
+			// Windows 下以分隔符开头的路径位于当前盘符的根目录
+			p = filepath.VolumeName(cwd) + p
+		default:
+			p = cwd + string(filepath.Separator) + p
+		}
+	}
+
+	p = resolveExisting(collapseWildcards(filepath.FromSlash(p)))
+	if volume := filepath.VolumeName(p); len(volume) == 2 && volume[1] == ':' {
+		p = strings.ToUpper(volume) + p[2:]
+	}
+	return p, nil
+}
+
+// stripLongPathPrefix 去掉 windows.OptimizePath 添加的 \\?\ 前缀，\\?\UNC\server\share 还原为 \\server\share
+func stripLongPathPrefix(p string) string {
+	for _, prefix := range []string{`\\?\`, `//?/`, `\\.\`, `//./`} {
+		rest, ok := strings.CutPrefix(p, prefix)
+		if !ok {
+			continue
+		}
+		if len(rest) >= 4 && strings.EqualFold(rest[:4], `UNC\`) {
+			return `\\` + rest[4:]
+		}
+		return rest
+	}
+	return p
+}
+
+// collapseWildcards 把可能匹配 .. 的通配符路径段（如 .*）替换为 ..，其他通配符段保持不变
+func collapseWildcards(p string) string {
+	volume := filepath.VolumeName(p)
+	parts := strings.Split(p[len(volume):], string(filepath.Separator))
+	for i, part := range parts {
+		if strings.ContainsAny(part, "*?[") {
+			if matched, _ := filepath.Match(part, ".."); matched {
+				parts[i] = ".."
+			}
+		}
+	}
+	return volume + strings.Join(parts, string(filepath.Separator))
+}
+
+// resolveExisting 解析路径中最长的已存在前缀的符号链接，再拼接其余部分并清理
+// 符号链接之后的 .. 按链接目标解析；不存在的路径段不可能是链接，按字面清理
+func resolveExisting(p string) string {
+	current, rest := p, ""
+	for {
+		if resolved, err := filepath.EvalSymlinks(current); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		trimmed := strings.TrimRight(current, string(filepath.Separator))
+		if len(trimmed) <= len(filepath.VolumeName(current)) {
+			return filepath.Clean(p)
+		}
+		parent, name := filepath.Split(trimmed)
+		if parent == "" {
+			return filepath.Clean(p)
+		}
+		rest = filepath.Join(name, rest)
+		current = parent
+	}
+}
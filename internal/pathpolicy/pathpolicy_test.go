@@ -0,0 +1,176 @@
+package pathpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// confinedRoot 创建允许的根目录：root/project 为项目目录，root/project/escape 是指向根目录之外的符号链接
+func confinedRoot(t *testing.T) (project, outside string) {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	outside, err = filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	project = filepath.Join(root, "project")
+	require.NoError(t, os.MkdirAll(filepath.Join(project, "src"), 0o755))
+	if err := os.Symlink(outside, filepath.Join(project, "escape")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	return project, outside
+}
+
+// TestCanonicalize 测试路径规范化：..、符号链接、\\?\ 长路径前缀、通配符和非文件系统驱动器
+func TestCanonicalize(t *testing.T) {
+	project, outside := confinedRoot(t)
+
+	testCases := map[string]string{
+		"src/../main.go":           filepath.Join(project, "main.go"),
+		"./src/new/../../x":        filepath.Join(project, "x"),
+		"escape/secret":            filepath.Join(outside, "secret"),
+		"escape/../x":              filepath.Join(filepath.Dir(outside), "x"),
+		`\\?\` + project + "/src":  filepath.Join(project, "src"),
+		"src/.*":                   project,
+		"FileSystem::" + project:   project,
+		"missing/../../project/x/": filepath.Join(project, "x"),
+	}
+	for path, expected := range testCases {
+		resolved, err := Canonicalize(path, project)
+		require.NoError(t, err, path)
+		assert.Equal(t, expected, resolved, path)
+	}
+
+	for _, path := range []string{"HKLM:\\Software\\x", "Registry::HKEY_LOCAL_MACHINE\\x", "https://example.com/x", ""} {
+		_, err := Canonicalize(path, project)
+		assert.Error(t, err, path)
+	}
+	_, err := Canonicalize("relative", "")
+	assert.Error(t, err, "工作目录未知时无法解析相对路径")
+}
+
+// TestPathPolicyCheckCommand 测试从命令中识别写入和删除的路径
+func TestPathPolicyCheckCommand(t *testing.T) {
+	project, outside := confinedRoot(t)
+	paths, err := New([]string{project}, []string{filepath.Join(project, ".git")})
+	require.NoError(t, err)
+
+	allowed := []string{
+		"Remove-Item src -Recurse -Force",
+		"rm -rf ./build",
+		"echo hi > out.txt 2>&1",
+		"echo hi > /dev/null; Get-Content " + outside + "/x",
+		"cp " + outside + "/template.txt src/",
+		"Copy-Item -Path " + outside + "/a -Destination src/a",
+		"Set-Content -Path notes.txt -Value $content",
+		"cd src; rm ../main.go",
+		"mkdir -p src/a/b && touch src/a/b/c",
+		"Remove-Item env:FOO",
+		"cat " + outside + "/x | tee log.txt",
+	}
+	for _, command := range allowed {
+		_, err := paths.CheckCommand(command, project)
+		assert.NoError(t, err, command)
+	}
+
+	denied := map[string]string{
+		"rm -rf " + outside:                      OpDelete,
+		"Remove-Item ../../etc -Recurse":         OpDelete,
+		"del escape/secret":                      OpDelete,
+		"echo x >> " + outside + "/log":          OpWrite,
+		"cp src/a " + outside:                    OpWrite,
+		"mv src/a " + outside + "/a":             OpWrite,
+		"Out-File -Encoding utf8 " + outside:     OpWrite,
+		"Set-Content -Value x -Path " + outside:  OpWrite,
+		"cd ..":                                  OpCwd,
+		"cd src; cd ../..":                       OpCwd,
+		"cd src; rm ../../x":                     OpDelete,
+		"rm .git/config":                         OpDelete,
+		"cmd /c del " + outside + "\\x":          OpDelete,
+		"bash -c 'touch " + outside + "/x'":      OpWrite,
+		"Remove-Item $env:TEMP\\x":               OpDelete,
+		"echo x > $target":                       OpWrite,
+		"Remove-Item HKLM:\\Software\\Vendor":    OpDelete,
+		"[IO.File]::WriteAllText('x', 'y')":      OpWrite,
+		"dd if=/dev/zero of=" + outside + "/img": OpWrite,
+	}
+	for command, op := range denied {
+		_, err := paths.CheckCommand(command, project)
+		var violation *Violation
+		if assert.ErrorAs(t, err, &violation, command) {
+			assert.Equal(t, op, violation.Op, command)
+		}
+	}
+
+	// 返回命令执行后的工作目录，无法确定时为空
+	cwd, err := paths.CheckCommand("cd src", project)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(project, "src"), cwd)
+	cwd, err = paths.CheckCommand("popd", project)
+	require.NoError(t, err)
+	assert.Empty(t, cwd)
+	_, err = paths.CheckCommand("rm x", "")
+	assert.ErrorContains(t, err, "working directory cannot be determined")
+
+	// 未配置约束时不检查
+	unconfined, err := New(nil, nil)
+	require.NoError(t, err)
+	_, err = unconfined.CheckCommand("rm -rf "+outside, project)
+	assert.NoError(t, err)
+}
+
+// TestPathPolicyWriterBypasses 测试下载、导出、归档和 git 命令的输出路径受约束
+func TestPathPolicyWriterBypasses(t *testing.T) {
+	project, outside := confinedRoot(t)
+	paths, err := New([]string{project}, nil)
+	require.NoError(t, err)
+
+	denied := []string{
+		"Invoke-WebRequest https://example.com -OutFile " + outside + "/x",
+		"iwr https://example.com -OutF " + outside + "/x",
+		"Invoke-RestMethod https://example.com -OutFile " + outside + "/x",
+		"Export-Csv " + outside + "/x",
+		"Get-Process | Export-Csv -NoTypeInformation " + outside + "/x",
+		"Get-Process | Export-Clixml -Path " + outside + "/x",
+		"Expand-Archive a.zip -DestinationPath " + outside,
+		"Compress-Archive src " + outside + "/x.zip",
+		"Start-Transcript " + outside + "/log",
+		"curl -o " + outside + "/x https://example.com",
+		"curl --output " + outside + "/x https://example.com",
+		"curl --output=" + outside + "/x https://example.com",
+		"wget -O " + outside + "/x https://example.com",
+		"wget -P " + outside + " https://example.com",
+		"wget --output-document " + outside + "/x https://example.com",
+		"tar -xf a.tar -C " + outside,
+		"tar xzf a.tgz --directory=" + outside,
+		"git clone https://example.com/repo " + outside + "/repo",
+		"git clone --depth 1 https://example.com/repo " + outside + "/repo",
+		"git -C " + outside + " init",
+	}
+	for _, command := range denied {
+		_, err := paths.CheckCommand(command, project)
+		var violation *Violation
+		if assert.ErrorAs(t, err, &violation, command) {
+			assert.Equal(t, OpWrite, violation.Op, command)
+		}
+	}
+
+	allowed := []string{
+		"Invoke-WebRequest https://example.com -OutFile page.html",
+		"curl -o src/x https://example.com",
+		"wget https://example.com",
+		"Get-Process | Export-Csv procs.csv",
+		"Expand-Archive a.zip",
+		"tar -xf " + outside + "/a.tar -C src",
+		"tar -cf out.tar src",
+		"git clone https://example.com/repo",
+		"git status",
+	}
+	for _, command := range allowed {
+		_, err := paths.CheckCommand(command, project)
+		assert.NoError(t, err, command)
+	}
+}
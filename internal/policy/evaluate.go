@@ -0,0 +1,397 @@
+package policy
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"mcp-bash-tools/internal/psparse"
+)
+
+// MaxNestedScripts cmd /c、Invoke-Expression 等嵌套执行的最大检查深度，超过时拒绝
+const MaxNestedScripts = 8
+
+// Evaluate 判定命令：命令先按 PowerShell 语法解析为命令调用，每个调用取第一条匹配的规则，
+// cmd /c、powershell -Command、Invoke-Expression 等执行的字符串递归判定，结果取其中最严格的判定
+// 允许规则只对匹配的调用生效，不影响嵌套执行的命令
+func (p *Policy) Evaluate(command string) Decision {
+	return p.evaluate(command, false, 0)
+}
+
+// EvaluatePOSIX 判定在 bash、sh、zsh 中执行的命令：在 Evaluate 的基础上，
+// 反引号和 $(...) 命令替换中的命令同样作为嵌套脚本判定（PowerShell 语法把反引号视为转义字符）
+func (p *Policy) EvaluatePOSIX(command string) Decision {
+	return p.evaluate(command, true, 0)
+}
+
+func (p *Policy) evaluate(source string, posix bool, depth int) Decision {
+	if depth > MaxNestedScripts {
+		return Decision{Verdict: Deny, RuleID: "nesting-depth", Reason: "too many nested scripts", Command: source}
+	}
+	result := Decision{Verdict: Allow}
+	script := psparse.Parse(source)
+	if script.Err != nil {
+		return Decision{Verdict: Deny, RuleID: "parse-error", Reason: script.Err.Error(), Command: source}
+	}
+	if p.Default != "" && p.Default != Allow {
+		// 允许列表模式下 .NET 静态方法调用不经过任何命令，无法按命令规则放行
+		for _, method := range script.Methods {
+			if strings.Contains(method, "::") {
+				return p.defaultDecision("static .NET method calls are not allowlisted", method)
+			}
+		}
+	}
+	if posix {
+		for _, sub := range CommandSubstitutions(source) {
+			if result = stricter(result, p.evaluate(sub, true, depth+1)); result.Verdict == Deny {
+				return result
+			}
+		}
+	}
+	for _, cmd := range script.Commands() {
+		decisions := []Decision{}
+		text, _ := cmd.Text(true)
+		if rule := p.match(cmd, script); rule != nil {
+			decisions = append(decisions, Decision{Verdict: rule.Verdict, RuleID: rule.ID, Reason: rule.Reason, Command: text})
+		} else if p.Default != "" && p.Default != Allow {
+			reason := "command is not allowlisted"
+			if cmd.Dynamic || cmd.Name == "" {
+				reason = "command name cannot be determined statically"
+			}
+			decisions = append(decisions, p.defaultDecision(reason, text))
+		}
+		// bash -c 等执行的字符串按 POSIX 语法判定
+		nestedPOSIX := posix || IsPOSIXShell(cmd.Name)
+		for _, nested := range NestedScripts(cmd) {
+			decisions = append(decisions, p.evaluate(nested, nestedPOSIX, depth+1))
+		}
+		for _, d := range decisions {
+			result = stricter(result, d)
+		}
+		if result.Verdict == Deny {
+			return result
+		}
+	}
+	return result
+}
+
+// stricter 合并两个判定，取更严格的一个；同样严格时优先取有规则ID的
+func stricter(result, d Decision) Decision {
+	if d.Verdict.severity() > result.Verdict.severity() || result.RuleID == "" && d.Verdict == result.Verdict {
+		return d
+	}
+	return result
+}
+
+// defaultDecision 没有规则匹配时的判定，规则ID为 default
+func (p *Policy) defaultDecision(reason, command string) Decision {
+	if p.Default != Deny {
+		reason = "no rule matched"
+	}
+	return Decision{Verdict: p.Default, RuleID: "default", Reason: reason, Command: command}
+}
+
+// match 返回第一条匹配命令调用的规则
+func (p *Policy) match(cmd *psparse.Command, script *psparse.Script) *Rule {
+	for _, rule := range p.Rules {
+		if rule.matches(cmd, script) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// matches 判断规则的全部匹配条件是否都满足
+func (r *Rule) matches(cmd *psparse.Command, script *psparse.Script) bool {
+	if len(r.commands) > 0 && !matchAny(r.commands, cmd.Name, commandWord(cmd.Word)) {
+		return false
+	}
+	for _, names := range r.parameters {
+		if !cmd.HasParameter(names...) {
+			return false
+		}
+	}
+	if len(r.arguments) > 0 {
+		rendered := renderElements(cmd.Elements)
+		for _, globs := range r.arguments {
+			if !matchAny(globs, rendered...) {
+				return false
+			}
+		}
+	}
+	if len(r.paths) > 0 {
+		var paths []string
+		for _, value := range cmd.Values() {
+			paths = append(paths, normalizePath(value))
+		}
+		if !matchAny(r.paths, paths...) {
+			return false
+		}
+	}
+	if len(r.subcommands) > 0 {
+		args := cmd.Arguments()
+		if len(args) == 0 || !matchAny(r.subcommands, args[0]) {
+			return false
+		}
+	}
+	if len(r.allowedArgs) > 0 {
+		if len(cmd.Splats) > 0 {
+			return false
+		}
+		for _, e := range cmd.Elements {
+			if e.Parameter != "" && !matchAny(r.allowedArgs, "-"+e.Parameter) {
+				return false
+			}
+			if (e.Parameter == "" || e.Value != "") && !matchAny(r.allowedArgs, e.Value) {
+				return false
+			}
+		}
+	}
+	if r.pattern != nil && !matchesPattern(cmd, r.pattern) {
+		return false
+	}
+	if len(r.withCommands) > 0 || len(r.withMethods) > 0 {
+		// 同一脚本以及参数值中作为脚本执行的内容（iex (iwr ...)）
+		scripts := []*psparse.Script{script}
+		for _, value := range cmd.Values() {
+			scripts = append(scripts, psparse.Parse(value))
+		}
+		var names, methods []string
+		for _, s := range scripts {
+			for _, other := range s.Commands() {
+				if other != cmd {
+					names = append(names, other.Name)
+				}
+			}
+			methods = append(methods, s.Methods...)
+		}
+		if len(r.withCommands) > 0 && !matchAny(r.withCommands, names...) {
+			return false
+		}
+		if len(r.withMethods) > 0 && !matchAny(r.withMethods, methods...) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny 判断任一值是否匹配任一模式
+func matchAny(globs []*regexp.Regexp, values ...string) bool {
+	for _, value := range values {
+		value = strings.ToLower(value)
+		for _, glob := range globs {
+			if glob.MatchString(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// commandWord 返回源文本中命令词的文件名部分（小写，去掉可执行文件扩展名），不解析别名
+func commandWord(word string) string {
+	word = strings.ToLower(word)
+	if i := strings.LastIndexAny(word, `\/`); i >= 0 {
+		word = word[i+1:]
+	}
+	switch path.Ext(word) {
+	case ".exe", ".com", ".cmd", ".bat", ".ps1":
+		word = strings.TrimSuffix(word, path.Ext(word))
+	}
+	return word
+}
+
+// renderElements 返回参数的文本形式：位置参数为值，命名参数为 -name，以冒号绑定值时另加 -name:value
+func renderElements(elements []psparse.Element) []string {
+	var rendered []string
+	for _, e := range elements {
+		switch {
+		case e.Parameter == "":
+			rendered = append(rendered, e.Value)
+		case e.Value == "":
+			rendered = append(rendered, "-"+e.Parameter)
+		default:
+			rendered = append(rendered, "-"+e.Parameter, "-"+e.Parameter+":"+e.Value)
+		}
+	}
+	return rendered
+}
+
+// matchesPattern 检查命令调用是否匹配正则
+// 正则匹配小写的 命令名 参数... 文本，命令名分别使用源文本中的命令词和解析别名后的规范名称；
+// 匹配起点在引号字符串参数内的不算（如 echo "shutdown -s"）
+func matchesPattern(cmd *psparse.Command, re *regexp.Regexp) bool {
+	forms := []bool{false}
+	if !strings.EqualFold(cmd.Word, cmd.Name) {
+		forms = append(forms, true)
+	}
+	for _, word := range forms {
+		text, quoted := cmd.Text(word)
+		text = strings.ToLower(text)
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			if !inRanges(loc[0], quoted) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inRanges 判断位置是否落在任一范围内
+func inRanges(pos int, ranges [][2]int) bool {
+	for _, r := range ranges {
+		if pos >= r[0] && pos < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// NestedScripts 返回命令会作为脚本执行的字符串参数（cmd /c、powershell -Command、Invoke-Expression 等）
+func NestedScripts(cmd *psparse.Command) []string {
+	switch cmd.Name {
+	case "invoke-expression":
+		if value, ok := cmd.Parameter("command"); ok {
+			return []string{value}
+		}
+		return cmd.Arguments()
+	case "cmd":
+		// cmd /c 或 /k 之后的全部内容
+		for i, e := range cmd.Elements {
+			if v := strings.ToLower(e.Value); e.Parameter == "" && (v == "/c" || v == "/k" || v == "/r") {
+				return []string{joinElements(cmd.Elements[i+1:])}
+			}
+		}
+	case "powershell", "pwsh":
+		// -Command 之后的全部内容，未指定 -Command 和 -File 时位置参数即命令
+		for i, e := range cmd.Elements {
+			if e.Parameter != "" && strings.HasPrefix("command", e.Parameter) {
+				if e.Value != "" {
+					return []string{e.Value}
+				}
+				return []string{joinElements(cmd.Elements[i+1:])}
+			}
+		}
+		if !cmd.HasParameter("file") {
+			return []string{strings.Join(cmd.Arguments(), " ")}
+		}
+	case "bash", "sh", "zsh", "dash":
+		if value, ok := cmd.Parameter("c"); ok {
+			return []string{value}
+		}
+	case "start-process":
+		// Start-Process 的 -FilePath 和 -ArgumentList 组成的命令
+		file, ok := cmd.Parameter("filepath")
+		args := cmd.Arguments()
+		if !ok && len(args) > 0 {
+			file, args = args[0], args[1:]
+		}
+		if list, ok := cmd.Parameter("argumentlist"); ok {
+			args = []string{list}
+		}
+		return []string{strings.Join(append([]string{file}, args...), " ")}
+	case "sudo", "doas", "env", "nohup", "exec", "command", "call", "time", "xargs", "runas":
+		// 以参数执行其他命令的包装命令
+		return []string{joinElements(cmd.Elements)}
+	}
+	return nil
+}
+
+// joinElements 把参数重新拼接为命令文本
+func joinElements(elements []psparse.Element) string {
+	parts := make([]string, 0, len(elements))
+	for _, e := range elements {
+		switch {
+		case e.Parameter == "":
+			parts = append(parts, e.Value)
+		case e.Value == "":
+			parts = append(parts, "-"+e.Parameter)
+		default:
+			parts = append(parts, "-"+e.Parameter+":"+e.Value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// pathPrefixes 路径开头的环境变量和注册表根键，规范化为对应的路径
+var pathPrefixes = []struct{ prefix, path string }{
+	{"$env:windir", "c:/windows"},
+	{"$env:systemroot", "c:/windows"},
+	{"%windir%", "c:/windows"},
+	{"%systemroot%", "c:/windows"},
+	{"$env:programfiles", "c:/program files"},
+	{"%programfiles%", "c:/program files"},
+	{"$env:programdata", "c:/programdata"},
+	{"%programdata%", "c:/programdata"},
+	{"$env:systemdrive", "c:"},
+	{"%systemdrive%", "c:"},
+	{"registry::hkey_local_machine", "hklm:"},
+	{"registry::hklm", "hklm:"},
+	{"hkey_local_machine", "hklm:"},
+}
+
+// normalizePath 规范化路径参数：小写，/ 分隔，展开常见的系统目录环境变量，
+// 注册表根键统一为 hklm:，去掉 \\?\ 前缀、结尾的通配符和 . 、.. 路径段
+func normalizePath(value string) string {
+	p := strings.ToLower(strings.TrimSpace(value))
+	for _, prefix := range []string{`\\?\`, `\\.\`, `//?/`} {
+		p = strings.TrimPrefix(p, prefix)
+	}
+	for _, pp := range pathPrefixes {
+		if strings.HasPrefix(p, pp.prefix) {
+			p = pp.path + p[len(pp.prefix):]
+			break
+		}
+	}
+	p = strings.TrimRight(strings.ReplaceAll(p, `\`, "/"), "*")
+	if p == "" {
+		return ""
+	}
+	return path.Clean(p)
+}
+
+// compileGlobs 编译通配符：* 匹配任意字符，? 匹配单个字符；
+// 路径模式中 * 和 ? 不匹配 /，** 匹配多级目录，结尾的 /** 同时匹配目录本身
+func compileGlobs(globs []string, paths bool) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, 0, len(globs))
+	for _, glob := range globs {
+		compiled = append(compiled, compileGlob(glob, paths))
+	}
+	return compiled
+}
+
+func compileGlob(glob string, paths bool) *regexp.Regexp {
+	glob = strings.ToLower(glob)
+	if paths {
+		glob = strings.ReplaceAll(glob, `\`, "/")
+	}
+	runes := []rune(glob)
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(runes); i++ {
+		rest := string(runes[i:])
+		switch {
+		case paths && rest == "/**":
+			b.WriteString("(/.*)?")
+			i = len(runes)
+		case paths && strings.HasPrefix(rest, "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case paths && strings.HasPrefix(rest, "**"):
+			b.WriteString(".*")
+			i++
+		case runes[i] == '*' && paths:
+			b.WriteString("[^/]*")
+		case runes[i] == '*':
+			b.WriteString(".*")
+		case runes[i] == '?' && paths:
+			b.WriteString("[^/]")
+		case runes[i] == '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(runes[i])))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile("(?s)" + b.String())
+}
@@ -0,0 +1,300 @@
+// Package policy 声明式命令策略：规则按命令名、参数、路径参数或正则匹配解析后的命令调用，
+// 给出 allow（允许）、deny（拒绝）或 ask（需要确认）的判定
+package policy
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"mcp-bash-tools/internal/core"
+	"mcp-bash-tools/internal/psparse"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Verdict 规则的判定
+type Verdict string
+
+const (
+	Allow Verdict = "allow"
+	Ask   Verdict = "ask"
+	Deny  Verdict = "deny"
+)
+
+// severity 判定的严格程度，整条命令取各调用中最严格的判定
+func (v Verdict) severity() int {
+	switch v {
+	case Deny:
+		return 2
+	case Ask:
+		return 1
+	}
+	return 0
+}
+
+// Rule 一条策略规则，所有已设置的匹配条件都满足时规则匹配
+type Rule struct {
+	ID      string  `yaml:"id"`
+	Verdict Verdict `yaml:"verdict"`
+	Reason  string  `yaml:"reason"`
+
+	Commands     []string `yaml:"commands"`      // 命令名（通配符），匹配规范名称（已解析别名）或源文本中的命令词
+	Parameters   []string `yaml:"parameters"`    // 全部需要出现的命名参数，可缩写匹配，a|b 表示任一
+	Arguments    []string `yaml:"arguments"`     // 全部需要出现的参数（通配符），命名参数写作 -name，a|b 表示任一
+	Paths        []string `yaml:"paths"`         // 任一参数值规范化后匹配的路径（通配符，/ 分隔，** 匹配多级目录）
+	Pattern      string   `yaml:"pattern"`       // 匹配小写 命令名 参数... 文本的正则，起点在引号字符串参数内的匹配不算
+	WithCommands []string `yaml:"with_commands"` // 同一脚本中还需出现的其他命令（通配符）
+	WithMethods  []string `yaml:"with_methods"`  // 同一脚本中调用的 .NET 方法（通配符，静态方法为 类型::名称）
+
+	// 参数约束，用于允许列表：不满足时规则不匹配
+	Subcommands      []string `yaml:"subcommands"`       // 第一个位置参数必须匹配其一（通配符）
+	AllowedArguments []string `yaml:"allowed_arguments"` // 每个参数都必须匹配其一（通配符），命名参数写作 -name，无法解析的参数展开视为不匹配
+
+	pattern      *regexp.Regexp
+	commands     []*regexp.Regexp
+	parameters   [][]string
+	arguments    [][]*regexp.Regexp
+	paths        []*regexp.Regexp
+	withCommands []*regexp.Regexp
+	withMethods  []*regexp.Regexp
+	subcommands  []*regexp.Regexp
+	allowedArgs  []*regexp.Regexp
+}
+
+// Policy 有序的规则列表
+type Policy struct {
+	// Default 没有规则匹配的命令调用的判定，为空时为 allow；
+	// 不为 allow 时（允许列表模式）无法静态确定的命令名和 .NET 静态方法调用同样按此判定
+	Default Verdict `yaml:"default"`
+	Rules   []*Rule `yaml:"rules"`
+}
+
+// 安全模式（security.mode）
+const (
+	ModeBlocklist = "blocklist" // 只拦截策略拒绝的命令
+	ModeAllowlist = "allowlist" // 每个命令调用都必须匹配策略中的 allow 规则
+)
+
+// Decision 策略对一条命令的判定
+type Decision struct {
+	Verdict Verdict `json:"verdict"`
+	RuleID  string  `json:"ruleId,omitempty"`
+	Reason  string  `json:"reason,omitempty"`
+	Command string  `json:"command,omitempty"` // 触发规则的命令调用
+}
+
+// String 返回判定的说明，用于错误信息和审计
+func (d Decision) String() string {
+	if d.RuleID == "" {
+		return string(d.Verdict)
+	}
+	s := fmt.Sprintf("rule %s", d.RuleID)
+	if d.Reason != "" {
+		s += fmt.Sprintf(" (%s)", d.Reason)
+	}
+	if d.Command != "" {
+		s += fmt.Sprintf(" matched %q", d.Command)
+	}
+	return s
+}
+
+//go:embed default.yaml
+var defaultPolicyYAML []byte
+
+// defaultPolicy 内置策略，首次使用时解析
+var defaultPolicy = sync.OnceValue(func() *Policy {
+	p, err := Parse(defaultPolicyYAML)
+	if err != nil {
+		// 内置策略写错属于编程错误
+		panic(err)
+	}
+	return p
+})
+
+// Default 返回内置策略
+func Default() *Policy {
+	return defaultPolicy()
+}
+
+// Parse 解析 YAML 策略并校验规则，未知字段视为错误
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Load 读取并解析策略文件
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// FromPatterns 将危险命令正则转换为 deny 规则（ID 为 dangerous-pattern-<序号>）
+func FromPatterns(patterns []string) (*Policy, error) {
+	p := &Policy{}
+	for i, pattern := range patterns {
+		p.Rules = append(p.Rules, &Rule{
+			ID:      fmt.Sprintf("dangerous-pattern-%d", i+1),
+			Verdict: Deny,
+			Reason:  "matches dangerous pattern " + pattern,
+			Pattern: pattern,
+		})
+	}
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// FromConfig 按配置构造策略：security.policy_file 为空时使用内置策略；
+// security.dangerous_patterns 中的正则追加为 deny 规则（内置策略或策略文件的规则仍然生效）；
+// execution.blocked_commands 和 allowed_commands 依次追加为 deny 和 allow 规则；
+// security.mode 为 allowlist 时没有规则匹配的命令调用被拒绝
+func FromConfig(cfg *core.Config) (*Policy, error) {
+	sec := cfg.Security
+	extra, err := FromPatterns(sec.DangerousPatterns)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range cfg.Execution.BlockedCommands {
+		extra.Rules = append(extra.Rules, &Rule{
+			ID:       fmt.Sprintf("blocked-command-%d", i+1),
+			Verdict:  Deny,
+			Reason:   name + " is in execution.blocked_commands",
+			Commands: commandNames(name),
+		})
+	}
+	for i, name := range cfg.Execution.AllowedCommands {
+		extra.Rules = append(extra.Rules, &Rule{
+			ID:       fmt.Sprintf("allowed-command-%d", i+1),
+			Verdict:  Allow,
+			Reason:   name + " is in execution.allowed_commands",
+			Commands: commandNames(name),
+		})
+	}
+	if err := extra.compile(); err != nil {
+		return nil, err
+	}
+
+	var p *Policy
+	switch {
+	case sec.PolicyFile != "":
+		if p, err = Load(sec.PolicyFile); err != nil {
+			return nil, err
+		}
+	default:
+		// 内置策略的规则编译后不再修改，可以共享
+		p = &Policy{Default: Default().Default, Rules: append([]*Rule(nil), Default().Rules...)}
+	}
+	p.Rules = append(p.Rules, extra.Rules...)
+
+	switch sec.Mode {
+	case "", ModeBlocklist:
+	case ModeAllowlist:
+		p.Default = Deny
+	default:
+		return nil, fmt.Errorf("security.mode must be %s or %s, got %q", ModeBlocklist, ModeAllowlist, sec.Mode)
+	}
+	return p, nil
+}
+
+// commandNames 返回命令名及其规范名称（rm 同时匹配 remove-item 及其全部别名）
+func commandNames(name string) []string {
+	names := []string{name}
+	if canonical := psparse.CanonicalName(name); canonical != "" && canonical != strings.ToLower(name) {
+		names = append(names, canonical)
+	}
+	return names
+}
+
+// compile 校验规则并预编译正则
+func (p *Policy) compile() error {
+	switch p.Default {
+	case "", Allow, Ask, Deny:
+	default:
+		return fmt.Errorf("default must be allow, deny or ask, got %q", p.Default)
+	}
+	seen := make(map[string]bool)
+	for i, rule := range p.Rules {
+		if rule == nil {
+			return fmt.Errorf("rule %d is empty", i+1)
+		}
+		if rule.ID == "" {
+			return fmt.Errorf("rule %d has no id", i+1)
+		}
+		if seen[rule.ID] {
+			return fmt.Errorf("duplicate rule id %q", rule.ID)
+		}
+		seen[rule.ID] = true
+		switch rule.Verdict {
+		case Allow, Ask, Deny:
+		default:
+			return fmt.Errorf("rule %s: verdict must be allow, deny or ask, got %q", rule.ID, rule.Verdict)
+		}
+		if len(rule.Commands) == 0 && len(rule.Parameters) == 0 && len(rule.Arguments) == 0 && len(rule.Paths) == 0 &&
+			rule.Pattern == "" && len(rule.WithCommands) == 0 && len(rule.WithMethods) == 0 &&
+			len(rule.Subcommands) == 0 && len(rule.AllowedArguments) == 0 {
+			return fmt.Errorf("rule %s has no match conditions", rule.ID)
+		}
+		if rule.Pattern != "" {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return fmt.Errorf("rule %s: invalid pattern %q: %w", rule.ID, rule.Pattern, err)
+			}
+			rule.pattern = re
+		}
+		rule.commands = compileGlobs(rule.Commands, false)
+		rule.withCommands = compileGlobs(rule.WithCommands, false)
+		rule.withMethods = compileGlobs(rule.WithMethods, false)
+		rule.paths = compileGlobs(rule.Paths, true)
+		rule.subcommands = compileGlobs(rule.Subcommands, false)
+		rule.allowedArgs = compileGlobs(rule.AllowedArguments, false)
+		rule.parameters = nil
+		for _, parameter := range rule.Parameters {
+			rule.parameters = append(rule.parameters, strings.Split(strings.ToLower(parameter), "|"))
+		}
+		rule.arguments = nil
+		for _, argument := range rule.Arguments {
+			rule.arguments = append(rule.arguments, compileGlobs(strings.Split(argument, "|"), false))
+		}
+	}
+	return nil
+}
+
+// 当前生效的策略，重新加载配置时整体替换
+var current atomic.Pointer[Policy]
+
+// Current 返回当前生效的策略，未设置时为内置策略
+func Current() *Policy {
+	if p := current.Load(); p != nil {
+		return p
+	}
+	return Default()
+}
+
+// SetCurrent 原子替换当前策略，p 为nil时恢复内置策略
+func SetCurrent(p *Policy) {
+	current.Store(p)
+}
@@ -0,0 +1,80 @@
+package policy
+
+import "strings"
+
+// IsPOSIXShell 判断命令是否为 POSIX Shell，其 -c 参数按 POSIX 语法执行
+func IsPOSIXShell(name string) bool {
+	switch name {
+	case "bash", "sh", "zsh", "dash":
+		return true
+	}
+	return false
+}
+
+// CommandSubstitutions 按 POSIX Shell 的语法返回命令文本中反引号和 $(...) 命令替换的内容，嵌套的替换留在内容中
+// 单引号中的内容不会展开；反斜杠转义的反引号同样视为命令替换，因为 bash -c "echo \`id\`" 会在内层 Shell 中执行
+func CommandSubstitutions(source string) []string {
+	var subs []string
+	inDouble := false
+	for i := 0; i < len(source); i++ {
+		switch c := source[i]; {
+		case c == '\\' && i+1 < len(source) && source[i+1] != '`':
+			i++
+		case c == '`':
+			end := strings.IndexByte(source[i+1:], '`')
+			if end < 0 {
+				return append(subs, source[i+1:])
+			}
+			subs = append(subs, source[i+1:i+1+end])
+			i += end + 1
+		case c == '$' && i+1 < len(source) && source[i+1] == '(':
+			end := closingParen(source, i+2)
+			subs = append(subs, source[i+2:end])
+			i = end
+		case c == '"':
+			inDouble = !inDouble
+		case c == '\'' && !inDouble:
+			end := strings.IndexByte(source[i+1:], '\'')
+			if end < 0 {
+				return subs
+			}
+			i += end + 1
+		}
+	}
+	return subs
+}
+
+// closingParen 返回与 start 之前的 $( 匹配的 ) 的位置，未闭合时返回文本长度
+// 引号中的括号不计入，双引号中的 $( 开始新的一层
+func closingParen(source string, start int) int {
+	// 尚未闭合的 ( 和 "
+	stack := []byte{'('}
+	for i := start; i < len(source); i++ {
+		c := source[i]
+		switch top := stack[len(stack)-1]; {
+		case c == '\\':
+			i++
+		case top == '"':
+			if c == '"' {
+				stack = stack[:len(stack)-1]
+			} else if c == '$' && i+1 < len(source) && source[i+1] == '(' {
+				stack = append(stack, '(')
+				i++
+			}
+		case c == '\'':
+			end := strings.IndexByte(source[i+1:], '\'')
+			if end < 0 {
+				return len(source)
+			}
+			i += end + 1
+		case c == '"' || c == '(':
+			stack = append(stack, c)
+		case c == ')':
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return i
+			}
+		}
+	}
+	return len(source)
+}
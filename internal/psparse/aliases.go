@@ -0,0 +1,114 @@
+package psparse
+
+import (
+	"path"
+	"strings"
+)
+
+// Aliases Windows PowerShell 内置别名到 cmdlet 的映射（小写）
+// 包含 rm、curl 等在 PowerShell 7 的非 Windows 平台上不存在的别名，检查时按最坏情况解析
+var Aliases = map[string]string{
+	"%":       "foreach-object",
+	"?":       "where-object",
+	"ac":      "add-content",
+	"cat":     "get-content",
+	"cd":      "set-location",
+	"chdir":   "set-location",
+	"clc":     "clear-content",
+	"clear":   "clear-host",
+	"cls":     "clear-host",
+	"copy":    "copy-item",
+	"cp":      "copy-item",
+	"cpi":     "copy-item",
+	"curl":    "invoke-webrequest",
+	"del":     "remove-item",
+	"dir":     "get-childitem",
+	"echo":    "write-output",
+	"epal":    "export-alias",
+	"erase":   "remove-item",
+	"etsn":    "enter-pssession",
+	"foreach": "foreach-object",
+	"gc":      "get-content",
+	"gci":     "get-childitem",
+	"gcm":     "get-command",
+	"gi":      "get-item",
+	"gp":      "get-itemproperty",
+	"gps":     "get-process",
+	"gsv":     "get-service",
+	"gwmi":    "get-wmiobject",
+	"icm":     "invoke-command",
+	"iex":     "invoke-expression",
+	"ihy":     "invoke-history",
+	"ii":      "invoke-item",
+	"ipal":    "import-alias",
+	"ipmo":    "import-module",
+	"irm":     "invoke-restmethod",
+	"iwmi":    "invoke-wmimethod",
+	"iwr":     "invoke-webrequest",
+	"kill":    "stop-process",
+	"ls":      "get-childitem",
+	"man":     "help",
+	"md":      "mkdir",
+	"mi":      "move-item",
+	"move":    "move-item",
+	"mv":      "move-item",
+	"nal":     "new-alias",
+	"ni":      "new-item",
+	"nsn":     "new-pssession",
+	"ps":      "get-process",
+	"pwd":     "get-location",
+	"rd":      "remove-item",
+	"ren":     "rename-item",
+	"ri":      "remove-item",
+	"rm":      "remove-item",
+	"rmdir":   "remove-item",
+	"rni":     "rename-item",
+	"rp":      "remove-itemproperty",
+	"rv":      "remove-variable",
+	"rwmi":    "remove-wmiobject",
+	"sajb":    "start-job",
+	"sal":     "set-alias",
+	"saps":    "start-process",
+	"sasv":    "start-service",
+	"sc":      "set-content",
+	"set":     "set-variable",
+	"si":      "set-item",
+	"sl":      "set-location",
+	"sleep":   "start-sleep",
+	"sp":      "set-itemproperty",
+	"spps":    "stop-process",
+	"spsv":    "stop-service",
+	"start":   "start-process",
+	"sv":      "set-variable",
+	"swmi":    "set-wmiinstance",
+	"type":    "get-content",
+	"wget":    "invoke-webrequest",
+	"where":   "where-object",
+	"write":   "write-output",
+}
+
+// executableExtensions 解析命令名时去掉的可执行文件扩展名
+var executableExtensions = []string{".exe", ".com", ".cmd", ".bat", ".ps1"}
+
+// CanonicalName 返回命令词的规范命令名：去掉目录、模块限定和可执行文件扩展名，转为小写并解析内置别名
+// 命令名中含有变量（无法静态确定）时返回空
+func CanonicalName(word string) string {
+	name := strings.ToLower(strings.TrimSpace(word))
+	if i := strings.LastIndexAny(name, `\/`); i >= 0 {
+		name = name[i+1:]
+	}
+	if name == "" || strings.ContainsAny(name, "$(){}") {
+		return ""
+	}
+	ext := path.Ext(name)
+	for _, e := range executableExtensions {
+		if ext == e {
+			name = strings.TrimSuffix(name, ext)
+			break
+		}
+	}
+	if cmdlet, ok := Aliases[name]; ok {
+		return cmdlet
+	}
+	return name
+}
@@ -0,0 +1,670 @@
+// Package psparse 按 PowerShell 语法解析命令文本，供安全检查按命令调用而不是子串判断
+// 解析只覆盖识别命令调用所需的语法（字符串、Here-String、注释、转义、管道、语句、子表达式和脚本块），
+// 并且是容错的：无法识别的语法按表达式跳过，只有子表达式嵌套过深时报告错误
+package psparse
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TokenKind 词法单元类型
+type TokenKind int
+
+const (
+	TokenWord      TokenKind = iota // 裸词或字符串（命令名、参数值、表达式中的其他内容）
+	TokenParameter                  // 命名参数 -Name 或 -Name:
+	TokenVariable                   // 变量 $name、${name}、$env:name
+	TokenSplat                      // 参数展开 @name
+	TokenOperator                   // 运算符 | || && ; & . , = 以及重定向
+	TokenNewline                    // 换行
+	TokenOpen                       // 分组开始 ( $( @( { @{
+	TokenClose                      // 分组结束 ) }
+	TokenType                       // 类型字面量 [System.IO.File]
+	TokenMember                     // 成员访问 .Name 或 ::Name
+)
+
+// Token 词法单元
+type Token struct {
+	Kind           TokenKind
+	Text           string   // 源文本
+	Value          string   // 词去掉引号和转义后的值；参数、变量、类型和成员为小写名称
+	Pos            int      // 在源文本中的起始字节偏移
+	End            int      // 在源文本中的结束字节偏移
+	Quoted         bool     // 词以引号开头
+	Literal        bool     // 词的值是常量，不含变量或子表达式
+	Colon          bool     // 参数以冒号结尾，紧随其后的词法单元是参数值
+	Subexpressions []string // 可展开字符串和裸词中 $(...) 的源文本
+}
+
+// Is 判断词法单元是否为指定的运算符之一
+func (t *Token) Is(operators ...string) bool {
+	if t == nil || t.Kind != TokenOperator {
+		return false
+	}
+	for _, op := range operators {
+		if t.Text == op {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrTooDeep 子表达式嵌套超过 maxDepth 层
+var ErrTooDeep = errors.New("subexpressions are nested too deeply")
+
+// Tokenize 将源文本切分为词法单元
+// 未闭合的字符串、注释和子表达式延伸到文本末尾；子表达式嵌套过深时仍返回已切分的词法单元和 ErrTooDeep
+func Tokenize(src string) ([]Token, error) {
+	return tokenize(src, 0)
+}
+
+// tokenize 切分源文本，depth 是源文本所在的子表达式嵌套深度
+func tokenize(src string, depth int) ([]Token, error) {
+	l := &lexer{src: src, depth: depth}
+	l.run()
+	return l.tokens, l.err
+}
+
+type lexer struct {
+	src    string
+	pos    int
+	depth  int   // 当前子表达式嵌套深度
+	err    error // 第一个错误
+	tokens []Token
+}
+
+// PowerShell 把弯引号和各种破折号视同 ASCII 引号和连字符
+func isSingleQuote(r rune) bool {
+	return r == '\'' || r == '‘' || r == '’' || r == '‚' || r == '‛'
+}
+
+func isDoubleQuote(r rune) bool {
+	return r == '"' || r == '“' || r == '”' || r == '„'
+}
+
+func isDash(r rune) bool {
+	return r == '-' || r == '–' || r == '—' || r == '―'
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\f' || r == '\v' || r == '\r' || r == ' ' || r == '\u0085'
+}
+
+// isDelimiter 判断字符是否结束裸词
+func isDelimiter(r rune) bool {
+	return isSpace(r) || r == '\n' || strings.ContainsRune(";|&(){},<>", r)
+}
+
+func isNameChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (l *lexer) peek(offset int) rune {
+	if l.pos+offset >= len(l.src) {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[l.pos+offset:])
+	return r
+}
+
+func (l *lexer) emit(kind TokenKind, start int, value string) *Token {
+	l.tokens = append(l.tokens, Token{
+		Kind:    kind,
+		Text:    l.src[start:l.pos],
+		Value:   value,
+		Pos:     start,
+		End:     l.pos,
+		Literal: true,
+	})
+	return &l.tokens[len(l.tokens)-1]
+}
+
+// adjacentTo 判断当前位置是否紧跟在上一个指定类型的词法单元之后
+func (l *lexer) adjacentTo(kinds ...TokenKind) bool {
+	if len(l.tokens) == 0 {
+		return false
+	}
+	last := l.tokens[len(l.tokens)-1]
+	if last.End != l.pos {
+		return false
+	}
+	for _, kind := range kinds {
+		if last.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *lexer) run() {
+	for l.pos < len(l.src) {
+		start := l.pos
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		next := l.peek(size)
+		switch {
+		case r == '\n':
+			l.pos++
+			l.emit(TokenNewline, start, "")
+		case isSpace(r):
+			l.pos += size
+		case r == '`' && (next == '\n' || next == '\r'):
+			// 行继续符
+			l.pos += size
+			l.skipNewline()
+		case r == '#':
+			l.skipUntil("\n", false)
+		case r == '<' && next == '#':
+			l.skipUntil("#>", true)
+		case r == ';' || r == ',':
+			l.pos++
+			l.emit(TokenOperator, start, "")
+		case (r == '|' || r == '&') && next == r:
+			l.pos += 2
+			l.emit(TokenOperator, start, "")
+		case r == '|' || r == '&':
+			l.pos++
+			l.emit(TokenOperator, start, "")
+		case r == '(' || r == '{':
+			l.pos++
+			l.emit(TokenOpen, start, "")
+		case r == ')' || r == '}':
+			l.pos++
+			l.emit(TokenClose, start, "")
+		case (r == '$' || r == '@') && next == '(', r == '@' && next == '{':
+			l.pos += 2
+			l.emit(TokenOpen, start, "")
+		case r == '@' && (isSingleQuote(next) || isDoubleQuote(next)) && l.hereStringStart():
+			l.readHereString(start)
+		case r == '@' && isNameChar(next):
+			l.pos++
+			name := l.readName()
+			l.emit(TokenSplat, start, strings.ToLower(name))
+		case r == '$':
+			l.readVariableOrWord(start)
+		case r == '[':
+			l.readTypeOrWord(start)
+		case (r == '.' && (isNameChar(next) || next == '$')) && l.adjacentTo(TokenVariable, TokenClose, TokenType, TokenMember),
+			r == ':' && next == ':' && l.adjacentTo(TokenType, TokenClose, TokenVariable):
+			l.readMember(start)
+		case r == '.' && (next == 0 || isSpace(next) || next == '\n'):
+			// 点源运算符
+			l.pos++
+			l.emit(TokenOperator, start, "")
+		case l.redirectionAt():
+			l.readRedirection(start)
+		case r == '=':
+			l.pos++
+			l.emit(TokenOperator, start, "")
+		case isDash(r) && isDash(next) && l.peek(size+utf8.RuneLen(next)) == '%':
+			// --% 之后的内容原样传给本机命令
+			l.skipUntil("\n", false)
+			l.emit(TokenWord, start, l.src[start:l.pos])
+		case isDash(r) && (unicode.IsLetter(next) || next == '_' || next == '?'):
+			l.readParameter(start, size)
+		default:
+			l.readWord(start)
+		}
+	}
+}
+
+// skipUntil 跳过到指定结束标记，inclusive 为true时同时跳过结束标记
+func (l *lexer) skipUntil(marker string, inclusive bool) {
+	idx := strings.Index(l.src[l.pos:], marker)
+	if idx < 0 {
+		l.pos = len(l.src)
+		return
+	}
+	l.pos += idx
+	if inclusive {
+		l.pos += len(marker)
+	}
+}
+
+// skipNewline 跳过一个换行（\n 或 \r\n）
+func (l *lexer) skipNewline() {
+	if l.peek(0) == '\r' {
+		l.pos++
+	}
+	if l.peek(0) == '\n' {
+		l.pos++
+	}
+}
+
+// readName 读取变量名或参数展开名
+func (l *lexer) readName() string {
+	start := l.pos
+	for l.pos < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		if isNameChar(r) || r == ':' && isNameChar(l.peek(size)) && l.pos > start {
+			l.pos += size
+			continue
+		}
+		break
+	}
+	return l.src[start:l.pos]
+}
+
+// readVariable 读取 $ 之后的变量名，返回小写名称；$ 之后不是变量时返回空
+func (l *lexer) readVariable() string {
+	r := l.peek(1)
+	switch {
+	case r == '{':
+		end := strings.IndexByte(l.src[l.pos+2:], '}')
+		if end < 0 {
+			name := l.src[l.pos+2:]
+			l.pos = len(l.src)
+			return strings.ToLower(name)
+		}
+		name := l.src[l.pos+2 : l.pos+2+end]
+		l.pos += end + 3
+		return strings.ToLower(name)
+	case isNameChar(r):
+		l.pos++
+		return strings.ToLower(l.readName())
+	case r == '$' || r == '?' || r == '^':
+		l.pos += 2
+		return string(r)
+	}
+	return ""
+}
+
+// readVariableOrWord 读取变量；变量后紧跟路径分隔符时（如 $env:windir\system32）整体作为裸词
+func (l *lexer) readVariableOrWord(start int) {
+	name := l.readVariable()
+	if name == "" {
+		l.pos = start
+		l.readWord(start)
+		return
+	}
+	if r := l.peek(0); r == '\\' || r == '/' {
+		l.pos = start
+		l.readWord(start)
+		return
+	}
+	tok := l.emit(TokenVariable, start, name)
+	tok.Literal = false
+}
+
+// readTypeOrWord 读取类型字面量 [Type.Name]，内容不像类型名时按裸词读取（如通配符 [a-z]*）
+func (l *lexer) readTypeOrWord(start int) {
+	depth := 0
+	for i, r := range l.src[l.pos:] {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+			if depth == 0 {
+				name := l.src[l.pos+1 : l.pos+i]
+				if name != "" && unicode.IsLetter([]rune(name)[0]) && !strings.ContainsAny(name, "-*?") {
+					l.pos += i + 1
+					l.emit(TokenType, start, normalizeTypeName(name))
+					return
+				}
+				l.readWord(start)
+				return
+			}
+		case isNameChar(r) || strings.ContainsRune(".,` ", r):
+		default:
+			l.readWord(start)
+			return
+		}
+	}
+	l.readWord(start)
+}
+
+// normalizeTypeName 类型名转为小写并去掉可省略的 System. 前缀
+func normalizeTypeName(name string) string {
+	name = strings.ToLower(strings.ReplaceAll(name, " ", ""))
+	return strings.TrimPrefix(name, "system.")
+}
+
+// readMember 读取成员访问 .Name 或 ::Name
+func (l *lexer) readMember(start int) {
+	if l.src[l.pos] == ':' {
+		l.pos += 2
+	} else {
+		l.pos++
+	}
+	nameStart := l.pos
+	for l.pos < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		if !isNameChar(r) {
+			break
+		}
+		l.pos += size
+	}
+	l.emit(TokenMember, start, strings.ToLower(l.src[nameStart:l.pos]))
+}
+
+// redirectionAt 判断当前位置是否为重定向运算符（>、>>、2>、2>&1、*>、<）
+func (l *lexer) redirectionAt() bool {
+	r := l.peek(0)
+	if r == '>' || r == '<' {
+		return true
+	}
+	return (r == '*' || r >= '1' && r <= '6') && l.peek(1) == '>'
+}
+
+func (l *lexer) readRedirection(start int) {
+	if r := l.peek(0); r != '>' && r != '<' {
+		l.pos++
+	}
+	l.pos++
+	if l.peek(0) == '>' {
+		l.pos++
+	} else if l.peek(0) == '&' && l.peek(1) >= '1' && l.peek(1) <= '6' {
+		l.pos += 2
+	}
+	l.emit(TokenOperator, start, "")
+}
+
+// readParameter 读取命名参数，破折号可以是 - 或 – — ―
+func (l *lexer) readParameter(start, dashSize int) {
+	l.pos += dashSize
+	nameStart := l.pos
+	for l.pos < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		if isDelimiter(r) || r == ':' || isSingleQuote(r) || isDoubleQuote(r) {
+			break
+		}
+		l.pos += size
+	}
+	name := strings.ToLower(l.src[nameStart:l.pos])
+	colon := l.peek(0) == ':'
+	if colon {
+		l.pos++
+	}
+	tok := l.emit(TokenParameter, start, name)
+	tok.Colon = colon
+}
+
+// hereStringStart 判断 @" 或 @' 之后是否为换行（Here-String 的开始标记必须独占一行）
+func (l *lexer) hereStringStart() bool {
+	_, size := utf8.DecodeRuneInString(l.src[l.pos+1:])
+	for i := l.pos + 1 + size; i < len(l.src); i++ {
+		switch l.src[i] {
+		case ' ', '\t', '\r':
+		case '\n':
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// readHereString 读取 Here-String，结束标记为行首的 "@ 或 '@
+func (l *lexer) readHereString(start int) {
+	quote, size := utf8.DecodeRuneInString(l.src[l.pos+1:])
+	l.pos += 1 + size
+	l.pos += strings.IndexByte(l.src[l.pos:], '\n') + 1
+	bodyStart := l.pos
+	bodyEnd, end := len(l.src), len(l.src)
+	for i := bodyStart; i < len(l.src); {
+		lineEnd := strings.IndexByte(l.src[i:], '\n')
+		line := l.src[i:]
+		if lineEnd >= 0 {
+			line = l.src[i : i+lineEnd]
+		}
+		trimmed := strings.TrimLeft(line, " \t")
+		if r, n := utf8.DecodeRuneInString(trimmed); n > 0 && (isDoubleQuote(r) && isDoubleQuote(quote) || isSingleQuote(r) && isSingleQuote(quote)) && strings.HasPrefix(trimmed[n:], "@") {
+			bodyEnd = max(bodyStart, i-1)
+			end = i + len(line) - len(trimmed) + n + 1
+			break
+		}
+		if lineEnd < 0 {
+			break
+		}
+		i += lineEnd + 1
+	}
+	body := strings.TrimSuffix(l.src[bodyStart:bodyEnd], "\r")
+	l.pos = end
+	tok := l.emit(TokenWord, start, body)
+	tok.Quoted = true
+	if isDoubleQuote(quote) {
+		sub := &lexer{src: body, depth: l.depth}
+		value, literal, subs := expandString(sub.readExpandable(false))
+		tok.Value, tok.Literal, tok.Subexpressions = value, literal, subs
+		if l.err == nil {
+			l.err = sub.err
+		}
+	}
+}
+
+// readWord 读取裸词，词中可以包含引号部分（"a"b 等同于 ab）、转义字符和变量
+func (l *lexer) readWord(start int) {
+	var b strings.Builder
+	literal := true
+	var subs []string
+loop:
+	for l.pos < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		if isDelimiter(r) && l.pos > start {
+			break
+		}
+		switch {
+		case isSingleQuote(r):
+			l.pos += size
+			b.WriteString(l.readSingleQuoted())
+		case isDoubleQuote(r):
+			l.pos += size
+			value, lit, s := l.readDoubleQuoted()
+			b.WriteString(value)
+			literal = literal && lit
+			subs = append(subs, s...)
+		case r == '`' && (l.peek(size) == '\n' || l.peek(size) == '\r'):
+			// 行继续符结束裸词
+			l.pos += size
+			l.skipNewline()
+			break loop
+		case r == '`' && l.pos+size < len(l.src):
+			// 裸词中的反引号只转义下一个字符，不处理 `n 等特殊序列
+			l.pos += size
+			escaped, n := utf8.DecodeRuneInString(l.src[l.pos:])
+			l.pos += n
+			b.WriteRune(escaped)
+		case r == '$' && l.peek(1) == '(':
+			inner := l.readSubexpression()
+			b.WriteString("$(" + inner + ")")
+			literal = false
+			subs = append(subs, inner)
+		case r == '$':
+			varStart := l.pos
+			if l.readVariable() == "" {
+				// 不是变量（包括未闭合的 ${）时 $ 按普通字符处理
+				l.pos = varStart + size
+				b.WriteRune(r)
+				continue
+			}
+			b.WriteString(l.src[varStart:l.pos])
+			literal = false
+		default:
+			l.pos += size
+			b.WriteRune(r)
+		}
+	}
+	tok := l.emit(TokenWord, start, b.String())
+	tok.Literal = literal
+	tok.Subexpressions = subs
+	if r, _ := utf8.DecodeRuneInString(tok.Text); isSingleQuote(r) || isDoubleQuote(r) {
+		tok.Quoted = true
+	}
+}
+
+// readSingleQuoted 读取单引号字符串的剩余部分，两个连续的单引号表示一个单引号
+func (l *lexer) readSingleQuoted() string {
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		l.pos += size
+		if isSingleQuote(r) {
+			if next, n := utf8.DecodeRuneInString(l.src[l.pos:]); isSingleQuote(next) {
+				l.pos += n
+				b.WriteRune('\'')
+				continue
+			}
+			break
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// readDoubleQuoted 读取双引号字符串的剩余部分，返回展开转义后的值、是否为常量和其中的子表达式
+func (l *lexer) readDoubleQuoted() (string, bool, []string) {
+	return expandString(l.readExpandable(true))
+}
+
+// subexpression 可展开字符串中的一个 $(...)，位置相对于字符串内容
+type subexpression struct {
+	start, end int    // $ 的位置和 ) 之后的位置
+	inner      string // 括号内的源文本
+}
+
+// readExpandable 读取可展开字符串的内容并记录其中子表达式的位置，供 expandString 复用而不必重新扫描
+// quoted 为true时读到结束的双引号为止（"" 表示一个双引号），否则读到文本末尾
+func (l *lexer) readExpandable(quoted bool) (string, []subexpression) {
+	start := l.pos
+	var subs []subexpression
+	for l.pos < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		switch {
+		case r == '`':
+			l.pos += size
+			if l.pos < len(l.src) {
+				_, n := utf8.DecodeRuneInString(l.src[l.pos:])
+				l.pos += n
+			}
+			continue
+		case r == '$' && l.peek(1) == '(':
+			subStart := l.pos
+			inner := l.readSubexpression()
+			subs = append(subs, subexpression{start: subStart - start, end: l.pos - start, inner: inner})
+			continue
+		case quoted && isDoubleQuote(r):
+			if next, n := utf8.DecodeRuneInString(l.src[l.pos+size:]); isDoubleQuote(next) {
+				l.pos += size + n
+				continue
+			}
+			body := l.src[start:l.pos]
+			l.pos += size
+			return body, subs
+		}
+		l.pos += size
+	}
+	return l.src[start:], subs
+}
+
+// readSubexpression 读取从 $( 开始到匹配的 ) 的子表达式，返回内部源文本
+// 嵌套超过 maxDepth 层时记录 ErrTooDeep 并跳过其余文本
+func (l *lexer) readSubexpression() string {
+	l.pos += 2
+	start := l.pos
+	if l.depth >= maxDepth {
+		if l.err == nil {
+			l.err = ErrTooDeep
+		}
+		l.pos = len(l.src)
+		return ""
+	}
+	l.depth++
+	defer func() { l.depth-- }()
+	depth := 1
+	for l.pos < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		switch {
+		case r == '`':
+			l.pos += size
+			if l.pos < len(l.src) {
+				_, n := utf8.DecodeRuneInString(l.src[l.pos:])
+				l.pos += n
+			}
+			continue
+		case isSingleQuote(r):
+			l.pos += size
+			l.readSingleQuoted()
+			continue
+		case isDoubleQuote(r):
+			l.pos += size
+			l.readExpandable(true)
+			continue
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			if depth == 0 {
+				inner := l.src[start:l.pos]
+				l.pos += size
+				return inner
+			}
+		}
+		l.pos += size
+	}
+	return l.src[start:]
+}
+
+// expandString 处理可展开字符串的内容：转义字符、"" 和子表达式，变量保留原文
+// subs 是 readExpandable 记录的子表达式位置
+func expandString(body string, subs []subexpression) (string, bool, []string) {
+	var b strings.Builder
+	literal := true
+	var inners []string
+	for i := 0; i < len(body); {
+		r, size := utf8.DecodeRuneInString(body[i:])
+		switch {
+		case r == '`' && i+size < len(body):
+			escaped, n := utf8.DecodeRuneInString(body[i+size:])
+			b.WriteRune(unescape(escaped))
+			i += size + n
+			continue
+		case isDoubleQuote(r):
+			if next, n := utf8.DecodeRuneInString(body[i+size:]); isDoubleQuote(next) {
+				b.WriteRune('"')
+				i += size + n
+				continue
+			}
+		case len(subs) > 0 && subs[0].start == i:
+			b.WriteString(body[i:subs[0].end])
+			inners = append(inners, subs[0].inner)
+			literal = false
+			i = subs[0].end
+			subs = subs[1:]
+			continue
+		case r == '$' && i+1 < len(body):
+			if next, _ := utf8.DecodeRuneInString(body[i+1:]); isNameChar(next) || next == '{' {
+				literal = false
+			}
+		}
+		b.WriteRune(r)
+		i += size
+	}
+	return b.String(), literal, inners
+}
+
+// unescape 返回字符串中反引号转义序列对应的字符
+// `e 只有 PowerShell 6 以上支持，按 Windows PowerShell 的行为保留为字母 e
+func unescape(r rune) rune {
+	switch r {
+	case '0':
+		return 0
+	case 'a':
+		return '\a'
+	case 'b':
+		return '\b'
+	case 'f':
+		return '\f'
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'v':
+		return '\v'
+	}
+	return r
+}
@@ -0,0 +1,589 @@
+package psparse
+
+import (
+	"strings"
+)
+
+// Script 解析结果
+type Script struct {
+	Pipelines []*Pipeline // 全部管道，包括子表达式、脚本块、哈希表和可展开字符串中嵌套的管道
+	Methods   []string    // 调用的 .NET 方法（小写），实例方法为名称，静态方法为 类型::名称
+	Err       error       // 解析错误：子表达式嵌套过深时为 ErrTooDeep，此时结果不完整
+}
+
+// Pipeline 以 | 连接的命令
+type Pipeline struct {
+	Commands []*Command
+}
+
+// Command 一次命令调用
+type Command struct {
+	Name         string        // 规范命令名（小写，去掉路径和扩展名并解析别名），无法静态确定时为空
+	Word         string        // 源文本中的命令词（去掉引号和转义）
+	Invocation   string        // 调用运算符 & 或 .，直接调用时为空
+	Dynamic      bool          // 命令名来自变量或表达式，无法静态确定
+	Elements     []Element     // 命名参数和位置参数，按出现顺序
+	Redirections []Redirection // 输出重定向
+	Splats       []string      // 无法解析的参数展开变量名
+}
+
+// Element 命令的一个参数
+type Element struct {
+	Parameter string // 命名参数名（小写，不含 -）；为空表示位置参数
+	Value     string // 位置参数的值，或以 -Name:value 形式绑定的参数值
+	Literal   bool   // 值是常量
+	Quoted    bool   // 值来自引号字符串
+}
+
+// Redirection 输出重定向
+type Redirection struct {
+	Operator string // >、>>、2>、2>&1、*> 等
+	Target   string // 重定向目标，重定向到其他流时为空
+}
+
+// Commands 返回脚本中的全部命令调用
+func (s *Script) Commands() []*Command {
+	var commands []*Command
+	for _, pipeline := range s.Pipelines {
+		commands = append(commands, pipeline.Commands...)
+	}
+	return commands
+}
+
+// Arguments 返回位置参数的值
+func (c *Command) Arguments() []string {
+	var args []string
+	for _, e := range c.Elements {
+		if e.Parameter == "" {
+			args = append(args, e.Value)
+		}
+	}
+	return args
+}
+
+// Values 返回位置参数和以冒号绑定的参数值
+func (c *Command) Values() []string {
+	var values []string
+	for _, e := range c.Elements {
+		if e.Parameter == "" || e.Value != "" {
+			values = append(values, e.Value)
+		}
+	}
+	return values
+}
+
+// parameterIndex 返回匹配指定参数名的参数位置
+// PowerShell 允许把参数名缩写为任意前缀（-r 即 -Recurse），names 中任一名称以参数为前缀即匹配
+func (c *Command) parameterIndex(names ...string) int {
+	for i, e := range c.Elements {
+		if e.Parameter == "" {
+			continue
+		}
+		for _, name := range names {
+			if strings.HasPrefix(name, e.Parameter) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// HasParameter 判断命令是否带有指定的命名参数（可缩写），-Name:$false 视为未指定
+func (c *Command) HasParameter(names ...string) bool {
+	i := c.parameterIndex(names...)
+	if i < 0 {
+		return false
+	}
+	value := strings.ToLower(c.Elements[i].Value)
+	return value != "$false" && value != "0"
+}
+
+// Parameter 返回命名参数的值：-Name:value 的值，或紧随 -Name 的位置参数
+func (c *Command) Parameter(names ...string) (string, bool) {
+	i := c.parameterIndex(names...)
+	if i < 0 {
+		return "", false
+	}
+	if c.Elements[i].Value != "" {
+		return c.Elements[i].Value, true
+	}
+	if i+1 < len(c.Elements) && c.Elements[i+1].Parameter == "" {
+		return c.Elements[i+1].Value, true
+	}
+	return "", true
+}
+
+// Text 按 命令名 参数... 的形式重建命令文本，word 为true时使用源文本中的命令词
+// 同时返回值来自引号字符串的字节范围
+func (c *Command) Text(word bool) (string, [][2]int) {
+	var b strings.Builder
+	if word {
+		b.WriteString(c.Word)
+	} else {
+		b.WriteString(c.Name)
+	}
+	var quoted [][2]int
+	for _, e := range c.Elements {
+		b.WriteByte(' ')
+		if e.Parameter != "" {
+			b.WriteString("-" + e.Parameter)
+			if e.Value == "" {
+				continue
+			}
+			b.WriteByte(':')
+		}
+		start := b.Len()
+		b.WriteString(e.Value)
+		if e.Quoted {
+			quoted = append(quoted, [2]int{start, b.Len()})
+		}
+	}
+	return b.String(), quoted
+}
+
+// maxDepth 子表达式的最大嵌套深度
+const maxDepth = 32
+
+// 语句开头的关键字
+var (
+	// 后面跟名称和定义体
+	definitionKeywords = map[string]bool{"function": true, "filter": true, "workflow": true, "class": true, "enum": true, "configuration": true}
+	// 后面跟管道
+	pipelineKeywords = map[string]bool{"return": true, "throw": true, "exit": true}
+	// 后面跟条件、分组和脚本块
+	statementKeywords = map[string]bool{
+		"if": true, "elseif": true, "else": true, "foreach": true, "for": true, "while": true, "do": true, "until": true,
+		"switch": true, "try": true, "catch": true, "finally": true, "trap": true, "param": true, "begin": true,
+		"process": true, "end": true, "data": true, "dynamicparam": true, "break": true, "continue": true, "using": true,
+	}
+	// 复合赋值运算符（按裸词切分）
+	assignmentOperators = map[string]bool{"+=": true, "-=": true, "*=": true, "/=": true, "%=": true, "??=": true}
+)
+
+// Parse 解析 PowerShell 命令文本，子表达式嵌套超过 maxDepth 层时 Script.Err 为 ErrTooDeep
+func Parse(src string) *Script {
+	p := &parser{script: &Script{}, hashtables: map[string][]Element{}}
+	p.parseSource(src)
+	return p.script
+}
+
+type parser struct {
+	src        string
+	tokens     []Token
+	pos        int
+	depth      int
+	script     *Script
+	hashtables map[string][]Element // 赋值为哈希表字面量的变量，用于解析参数展开
+}
+
+// parseSource 解析一段源文本（顶层或子表达式），结果追加到同一个 Script
+func (p *parser) parseSource(src string) {
+	if p.depth > maxDepth {
+		p.fail(ErrTooDeep)
+		return
+	}
+	tokens, err := tokenize(src, p.depth)
+	if err != nil {
+		p.fail(err)
+	}
+	sub := &parser{src: src, tokens: tokens, depth: p.depth + 1, script: p.script, hashtables: p.hashtables}
+	sub.parseStatements(false)
+}
+
+// fail 记录第一个解析错误
+func (p *parser) fail(err error) {
+	if p.script.Err == nil {
+		p.script.Err = err
+	}
+}
+
+func (p *parser) peek() *Token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+// adjacent 判断下一个词法单元是否紧跟在前一个之后（中间没有空白）
+func (p *parser) adjacent() bool {
+	return p.pos > 0 && p.pos < len(p.tokens) && p.tokens[p.pos].Pos == p.tokens[p.pos-1].End
+}
+
+// atTerminator 判断是否到达语句或管道元素的结尾
+func (p *parser) atTerminator() bool {
+	t := p.peek()
+	return t == nil || t.Kind == TokenNewline || t.Kind == TokenClose || t.Is(";", "&&", "||", "|", "&")
+}
+
+// parseStatements 解析语句列表，inGroup 为true时在分组结束处返回
+func (p *parser) parseStatements(inGroup bool) {
+	for {
+		t := p.peek()
+		switch {
+		case t == nil:
+			return
+		case t.Kind == TokenClose:
+			if inGroup {
+				return
+			}
+			p.pos++
+		case t.Kind == TokenNewline || t.Is(";", "&&", "||", "|"):
+			p.pos++
+		default:
+			start := p.pos
+			p.parseStatement()
+			if p.pos == start {
+				p.pos++
+			}
+		}
+	}
+}
+
+func (p *parser) parseStatement() {
+	t := p.peek()
+	if t.Kind == TokenWord && !t.Quoted {
+		keyword := strings.ToLower(t.Value)
+		switch {
+		case definitionKeywords[keyword]:
+			p.pos++
+			if n := p.peek(); n != nil && n.Kind == TokenWord {
+				p.pos++
+			}
+			return
+		case pipelineKeywords[keyword]:
+			p.pos++
+			p.parsePipeline()
+			return
+		case statementKeywords[keyword]:
+			p.pos++
+			p.parseExpression()
+			return
+		}
+	}
+	p.parsePipeline()
+}
+
+func (p *parser) parsePipeline() {
+	pipeline := &Pipeline{}
+	for {
+		if cmd := p.parseElement(); cmd != nil {
+			pipeline.Commands = append(pipeline.Commands, cmd)
+		}
+		if !p.peek().Is("|") {
+			break
+		}
+		p.pos++
+		for t := p.peek(); t != nil && t.Kind == TokenNewline; t = p.peek() {
+			p.pos++
+		}
+	}
+	if len(pipeline.Commands) > 0 {
+		p.script.Pipelines = append(p.script.Pipelines, pipeline)
+	}
+}
+
+// parseElement 解析管道中的一个元素，元素是表达式时返回nil
+func (p *parser) parseElement() *Command {
+	t := p.peek()
+	switch {
+	case t.Is("&", "."):
+		p.pos++
+		if p.atTerminator() {
+			return nil
+		}
+		cmd := &Command{Invocation: t.Text}
+		p.parseCommandName(cmd)
+		p.parseArguments(cmd)
+		return cmd
+	case p.atTerminator():
+		return nil
+	case t.Kind == TokenWord && !t.Quoted && !isNumber(t.Value):
+		cmd := &Command{}
+		p.parseCommandName(cmd)
+		p.parseArguments(cmd)
+		return cmd
+	}
+	p.parseExpression()
+	return nil
+}
+
+// parseCommandName 解析命令词，调用运算符之后可以是字符串、变量、分组或脚本块
+func (p *parser) parseCommandName(cmd *Command) {
+	t := p.peek()
+	switch t.Kind {
+	case TokenWord:
+		p.pos++
+		cmd.Word = t.Value
+		cmd.Name = CanonicalName(t.Value)
+		cmd.Dynamic = cmd.Name == ""
+		p.parseSubexpressions(t)
+	case TokenOpen:
+		raw, value, constant := p.parseGroup()
+		cmd.Word = raw
+		switch {
+		case constant:
+			cmd.Word, cmd.Name = value, CanonicalName(value)
+		case t.Text != "{":
+			// 脚本块中的命令已单独解析，其他分组的结果无法静态确定
+			cmd.Dynamic = true
+		}
+	default:
+		value := p.parseValue()
+		cmd.Word = value.Value
+		cmd.Dynamic = true
+	}
+}
+
+// parseArguments 解析命令参数直到管道或语句结束
+func (p *parser) parseArguments(cmd *Command) {
+	for !p.atTerminator() {
+		t := p.peek()
+		switch {
+		case t.Kind == TokenParameter:
+			p.pos++
+			e := Element{Parameter: t.Value}
+			if t.Colon && p.adjacent() && !p.atTerminator() {
+				value := p.parseValue()
+				e.Value, e.Literal, e.Quoted = value.Value, value.Literal, value.Quoted
+			}
+			cmd.Elements = append(cmd.Elements, e)
+		case t.Kind == TokenSplat:
+			p.pos++
+			if elements, ok := p.hashtables[t.Value]; ok {
+				cmd.Elements = append(cmd.Elements, elements...)
+			} else {
+				cmd.Splats = append(cmd.Splats, t.Value)
+			}
+		case t.Is(","):
+			p.pos++
+		case t.Kind == TokenOperator && isRedirection(t.Text):
+			p.pos++
+			r := Redirection{Operator: t.Text}
+			if !strings.Contains(t.Text, "&") && !p.atTerminator() {
+				r.Target = p.parseValue().Value
+			}
+			cmd.Redirections = append(cmd.Redirections, r)
+		default:
+			cmd.Elements = append(cmd.Elements, p.parseValue())
+		}
+	}
+}
+
+// parseValue 解析一个参数值，包括紧随其后的成员访问和方法调用
+func (p *parser) parseValue() Element {
+	t := p.peek()
+	start := t.Pos
+	e := Element{Value: t.Value, Literal: t.Literal, Quoted: t.Quoted}
+	switch t.Kind {
+	case TokenOpen:
+		raw, value, constant := p.parseGroup()
+		e = Element{Value: raw, Literal: constant}
+		if constant {
+			e.Value, e.Quoted = value, true
+		}
+	case TokenWord:
+		p.pos++
+		p.parseSubexpressions(t)
+	default:
+		p.pos++
+		e = Element{Value: t.Text, Literal: t.Kind != TokenVariable}
+	}
+	if p.parseMembers() {
+		e = Element{Value: p.src[start:p.tokens[p.pos-1].End]}
+	}
+	return e
+}
+
+// parseMembers 解析紧随值之后的成员访问、方法调用和索引，返回是否存在成员访问
+func (p *parser) parseMembers() bool {
+	found := false
+	for p.adjacent() {
+		t := p.peek()
+		switch {
+		case t.Kind == TokenMember:
+			p.recordMember()
+			found = true
+		case t.Kind == TokenOpen && t.Text == "(" && found:
+			p.parseGroup()
+		default:
+			return found
+		}
+	}
+	return found
+}
+
+// recordMember 消费一个成员访问，后面紧跟 ( 时记录方法调用
+func (p *parser) recordMember() {
+	t := p.peek()
+	p.pos++
+	if !p.adjacent() || p.peek().Kind != TokenOpen || p.peek().Text != "(" {
+		return
+	}
+	name := t.Value
+	if p.pos >= 2 && p.tokens[p.pos-2].Kind == TokenType && strings.HasPrefix(t.Text, "::") {
+		name = p.tokens[p.pos-2].Value + "::" + name
+	}
+	p.script.Methods = append(p.script.Methods, name)
+}
+
+// parseExpression 跳过表达式直到语句或管道元素结束，解析其中的分组、方法调用和赋值右侧的管道
+func (p *parser) parseExpression() {
+	start := p.pos
+	for !p.atTerminator() {
+		t := p.peek()
+		switch {
+		case t.Kind == TokenOpen:
+			p.parseGroup()
+		case t.Kind == TokenMember:
+			p.recordMember()
+		case t.Is("=") || t.Kind == TokenWord && !t.Quoted && assignmentOperators[t.Value]:
+			p.pos++
+			var target string
+			if p.pos-2 >= start && p.tokens[p.pos-2].Kind == TokenVariable {
+				target = p.tokens[p.pos-2].Value
+			}
+			if n := p.peek(); target != "" && n != nil && n.Kind == TokenOpen && n.Text == "@{" && t.Is("=") {
+				p.pos++
+				p.hashtables[target] = p.parseHashtable()
+				p.closeGroup()
+				continue
+			}
+			// 赋值右侧是管道
+			if !p.atTerminator() {
+				p.parsePipeline()
+			}
+			return
+		case t.Kind == TokenWord:
+			p.pos++
+			p.parseSubexpressions(t)
+		default:
+			p.pos++
+		}
+	}
+}
+
+// parseGroup 解析分组（(...)、$(...)、@(...)、{...}、@{...}），返回分组源文本
+// 分组内只有字符串常量和 + 时（如 ('Stop-' + 'Computer')）constant 为true，value 为拼接结果
+func (p *parser) parseGroup() (raw, value string, constant bool) {
+	open := p.peek()
+	p.pos++
+	if open.Text == "@{" {
+		p.parseHashtable()
+	} else {
+		if open.Text == "(" {
+			value, constant = p.foldConstant()
+		}
+		p.parseStatements(true)
+	}
+	end := p.closeGroup()
+	return p.src[open.Pos:end], value, constant
+}
+
+// closeGroup 消费分组结束符，返回分组结束位置；分组未闭合时延伸到文本末尾
+func (p *parser) closeGroup() int {
+	if t := p.peek(); t != nil && t.Kind == TokenClose {
+		p.pos++
+		return t.End
+	}
+	return len(p.src)
+}
+
+// foldConstant 计算分组内字符串常量拼接的结果，不移动解析位置
+func (p *parser) foldConstant() (string, bool) {
+	var b strings.Builder
+	expectString := true
+	for i := p.pos; i < len(p.tokens); i++ {
+		t := p.tokens[i]
+		switch {
+		case t.Kind == TokenClose:
+			return b.String(), !expectString
+		case t.Kind == TokenNewline:
+		case expectString && t.Kind == TokenWord && t.Quoted && t.Literal:
+			b.WriteString(t.Value)
+			expectString = false
+		case !expectString && t.Kind == TokenWord && t.Value == "+" && !t.Quoted:
+			expectString = true
+		default:
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// parseHashtable 解析哈希表字面量的内容，返回可用于参数展开的键值（值不是简单值时为空）
+func (p *parser) parseHashtable() []Element {
+	var elements []Element
+	for {
+		t := p.peek()
+		switch {
+		case t == nil || t.Kind == TokenClose:
+			return elements
+		case t.Kind == TokenNewline || t.Is(";"):
+			p.pos++
+			continue
+		case t.Kind != TokenWord:
+			start := p.pos
+			p.parseStatement()
+			if p.pos == start {
+				p.pos++
+			}
+			continue
+		}
+		p.pos++
+		e := Element{Parameter: strings.ToLower(t.Value)}
+		if key, value, ok := strings.Cut(t.Value, "="); ok && !t.Quoted {
+			// key=value 没有空格时词法分析得到一个裸词
+			e.Parameter, e.Value, e.Literal = strings.ToLower(key), value, t.Literal
+		} else if p.peek().Is("=") {
+			p.pos++
+			if v := p.peek(); v != nil && (v.Kind == TokenWord || v.Kind == TokenVariable) && p.simpleValueAt(p.pos+1) {
+				p.pos++
+				e.Value, e.Literal, e.Quoted = v.Value, v.Literal, v.Quoted
+				if v.Kind == TokenVariable {
+					e.Value = v.Text
+				}
+			} else if !p.atTerminator() {
+				p.parseStatement()
+			}
+		}
+		elements = append(elements, e)
+	}
+}
+
+// simpleValueAt 判断哈希表的值在指定位置结束
+func (p *parser) simpleValueAt(i int) bool {
+	if i >= len(p.tokens) {
+		return true
+	}
+	t := &p.tokens[i]
+	return t.Kind == TokenNewline || t.Kind == TokenClose || t.Is(";")
+}
+
+// parseSubexpressions 解析词中 $(...) 子表达式里的命令
+func (p *parser) parseSubexpressions(t *Token) {
+	for _, sub := range t.Subexpressions {
+		p.parseSource(sub)
+	}
+}
+
+// isRedirection 判断运算符是否为重定向
+func isRedirection(op string) bool {
+	return strings.ContainsAny(op, "<>")
+}
+
+// isNumber 判断裸词是否为数字字面量（此时语句是表达式而不是命令）
+func isNumber(word string) bool {
+	if word == "" {
+		return false
+	}
+	word = strings.TrimPrefix(strings.ToLower(word), "0x")
+	if word == "" {
+		return false
+	}
+	for _, r := range word {
+		if (r < '0' || r > '9') && r != '.' && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return word[0] >= '0' && word[0] <= '9' || word[0] == '.'
+}
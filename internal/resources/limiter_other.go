@@ -0,0 +1,37 @@
+//go:build !linux && !windows
+
+package resources
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// noLimiter 其他平台不支持资源限制
+type noLimiter struct{}
+
+func newPlatformLimiter(cgroupParent string) (ProcessLimiter, error) {
+	if cgroupParent != "" {
+		return nil, fmt.Errorf("cgroup_parent is only supported on Linux")
+	}
+	return noLimiter{}, nil
+}
+
+func (noLimiter) Name() string {
+	return "none"
+}
+
+func (noLimiter) Unsupported(limits Limits) []string {
+	return limits.names()
+}
+
+func (noLimiter) Prepare(cmd *exec.Cmd, limits Limits) (Process, error) {
+	return noProcess{}, nil
+}
+
+type noProcess struct{}
+
+func (noProcess) Started(*os.Process) error { return nil }
+
+func (noProcess) Release() {}
@@ -0,0 +1,73 @@
+package resources
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"mcp-bash-tools/internal/windows"
+)
+
+// jobLimiter 每条命令加入一个设置了资源限制的 Job Object：内存为作业中全部进程提交内存的总和，
+// CPU 按硬上限执行，进程数为同时存在的进程数；Windows 没有对应的打开文件数和文件大小限制
+// 进程在启动后立即加入 Job，此前极短时间内创建的子进程不受限制
+type jobLimiter struct{}
+
+func newPlatformLimiter(cgroupParent string) (ProcessLimiter, error) {
+	if cgroupParent != "" {
+		return nil, fmt.Errorf("cgroup_parent is only supported on Linux")
+	}
+	return jobLimiter{}, nil
+}
+
+func (jobLimiter) Name() string {
+	return "job"
+}
+
+func (jobLimiter) Unsupported(limits Limits) []string {
+	var names []string
+	if limits.FileSizeBytes > 0 {
+		names = append(names, FileSize)
+	}
+	if limits.OpenFiles > 0 {
+		names = append(names, OpenFiles)
+	}
+	return names
+}
+
+func (jobLimiter) Prepare(cmd *exec.Cmd, limits Limits) (Process, error) {
+	return &jobProcess{limits: limits}, nil
+}
+
+// jobProcess 一个受限进程所在的 Job Object
+type jobProcess struct {
+	limits Limits
+	job    *windows.JobObject
+}
+
+func (p *jobProcess) Started(proc *os.Process) error {
+	if p.limits.MemoryBytes <= 0 && p.limits.CPUPercent <= 0 && p.limits.Processes <= 0 {
+		return nil
+	}
+	job, err := windows.CreateJobObject("")
+	if err != nil {
+		return err
+	}
+	p.job = job
+	if err := job.SetLimits(windows.JobLimits{
+		MemoryBytes: uint64(p.limits.MemoryBytes),
+		CPUPercent:  p.limits.CPUPercent,
+		Processes:   uint32(p.limits.Processes),
+	}); err != nil {
+		return err
+	}
+	return job.AddProcess(proc)
+}
+
+// Release 关闭 Job Object，其中残留的进程随之终止
+func (p *jobProcess) Release() {
+	if p.job != nil {
+		p.job.Close()
+		p.job = nil
+	}
+}
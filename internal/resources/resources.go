@@ -0,0 +1,191 @@
+// Package resources 限制命令进程的资源使用：内存、CPU、写入文件大小、打开文件数和进程数
+// 限制在创建进程时应用，Linux 下使用 cgroup v2（配置了委派的父 cgroup 时）和 rlimit，
+// Windows 下使用 Job Object
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync/atomic"
+
+	"mcp-bash-tools/internal/core"
+)
+
+// Limits 一次命令执行的资源限制，0表示不限制
+type Limits struct {
+	MemoryBytes   int64 // 进程树的内存上限（仅有 rlimit 时为每个进程的数据段上限）
+	CPUPercent    int   // 占单个 CPU 核心的百分比，200 表示两个核心
+	FileSizeBytes int64 // 每个写入文件的大小上限
+	OpenFiles     int   // 每个进程的打开文件数上限
+	Processes     int   // 进程树中同时存在的进程数上限
+}
+
+// IsZero 判断是否没有任何限制
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// 限制项名称，与配置键和调用参数一致
+const (
+	Memory    = "memory_mb"
+	CPU       = "cpu_percent"
+	FileSize  = "file_size_mb"
+	OpenFiles = "open_files"
+	Processes = "processes"
+)
+
+// names 返回设置了的限制项
+func (l Limits) names() []string {
+	var names []string
+	if l.MemoryBytes > 0 {
+		names = append(names, Memory)
+	}
+	if l.CPUPercent > 0 {
+		names = append(names, CPU)
+	}
+	if l.FileSizeBytes > 0 {
+		names = append(names, FileSize)
+	}
+	if l.OpenFiles > 0 {
+		names = append(names, OpenFiles)
+	}
+	if l.Processes > 0 {
+		names = append(names, Processes)
+	}
+	return names
+}
+
+// ProcessLimiter 在创建进程时应用资源限制的机制
+type ProcessLimiter interface {
+	// Name 返回限制机制的名称，如 cgroup+rlimit、rlimit、job
+	Name() string
+	// Unsupported 返回该机制无法执行的限制项
+	Unsupported(l Limits) []string
+	// Prepare 在进程启动前调用，可以设置 cmd.SysProcAttr；不支持的限制项被忽略
+	Prepare(cmd *exec.Cmd, l Limits) (Process, error)
+}
+
+// Process 一个受限进程的限制状态
+type Process interface {
+	// Started 在进程启动后立即调用
+	Started(p *os.Process) error
+	// Release 在进程退出后调用，终止进程树中残留的进程并释放 cgroup、Job 等资源
+	Release()
+}
+
+// Start 按限制启动命令，返回进程退出（Wait 返回）后调用的释放函数
+// 限制无法应用时终止已启动的进程并返回错误
+func Start(cmd *exec.Cmd, l Limits) (func(), error) {
+	if l.IsZero() {
+		return func() {}, cmd.Start()
+	}
+	limited, err := Current().Prepare(cmd, l)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare resource limits: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		limited.Release()
+		return nil, err
+	}
+	if err := limited.Started(cmd.Process); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		limited.Release()
+		return nil, fmt.Errorf("failed to apply resource limits: %w", err)
+	}
+	return limited.Release, nil
+}
+
+// New 根据配置创建当前平台的限制机制
+func New(cfg core.LimitsConfig) (ProcessLimiter, error) {
+	return newPlatformLimiter(cfg.CgroupParent)
+}
+
+var current atomic.Pointer[ProcessLimiter]
+
+func init() {
+	limiter, err := newPlatformLimiter("")
+	if err != nil {
+		panic(err)
+	}
+	SetCurrent(limiter)
+}
+
+// Current 返回当前生效的限制机制，未设置时为不使用 cgroup 的默认机制
+func Current() ProcessLimiter {
+	return *current.Load()
+}
+
+// SetCurrent 替换当前生效的限制机制（配置重新加载时调用）
+func SetCurrent(limiter ProcessLimiter) {
+	current.Store(&limiter)
+}
+
+// Request 单次调用指定的资源限制，0表示使用配置的默认值
+type Request struct {
+	MemoryMB   int `json:"memory_mb,omitempty" jsonschema:"进程树的内存上限(MB)"`
+	CPUPercent int `json:"cpu_percent,omitempty" jsonschema:"CPU上限,占单个核心的百分比,200表示两个核心"`
+	FileSizeMB int `json:"file_size_mb,omitempty" jsonschema:"每个写入文件的大小上限(MB)"`
+	OpenFiles  int `json:"open_files,omitempty" jsonschema:"每个进程的打开文件数上限"`
+	Processes  int `json:"processes,omitempty" jsonschema:"同时存在的进程数上限"`
+}
+
+// Resolve 计算单次调用的限制：未指定的项使用配置的默认值（未配置默认值时为上限），
+// 指定的项不能超过配置的上限，且必须是限制机制支持的项
+func Resolve(cfg core.LimitsConfig, req Request, limiter ProcessLimiter) (Limits, error) {
+	var errs []error
+	resolve := func(name string, requested, def, maximum int) int {
+		switch {
+		case requested < 0:
+			errs = append(errs, fmt.Errorf("%s must not be negative, got: %d", name, requested))
+		case requested == 0 && def > 0:
+			return def
+		case requested == 0:
+			return maximum
+		case maximum > 0 && requested > maximum:
+			errs = append(errs, fmt.Errorf("%s must not exceed %d, got: %d", name, maximum, requested))
+		}
+		return requested
+	}
+	l := Limits{
+		MemoryBytes:   int64(resolve(Memory, req.MemoryMB, cfg.MemoryMB, cfg.MaxMemoryMB)) << 20,
+		CPUPercent:    resolve(CPU, req.CPUPercent, cfg.CPUPercent, cfg.MaxCPUPercent),
+		FileSizeBytes: int64(resolve(FileSize, req.FileSizeMB, cfg.FileSizeMB, cfg.MaxFileSizeMB)) << 20,
+		OpenFiles:     resolve(OpenFiles, req.OpenFiles, cfg.OpenFiles, cfg.MaxOpenFiles),
+		Processes:     resolve(Processes, req.Processes, cfg.Processes, cfg.MaxProcesses),
+	}
+	requested := Limits{
+		MemoryBytes:   int64(max(req.MemoryMB, 0)),
+		CPUPercent:    max(req.CPUPercent, 0),
+		FileSizeBytes: int64(max(req.FileSizeMB, 0)),
+		OpenFiles:     max(req.OpenFiles, 0),
+		Processes:     max(req.Processes, 0),
+	}
+	for _, name := range limiter.Unsupported(requested) {
+		errs = append(errs, fmt.Errorf("%s is not supported by the %s limiter", name, limiter.Name()))
+	}
+	return l, errors.Join(errs...)
+}
+
+// Validate 校验资源限制配置：不能为负数，默认值不能超过上限
+func Validate(cfg core.LimitsConfig) error {
+	var errs []error
+	check := func(name string, def, maximum int) {
+		if def < 0 || maximum < 0 {
+			errs = append(errs, fmt.Errorf("%s and max_%s must not be negative", name, name))
+		} else if maximum > 0 && def > maximum {
+			errs = append(errs, fmt.Errorf("%s (%d) must not exceed max_%s (%d)", name, def, name, maximum))
+		}
+	}
+	check(Memory, cfg.MemoryMB, cfg.MaxMemoryMB)
+	check(CPU, cfg.CPUPercent, cfg.MaxCPUPercent)
+	check(FileSize, cfg.FileSizeMB, cfg.MaxFileSizeMB)
+	check(OpenFiles, cfg.OpenFiles, cfg.MaxOpenFiles)
+	check(Processes, cfg.Processes, cfg.MaxProcesses)
+	if _, err := New(cfg); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,201 @@
+package security
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"mcp-bash-tools/pkg/logger"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// PermissionAll grants every permission
+	PermissionAll = "*"
+	// DefaultTokenExpiry is the lifetime of tokens issued by JWTAuthProvider.GenerateToken
+	DefaultTokenExpiry = 24 * time.Hour
+	// MinAPIKeyLength is the minimum length of a static API key
+	MinAPIKeyLength = 16
+	// MinJWTSecretLength is the minimum length of the HS256 signing secret
+	MinJWTSecretLength = 32
+)
+
+// ErrInvalidToken is returned when no provider accepts a token
+var ErrInvalidToken = errors.New("invalid token")
+
+// jwtClaims are the claims carried by HS256 tokens
+type jwtClaims struct {
+	Name        string   `json:"name,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// APIKeyAuthProvider authenticates static API keys from configuration
+type APIKeyAuthProvider struct {
+	keys []apiKey
+}
+
+type apiKey struct {
+	secret []byte
+	auth   AuthContext
+}
+
+// ChainAuthProvider tries each provider in order and accepts the first successful authentication
+type ChainAuthProvider []AuthProvider
+
+// NewAuthProvider builds the providers enabled by config: API keys first, then JWT.
+// Without API keys or a JWT secret a random secret is generated, so only tokens from GenerateToken are accepted.
+func NewAuthProvider(config SecurityConfig, logger *logger.Logger) (AuthProvider, error) {
+	var chain ChainAuthProvider
+	if len(config.APIKeys) > 0 {
+		provider, err := NewAPIKeyAuthProvider(config.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, provider)
+	}
+
+	secret := config.JWTSecret
+	if secret == "" && len(config.APIKeys) == 0 {
+		secret = generateSecretKey()
+	}
+	if secret != "" {
+		if len(secret) < MinJWTSecretLength {
+			return nil, fmt.Errorf("JWT secret must be at least %d characters", MinJWTSecretLength)
+		}
+		provider := NewJWTAuthProvider(secret, logger)
+		if config.TokenExpiry > 0 {
+			provider.tokenExpiry = config.TokenExpiry
+		}
+		chain = append(chain, provider)
+	}
+	return chain, nil
+}
+
+// ParseAPIKey parses an API key entry of the form "user:key" or "user:key:perm1+perm2".
+// Keys without permissions are granted PermissionAll.
+func ParseAPIKey(entry string) (*AuthContext, string, error) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) < 2 || parts[0] == "" {
+		return nil, "", fmt.Errorf("API key entry must have the form user:key[:perm1+perm2]")
+	}
+	user, key := parts[0], parts[1]
+	if len(key) < MinAPIKeyLength {
+		return nil, "", fmt.Errorf("API key for %s must be at least %d characters", user, MinAPIKeyLength)
+	}
+
+	permissions := []string{PermissionAll}
+	if len(parts) == 3 {
+		permissions = nil
+		for _, perm := range strings.Split(parts[2], "+") {
+			if perm = strings.TrimSpace(perm); perm != "" {
+				permissions = append(permissions, perm)
+			}
+		}
+	}
+	return &AuthContext{UserID: user, Username: user, Permissions: permissions}, key, nil
+}
+
+// NewAPIKeyAuthProvider creates a provider for the given API key entries (see ParseAPIKey)
+func NewAPIKeyAuthProvider(entries []string) (*APIKeyAuthProvider, error) {
+	provider := &APIKeyAuthProvider{}
+	for _, entry := range entries {
+		auth, key, err := ParseAPIKey(entry)
+		if err != nil {
+			return nil, err
+		}
+		provider.keys = append(provider.keys, apiKey{secret: []byte(key), auth: *auth})
+	}
+	return provider, nil
+}
+
+func (ap *APIKeyAuthProvider) Authenticate(ctx context.Context, token string) (*AuthContext, error) {
+	if token == "" {
+		return nil, fmt.Errorf("token is required")
+	}
+
+	// Compare against every key in constant time
+	var match *apiKey
+	for i := range ap.keys {
+		if subtle.ConstantTimeCompare([]byte(token), ap.keys[i].secret) == 1 {
+			match = &ap.keys[i]
+		}
+	}
+	if match == nil {
+		return nil, ErrInvalidToken
+	}
+
+	auth := match.auth
+	auth.Permissions = slices.Clone(match.auth.Permissions)
+	return &auth, nil
+}
+
+func (ap *APIKeyAuthProvider) GenerateToken(ctx context.Context, userID string, permissions []string) (string, error) {
+	return "", fmt.Errorf("API keys are configured statically and cannot be generated")
+}
+
+func (ap *APIKeyAuthProvider) ValidatePermissions(ctx context.Context, auth *AuthContext, required []string) error {
+	return CheckPermissions(auth, required)
+}
+
+func (c ChainAuthProvider) Authenticate(ctx context.Context, token string) (*AuthContext, error) {
+	if token == "" {
+		return nil, fmt.Errorf("token is required")
+	}
+	for _, provider := range c {
+		if auth, err := provider.Authenticate(ctx, token); err == nil {
+			return auth, nil
+		}
+	}
+	// Do not reveal which provider rejected the token
+	return nil, ErrInvalidToken
+}
+
+func (c ChainAuthProvider) GenerateToken(ctx context.Context, userID string, permissions []string) (string, error) {
+	for _, provider := range c {
+		if token, err := provider.GenerateToken(ctx, userID, permissions); err == nil {
+			return token, nil
+		}
+	}
+	return "", fmt.Errorf("no configured provider can generate tokens")
+}
+
+func (c ChainAuthProvider) ValidatePermissions(ctx context.Context, auth *AuthContext, required []string) error {
+	return CheckPermissions(auth, required)
+}
+
+// BearerToken extracts the token from an Authorization header value; a value without the Bearer scheme is returned as is
+func BearerToken(value string) string {
+	value = strings.TrimSpace(value)
+	if scheme, token, ok := strings.Cut(value, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return value
+}
+
+// Expired reports whether the authentication has an expiry that has passed
+func (a *AuthContext) Expired(now time.Time) bool {
+	return !a.ExpiresAt.IsZero() && now.After(a.ExpiresAt)
+}
+
+// CheckPermissions verifies that auth holds every required permission, expanding role grants (see Roles)
+func CheckPermissions(auth *AuthContext, required []string) error {
+	if auth == nil {
+		return fmt.Errorf("authentication required")
+	}
+	granted := ExpandPermissions(auth.Permissions)
+	if slices.Contains(granted, PermissionAll) {
+		return nil
+	}
+	for _, req := range required {
+		if !slices.Contains(granted, req) {
+			return fmt.Errorf("permission '%s' not granted", req)
+		}
+	}
+	return nil
+}
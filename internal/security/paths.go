@@ -0,0 +1,67 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"mcp-bash-tools/internal/pathpolicy"
+)
+
+// ValidateWorkingDir 校验工作目录并返回其绝对路径
+// 目录必须存在，且满足路径约束：位于允许的根目录之下、不在禁止的路径之下（解析符号链接后比较）
+func ValidateWorkingDir(dir string, paths *pathpolicy.Policy) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("invalid working directory %s: %w", dir, err)
+	}
+
+	info, err := os.Stat(absDir)
+	if err != nil {
+		return "", fmt.Errorf("working directory not accessible: %s", absDir)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("working directory is not a directory: %s", absDir)
+	}
+
+	if err := paths.CheckDir(absDir); err != nil {
+		var violation *pathpolicy.Violation
+		if errors.As(err, &violation) {
+			return "", fmt.Errorf("working directory not allowed: %s (%s)", absDir, violation.Reason)
+		}
+		return "", fmt.Errorf("working directory not allowed: %s (%v)", absDir, err)
+	}
+	return absDir, nil
+}
+
+// restrictedEnv 允许列表模式下禁止设置的环境变量：让Shell在启动时执行代码、
+// 让动态链接器加载任意库，或改变命令名解析到的可执行文件，从而绕过按命令名放行的规则
+var restrictedEnv = []string{
+	"BASH_ENV", "ENV", "PROMPT_COMMAND", "PS4", "SHELLOPTS", "BASHOPTS", "ZDOTDIR",
+	"LD_PRELOAD", "LD_AUDIT", "LD_LIBRARY_PATH", "DYLD_INSERT_LIBRARIES", "DYLD_LIBRARY_PATH",
+	"PATH", "PATHEXT",
+}
+
+// ValidateEnv 校验环境变量名和值
+// restricted 为true（security.mode 为 allowlist）时还拒绝 restrictedEnv 中的变量和 bash 导出的函数 BASH_FUNC_*
+func ValidateEnv(env map[string]string, restricted bool) error {
+	for key, value := range env {
+		if key == "" {
+			return fmt.Errorf("environment variable name must not be empty")
+		}
+		if strings.ContainsAny(key, "=\x00") {
+			return fmt.Errorf("invalid environment variable name: %q", key)
+		}
+		if strings.ContainsRune(value, 0) {
+			return fmt.Errorf("environment variable %s contains a NUL character", key)
+		}
+		// Windows 的环境变量名不区分大小写
+		if name := strings.ToUpper(key); restricted && (strings.HasPrefix(name, "BASH_FUNC_") || slices.Contains(restrictedEnv, name)) {
+			return fmt.Errorf("environment variable %s is not allowed in allowlist mode", key)
+		}
+	}
+	return nil
+}
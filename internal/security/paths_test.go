@@ -0,0 +1,23 @@
+package security
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidateEnv 测试环境变量校验，允许列表模式下拒绝能执行额外代码的变量
+func TestValidateEnv(t *testing.T) {
+	assert.NoError(t, ValidateEnv(map[string]string{"FOO": "bar", "LANG": "C"}, false))
+	assert.Error(t, ValidateEnv(map[string]string{"": "x"}, false))
+	assert.Error(t, ValidateEnv(map[string]string{"A=B": "x"}, false))
+	assert.Error(t, ValidateEnv(map[string]string{"FOO": "a\x00b"}, false))
+
+	restricted := []string{"BASH_FUNC_echo%%", "BASH_ENV", "ENV", "LD_PRELOAD", "PROMPT_COMMAND", "PATH", "ld_preload"}
+	for _, name := range restricted {
+		env := map[string]string{name: "/tmp/x"}
+		assert.NoError(t, ValidateEnv(env, false), name)
+		assert.ErrorContains(t, ValidateEnv(env, true), "not allowed in allowlist mode", name)
+	}
+	assert.NoError(t, ValidateEnv(map[string]string{"FOO": "bar", "ENVIRONMENT": "ci"}, true))
+}
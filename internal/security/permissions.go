@@ -0,0 +1,122 @@
+package security
+
+import (
+	"slices"
+	"strings"
+
+	"mcp-bash-tools/internal/pathpolicy"
+	"mcp-bash-tools/internal/policy"
+	"mcp-bash-tools/internal/psparse"
+)
+
+// 工具权限
+const (
+	PermBashExecute    = "bash.execute"     // 执行命令（前台、会话，以及 session_open/session_close）
+	PermBashBackground = "bash.background"  // 以 run_in_background 启动后台任务
+	PermBashOutputRead = "bash_output.read" // 读取后台任务输出并列出任务
+	PermKillShellOwn   = "kill_shell.own"   // 终止本连接创建的后台任务
+	PermKillShellAny   = "kill_shell.any"   // 终止任意连接创建的后台任务
+)
+
+// 命令类别权限，命令属于某类别时执行它还需要对应权限
+const (
+	PermCommandNetwork         = "command.network"          // 网络访问（curl、wget、ssh、git push 等）
+	PermCommandFilesystemWrite = "command.filesystem-write" // 写文件系统（rm、mv、Set-Content、输出重定向等）
+	PermCommandProcessControl  = "command.process-control"  // 控制其他进程或服务（kill、Stop-Process、systemctl 等）
+)
+
+// RolePrefix 角色授权的前缀，例如 role:observer
+const RolePrefix = "role:"
+
+// Roles 预定义角色及其包含的权限，可在API密钥或JWT的权限中以 role:<name> 授予
+var Roles = map[string][]string{
+	// 只能查看后台任务和输出，不能执行或终止命令
+	"observer": {PermBashOutputRead},
+	// 可以执行任意类别的命令并管理自己的后台任务
+	"operator": {
+		PermBashExecute, PermBashBackground, PermBashOutputRead, PermKillShellOwn,
+		PermCommandNetwork, PermCommandFilesystemWrite, PermCommandProcessControl,
+	},
+	// 拥有全部权限
+	"admin": {PermissionAll},
+}
+
+// ExpandPermissions 将 role:<name> 展开为角色包含的权限，未知角色不授予任何权限
+func ExpandPermissions(permissions []string) []string {
+	expanded := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		if role, ok := strings.CutPrefix(permission, RolePrefix); ok {
+			expanded = append(expanded, Roles[role]...)
+			continue
+		}
+		expanded = append(expanded, permission)
+	}
+	return expanded
+}
+
+// commandClasses 按规范命令名（已解析别名，如 curl、wget 即 Invoke-WebRequest）识别的命令类别
+// 写文件系统的命令由路径约束的写入命令表识别（pathpolicy.Writes），与路径检查保持一致
+var commandClasses = []struct {
+	permission string
+	names      []string
+}{
+	{PermCommandNetwork, []string{
+		"invoke-webrequest", "invoke-restmethod", "start-bitstransfer", "test-netconnection",
+		"ssh", "scp", "sftp", "rsync", "nc", "ncat", "netcat", "telnet", "ftp",
+	}},
+	{PermCommandProcessControl, []string{
+		"stop-process", "start-process", "pkill", "killall", "taskkill", "renice", "systemctl", "service",
+		"sc.exe", "stop-service", "start-service", "restart-service", "suspend-service", "set-service",
+	}},
+}
+
+// networkGitCommands 访问远程仓库的 git 子命令
+var networkGitCommands = []string{"clone", "fetch", "pull", "push", "ls-remote"}
+
+// CommandPermissions 返回执行命令所需的命令类别权限
+// 命令按 PowerShell 语法解析为命令调用，sudo、cmd /c、bash -c 等执行的命令递归识别；
+// posix 为true时反引号和 $(...) 命令替换中的命令同样识别。类别用于区分角色，不替代命令策略
+func CommandPermissions(command string, posix bool) []string {
+	found := map[string]bool{}
+	classifyScript(command, posix, 0, found)
+	var permissions []string
+	for _, permission := range []string{PermCommandNetwork, PermCommandFilesystemWrite, PermCommandProcessControl} {
+		if found[permission] {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// classifyScript 记录脚本中各命令调用所属的类别
+func classifyScript(source string, posix bool, depth int, found map[string]bool) {
+	if depth > policy.MaxNestedScripts {
+		return
+	}
+	if posix {
+		for _, sub := range policy.CommandSubstitutions(source) {
+			classifyScript(sub, true, depth+1, found)
+		}
+	}
+	for _, cmd := range psparse.Parse(source).Commands() {
+		word := strings.ToLower(cmd.Word)
+		if i := strings.LastIndexAny(word, `\/`); i >= 0 {
+			word = word[i+1:]
+		}
+		for _, class := range commandClasses {
+			if slices.Contains(class.names, cmd.Name) || slices.Contains(class.names, word) {
+				found[class.permission] = true
+			}
+		}
+		if args := cmd.Arguments(); cmd.Name == "git" && len(args) > 0 && slices.Contains(networkGitCommands, args[0]) {
+			found[PermCommandNetwork] = true
+		}
+		if pathpolicy.Writes(cmd) {
+			found[PermCommandFilesystemWrite] = true
+		}
+		nestedPOSIX := posix || policy.IsPOSIXShell(cmd.Name)
+		for _, nested := range policy.NestedScripts(cmd) {
+			classifyScript(nested, nestedPOSIX, depth+1, found)
+		}
+	}
+}
@@ -3,15 +3,11 @@ package security
 /*
 	⚠️ 注意: 此文件包含企业级安全管理器的预留实现
 
-	当前状态: 未启用
-	- 本项目当前仅使用 validator.go 中的基础命令验证
-	- SecurityManager 提供了高级安全特性（JWT认证、RBAC、速率限制等）
-	- 这些功能已实现但未集成到主服务器中
-
-	如需启用:
-	1. 在 cmd/server/main.go 中初始化 SecurityManager
-	2. 在 BashHandler 中添加认证和授权检查
-	3. 配置相应的安全策略和速率限制
+	当前状态: 部分启用
+	- 命令验证使用 validator.go 中的基础检查
+	- 认证已集成: security.enable_auth 开启后，服务器通过 SecurityManager.Authenticate
+	  校验静态API密钥或HMAC签名的JWT（见 auth.go），并将 AuthContext 放入处理器的Context
+	- RBAC、速率限制等其余特性尚未集成到主服务器中
 
 	功能特性:
 	- JWT令牌认证
@@ -27,13 +23,18 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"math"
 	"regexp"
 	"strings"
 	"sync"
 	"time"
 
+	"mcp-bash-tools/internal/psparse"
 	"mcp-bash-tools/pkg/logger"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
 // contextKey 自定义 context key 类型，避免键冲突
@@ -59,7 +60,8 @@ type SecurityManager struct {
 // SecurityConfig holds security configuration
 type SecurityConfig struct {
 	EnableAuth         bool          `json:"enable_auth" default:"true"`
-	APIKeys            []string      `json:"api_keys"`
+	APIKeys            []string      `json:"api_keys"`   // "user:key" 或 "user:key:perm1+perm2"
+	JWTSecret          string        `json:"jwt_secret"` // HS256 签名密钥，为空且未配置API密钥时随机生成
 	TokenExpiry        time.Duration `json:"token_expiry" default:"24h"`
 	EnableRateLimit    bool          `json:"enable_rate_limit" default:"true"`
 	RateLimitRPS       int           `json:"rate_limit_rps" default:"10"`
@@ -81,19 +83,34 @@ type RateLimiter struct {
 }
 
 type RateLimiterConfig struct {
-	RPS      int           `json:"rps"`
+	Name     string        `json:"name"` // budget name reported in RateLimitError
+	RPS      float64       `json:"rps"`  // tokens added per second, may be fractional
 	Burst    int           `json:"burst"`
 	Interval time.Duration `json:"interval"`
 }
 
+// TokenBucket refills continuously, so rates below one token per second work
 type TokenBucket struct {
-	tokens     int
+	tokens     float64
 	lastRefill time.Time
-	capacity   int
-	refillRate int
+	capacity   float64
+	refillRate float64 // tokens per second
 	mutex      sync.Mutex
 }
 
+// RateLimitError is returned when a bucket is empty; RetryAfter is when the next token becomes available
+type RateLimitError struct {
+	Limit      string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	if e.Limit == "" {
+		return fmt.Sprintf("rate limit exceeded, retry after %s", e.RetryAfter)
+	}
+	return fmt.Sprintf("rate limit exceeded for %s, retry after %s", e.Limit, e.RetryAfter)
+}
+
 // CommandValidator validates and sanitizes commands
 type CommandValidator struct {
 	config            ValidationConfig
@@ -133,11 +150,12 @@ type AuthContext struct {
 	SessionID   string    `json:"session_id"`
 }
 
-// JWTAuthProvider implements JWT-based authentication
+// JWTAuthProvider implements JWT-based authentication (HS256)
 type JWTAuthProvider struct {
-	secretKey string
-	logger    *logger.Logger
-	mutex     sync.RWMutex
+	secretKey   string
+	tokenExpiry time.Duration
+	logger      *logger.Logger
+	mutex       sync.RWMutex
 }
 
 // SecurityEvent represents a security-related event
@@ -159,7 +177,7 @@ func NewSecurityManager(config SecurityConfig, logger *logger.Logger) *SecurityM
 		logger: logger,
 		config: config,
 		rateLimiter: NewRateLimiter(RateLimiterConfig{
-			RPS:      config.RateLimitRPS,
+			RPS:      float64(config.RateLimitRPS),
 			Burst:    config.RateLimitBurst,
 			Interval: time.Second,
 		}),
@@ -170,9 +188,14 @@ func NewSecurityManager(config SecurityConfig, logger *logger.Logger) *SecurityM
 		}),
 	}
 
-	// Initialize auth provider
+	// Initialize auth provider; an invalid configuration leaves it unset so every authentication fails
 	if config.EnableAuth {
-		sm.authProvider = NewJWTAuthProvider(generateSecretKey(), logger)
+		provider, err := NewAuthProvider(config, logger)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to configure authentication: %v", err))
+		} else {
+			sm.authProvider = provider
+		}
 	}
 
 	return sm
@@ -202,8 +225,9 @@ func NewCommandValidator(config ValidationConfig) *CommandValidator {
 
 func NewJWTAuthProvider(secretKey string, logger *logger.Logger) *JWTAuthProvider {
 	return &JWTAuthProvider{
-		secretKey: secretKey,
-		logger:    logger,
+		secretKey:   secretKey,
+		tokenExpiry: DefaultTokenExpiry,
+		logger:      logger,
 	}
 }
 
@@ -324,44 +348,53 @@ func (rl *RateLimiter) Allow(identifier string) error {
 		rl.buckets[identifier] = bucket
 	}
 
-	return bucket.Allow()
+	if err := bucket.Allow(); err != nil {
+		err.Limit = rl.config.Name
+		return err
+	}
+	return nil
 }
 
-func NewTokenBucket(capacity, refillRate int) *TokenBucket {
+func NewTokenBucket(capacity int, refillRate float64) *TokenBucket {
 	return &TokenBucket{
-		tokens:     capacity,
-		capacity:   capacity,
+		tokens:     float64(capacity),
+		capacity:   float64(capacity),
 		refillRate: refillRate,
 		lastRefill: time.Now(),
 	}
 }
 
-func (tb *TokenBucket) Allow() error {
+// Allow takes one token, or reports how long until one is available
+func (tb *TokenBucket) Allow() *RateLimitError {
 	tb.mutex.Lock()
 	defer tb.mutex.Unlock()
 
-	tb.refill()
+	tb.refill(time.Now())
 
-	if tb.tokens > 0 {
+	if tb.tokens >= 1 {
 		tb.tokens--
 		return nil
 	}
 
-	return fmt.Errorf("rate limit exceeded")
+	err := &RateLimitError{RetryAfter: time.Duration(math.MaxInt64)}
+	if tb.refillRate > 0 {
+		wait := time.Duration((1 - tb.tokens) / tb.refillRate * float64(time.Second))
+		err.RetryAfter = wait.Round(time.Millisecond)
+		if err.RetryAfter < wait {
+			err.RetryAfter += time.Millisecond
+		}
+	}
+	return err
 }
 
-func (tb *TokenBucket) refill() {
-	now := time.Now()
+// refill adds the tokens accrued since the last refill, including fractions of a token
+func (tb *TokenBucket) refill(now time.Time) {
 	elapsed := now.Sub(tb.lastRefill)
-
-	if elapsed >= time.Second {
-		tokensToAdd := int(elapsed.Seconds()) * tb.refillRate
-		tb.tokens += tokensToAdd
-		if tb.tokens > tb.capacity {
-			tb.tokens = tb.capacity
-		}
-		tb.lastRefill = now
+	if elapsed <= 0 {
+		return
 	}
+	tb.tokens = min(tb.capacity, tb.tokens+elapsed.Seconds()*tb.refillRate)
+	tb.lastRefill = now
 }
 
 // Command validation methods
@@ -442,27 +475,37 @@ func (cv *CommandValidator) isDangerousCommand(command string) bool {
 	return false
 }
 
+// isAllowedCommand requires every invocation in the command (pipelines, statement lists,
+// subexpressions) to resolve to an allowed command name; dynamic names never match
 func (cv *CommandValidator) isAllowedCommand(command string) bool {
-	baseCommand := cv.extractBaseCommand(command)
+	script := psparse.Parse(command)
+	commands := script.Commands()
+	if script.Err != nil || len(commands) == 0 {
+		return false
+	}
+	for _, cmd := range commands {
+		if cmd.Dynamic || cmd.Name == "" || !cv.allowedName(cmd) {
+			return false
+		}
+	}
+	return true
+}
 
+// allowedName matches the canonical name (aliases resolved) or the name as written
+func (cv *CommandValidator) allowedName(cmd *psparse.Command) bool {
+	word := strings.ToLower(cmd.Word)
+	if i := strings.LastIndexAny(word, `\/`); i >= 0 {
+		word = word[i+1:]
+	}
 	for _, allowed := range cv.config.AllowedCommands {
-		if strings.ToLower(baseCommand) == strings.ToLower(allowed) {
+		allowed = strings.ToLower(allowed)
+		if allowed == cmd.Name || allowed == word || psparse.CanonicalName(allowed) == cmd.Name {
 			return true
 		}
 	}
-
 	return false
 }
 
-func (cv *CommandValidator) extractBaseCommand(command string) string {
-	// Simple extraction - can be enhanced
-	parts := strings.Fields(command)
-	if len(parts) > 0 {
-		return parts[0]
-	}
-	return command
-}
-
 func (cv *CommandValidator) initializeDangerousCommands() {
 	// Windows dangerous commands only
 	dangerous := []string{
@@ -505,41 +548,52 @@ func (jp *JWTAuthProvider) Authenticate(ctx context.Context, token string) (*Aut
 		return nil, fmt.Errorf("token is required")
 	}
 
-	// Simple token validation for demo
-	// In production, use proper JWT validation
-	if token == "demo-token" {
-		return &AuthContext{
-			UserID:      "demo-user",
-			Username:    "demo",
-			Permissions: []string{"execute", "read"},
-			ExpiresAt:   time.Now().Add(24 * time.Hour),
-			SessionID:   "demo-session",
-		}, nil
+	claims := &jwtClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return []byte(jp.secretKey), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("invalid token: missing subject")
 	}
 
-	return nil, fmt.Errorf("invalid token")
+	username := claims.Name
+	if username == "" {
+		username = claims.Subject
+	}
+	return &AuthContext{
+		UserID:      claims.Subject,
+		Username:    username,
+		Permissions: claims.Permissions,
+		ExpiresAt:   claims.ExpiresAt.Time,
+		SessionID:   claims.ID,
+	}, nil
 }
 
 func (jp *JWTAuthProvider) GenerateToken(ctx context.Context, userID string, permissions []string) (string, error) {
-	// Simple token generation for demo
-	// In production, use proper JWT generation
-	return "demo-token-" + userID, nil
+	if userID == "" {
+		return "", fmt.Errorf("user ID is required")
+	}
+
+	now := time.Now()
+	id := make([]byte, 16)
+	rand.Read(id)
+	claims := jwtClaims{
+		Permissions: permissions,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			ID:        hex.EncodeToString(id),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(jp.tokenExpiry)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jp.secretKey))
 }
 
 func (jp *JWTAuthProvider) ValidatePermissions(ctx context.Context, auth *AuthContext, required []string) error {
-	for _, req := range required {
-		found := false
-		for _, perm := range auth.Permissions {
-			if perm == req {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return fmt.Errorf("permission '%s' not granted", req)
-		}
-	}
-	return nil
+	return CheckPermissions(auth, required)
 }
 
 // Utility methods
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package windows
+
+// setUTF8Encoding 设置控制台UTF-8编码（非 Windows 平台无需设置）
+func (oce *OptimizedCommandExecutor) setUTF8Encoding() {
+	oce.utf8Enabled = true
+}
+
+// enableVirtualTerminal 启用虚拟终端处理（非 Windows 平台终端默认支持ANSI）
+func (oce *OptimizedCommandExecutor) enableVirtualTerminal() {
+	oce.enableVTProcessing = true
+}
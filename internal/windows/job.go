@@ -0,0 +1,8 @@
+package windows
+
+// JobLimits Job Object 的资源限制，0表示不限制
+type JobLimits struct {
+	MemoryBytes uint64 // 作业中全部进程提交内存的总和
+	CPUPercent  int    // 占单个 CPU 核心的百分比，按硬上限执行
+	Processes   uint32 // 同时存在的进程数
+}
@@ -5,12 +5,11 @@ package windows
 import (
 	"fmt"
 	"os"
-	"syscall"
 )
 
 // JobObject 表示一个 Windows Job Object（非 Windows 平台的存根）
 type JobObject struct {
-	handle syscall.Handle
+	handle uintptr
 }
 
 // CreateJobObject 创建一个新的 Job Object（非 Windows 平台返回错误）
@@ -18,6 +17,11 @@ func CreateJobObject(name string) (*JobObject, error) {
 	return nil, fmt.Errorf("Job Objects are only supported on Windows")
 }
 
+// SetLimits 设置 Job Object 的资源限制（非 Windows 平台返回错误）
+func (j *JobObject) SetLimits(limits JobLimits) error {
+	return fmt.Errorf("Job Objects are only supported on Windows")
+}
+
 // AddProcess 将进程添加到 Job Object（非 Windows 平台返回错误）
 func (j *JobObject) AddProcess(process *os.Process) error {
 	return fmt.Errorf("Job Objects are only supported on Windows")
@@ -34,6 +38,6 @@ func (j *JobObject) Close() error {
 }
 
 // Handle 返回 Job Object 的句柄（非 Windows 平台返回 0）
-func (j *JobObject) Handle() syscall.Handle {
+func (j *JobObject) Handle() uintptr {
 	return 0
 }
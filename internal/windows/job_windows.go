@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"runtime"
 	"syscall"
 	"unsafe"
 
@@ -16,8 +17,19 @@ import (
 // 常量定义
 const (
 	sizeofJobobjectExtendedLimitInformation = 144 // binary.size cannot handle uintptr
+
+	// JOBOBJECT_CPU_RATE_CONTROL_INFORMATION 的标志
+	jobObjectCPURateControlEnable  = 0x1
+	jobObjectCPURateControlHardCap = 0x4
 )
 
+// jobObjectCPURateControlInformation 对应 JOBOBJECT_CPU_RATE_CONTROL_INFORMATION，
+// CPURate 为占全部处理器的万分比
+type jobObjectCPURateControlInformation struct {
+	ControlFlags uint32
+	CPURate      uint32
+}
+
 // JobObject 表示一个 Windows Job Object
 type JobObject struct {
 	handle windows.Handle
@@ -66,6 +78,53 @@ func CreateJobObject(name string) (*JobObject, error) {
 	}, nil
 }
 
+// SetLimits 设置 Job Object 的内存、进程数和 CPU 限制，保留 Job 关闭时终止所有进程的标志
+func (j *JobObject) SetLimits(limits JobLimits) error {
+	if j.handle == 0 {
+		return fmt.Errorf("job object handle is invalid")
+	}
+
+	extendedInfo := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{
+		BasicLimitInformation: windows.JOBOBJECT_BASIC_LIMIT_INFORMATION{
+			LimitFlags: windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE,
+		},
+	}
+	if limits.MemoryBytes > 0 {
+		extendedInfo.BasicLimitInformation.LimitFlags |= windows.JOB_OBJECT_LIMIT_JOB_MEMORY
+		extendedInfo.JobMemoryLimit = uintptr(limits.MemoryBytes)
+	}
+	if limits.Processes > 0 {
+		extendedInfo.BasicLimitInformation.LimitFlags |= windows.JOB_OBJECT_LIMIT_ACTIVE_PROCESS
+		extendedInfo.BasicLimitInformation.ActiveProcessLimit = limits.Processes
+	}
+	if _, err := windows.SetInformationJobObject(
+		j.handle,
+		windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&extendedInfo)),
+		uint32(unsafe.Sizeof(extendedInfo)),
+	); err != nil {
+		return fmt.Errorf("failed to set job object limits: %w", err)
+	}
+
+	if limits.CPUPercent > 0 {
+		// 单核百分比换算为占全部处理器的万分比
+		rate := min(max(limits.CPUPercent*100/runtime.NumCPU(), 1), 10000)
+		cpuInfo := jobObjectCPURateControlInformation{
+			ControlFlags: jobObjectCPURateControlEnable | jobObjectCPURateControlHardCap,
+			CPURate:      uint32(rate),
+		}
+		if _, err := windows.SetInformationJobObject(
+			j.handle,
+			windows.JobObjectCpuRateControlInformation,
+			uintptr(unsafe.Pointer(&cpuInfo)),
+			uint32(unsafe.Sizeof(cpuInfo)),
+		); err != nil {
+			return fmt.Errorf("failed to set job object CPU rate: %w", err)
+		}
+	}
+	return nil
+}
+
 // AddProcess 将进程添加到 Job Object
 // 添加后，该进程及其所有子进程都将被 Job Object 管理
 func (j *JobObject) AddProcess(process *os.Process) error {
@@ -5,28 +5,6 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"syscall"
-	"unsafe"
-)
-
-// Windows API 相关常量
-const (
-	STD_OUTPUT_HANDLE = ^uint32(0) - 11
-	STD_ERROR_HANDLE  = ^uint32(0) - 12
-
-	ENABLE_VIRTUAL_TERMINAL_PROCESSING = 0x0004
-
-	CP_UTF8 = 65001
-)
-
-var (
-	kernel32 = syscall.NewLazyDLL("kernel32.dll")
-
-	procGetConsoleMode      = kernel32.NewProc("GetConsoleMode")
-	procSetConsoleMode      = kernel32.NewProc("SetConsoleMode")
-	procGetStdHandle        = kernel32.NewProc("GetStdHandle")
-	procSetConsoleOutputCP  = kernel32.NewProc("SetConsoleOutputCP")
-	procGetConsoleOutputCP  = kernel32.NewProc("GetConsoleOutputCP")
 )
 
 // OptimizedCommandExecutor Windows优化命令执行器
@@ -50,30 +28,6 @@ func (oce *OptimizedCommandExecutor) initializeConsole() {
 	oce.enableVirtualTerminal()
 }
 
-// setUTF8Encoding 设置控制台UTF-8编码
-func (oce *OptimizedCommandExecutor) setUTF8Encoding() {
-	procSetConsoleOutputCP.Call(uintptr(CP_UTF8))
-	oce.utf8Enabled = true
-}
-
-// enableVirtualTerminal 启用虚拟终端处理（ANSI颜色支持）
-func (oce *OptimizedCommandExecutor) enableVirtualTerminal() {
-	stdOutHandle, _, _ := procGetStdHandle.Call(uintptr(STD_OUTPUT_HANDLE))
-	if stdOutHandle == 0 {
-		return
-	}
-
-	var mode uint32
-	ret, _, _ := procGetConsoleMode.Call(stdOutHandle, uintptr(unsafe.Pointer(&mode)))
-	if ret == 0 {
-		return
-	}
-
-	mode |= ENABLE_VIRTUAL_TERMINAL_PROCESSING
-	procSetConsoleMode.Call(stdOutHandle, uintptr(mode))
-	oce.enableVTProcessing = true
-}
-
 // ExecuteCommandWithOptimization 执行PowerShell优化命令
 func (oce *OptimizedCommandExecutor) ExecuteCommandWithOptimization(command string, workDir string) (*exec.Cmd, error) {
 	// 使用PowerShell执行命令